@@ -2,9 +2,9 @@ package main
 
 import (
 	"flag"
-	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/waggle-sensor/edge-scheduler/pkg/cloudscheduler"
 	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
@@ -23,6 +23,7 @@ func getenv(key string, def string) string {
 func main() {
 	var config cloudscheduler.CloudSchedulerConfig
 	var configPath string
+	var webhookAllowedHosts string
 	config.Version = Version
 	flag.BoolVar(&config.Debug, "debug", false, "flag to debug")
 	flag.StringVar(&configPath, "config", "", "path to config file")
@@ -41,9 +42,15 @@ func main() {
 	flag.BoolVar(&config.PushNotification, "push-notification", true, "Enable HTTP push notification for science goals")
 	flag.StringVar(&config.AuthServerURL, "auth-server-url", getenv("AUTH_URL", ""), "Authentication server URL")
 	flag.StringVar(&config.AuthToken, "auth-token", getenv("AUTH_TOKEN", ""), "TOKEN to query to authentication server")
+	flag.StringVar(&config.Logging.Format, "log-format", getenv("LOG_FORMAT", "text"), "Log format: text, logfmt, or json")
+	flag.StringVar(&config.Logging.Level, "log-level", getenv("LOG_LEVEL", "info"), "Log level: debug, info, warning, or error")
+	flag.StringVar(&config.OTLPEndpoint, "otlp-endpoint", getenv("OTEL_EXPORTER_OTLP_ENDPOINT", ""), "OpenTelemetry collector endpoint to export traces to, e.g. http://localhost:4318")
+	flag.StringVar(&webhookAllowedHosts, "webhook-allowed-hosts", getenv("WEBHOOK_ALLOWED_HOSTS", ""), "Comma-separated hosts that webhooks of reactions may call. Any host with a public address if not given")
 	flag.IntVar(&config.JobReevaluationIntervalSecond, "job-reevaluation-interval-second", 300, "Interval in seconds to re-evaluate jobs to reflect changes from outside the scheduler. Setting it below zero disables this feature.")
 	flag.Parse()
-	logger.Info.Printf("Cloud scheduler (%s) starts...", config.Name)
+	if webhookAllowedHosts != "" {
+		config.WebhookAllowedHosts = strings.Split(webhookAllowedHosts, ",")
+	}
 	if configPath != "" {
 		logger.Info.Printf("Config file (%s) provided. Loading configs...", configPath)
 		blob, err := ioutil.ReadFile(configPath)
@@ -55,12 +62,17 @@ func main() {
 			panic(err)
 		}
 	}
-	if !config.Debug {
-		logger.Debug.SetOutput(io.Discard)
+	if config.Debug {
+		config.Logging.Level = "debug"
 	}
+	if err := logger.Configure(config.Logging); err != nil {
+		panic(err)
+	}
+	logger.Info.Printf("Cloud scheduler (%s) starts...", config.Name)
 	cs := cloudscheduler.NewCloudSchedulerBuilder(&config).
 		AddGoalManager().
 		AddAPIServer().
+		AddTracer().
 		Build()
 
 	err := cs.Configure()
@@ -2,7 +2,6 @@ package main
 
 import (
 	"flag"
-	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -25,6 +24,7 @@ var Version = "0.0.0"
 func main() {
 	var config nodescheduler.NodeSchedulerConfig
 	var configPath string
+	var volumeHostPaths string
 	config.Version = Version
 	flag.BoolVar(&config.Debug, "debug", false, "flag to debug")
 	flag.StringVar(&configPath, "config", "", "Path to config file")
@@ -40,11 +40,20 @@ func main() {
 	flag.StringVar(&config.RabbitmqURI, "rabbitmq-uri", getenv("RABBITMQ_URI", "wes-rabbitmq:5672"), "RabbitMQ management uri")
 	flag.StringVar(&config.RabbitmqUsername, "rabbitmq-username", getenv("RABBITMQ_USERNAME", "service"), "RabbitMQ management username")
 	flag.StringVar(&config.RabbitmqPassword, "rabbitmq-password", getenv("RABBITMQ_PASSWORD", "service"), "RabbitMQ management password")
+	flag.StringVar(&config.RabbitmqManagementURI, "rabbitmq-management-uri", getenv("RABBITMQ_MANAGEMENT_URI", ""), "RabbitMQ management API to mint a credential per plugin run, e.g. http://wes-rabbitmq:15672")
 	flag.StringVar(&config.GoalStreamURL, "goalstream-url", "", "URL to receive goal stream")
 	flag.StringVar(&config.RuleCheckerURI, "rulechecker-uri", "http://wes-sciencerule-checker:5000", "rulechecker URI")
 	flag.StringVar(&config.ScoreboardURI, "scoreboard-uri", "wes-scoreboard:6379", "scoreboard URI")
+	flag.StringVar(&config.Logging.Format, "log-format", getenv("LOG_FORMAT", "text"), "Log format: text, logfmt, or json")
+	flag.StringVar(&config.Logging.Level, "log-level", getenv("LOG_LEVEL", "info"), "Log level: debug, info, warning, or error")
+	flag.StringVar(&config.OTLPEndpoint, "otlp-endpoint", getenv("OTEL_EXPORTER_OTLP_ENDPOINT", ""), "OpenTelemetry collector endpoint to export traces to, e.g. http://localhost:4318")
 	flag.StringVar(&config.SchedulingPolicy, "policy", "default", "Name of the scheduling policy")
+	flag.StringVar(&config.Location, "location", "", "Latitude and longitude of the node for solar functions in science rules, e.g. 41.7,-87.98")
+	flag.StringVar(&volumeHostPaths, "volume-host-paths", getenv("WAGGLE_VOLUME_HOST_PATHS", ""), "Comma-separated host paths that plugins may mount, e.g. /media/plugin-data/shared,/etc/waggle:ro")
+	flag.StringVar(&config.HostRoot, "host-root", getenv("WAGGLE_HOST_ROOT", ""), "Path where the host filesystem is mounted, e.g. /host, to resolve symbolic links in host paths of volumes. Without it, only the paths in -volume-host-paths can be mounted")
+	flag.StringVar(&config.GPSServerURI, "gps-server-uri", getenv("WAGGLE_GPS_SERVER", ""), "GPS server to read the location of the node from if --location is not given")
 	flag.Parse()
+	config.VolumeHostPaths = nodescheduler.ParseVolumeHostPaths(volumeHostPaths)
 	if configPath != "" {
 		logger.Info.Printf("Config file (%s) provided. Loading configs...", configPath)
 		blob, err := ioutil.ReadFile(configPath)
@@ -56,21 +65,28 @@ func main() {
 			panic(err)
 		}
 	}
-	if !config.Debug {
-		logger.Debug.SetOutput(io.Discard)
+	if config.Debug {
+		config.Logging.Level = "debug"
+	}
+	if err := logger.Configure(config.Logging); err != nil {
+		panic(err)
 	}
 	logger.Info.Printf("Node scheduler (%q) starts...", config.Name)
 	logger.Debug.Print("Creating node scheduler...")
 	appID := getenv("WAGGLE_APP_ID", "")
-	ns := nodescheduler.NewNodeSchedulerBuilder(&config).
+	ns, err := nodescheduler.NewNodeSchedulerBuilder(&config).
 		AddGoalManager(appID).
 		AddKnowledgebase().
 		AddResourceManager().
 		AddAPIServer().
 		AddLoggerToBeehive(appID).
 		AddConnToScoreboard().
+		AddTracer().
 		Build()
-	err := ns.Configure()
+	if err != nil {
+		panic(err)
+	}
+	err = ns.Configure()
 	if err != nil {
 		panic(err)
 	}
@@ -23,8 +23,7 @@ func init() {
 	flags.BoolVar(&deployment.DevelopMode, "develop", false, "Enable the following development time features: access to wan network")
 	flags.StringVar(&deployment.Type, "type", "pod", "Type of the plugin. It is one of ['pod', 'job', 'deployment', 'daemonset]. Default is 'pod'.")
 	flags.StringVar(&deployment.ResourceString, "resource", "", "Specify resource requirement for running the plugin as a comma-separated list without spaces. For example, resource.cpu=1,limit.cpu=2.")
-	// The volume feature is disabled as this holds a security problem
-	// flags.StringSliceVarP(&deployment.Volume, "volume", "v", []string{}, "Host path to mount the volume into the plugin")
+	flags.StringSliceVarP(&deployment.Volume, "volume", "v", []string{}, "Mount a volume into the plugin as SOURCE:PATH. SOURCE is a host path allowed by WAGGLE_VOLUME_HOST_PATHS, scratch, configmap=NAME, or emptydir=SIZE")
 	flags.BoolVar(&deployment.EnablePluginController, "enable-plugin-controller", false, "Enable plugin controller supporting the plugin")
 	flags.BoolVar(&deployment.ForceToUpdate, "force-to-update", false, "Force to create the plugin when failed to update it")
 	rootCmd.AddCommand(cmdDeploy)
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 
@@ -19,6 +18,7 @@ const (
 var (
 	Version    = "0.0.0"
 	debug      bool
+	logFormat  string
 	kubeconfig string
 	followLog  bool
 	stdin      bool
@@ -50,14 +50,13 @@ func init() {
 	rootCmd.SilenceUsage = true
 	rootCmd.PersistentFlags().StringVar(&kubeconfig, "kubeconfig", getenv("KUBECONFIG", detectDefaultKubeconfig()), "path to the kubeconfig file")
 	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "flag to debug")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", getenv("LOG_FORMAT", "text"), "log format: text, logfmt, or json")
 }
 
 var rootCmd = &cobra.Command{
 	Use: "pluginctl [FLAGS] [COMMANDS]",
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		if !debug {
-			logger.Debug.SetOutput(io.Discard)
-		}
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return configureLogger()
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Printf("SAGE plugin control for running plugins: %s\n", Version)
@@ -85,6 +84,14 @@ var completionCmd = &cobra.Command{
 	},
 }
 
+func configureLogger() error {
+	config := logger.Config{Format: logFormat, Level: "info"}
+	if debug {
+		config.Level = "debug"
+	}
+	return logger.Configure(config)
+}
+
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
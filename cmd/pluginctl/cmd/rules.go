@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/waggle-sensor/edge-scheduler/pkg/pluginctl"
+	"github.com/waggle-sensor/edge-scheduler/pkg/sciencerule"
+)
+
+var (
+	schedulerURL string
+	rulesOutput  string
+	rulesJobID   string
+)
+
+func init() {
+	flags := cmdRulesEvaluate.Flags()
+	flags.StringVar(&schedulerURL, "scheduler-url", getenv("NODE_SCHEDULER_URL", ""), "URL of the node scheduler. Found from the cluster if not given")
+	flags.StringVarP(&rulesOutput, "output", "o", "text", "Output format: text or json")
+	flags.StringVar(&rulesJobID, "job", "", "Read states of the job's scoreboard with scoreboard(). Global states are read if not given")
+	cmdRules.AddCommand(cmdRulesEvaluate)
+	rootCmd.AddCommand(cmdRules)
+}
+
+var cmdRules = &cobra.Command{
+	Use:   "rules [COMMANDS]",
+	Short: "Debug science rules on the node",
+}
+
+var cmdRulesEvaluate = &cobra.Command{
+	Use:     "evaluate [FLAGS] CONDITION",
+	Aliases: []string{"eval"},
+	Short:   "Evaluate a condition of science rules on the node scheduler immediately",
+	Long: `Evaluate a condition of science rules on the node scheduler immediately
+against its current knowledge, and show the result with the values the condition
+read, e.g.
+
+  pluginctl rules evaluate "avg(v('env.temperature', since='-5m')) > 30"`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		url := schedulerURL
+		if url == "" {
+			pluginCtl, err := pluginctl.NewPluginCtl(kubeconfig)
+			if err != nil {
+				return err
+			}
+			if url, err = pluginCtl.GetNodeSchedulerURL(); err != nil {
+				return fmt.Errorf("failed to find the node scheduler: %s", err.Error())
+			}
+		}
+		result, err := pluginctl.EvaluateCondition(url, args[0], rulesJobID)
+		var syntaxError *sciencerule.SyntaxError
+		if errors.As(err, &syntaxError) {
+			pluginctl.PrintSyntaxError(os.Stderr, args[0], syntaxError)
+			return fmt.Errorf("failed to parse the condition")
+		} else if err != nil {
+			return err
+		}
+		switch rulesOutput {
+		case "json":
+			blob, err := json.MarshalIndent(result, "", " ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(blob))
+		case "text":
+			pluginctl.PrintConditionEvaluation(os.Stdout, result)
+		default:
+			return fmt.Errorf("unknown output %q: must be text or json", rulesOutput)
+		}
+		return nil
+	},
+}
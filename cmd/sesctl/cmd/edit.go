@@ -1,42 +1,121 @@
 package cmd
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/url"
+	"os"
+	"os/exec"
 	"path"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/waggle-sensor/edge-scheduler/pkg/cloudscheduler"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"gopkg.in/yaml.v2"
 )
 
 func init() {
-	// TODO: edit does not yet support inline editing of jobs like "kubectl edit"
+	var (
+		revision int
+		submit   bool
+		yes      bool
+	)
 	cmdEdit := &cobra.Command{
-		Use:              "edit JOB_ID",
-		Short:            "Modify an existing job",
+		Use:   "edit JOB_ID",
+		Short: "Modify an existing job",
+		Long: `Modify an existing job. Without --file-path, the job description is opened
+in the editor given by $EDITOR, or vi if not set. The edit is validated
+and the difference from the current description is shown, and the job
+is updated once the difference is confirmed. The edit is rejected if
+the job has been edited by someone else in the meantime.`,
 		TraverseChildren: true,
 		Args:             cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			jobRequest.JobID = args[0]
 			editFunc := func(r *JobRequest) error {
-				subPathString := path.Join(cloudscheduler.API_V1_VERSION, cloudscheduler.API_PATH_JOB_EDIT)
-				if r.FilePath != "" {
-					q, err := url.ParseQuery("&id=" + fmt.Sprint(args[0]) + "&override=" + fmt.Sprint(r.Override))
+				filePath := r.FilePath
+				if filePath == "" {
+					job, err := getJob(r)
 					if err != nil {
 						return err
 					}
-					resp, err := r.handler.RequestPostFromFile(subPathString, r.FilePath, q, r.Headers)
+					revision = job.Revision
+					filePath, err = editJobInEditor(job)
 					if err != nil {
 						return err
 					}
-					decoder, err := r.handler.ParseJSONHTTPResponse(resp)
+					if filePath == "" {
+						fmt.Println("Edit cancelled, no changes made.")
+						return nil
+					}
+					defer func() {
+						if filePath != "" {
+							os.Remove(filePath)
+						}
+					}()
+				}
+				// the edit is checked first so that the difference is shown
+				// before the job changes
+				checked, err := postJobEdit(r, filePath, revision, true)
+				if err != nil {
+					return err
+				}
+				diff, _ := checked["diff"].(string)
+				if diff == "" {
+					fmt.Printf("No changes to job %s.\n", r.JobID)
+					return nil
+				}
+				fmt.Print(diff)
+				if r.DryRun {
+					return nil
+				}
+				if !yes {
+					ok, err := confirm(fmt.Sprintf("Apply the changes to job %s?", r.JobID))
 					if err != nil {
 						return err
 					}
-					fmt.Println(printSingleJsonFromDecoder(decoder))
-				} else {
-					return fmt.Errorf("Interactive job editing is not supported. Please use -f to change job.")
+					if !ok {
+						fmt.Println("Edit cancelled, no changes made.")
+						if r.FilePath == "" {
+							fmt.Fprintf(os.Stderr, "The edit is kept in %s\n", filePath)
+							filePath = ""
+						}
+						return nil
+					}
+				}
+				// the job is edited only if it is still at the revision the difference is from
+				if revision < 0 {
+					if latest, ok := checked["revision"].(float64); ok {
+						revision = int(latest)
+					}
+				}
+				edited, err := postJobEdit(r, filePath, revision, false)
+				if err != nil {
+					return err
+				}
+				delete(edited, "diff")
+				blob, _ := json.MarshalIndent(edited, "", " ")
+				fmt.Println(string(blob))
+				if !submit {
+					return nil
 				}
+				subPathString := path.Join(cloudscheduler.API_V1_VERSION, cloudscheduler.API_PATH_JOB_SUBMIT)
+				q := url.Values{}
+				q.Set("id", r.JobID)
+				q.Set("override", fmt.Sprint(r.Override))
+				resp, err := r.handler.RequestGet(subPathString, q, r.Headers)
+				if err != nil {
+					return err
+				}
+				decoder, err := r.handler.ParseJSONHTTPResponse(resp)
+				if err != nil {
+					return err
+				}
+				fmt.Println(printSingleJsonFromDecoder(decoder))
 				return nil
 			}
 			return jobRequest.Run(editFunc)
@@ -45,5 +124,160 @@ func init() {
 	flags := cmdEdit.Flags()
 	flags.StringVarP(&jobRequest.FilePath, "file-path", "f", "", "Path to the job file")
 	flags.BoolVar(&jobRequest.Override, "override", false, "Attempt to override the permission")
+	flags.BoolVarP(&jobRequest.DryRun, "dry-run", "", false, "Show the difference without changing the job")
+	flags.BoolVar(&submit, "submit", false, "Resubmit the job after editing it")
+	flags.BoolVarP(&yes, "yes", "y", false, "Apply the edit without asking for confirmation")
+	flags.IntVar(&revision, "revision", -1, "Revision of the job the file was edited from. Used with --file-path to reject the edit if the job has changed since")
 	rootCmd.AddCommand(cmdEdit)
 }
+
+// postJobEdit posts the edited job description in the file. With dryRun, the edit is
+// only checked. The response has the difference from the current description
+func postJobEdit(r *JobRequest, filePath string, revision int, dryRun bool) (map[string]interface{}, error) {
+	subPathString := path.Join(cloudscheduler.API_V1_VERSION, cloudscheduler.API_PATH_JOB_EDIT)
+	q := url.Values{}
+	q.Set("id", r.JobID)
+	q.Set("override", fmt.Sprint(r.Override))
+	q.Set("dryrun", fmt.Sprint(dryRun))
+	if revision >= 0 {
+		q.Set("revision", fmt.Sprint(revision))
+	}
+	resp, err := r.handler.RequestPostFromFile(subPathString, filePath, q, r.Headers)
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := r.handler.ParseJSONHTTPResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	var edited map[string]interface{}
+	if err := decoder.Decode(&edited); err != nil {
+		return nil, err
+	}
+	return edited, nil
+}
+
+// confirm asks the question and returns true if the user answers yes
+func confirm(question string) (bool, error) {
+	fmt.Printf("%s [y/N]: ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+func getJob(r *JobRequest) (*datatype.Job, error) {
+	subPathString := path.Join(cloudscheduler.API_V1_VERSION, cloudscheduler.API_PATH_JOB_STATUS_REGEX)
+	resp, err := r.handler.RequestGet(fmt.Sprintf(subPathString, r.JobID), nil, r.Headers)
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := r.handler.ParseJSONHTTPResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	var job datatype.Job
+	if err := decoder.Decode(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// editJobInEditor opens the description of the job in the user's editor until
+// the edit is valid. It returns the path to a temporary file holding the edit,
+// or an empty path if the user made no changes
+func editJobInEditor(job *datatype.Job) (string, error) {
+	blob, err := yaml.Marshal(job.EditableSpec())
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp("", fmt.Sprintf("sesctl-edit-%s-*.yaml", job.JobID))
+	if err != nil {
+		return "", err
+	}
+	filePath := f.Name()
+	f.Close()
+	instruction := fmt.Sprintf(`# Please edit the job description below. These lines beginning with '#' are
+# ignored, and an empty file cancels the edit.
+#
+# job %s (%s) at revision %d
+#
+`, job.JobID, job.Name, job.Revision)
+	header := instruction
+	original := blob
+	for {
+		if err := os.WriteFile(filePath, append([]byte(header), blob...), 0600); err != nil {
+			return "", err
+		}
+		if err := runEditor(filePath); err != nil {
+			os.Remove(filePath)
+			return "", err
+		}
+		edited, err := os.ReadFile(filePath)
+		if err != nil {
+			return "", err
+		}
+		edited = stripHeader(edited)
+		if len(bytes.TrimSpace(edited)) == 0 || bytes.Equal(edited, original) {
+			os.Remove(filePath)
+			return "", nil
+		}
+		// the edit is checked the same way as sesctl lint checks job files
+		var errorList []*datatype.ValidationError
+		var editedJob datatype.Job
+		if err := yaml.UnmarshalStrict(edited, &editedJob); err != nil {
+			errorList = datatype.ToValidationErrors([]error{err})
+		} else if errorList, err = lintJob(edited); err != nil {
+			errorList = datatype.ToValidationErrors([]error{err})
+		}
+		if len(errorList) == 0 {
+			return filePath, os.WriteFile(filePath, edited, 0600)
+		}
+		// the user fixes the errors in the editor, as kubectl edit does
+		if bytes.Equal(edited, blob) {
+			return "", fmt.Errorf("the edit is invalid and was not changed since. The edit is kept in %s", filePath)
+		}
+		var b strings.Builder
+		b.WriteString("# The edit has the following errors:\n")
+		for _, e := range errorList {
+			for _, line := range strings.Split(fmt.Sprintf("%s (%s)", e.Error(), e.Code), "\n") {
+				fmt.Fprintf(&b, "#   %s\n", line)
+			}
+		}
+		b.WriteString("#\n")
+		header = b.String() + instruction
+		blob = edited
+	}
+}
+
+func runEditor(filePath string) error {
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+	c := exec.Command(editor[0], append(editor[1:], filePath)...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("failed to run editor %q: %s", strings.Join(editor, " "), err.Error())
+	}
+	return nil
+}
+
+// stripHeader removes the comment lines that sesctl writes on top of the job description.
+// Lines in the description are kept as they are, including lines beginning with '#'
+// in block scalars, e.g. a script given to a plugin
+func stripHeader(blob []byte) []byte {
+	for bytes.HasPrefix(blob, []byte("#")) {
+		i := bytes.IndexByte(blob, '\n')
+		if i < 0 {
+			return nil
+		}
+		blob = blob[i+1:]
+	}
+	return blob
+}
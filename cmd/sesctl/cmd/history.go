@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/waggle-sensor/edge-scheduler/pkg/cloudscheduler"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"gopkg.in/yaml.v2"
+)
+
+func init() {
+	var showRevision int
+	cmdHistory := &cobra.Command{
+		Use:              "history [FLAGS] JOB_ID",
+		Short:            "Show revisions of a job",
+		TraverseChildren: true,
+		Args:             cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			jobRequest.JobID = args[0]
+			historyFunc := func(r *JobRequest) error {
+				subPathString := path.Join(cloudscheduler.API_V1_VERSION, cloudscheduler.API_PATH_JOB_REVISIONS_REGEX)
+				resp, err := r.handler.RequestGet(fmt.Sprintf(subPathString, r.JobID), nil, r.Headers)
+				if err != nil {
+					return err
+				}
+				decoder, err := r.handler.ParseJSONHTTPResponse(resp)
+				if err != nil {
+					return err
+				}
+				var history struct {
+					Revision  int                     `json:"revision"`
+					Revisions []*datatype.JobRevision `json:"revisions"`
+				}
+				if err := decoder.Decode(&history); err != nil {
+					return err
+				}
+				if showRevision >= 0 {
+					for _, revision := range history.Revisions {
+						if revision.Revision == showRevision {
+							blob, err := yaml.Marshal(revision.Spec.EditableSpec())
+							if err != nil {
+								return err
+							}
+							fmt.Print(string(blob))
+							return nil
+						}
+					}
+					return fmt.Errorf("revision %d of job %q does not exist", showRevision, r.JobID)
+				}
+				writer := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+				fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", "REVISION", "AUTHOR", "AGE", "REASON", "SCIENCE_GOALS")
+				for _, revision := range history.Revisions {
+					number := strconv.Itoa(revision.Revision)
+					if revision.Revision == history.Revision {
+						number += "*"
+					}
+					fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n",
+						number,
+						revision.Author,
+						time.Since(revision.CreatedAt.Time).Round(time.Second),
+						revision.Reason,
+						strings.Join(revision.ScienceGoals, ","))
+				}
+				writer.Flush()
+				return nil
+			}
+			return jobRequest.Run(historyFunc)
+		},
+	}
+	flags := cmdHistory.Flags()
+	flags.IntVarP(&showRevision, "revision", "r", -1, "Show the job description of the revision in YAML")
+	rootCmd.AddCommand(cmdHistory)
+
+	var to int
+	cmdRollback := &cobra.Command{
+		Use:              "rollback [FLAGS] JOB_ID",
+		Short:            "Roll a job back to an earlier revision and resubmit it",
+		TraverseChildren: true,
+		Args:             cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			jobRequest.JobID = args[0]
+			if to < 0 {
+				return fmt.Errorf("Please specify the revision to roll back to with --to")
+			}
+			rollbackFunc := func(r *JobRequest) error {
+				subPathString := path.Join(cloudscheduler.API_V1_VERSION, cloudscheduler.API_PATH_JOB_ROLLBACK_REGEX)
+				q := url.Values{}
+				q.Set("to", strconv.Itoa(to))
+				q.Set("override", fmt.Sprint(r.Override))
+				resp, err := r.handler.RequestGet(fmt.Sprintf(subPathString, r.JobID), q, r.Headers)
+				if err != nil {
+					return err
+				}
+				decoder, err := r.handler.ParseJSONHTTPResponse(resp)
+				if err != nil {
+					return err
+				}
+				var rolledBack map[string]interface{}
+				if err := decoder.Decode(&rolledBack); err != nil {
+					return err
+				}
+				if diff, _ := rolledBack["diff"].(string); diff != "" {
+					fmt.Print(diff)
+				}
+				delete(rolledBack, "diff")
+				blob, _ := json.MarshalIndent(rolledBack, "", " ")
+				fmt.Println(string(blob))
+				return nil
+			}
+			return jobRequest.Run(rollbackFunc)
+		},
+	}
+	flags = cmdRollback.Flags()
+	flags.IntVar(&to, "to", -1, "Revision to roll back to")
+	flags.BoolVar(&jobRequest.Override, "override", false, "Attempt to override the permission")
+	rootCmd.AddCommand(cmdRollback)
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"gopkg.in/yaml.v2"
+)
+
+func init() {
+	cmdLint := &cobra.Command{
+		Use:   "lint JOB_FILE",
+		Short: "Check a job file without sending it to the scheduler",
+		Long: `Check a job file without sending it to the scheduler. The linter checks
+plugin names, science rules and their targets, and notification settings.
+Nodes and plugin images are checked by the scheduler when the job is submitted.`,
+		Args: cobra.ExactArgs(1),
+		// linting is offline and does not need a token
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return configureLogger()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filePath := args[0]
+			blob, err := os.ReadFile(filePath)
+			if err != nil {
+				return err
+			}
+			errorList, err := lintJob(blob)
+			if err != nil {
+				return fmt.Errorf("failed to parse %s: %s", filePath, err.Error())
+			}
+			for _, e := range errorList {
+				if e.Line > 0 {
+					fmt.Printf("%s:%d: %s (%s)\n", filePath, e.Line, e.Error(), e.Code)
+				} else {
+					fmt.Printf("%s: %s (%s)\n", filePath, e.Error(), e.Code)
+				}
+			}
+			if len(errorList) > 0 {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("found %d problem(s) in %s", len(errorList), filePath)
+			}
+			return nil
+		},
+	}
+	rootCmd.AddCommand(cmdLint)
+}
+
+// lintJob parses the job in YAML or JSON the same way the scheduler does and
+// returns problems found in it with line numbers, ordered by line
+func lintJob(blob []byte) ([]*datatype.ValidationError, error) {
+	var job datatype.Job
+	if err := yaml.Unmarshal(blob, &job); err != nil {
+		return nil, err
+	}
+	errorList := job.Lint()
+	lines, err := datatype.FieldLines(blob)
+	if err != nil {
+		return nil, err
+	}
+	datatype.SetLines(errorList, lines)
+	sort.SliceStable(errorList, func(i, j int) bool {
+		return errorList[i].Line < errorList[j].Line
+	})
+	return errorList, nil
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/nodescheduler"
+	"github.com/waggle-sensor/edge-scheduler/pkg/sciencerule"
+	"gopkg.in/yaml.v2"
+)
+
+func init() {
+	cmdRules := &cobra.Command{
+		Use:   "rules [COMMANDS]",
+		Short: "Work with science rules of a job file",
+		// working with job files is offline and does not need a token
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return configureLogger()
+		},
+	}
+
+	var (
+		dataPath      string
+		start         string
+		end           string
+		interval      time.Duration
+		pluginRunTime time.Duration
+		summaryOnly   bool
+		output        string
+		location      string
+	)
+	cmdRulesBacktest := &cobra.Command{
+		Use:   "backtest [FLAGS] JOB_FILE",
+		Short: "Replay recorded measurements through science rules of a job",
+		Long: `Replay recorded measurements through science rules of a job as the node
+scheduler evaluates them, and show when each rule would fire and how many times
+plugins would run per day.
+
+The data file is a CSV file with the header time,name,value or a JSON lines
+file with the same keys. time is a timestamp in RFC3339, or an offset from
+--start, e.g. 10m.
+
+Rules with solar functions, e.g. daylight(), need the location of the node
+given with --location.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if dataPath == "" {
+				return fmt.Errorf("Please specify the measurement data with --data")
+			}
+			blob, err := os.ReadFile(args[0])
+			if err != nil {
+				return err
+			}
+			var job datatype.Job
+			if err := yaml.Unmarshal(blob, &job); err != nil {
+				return fmt.Errorf("failed to parse %s: %s", args[0], err.Error())
+			}
+			measurements, err := nodescheduler.LoadSimulatedMeasurements(dataPath)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %s", dataPath, err.Error())
+			}
+			config := nodescheduler.BacktestConfig{
+				Interval:      interval,
+				PluginRunTime: pluginRunTime,
+			}
+			if config.Start, err = parseBacktestTime(start); err != nil {
+				return fmt.Errorf("failed to parse --start: %s", err.Error())
+			}
+			if config.End, err = parseBacktestTime(end); err != nil {
+				return fmt.Errorf("failed to parse --end: %s", err.Error())
+			}
+			if location != "" {
+				loc, err := sciencerule.ParseLocation(location)
+				if err != nil {
+					return fmt.Errorf("failed to parse --location: %s", err.Error())
+				}
+				config.Location = &loc
+			}
+			cmd.SilenceUsage = true
+			report, err := nodescheduler.Backtest(&job, measurements, config)
+			if err != nil {
+				return err
+			}
+			switch output {
+			case "json":
+				blob, err := json.MarshalIndent(report, "", " ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(blob))
+			case "text":
+				printBacktestReport(report, summaryOnly)
+			default:
+				return fmt.Errorf("unknown output %q: must be text or json", output)
+			}
+			return nil
+		},
+	}
+	flags := cmdRulesBacktest.Flags()
+	flags.StringVar(&dataPath, "data", "", "Path to the measurement data in CSV or JSON lines")
+	flags.StringVar(&start, "start", "", "Start of the backtest in RFC3339. The earliest timestamp of the data if not given")
+	flags.StringVar(&end, "end", "", "End of the backtest in RFC3339. The time of the last measurement if not given")
+	flags.DurationVar(&interval, "interval", 10*time.Second, "How often time-based rules are evaluated")
+	flags.DurationVar(&pluginRunTime, "plugin-run-time", 65*time.Second, "How long a plugin runs once scheduled")
+	flags.BoolVar(&summaryOnly, "summary", false, "Show the daily summary only")
+	flags.StringVarP(&output, "output", "o", "text", "Output format: text or json")
+	flags.StringVar(&location, "location", "", "Latitude and longitude of the node for solar functions, e.g. 41.7,-87.98")
+	cmdRules.AddCommand(cmdRulesBacktest)
+	rootCmd.AddCommand(cmdRules)
+}
+
+func parseBacktestTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+func printBacktestReport(report *nodescheduler.BacktestReport, summaryOnly bool) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	if !summaryOnly {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", "TIME", "ACTION", "OBJECT", "OUTCOME")
+		for _, f := range report.Firings {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", f.Time.Format(time.RFC3339), f.Action, f.Object, f.Outcome)
+		}
+		fmt.Fprintln(writer)
+	}
+	fmt.Fprintf(writer, "%s\t%s\t%s\n", "DATE", "FIRINGS", "PLUGIN_RUNS")
+	totals := make(map[string]int)
+	for _, day := range report.Days {
+		firings := 0
+		for rule, n := range day.Firings {
+			firings += n
+			totals[rule] += n
+		}
+		fmt.Fprintf(writer, "%s\t%d\t%s\n", day.Date, firings, formatCounts(day.PluginRuns))
+	}
+	fmt.Fprintln(writer)
+	fmt.Fprintf(writer, "%s\t%s\n", "FIRINGS", "RULE")
+	for _, rule := range report.Rules {
+		fmt.Fprintf(writer, "%d\t%s\n", totals[rule], rule)
+	}
+	writer.Flush()
+	for rule, err := range report.Errors {
+		fmt.Printf("\nrule %q failed to evaluate: %s\n", rule, err)
+	}
+}
+
+// formatCounts prints counts in the order of the keys, e.g. a=1, b=2
+func formatCounts(counts map[string]int) string {
+	var keys []string
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	ret := ""
+	for i, k := range keys {
+		if i > 0 {
+			ret += ", "
+		}
+		ret += fmt.Sprintf("%s=%d", k, counts[k])
+	}
+	if ret == "" {
+		return "-"
+	}
+	return ret
+}
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"io"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -10,8 +9,9 @@ import (
 )
 
 var (
-	Version string
-	debug   bool
+	Version   string
+	debug     bool
+	logFormat string
 )
 
 var jobRequest = &JobRequest{}
@@ -30,16 +30,15 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&jobRequest.ServerHostString, "server", getenv("SES_HOST", "http://localhost:9770"), "Path to the kubeconfig file")
 	rootCmd.PersistentFlags().StringVar(&jobRequest.UserToken, "token", "", "User token")
 	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "flag to debug")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", getenv("LOG_FORMAT", "text"), "log format: text, logfmt, or json")
 }
 
 var rootCmd = &cobra.Command{
 	Use: "sesctl [FLAGS] [COMMANDS]",
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		if !debug {
-			logger.Debug.SetOutput(io.Discard)
-		}
-	},
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := configureLogger(); err != nil {
+			return err
+		}
 		if jobRequest.UserToken == "" {
 			tokenFromEnv := getenv("SES_USER_TOKEN", "")
 			if tokenFromEnv == "" {
@@ -57,6 +56,14 @@ var rootCmd = &cobra.Command{
 	// ValidArgs: []string{"deploy", "logs"},
 }
 
+func configureLogger() error {
+	config := logger.Config{Format: logFormat, Level: "info"}
+	if debug {
+		config.Level = "debug"
+	}
+	return logger.Configure(config)
+}
+
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/waggle-sensor/edge-scheduler/pkg/cloudscheduler"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"gopkg.in/yaml.v2"
+)
+
+func init() {
+	cmdTemplate := &cobra.Command{
+		Use:   "template [COMMANDS]",
+		Short: "Manage job templates with ${VAR} placeholders",
+	}
+
+	var (
+		fromJobID string
+		public    bool
+	)
+	cmdTemplateCreate := &cobra.Command{
+		Use:              "create [FLAGS] [TEMPLATE_NAME]",
+		Short:            "Create or update a job template from a file or an existing job",
+		TraverseChildren: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			createFunc := func(r *JobRequest) error {
+				subPathString := path.Join(cloudscheduler.API_V1_VERSION, cloudscheduler.API_PATH_TEMPLATE_CREATE)
+				if r.FilePath != "" {
+					resp, err := r.handler.RequestPostFromFile(subPathString, r.FilePath, nil, r.Headers)
+					if err != nil {
+						return err
+					}
+					decoder, err := r.handler.ParseJSONHTTPResponse(resp)
+					if err != nil {
+						return err
+					}
+					fmt.Println(printSingleJsonFromDecoder(decoder))
+				} else if fromJobID != "" {
+					if len(args) < 1 {
+						return fmt.Errorf("Please specify template name")
+					}
+					q := url.Values{}
+					q.Set("name", args[0])
+					q.Set("from_job", fromJobID)
+					q.Set("public", fmt.Sprint(public))
+					resp, err := r.handler.RequestGet(subPathString, q, r.Headers)
+					if err != nil {
+						return err
+					}
+					decoder, err := r.handler.ParseJSONHTTPResponse(resp)
+					if err != nil {
+						return err
+					}
+					fmt.Println(printSingleJsonFromDecoder(decoder))
+				} else {
+					return fmt.Errorf("Either --file-path or --from-job should be provided.")
+				}
+				return nil
+			}
+			return jobRequest.Run(createFunc)
+		},
+	}
+	flags := cmdTemplateCreate.Flags()
+	flags.StringVarP(&jobRequest.FilePath, "file-path", "f", "", "Path to the template file")
+	flags.StringVar(&fromJobID, "from-job", "", "Job ID to make the template from")
+	flags.BoolVar(&public, "public", false, "Make the template from the job visible to all users")
+	cmdTemplate.AddCommand(cmdTemplateCreate)
+
+	cmdTemplateList := &cobra.Command{
+		Use:              "list",
+		Short:            "List job templates",
+		TraverseChildren: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			listFunc := func(r *JobRequest) error {
+				subPathString := path.Join(cloudscheduler.API_V1_VERSION, cloudscheduler.API_PATH_TEMPLATE_LIST)
+				resp, err := r.handler.RequestGet(subPathString, nil, r.Headers)
+				if err != nil {
+					return err
+				}
+				decoder, err := r.handler.ParseJSONHTTPResponse(resp)
+				if err != nil {
+					return err
+				}
+				var templates map[string]*datatype.JobTemplate
+				if err := decoder.Decode(&templates); err != nil {
+					return err
+				}
+				names := make([]string, 0, len(templates))
+				for name := range templates {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				writer := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+				fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", "NAME", "USER", "PUBLIC", "VARIABLES", "DESCRIPTION")
+				for _, name := range names {
+					t := templates[name]
+					fmt.Fprintf(writer, "%s\t%s\t%t\t%s\t%s\n", t.Name, t.User, t.Public, strings.Join(t.GetVariables(), ","), t.Description)
+				}
+				writer.Flush()
+				return nil
+			}
+			return jobRequest.Run(listFunc)
+		},
+	}
+	cmdTemplate.AddCommand(cmdTemplateList)
+
+	cmdTemplateShow := &cobra.Command{
+		Use:              "show TEMPLATE_NAME",
+		Short:            "Show a job template in YAML",
+		TraverseChildren: true,
+		Args:             cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			showFunc := func(r *JobRequest) error {
+				subPathString := path.Join(cloudscheduler.API_V1_VERSION, cloudscheduler.API_PATH_TEMPLATE_REGEX)
+				resp, err := r.handler.RequestGet(fmt.Sprintf(subPathString, url.PathEscape(args[0])), nil, r.Headers)
+				if err != nil {
+					return err
+				}
+				decoder, err := r.handler.ParseJSONHTTPResponse(resp)
+				if err != nil {
+					return err
+				}
+				var template datatype.JobTemplate
+				if err := decoder.Decode(&template); err != nil {
+					return err
+				}
+				blob, err := yaml.Marshal(template)
+				if err != nil {
+					return err
+				}
+				fmt.Print(string(blob))
+				return nil
+			}
+			return jobRequest.Run(showFunc)
+		},
+	}
+	cmdTemplate.AddCommand(cmdTemplateShow)
+
+	var (
+		values []string
+		submit bool
+	)
+	cmdTemplateInstantiate := &cobra.Command{
+		Use:              "instantiate [FLAGS] TEMPLATE_NAME",
+		Short:            "Create a job from a job template",
+		TraverseChildren: true,
+		Args:             cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			variables, err := datatype.ParseTemplateValues(values)
+			if err != nil {
+				return err
+			}
+			instantiateFunc := func(r *JobRequest) error {
+				subPathString := path.Join(cloudscheduler.API_V1_VERSION, cloudscheduler.API_PATH_TEMPLATE_INSTANTIATE_REGEX)
+				body, err := json.Marshal(map[string]interface{}{"variables": variables})
+				if err != nil {
+					return err
+				}
+				resp, err := r.handler.RequestPost(fmt.Sprintf(subPathString, url.PathEscape(args[0])), body, r.Headers)
+				if err != nil {
+					return err
+				}
+				decoder, err := r.handler.ParseJSONHTTPResponse(resp)
+				if err != nil {
+					return err
+				}
+				var created map[string]interface{}
+				if err := decoder.Decode(&created); err != nil {
+					return err
+				}
+				blob, _ := json.MarshalIndent(created, "", " ")
+				fmt.Println(string(blob))
+				if !submit {
+					return nil
+				}
+				jobID, _ := created["job_id"].(string)
+				q := url.Values{}
+				q.Set("id", jobID)
+				q.Set("dryrun", fmt.Sprint(r.DryRun))
+				resp, err = r.handler.RequestGet(path.Join(cloudscheduler.API_V1_VERSION, cloudscheduler.API_PATH_JOB_SUBMIT), q, r.Headers)
+				if err != nil {
+					return err
+				}
+				decoder, err = r.handler.ParseJSONHTTPResponse(resp)
+				if err != nil {
+					return err
+				}
+				fmt.Println(printSingleJsonFromDecoder(decoder))
+				return nil
+			}
+			return jobRequest.Run(instantiateFunc)
+		},
+	}
+	flags = cmdTemplateInstantiate.Flags()
+	flags.StringArrayVar(&values, "set", nil, "Value of a template variable in VAR=VALUE. Can be given multiple times")
+	flags.BoolVar(&submit, "submit", false, "Submit the job after creating it")
+	flags.BoolVarP(&jobRequest.DryRun, "dry-run", "", false, "Dry run the submission of the job")
+	cmdTemplate.AddCommand(cmdTemplateInstantiate)
+
+	rootCmd.AddCommand(cmdTemplate)
+}
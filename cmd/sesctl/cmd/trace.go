@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/waggle-sensor/edge-scheduler/pkg/cloudscheduler"
+	"github.com/waggle-sensor/edge-scheduler/pkg/tracing"
+)
+
+func init() {
+	var otlpFilePath string
+	cmdTrace := &cobra.Command{
+		Use:              "trace [FLAGS] JOB_ID",
+		Short:            "Show the trace of a job from submission to runs of its plugins",
+		TraverseChildren: true,
+		Args:             cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			jobRequest.JobID = args[0]
+			if otlpFilePath != "" {
+				spans, err := readJobTraceFromOTLPFile(otlpFilePath, jobRequest.JobID)
+				if err != nil {
+					return err
+				}
+				tracing.WriteTraceView(os.Stdout, spans)
+				return nil
+			}
+			traceFunc := func(r *JobRequest) error {
+				subPathString := path.Join(cloudscheduler.API_V1_VERSION, cloudscheduler.API_PATH_JOB_TRACE_REGEX)
+				resp, err := r.handler.RequestGet(fmt.Sprintf(subPathString, r.JobID), nil, r.Headers)
+				if err != nil {
+					return err
+				}
+				decoder, err := r.handler.ParseJSONHTTPResponse(resp)
+				if err != nil {
+					return err
+				}
+				var trace struct {
+					Spans []*tracing.Span `json:"spans"`
+				}
+				if err := decoder.Decode(&trace); err != nil {
+					return err
+				}
+				tracing.WriteTraceView(os.Stdout, trace.Spans)
+				return nil
+			}
+			return jobRequest.Run(traceFunc)
+		},
+	}
+	flags := cmdTrace.Flags()
+	flags.StringVar(&otlpFilePath, "otlp-file", "", "Read spans from a file written by the file exporter of an OpenTelemetry collector instead of the cloud scheduler")
+	rootCmd.AddCommand(cmdTrace)
+}
+
+// readJobTraceFromOTLPFile returns spans of the latest trace of the job in the file.
+// The file has one OTLP/JSON object per line
+func readJobTraceFromOTLPFile(filePath string, jobID string) ([]*tracing.Span, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var spans []*tracing.Span
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		s, err := tracing.ParseOTLP([]byte(line))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read line %d of %s: %s", n, filePath, err.Error())
+		}
+		spans = append(spans, s...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	// the job is resubmitted with a new trace
+	var latest *tracing.Span
+	for _, s := range spans {
+		if s.Attributes["job_id"] == jobID && (latest == nil || s.Start.After(latest.Start)) {
+			latest = s
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("no trace found for job %q in %s", jobID, filePath)
+	}
+	var trace []*tracing.Span
+	for _, s := range spans {
+		if s.TraceID == latest.TraceID {
+			trace = append(trace, s)
+		}
+	}
+	return trace, nil
+}
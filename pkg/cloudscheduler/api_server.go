@@ -18,10 +18,13 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+	"github.com/waggle-sensor/edge-scheduler/pkg/tracing"
 	yaml "gopkg.in/yaml.v2"
 	// "github.com/urfave/negroni"
 )
 
+var apiLog = logger.New("apiserver")
+
 const (
 	API_V1_VERSION                             = "/api/v1"
 	API_PATH_JOB_CREATE                        = "/create"
@@ -31,6 +34,13 @@ const (
 	API_PATH_JOB_STATUS_REGEX                  = "/jobs/%s/status"
 	API_PATH_JOB_REMOVE_REGEX                  = "/jobs/%s/rm"
 	API_PATH_JOB_TEMPLATE_REGEX                = "/jobs/%s/template"
+	API_PATH_JOB_TRACE_REGEX                   = "/jobs/%s/trace"
+	API_PATH_JOB_REVISIONS_REGEX               = "/jobs/%s/revisions"
+	API_PATH_JOB_ROLLBACK_REGEX                = "/jobs/%s/rollback"
+	API_PATH_TEMPLATE_CREATE                   = "/templates/create"
+	API_PATH_TEMPLATE_LIST                     = "/templates/list"
+	API_PATH_TEMPLATE_REGEX                    = "/templates/%s"
+	API_PATH_TEMPLATE_INSTANTIATE_REGEX        = "/templates/%s/instantiate"
 	API_PATH_GOALS_NODE_REGEX                  = "/goals/%s"
 	API_PATH_GOALS_NODE_STREAM_REGEX           = "/goals/%s/stream"
 	MANAGEMENT_API_PATH_SYSTEM_METRICS         = "/system/metrics"
@@ -106,10 +116,17 @@ func (api *APIServer) ConfigureAPIs(prometheusGatherer *prometheus.Registry) {
 	api_route.Handle(fmt.Sprintf(API_PATH_JOB_STATUS_REGEX, "{id}"), http.HandlerFunc(api.handlerJobStatus)).Methods(http.MethodGet)
 	api_route.Handle(fmt.Sprintf(API_PATH_JOB_REMOVE_REGEX, "{id}"), http.HandlerFunc(api.handlerJobRemove)).Methods(http.MethodGet)
 	api_route.Handle(fmt.Sprintf(API_PATH_JOB_TEMPLATE_REGEX, "{id}"), http.HandlerFunc(api.handlerJobTemplate)).Methods(http.MethodGet)
+	api_route.Handle(fmt.Sprintf(API_PATH_JOB_TRACE_REGEX, "{id}"), http.HandlerFunc(api.handlerJobTrace)).Methods(http.MethodGet)
+	api_route.Handle(fmt.Sprintf(API_PATH_JOB_REVISIONS_REGEX, "{id}"), http.HandlerFunc(api.handlerJobRevisions)).Methods(http.MethodGet)
+	api_route.Handle(fmt.Sprintf(API_PATH_JOB_ROLLBACK_REGEX, "{id}"), http.HandlerFunc(api.handlerJobRollback)).Methods(http.MethodGet)
+	api_route.Handle(API_PATH_TEMPLATE_CREATE, http.HandlerFunc(api.handlerTemplateCreate)).Methods(http.MethodGet, http.MethodPost)
+	api_route.Handle(API_PATH_TEMPLATE_LIST, http.HandlerFunc(api.handlerTemplates)).Methods(http.MethodGet)
+	api_route.Handle(fmt.Sprintf(API_PATH_TEMPLATE_REGEX, "{name}"), http.HandlerFunc(api.handlerTemplate)).Methods(http.MethodGet)
+	api_route.Handle(fmt.Sprintf(API_PATH_TEMPLATE_INSTANTIATE_REGEX, "{name}"), http.HandlerFunc(api.handlerTemplateInstantiate)).Methods(http.MethodPost)
 	// api_route.Handle("/goals", http.HandlerFunc(api.handlerGoals)).Methods(http.MethodGet, http.MethodPost, http.MethodPut)
 	api_route.Handle(fmt.Sprintf(API_PATH_GOALS_NODE_REGEX, "{nodeName}"), http.HandlerFunc(api.handlerGoalForNode)).Methods(http.MethodGet)
 	if api.enablePushNotification {
-		logger.Info.Printf("Enabling push notification. Nodes can connect to /goals/{nodeName}/stream to get notification from the cloud scheduler.")
+		apiLog.Infof("Enabling push notification. Nodes can connect to /goals/{nodeName}/stream to get notification from the cloud scheduler.")
 		api_route.Handle(fmt.Sprintf(API_PATH_GOALS_NODE_STREAM_REGEX, "{nodeName}"), http.HandlerFunc(api.handlerGoalStreamForNode)).Methods(http.MethodGet)
 	}
 	api.managementRouter = mux.NewRouter()
@@ -135,9 +152,9 @@ func (api *APIServer) ConfigureAPIs(prometheusGatherer *prometheus.Registry) {
 
 func (api *APIServer) Run() {
 	APIAddressPort := fmt.Sprintf("0.0.0.0:%d", api.port)
-	logger.Info.Printf("API server starts at %q...", APIAddressPort)
+	apiLog.Infof("API server starts at %q...", APIAddressPort)
 	managementAddressPort := fmt.Sprintf("0.0.0.0:%d", api.managementPort)
-	logger.Info.Printf("Management server starts at %q...", managementAddressPort)
+	apiLog.Infof("Management server starts at %q...", managementAddressPort)
 
 	// Added as requested for browser support
 	headersOk := handlers.AllowedHeaders([]string{"X-Requested-With", "Authorization"})
@@ -146,7 +163,7 @@ func (api *APIServer) Run() {
 	credentialOK := handlers.AllowCredentials()
 	cors := handlers.CORS(headersOk, originsOk, methodsOk, credentialOK)(api.apiRouter)
 	go http.ListenAndServe(managementAddressPort, handlers.LoggingHandler(os.Stdout, api.managementRouter))
-	logger.Info.Fatalln(http.ListenAndServe(APIAddressPort, handlers.LoggingHandler(os.Stdout, cors)))
+	apiLog.Fatal(http.ListenAndServe(APIAddressPort, handlers.LoggingHandler(os.Stdout, cors)))
 }
 
 func (api *APIServer) handlerCreateJob(w http.ResponseWriter, r *http.Request) {
@@ -234,11 +251,11 @@ func (api *APIServer) handlerEditJob(w http.ResponseWriter, r *http.Request) {
 		}
 		updatedJob.JobID = jobID
 		if oldJob.User != user.GetUserName() {
-			logger.Info.Printf("user %q does not own the job %s", user.GetUserName(), jobID)
+			apiLog.With(logger.Fields{"job_id": jobID, "user": user.GetUserName()}).Infof("user %q does not own the job %s", user.GetUserName(), jobID)
 			if queries.Get("override") == "true" {
-				logger.Info.Printf("user %q is attempting to override job %q owned by %s", user.GetUserName(), jobID, oldJob.User)
+				apiLog.With(logger.Fields{"job_id": jobID, "user": user.GetUserName()}).Infof("user %q is attempting to override job %q owned by %s", user.GetUserName(), jobID, oldJob.User)
 				if user.Auth.IsSuperUser {
-					logger.Info.Printf("user %q is a super user. overriding permitted", user.GetUserName())
+					apiLog.With(logger.Fields{"job_id": jobID, "user": user.GetUserName()}).Infof("user %q is a super user. overriding permitted", user.GetUserName())
 					// keep the original user name
 					updatedJob.User = oldJob.User
 				} else {
@@ -254,13 +271,67 @@ func (api *APIServer) handlerEditJob(w http.ResponseWriter, r *http.Request) {
 		} else {
 			updatedJob.User = user.GetUserName()
 		}
+		// revision is optional; editors that send the revision they edited
+		// from are rejected if someone else has edited the job since
+		revision := -1
+		if _, exist := queries["revision"]; exist {
+			revision, err = strconv.Atoi(queries.Get("revision"))
+			if err != nil {
+				response := datatype.NewAPIMessageBuilder().AddError(fmt.Sprintf("failed to parse revision %q: %s", queries.Get("revision"), err.Error())).Build()
+				respondJSON(w, http.StatusBadRequest, response.ToJson())
+				return
+			}
+		}
+		if lintErrors := updatedJob.Lint(); len(lintErrors) > 0 {
+			var errorList []error
+			for _, err := range lintErrors {
+				errorList = append(errorList, err)
+			}
+			response := datatype.NewAPIMessageBuilder().AddErrorList(errorList)
+			respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+			return
+		}
+		diff, err := datatype.DiffJobDescription(oldJob, updatedJob)
+		if err != nil {
+			response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+			respondJSON(w, http.StatusInternalServerError, response.ToJson())
+			return
+		}
+		if queries.Get("dryrun") == "true" {
+			if revision >= 0 && revision != oldJob.Revision {
+				err := &RevisionConflictError{JobID: jobID, Revision: revision, Latest: oldJob.Revision}
+				response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+				respondJSON(w, http.StatusConflict, response.ToJson())
+				return
+			}
+			response := datatype.NewAPIMessageBuilder().
+				AddEntity("job_id", jobID).
+				AddEntity("revision", oldJob.Revision).
+				AddEntity("diff", diff).
+				AddEntity("dryrun", true)
+			respondJSON(w, http.StatusOK, response.Build().ToJson())
+			return
+		}
+		updatedJob.Drafted()
+		if err := api.cloudScheduler.GoalManager.EditJob(updatedJob, revision, user.GetUserName()); err != nil {
+			code := http.StatusBadRequest
+			if _, conflict := err.(*RevisionConflictError); conflict {
+				code = http.StatusConflict
+			}
+			response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+			respondJSON(w, code, response.ToJson())
+			return
+		}
 		// Remove science goal of old Job if exists
 		if oldJob.ScienceGoal != nil {
 			api.cloudScheduler.GoalManager.RemoveScienceGoal(oldJob.ScienceGoal.ID)
 		}
-		updatedJob.Drafted()
-		api.cloudScheduler.GoalManager.UpdateJob(updatedJob, false)
-		response := datatype.NewAPIMessageBuilder().AddEntity("job_id", jobID).AddEntity("state", datatype.JobDrafted)
+		apiLog.With(updatedJob.LogFields()).Infof("job %s is edited to revision %d", jobID, updatedJob.Revision)
+		response := datatype.NewAPIMessageBuilder().
+			AddEntity("job_id", jobID).
+			AddEntity("state", datatype.JobDrafted).
+			AddEntity("revision", updatedJob.Revision).
+			AddEntity("diff", diff)
 		respondJSON(w, http.StatusOK, response.Build().ToJson())
 		return
 	} else {
@@ -297,10 +368,16 @@ func (api *APIServer) handlerSubmitJobs(w http.ResponseWriter, r *http.Request)
 		}
 		flagDryRun = f
 	}
+	// the trace of the job starts at submission
+	span := api.cloudScheduler.Tracer.StartSpan("job.submit", tracing.SpanContext{})
+	span.SetAttribute("user", user.GetUserName()).
+		SetAttribute("dryrun", strconv.FormatBool(flagDryRun))
+	defer span.Finish()
 	switch r.Method {
 	case http.MethodGet:
 		queries := r.URL.Query()
 		if jobID := queries.Get("id"); jobID != "" {
+			span.SetAttribute("job_id", jobID)
 			existingJob, err := api.cloudScheduler.GoalManager.GetJob(jobID)
 			if err != nil {
 				response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
@@ -308,11 +385,11 @@ func (api *APIServer) handlerSubmitJobs(w http.ResponseWriter, r *http.Request)
 				return
 			}
 			if existingJob.User != user.GetUserName() {
-				logger.Info.Printf("user %q does not own the job %s", user.GetUserName(), jobID)
+				apiLog.With(logger.Fields{"job_id": jobID, "user": user.GetUserName()}).Infof("user %q does not own the job %s", user.GetUserName(), jobID)
 				if queries.Get("override") == "true" {
-					logger.Info.Printf("user %q is attempting to override job %q owned by %s", user.GetUserName(), jobID, existingJob.User)
+					apiLog.With(logger.Fields{"job_id": jobID, "user": user.GetUserName()}).Infof("user %q is attempting to override job %q owned by %s", user.GetUserName(), jobID, existingJob.User)
 					if user.Auth.IsSuperUser {
-						logger.Info.Printf("user %q is a super user. overriding permitted", user.GetUserName())
+						apiLog.With(logger.Fields{"job_id": jobID, "user": user.GetUserName()}).Infof("user %q is a super user. overriding permitted", user.GetUserName())
 					} else {
 						response := datatype.NewAPIMessageBuilder().AddError(fmt.Sprintf("User %s does not have permission to override to the job", user.GetUserName())).Build()
 						respondJSON(w, http.StatusBadRequest, response.ToJson())
@@ -325,9 +402,10 @@ func (api *APIServer) handlerSubmitJobs(w http.ResponseWriter, r *http.Request)
 				}
 			}
 			// TODO: we should not commit to change on the existing goal of job when --dry-run is given
-			errorList := api.cloudScheduler.ValidateJobAndCreateScienceGoalForExistingJob(queries.Get("id"), user, flagDryRun)
+			errorList := api.cloudScheduler.ValidateJobAndCreateScienceGoalForExistingJob(queries.Get("id"), user, flagDryRun, span.Context())
 			if len(errorList) > 0 {
-				response := datatype.NewAPIMessageBuilder().AddError(fmt.Sprintf("%v", errorList)).Build()
+				span.SetError(fmt.Sprintf("%v", errorList))
+				response := datatype.NewAPIMessageBuilder().AddErrorList(errorList).Build()
 				respondJSON(w, http.StatusBadRequest, response.ToJson())
 				return
 			} else {
@@ -365,13 +443,15 @@ func (api *APIServer) handlerSubmitJobs(w http.ResponseWriter, r *http.Request)
 			newJob.User = user.GetUserName()
 			sg, errorList := api.cloudScheduler.ValidateJobAndCreateScienceGoal(newJob, user)
 			if len(errorList) > 0 {
+				span.SetError(fmt.Sprintf("%v", errorList))
 				response := datatype.NewAPIMessageBuilder().
 					AddEntity("job_name", newJob.Name).
 					AddEntity("message", "validation failed. Please revise the job and try again.").
-					AddError(fmt.Sprintf("%v", errorList)).Build()
+					AddErrorList(errorList).Build()
 				respondJSON(w, http.StatusBadRequest, response.ToJson())
 				return
 			} else {
+				sg.TraceID, sg.SpanID = span.TraceID, span.SpanID
 				newJob.ScienceGoal = sg
 				response := datatype.NewAPIMessageBuilder().AddEntity("job_name", newJob.Name)
 				if flagDryRun {
@@ -379,6 +459,7 @@ func (api *APIServer) handlerSubmitJobs(w http.ResponseWriter, r *http.Request)
 				} else {
 					jobID := api.cloudScheduler.GoalManager.AddJob(newJob)
 					newJob.UpdateJobID(jobID)
+					span.SetAttribute("job_id", jobID)
 					api.cloudScheduler.GoalManager.UpdateJob(newJob, true)
 					response = response.AddEntity("job_id", jobID).
 						AddEntity("state", datatype.JobSubmitted)
@@ -475,11 +556,11 @@ func (api *APIServer) handlerJobRemove(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if job.User != user.GetUserName() {
-		logger.Info.Printf("user %q does not own the job %s", user.GetUserName(), jobID)
+		apiLog.With(logger.Fields{"job_id": jobID, "user": user.GetUserName()}).Infof("user %q does not own the job %s", user.GetUserName(), jobID)
 		if queries.Get("override") == "true" {
-			logger.Info.Printf("user %q is attempting to override job %q owned by %s", user.GetUserName(), jobID, job.User)
+			apiLog.With(logger.Fields{"job_id": jobID, "user": user.GetUserName()}).Infof("user %q is attempting to override job %q owned by %s", user.GetUserName(), jobID, job.User)
 			if user.Auth.IsSuperUser {
-				logger.Info.Printf("user %q is a super user. overriding permitted", user.GetUserName())
+				apiLog.With(logger.Fields{"job_id": jobID, "user": user.GetUserName()}).Infof("user %q is a super user. overriding permitted", user.GetUserName())
 			} else {
 				response := datatype.NewAPIMessageBuilder().AddError(fmt.Sprintf("User %s does not have permission to override to the job", user.GetUserName())).Build()
 				respondJSON(w, http.StatusBadRequest, response.ToJson())
@@ -525,6 +606,124 @@ func (api *APIServer) handlerJobRemove(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handlerJobRevisions returns revisions of the job description, oldest first. Only the
+// owner of the job or a super user can see them
+func (api *APIServer) handlerJobRevisions(w http.ResponseWriter, r *http.Request) {
+	response := datatype.NewAPIMessageBuilder()
+	user, err := api.authenticate(r)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	err = api.authenticator.UpdatePermissionTableForUser(user)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusInternalServerError, response.Build().ToJson())
+		return
+	}
+	vars := mux.Vars(r)
+	job, err := api.cloudScheduler.GoalManager.GetJob(vars["id"])
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	// revisions keep env values of plugins that may have been removed since
+	if job.User != user.GetUserName() && !user.Auth.IsSuperUser {
+		response.AddError(fmt.Sprintf("User %s does not have access to the job", user.GetUserName()))
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	revisions, err := api.cloudScheduler.GoalManager.GetRevisions(job.JobID)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusInternalServerError, response.Build().ToJson())
+		return
+	}
+	if revisions == nil {
+		revisions = make([]*datatype.JobRevision, 0)
+	}
+	response.AddEntity("job_id", job.JobID).
+		AddEntity("revision", job.Revision).
+		AddEntity("revisions", revisions)
+	respondJSON(w, http.StatusOK, response.Build().ToJson())
+}
+
+// handlerJobRollback makes a new revision of the job from an earlier revision
+// and submits the job again
+func (api *APIServer) handlerJobRollback(w http.ResponseWriter, r *http.Request) {
+	response := datatype.NewAPIMessageBuilder()
+	user, err := api.authenticate(r)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	err = api.authenticator.UpdatePermissionTableForUser(user)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusInternalServerError, response.Build().ToJson())
+		return
+	}
+	vars := mux.Vars(r)
+	queries := r.URL.Query()
+	jobID := vars["id"]
+	to, err := strconv.Atoi(queries.Get("to"))
+	if err != nil {
+		response.AddError(fmt.Sprintf("failed to parse revision %q: %s", queries.Get("to"), err.Error()))
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	job, err := api.cloudScheduler.GoalManager.GetJob(jobID)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	if job.User != user.GetUserName() {
+		apiLog.With(logger.Fields{"job_id": jobID, "user": user.GetUserName()}).Infof("user %q does not own the job %s", user.GetUserName(), jobID)
+		if queries.Get("override") == "true" && user.Auth.IsSuperUser {
+			apiLog.With(logger.Fields{"job_id": jobID, "user": user.GetUserName()}).Infof("user %q is a super user. overriding permitted", user.GetUserName())
+		} else {
+			response.AddError(fmt.Sprintf("user %q is not the owner of job %q", user.GetUserName(), jobID))
+			respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+			return
+		}
+	}
+	oldGoal := job.ScienceGoal
+	rolledBack, err := api.cloudScheduler.GoalManager.RollbackJob(jobID, to, user.GetUserName())
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	diff, _ := datatype.DiffJobDescription(job, rolledBack)
+	apiLog.With(rolledBack.LogFields()).Infof("job %s is rolled back to revision %d as revision %d", jobID, to, rolledBack.Revision)
+	response.AddEntity("job_id", jobID).
+		AddEntity("revision", rolledBack.Revision).
+		AddEntity("rollback_to", to).
+		AddEntity("diff", diff)
+	if oldGoal != nil {
+		api.cloudScheduler.GoalManager.RemoveScienceGoal(oldGoal.ID)
+	}
+	span := api.cloudScheduler.Tracer.StartSpan("job.submit", tracing.SpanContext{})
+	span.SetAttribute("user", user.GetUserName()).
+		SetAttribute("job_id", jobID).
+		SetAttribute("rollback_to", strconv.Itoa(to))
+	defer span.Finish()
+	if errorList := api.cloudScheduler.ValidateJobAndCreateScienceGoalForExistingJob(jobID, user, false, span.Context()); len(errorList) > 0 {
+		span.SetError(fmt.Sprintf("%v", errorList))
+		response.AddEntity("state", datatype.JobDrafted).
+			AddErrorList(errorList).
+			AddError(fmt.Sprintf("the job is rolled back but failed to be submitted: %v", errorList))
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	response.AddEntity("state", datatype.JobSubmitted)
+	respondJSON(w, http.StatusOK, response.Build().ToJson())
+}
+
 func (api *APIServer) handlerJobTemplate(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	if r.Method == http.MethodGet {
@@ -546,6 +745,223 @@ func (api *APIServer) handlerJobTemplate(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// handlerJobTrace returns spans of the trace of the job's current science goal
+// from its submission to runs of its plugins on nodes
+func (api *APIServer) handlerJobTrace(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if r.Method == http.MethodGet {
+		response := datatype.NewAPIMessageBuilder()
+		job, err := api.cloudScheduler.GoalManager.GetJob(vars["id"])
+		if err != nil {
+			response.AddError(err.Error())
+			respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+			return
+		}
+		if job.ScienceGoal == nil || job.ScienceGoal.TraceID == "" {
+			response.AddError(fmt.Sprintf("job %q has no trace. The job may not have been submitted since tracing was enabled", job.JobID))
+			respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+			return
+		}
+		spans := api.cloudScheduler.Tracer.GetTrace(job.ScienceGoal.TraceID)
+		if spans == nil {
+			spans = make([]*tracing.Span, 0)
+		}
+		response.AddEntity("job_id", job.JobID).
+			AddEntity("trace_id", job.ScienceGoal.TraceID).
+			AddEntity("spans", spans)
+		respondJSON(w, http.StatusOK, response.Build().ToJson())
+	}
+}
+
+// handlerTemplateCreate stores a job template. The template is given in the body,
+// or made from an existing job with name and from_job queries. A template can only
+// be replaced by its owner or a super user
+func (api *APIServer) handlerTemplateCreate(w http.ResponseWriter, r *http.Request) {
+	user, err := api.authenticate(r)
+	if err != nil {
+		response := datatype.NewAPIMessageBuilder()
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	var template *datatype.JobTemplate
+	switch r.Method {
+	case http.MethodGet:
+		queries := r.URL.Query()
+		name, jobID := queries.Get("name"), queries.Get("from_job")
+		if name == "" || jobID == "" {
+			response := datatype.NewAPIMessageBuilder().AddError("name and from_job fields are required").Build()
+			respondJSON(w, http.StatusBadRequest, response.ToJson())
+			return
+		}
+		job, err := api.cloudScheduler.GoalManager.GetJob(jobID)
+		if err != nil {
+			response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+			respondJSON(w, http.StatusBadRequest, response.ToJson())
+			return
+		}
+		if job.User != user.GetUserName() && !user.Auth.IsSuperUser {
+			response := datatype.NewAPIMessageBuilder().AddError(fmt.Sprintf("User %s does not have access to the job", user.GetUserName())).Build()
+			respondJSON(w, http.StatusBadRequest, response.ToJson())
+			return
+		}
+		template = datatype.NewJobTemplateFromJob(name, user.GetUserName(), job)
+		template.Public = queries.Get("public") == "true"
+	case http.MethodPost:
+		defer r.Body.Close()
+		blob, err := io.ReadAll(r.Body)
+		if err != nil {
+			response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+			respondJSON(w, http.StatusBadRequest, response.ToJson())
+			return
+		}
+		if err = yaml.Unmarshal(blob, &template); err != nil || template == nil {
+			response := datatype.NewAPIMessageBuilder().AddError(fmt.Sprintf("failed to parse the template: %v", err)).Build()
+			respondJSON(w, http.StatusBadRequest, response.ToJson())
+			return
+		}
+		template.User = user.GetUserName()
+	}
+	if err := template.Validate(); err != nil {
+		response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+		respondJSON(w, http.StatusBadRequest, response.ToJson())
+		return
+	}
+	if existing, err := api.cloudScheduler.GoalManager.GetTemplate(template.Name); err == nil {
+		if existing.User != user.GetUserName() && !user.Auth.IsSuperUser {
+			response := datatype.NewAPIMessageBuilder().AddError(fmt.Sprintf("Template %q is owned by %s", template.Name, existing.User)).Build()
+			respondJSON(w, http.StatusBadRequest, response.ToJson())
+			return
+		}
+	}
+	if err := api.cloudScheduler.GoalManager.PutTemplate(template); err != nil {
+		response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+		respondJSON(w, http.StatusInternalServerError, response.ToJson())
+		return
+	}
+	apiLog.WithField("user", user.GetUserName()).Infof("template %q is stored", template.Name)
+	response := datatype.NewAPIMessageBuilder().
+		AddEntity("template_name", template.Name).
+		AddEntity("variables", template.GetVariables()).
+		Build()
+	respondJSON(w, http.StatusOK, response.ToJson())
+}
+
+// getVisibleTemplate returns the template if the user can see it. Templates that
+// the user cannot see are reported as not existing
+func (api *APIServer) getVisibleTemplate(name string, user *User) (*datatype.JobTemplate, error) {
+	template, err := api.cloudScheduler.GoalManager.GetTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+	if !template.VisibleTo(user.GetUserName()) && !user.Auth.IsSuperUser {
+		return nil, fmt.Errorf("Template %q does not exist", name)
+	}
+	return template, nil
+}
+
+// handlerTemplates returns job templates of the user and public templates
+func (api *APIServer) handlerTemplates(w http.ResponseWriter, r *http.Request) {
+	user, err := api.authenticate(r)
+	if err != nil {
+		response := datatype.NewAPIMessageBuilder()
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	if r.Method == http.MethodGet {
+		response := datatype.NewAPIMessageBuilder()
+		templates, err := api.cloudScheduler.GoalManager.GetTemplates()
+		if err != nil {
+			response.AddError(err.Error())
+			respondJSON(w, http.StatusInternalServerError, response.Build().ToJson())
+			return
+		}
+		for _, template := range templates {
+			if template.VisibleTo(user.GetUserName()) || user.Auth.IsSuperUser {
+				response.AddEntity(template.Name, template)
+			}
+		}
+		respondJSON(w, http.StatusOK, response.Build().ToJson())
+	}
+}
+
+func (api *APIServer) handlerTemplate(w http.ResponseWriter, r *http.Request) {
+	user, err := api.authenticate(r)
+	if err != nil {
+		response := datatype.NewAPIMessageBuilder()
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	vars := mux.Vars(r)
+	if r.Method == http.MethodGet {
+		template, err := api.getVisibleTemplate(vars["name"], user)
+		if err != nil {
+			response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+			respondJSON(w, http.StatusBadRequest, response.ToJson())
+			return
+		}
+		blob, err := httpSensitiveJsonMarshal(template)
+		if err != nil {
+			response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+			respondJSON(w, http.StatusBadRequest, response.ToJson())
+			return
+		}
+		respondJSON(w, http.StatusOK, blob)
+	}
+}
+
+// handlerTemplateInstantiate creates a job from the template. The body has values
+// of the template variables, e.g. {"variables": {"THRESHOLD": "0.8"}}
+func (api *APIServer) handlerTemplateInstantiate(w http.ResponseWriter, r *http.Request) {
+	user, err := api.authenticate(r)
+	if err != nil {
+		response := datatype.NewAPIMessageBuilder()
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	vars := mux.Vars(r)
+	template, err := api.getVisibleTemplate(vars["name"], user)
+	if err != nil {
+		response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+		respondJSON(w, http.StatusBadRequest, response.ToJson())
+		return
+	}
+	defer r.Body.Close()
+	var request struct {
+		Variables map[string]string `json:"variables"`
+	}
+	if blob, err := io.ReadAll(r.Body); err != nil {
+		response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+		respondJSON(w, http.StatusBadRequest, response.ToJson())
+		return
+	} else if len(bytes.TrimSpace(blob)) > 0 {
+		if err := json.Unmarshal(blob, &request); err != nil {
+			response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+			respondJSON(w, http.StatusBadRequest, response.ToJson())
+			return
+		}
+	}
+	newJob, err := template.Instantiate(request.Variables)
+	if err != nil {
+		response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+		respondJSON(w, http.StatusBadRequest, response.ToJson())
+		return
+	}
+	newJob.User = user.GetUserName()
+	jobID := api.cloudScheduler.GoalManager.AddJob(newJob)
+	apiLog.With(newJob.LogFields()).Infof("job %q is created from template %q", newJob.Name, template.Name)
+	response := datatype.NewAPIMessageBuilder().
+		AddEntity("job_name", newJob.Name).
+		AddEntity("job_id", jobID).
+		AddEntity("template_name", template.Name).
+		AddEntity("state", datatype.JobCreated).
+		Build()
+	respondJSON(w, http.StatusOK, response.ToJson())
+}
+
 func (api *APIServer) handlerGoals(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 
@@ -623,7 +1039,7 @@ func (api *APIServer) handlerGoalStreamForNode(w http.ResponseWriter, r *http.Re
 	} else {
 		blob, err := httpSensitiveJsonMarshal(goals)
 		if err != nil {
-			logger.Error.Printf("Failed to compress goals for node %q before pushing", nodeName)
+			apiLog.WithField("node", nodeName).Errorf("Failed to compress goals for node %q before pushing", nodeName)
 		} else {
 			event := datatype.NewSchedulerEventBuilder(datatype.EventGoalStatusUpdated).
 				AddEntry("goals", string(blob)).
@@ -757,7 +1173,7 @@ func (api *APIServer) handleDataPluginsWhitelist(w http.ResponseWriter, r *http.
 			http.Error(w, err.Error(), http.StatusBadRequest)
 		} else {
 			response := datatype.NewAPIMessageBuilder()
-			logger.Info.Printf("adding plugin whitelist %q", blob)
+			apiLog.Infof("adding plugin whitelist %q", blob)
 			api.cloudScheduler.Validator.AddPluginWhitelist(string(blob))
 			api.cloudScheduler.Validator.WritePluginWhitelist()
 			response.AddEntity("whitelist", string(blob))
@@ -772,7 +1188,7 @@ func (api *APIServer) handleDataPluginsWhitelist(w http.ResponseWriter, r *http.
 			http.Error(w, err.Error(), http.StatusBadRequest)
 		} else {
 			response := datatype.NewAPIMessageBuilder()
-			logger.Info.Printf("removing plugin whitelist %q", blob)
+			apiLog.Infof("removing plugin whitelist %q", blob)
 			api.cloudScheduler.Validator.RemovePluginWhitelist(string(blob))
 			api.cloudScheduler.Validator.WritePluginWhitelist()
 			response.AddEntity("whitelist", string(blob))
@@ -1,8 +1,12 @@
 package cloudscheduler
 
 import (
+	"time"
+
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+	"github.com/waggle-sensor/edge-scheduler/pkg/tracing"
 )
 
 type CloudSchedulerConfig struct {
@@ -23,6 +27,14 @@ type CloudSchedulerConfig struct {
 	AuthToken                     string `json:"auth_token" yaml:"authToken"`
 	JobReevaluationIntervalSecond int    `json:"job_reevaluation_interval_second" yaml:"jobReevaluationIntervalSecond"`
 	Debug                         bool   `json:"debug" yaml:"debug"`
+	// Logging configures the log format and levels of components
+	Logging logger.Config `json:"logging,omitempty" yaml:"logging,omitempty"`
+	// OTLPEndpoint is the OpenTelemetry collector to export spans to, e.g. http://localhost:4318.
+	// Spans are only kept in memory if not given
+	OTLPEndpoint string `json:"otlp_endpoint,omitempty" yaml:"otlpEndpoint,omitempty"`
+	// WebhookAllowedHosts are the hosts that webhooks of reactions may call. Webhooks
+	// may call any host that resolves to a public address if not given
+	WebhookAllowedHosts []string `json:"webhook_allowed_hosts,omitempty" yaml:"webhookAllowedHosts,omitempty"`
 }
 
 type CloudSchedulerBuilder struct {
@@ -37,6 +49,8 @@ func NewCloudSchedulerBuilder(config *CloudSchedulerConfig) *CloudSchedulerBuild
 			Config:              config,
 			Validator:           NewJobValidator(config),
 			chanFromGoalManager: make(chan datatype.Event, maxChannelBuffer),
+			reactionLastRun:     make(map[string]time.Time),
+			webhooks:            newWebhookPoster(config.WebhookAllowedHosts),
 		},
 	}
 }
@@ -64,6 +78,15 @@ func (csb *CloudSchedulerBuilder) AddAPIServer() *CloudSchedulerBuilder {
 	return csb
 }
 
+func (csb *CloudSchedulerBuilder) AddTracer() *CloudSchedulerBuilder {
+	var exporter tracing.Exporter
+	if csb.cloudScheduler.Config.OTLPEndpoint != "" {
+		exporter = tracing.NewOTLPExporter(csb.cloudScheduler.Config.OTLPEndpoint)
+	}
+	csb.cloudScheduler.Tracer = tracing.NewTracer("cloudscheduler", exporter)
+	return csb
+}
+
 func (rns *CloudSchedulerBuilder) Build() *CloudScheduler {
 	return rns.cloudScheduler
 }
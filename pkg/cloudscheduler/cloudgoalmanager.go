@@ -16,7 +16,13 @@ import (
 	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
 )
 
-const jobBucketName = "jobs"
+var gmLog = logger.New("goalmanager")
+
+const (
+	jobBucketName      = "jobs"
+	templateBucketName = "templates"
+	revisionBucketName = "revisions"
+)
 
 // CloudGoalManager structs a goal manager for cloudscheduler
 type CloudGoalManager struct {
@@ -41,7 +47,7 @@ func (cgm *CloudGoalManager) AddJob(job *datatype.Job) string {
 			return err
 		}
 		b.Put([]byte(job.JobID), []byte(buf))
-		return nil
+		return putRevision(tx, datatype.NewJobRevision(job, job.User, "created"))
 	})
 	return job.JobID
 }
@@ -70,7 +76,7 @@ func (cgm *CloudGoalManager) GetJobs(userName string) (jobs []*datatype.Job) {
 		})
 	})
 	if err != nil {
-		logger.Error.Printf("Error from DB: %s", err.Error())
+		gmLog.Errorf("Error from DB: %s", err.Error())
 	}
 	return
 }
@@ -137,6 +143,9 @@ func (cgm *CloudGoalManager) UpdateJob(job *datatype.Job, submit bool) (err erro
 			return err
 		}
 		b.Put([]byte(job.JobID), []byte(buf))
+		if submit && job.ScienceGoal != nil {
+			return linkScienceGoalToRevision(tx, job)
+		}
 		return nil
 	})
 	if err != nil {
@@ -152,6 +161,188 @@ func (cgm *CloudGoalManager) UpdateJob(job *datatype.Job, submit bool) (err erro
 	return
 }
 
+// RevisionConflictError is returned when an edit is made on a revision
+// of a job that is no longer the latest
+type RevisionConflictError struct {
+	JobID    string
+	Revision int
+	Latest   int
+}
+
+func (e *RevisionConflictError) Error() string {
+	return fmt.Sprintf("job %q was edited from revision %d, but the latest revision is %d. Please edit the latest revision", e.JobID, e.Revision, e.Latest)
+}
+
+// EditJob stores the edited job as the next revision of the job. If revision is
+// not negative, it must match the latest revision stored; otherwise the edit
+// is rejected with RevisionConflictError so that two editors cannot
+// silently overwrite each other
+func (cgm *CloudGoalManager) EditJob(job *datatype.Job, revision int, author string) error {
+	return cgm.ReviseJob(job, revision, author, "edited")
+}
+
+// ReviseJob is EditJob with the reason of the revision, e.g. when the scheduler
+// changes the job on behalf of the owner
+func (cgm *CloudGoalManager) ReviseJob(job *datatype.Job, revision int, author string, reason string) error {
+	return cgm.jobDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(jobBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", jobBucketName)
+		}
+		v := b.Get([]byte(job.JobID))
+		if v == nil {
+			return fmt.Errorf("Job ID %q does not exist", job.JobID)
+		}
+		var stored datatype.Job
+		if err := json.Unmarshal(v, &stored); err != nil {
+			return err
+		}
+		if revision >= 0 && stored.Revision != revision {
+			return &RevisionConflictError{JobID: job.JobID, Revision: revision, Latest: stored.Revision}
+		}
+		job.Revision = stored.Revision + 1
+		return putJobWithRevision(tx, &stored, job, author, reason)
+	})
+}
+
+// RollbackJob makes a new revision of the job with the description of an earlier
+// revision and returns the job. The caller submits the job again
+func (cgm *CloudGoalManager) RollbackJob(jobID string, to int, author string) (job *datatype.Job, err error) {
+	err = cgm.jobDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(jobBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", jobBucketName)
+		}
+		v := b.Get([]byte(jobID))
+		if v == nil {
+			return fmt.Errorf("Job ID %q does not exist", jobID)
+		}
+		var stored datatype.Job
+		if err := json.Unmarshal(v, &stored); err != nil {
+			return err
+		}
+		r, err := getRevision(tx, jobID, to)
+		if err != nil {
+			return err
+		}
+		if to == stored.Revision {
+			return fmt.Errorf("job %q is already at revision %d", jobID, to)
+		}
+		var j datatype.Job
+		if err := json.Unmarshal(v, &j); err != nil {
+			return err
+		}
+		j.RollbackTo(r)
+		j.ScienceGoal = nil
+		j.Drafted()
+		j.Revision = stored.Revision + 1
+		job = &j
+		return putJobWithRevision(tx, &stored, job, author, fmt.Sprintf("rollback to revision %d", to))
+	})
+	return
+}
+
+// GetRevisions returns revisions of the job in order
+func (cgm *CloudGoalManager) GetRevisions(jobID string) (revisions []*datatype.JobRevision, err error) {
+	err = cgm.jobDB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(revisionBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", revisionBucketName)
+		}
+		jb := b.Bucket([]byte(jobID))
+		if jb == nil {
+			return nil
+		}
+		return jb.ForEach(func(k, v []byte) error {
+			var r datatype.JobRevision
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			revisions = append(revisions, &r)
+			return nil
+		})
+	})
+	return
+}
+
+// putJobWithRevision stores the job and its new revision. Jobs created before
+// revisions were kept get their previous description recorded first so that
+// they can be rolled back to it
+func putJobWithRevision(tx *bolt.Tx, previous *datatype.Job, job *datatype.Job, author string, reason string) error {
+	if _, err := getRevision(tx, previous.JobID, previous.Revision); err != nil {
+		if err := putRevision(tx, datatype.NewJobRevision(previous, previous.User, "recorded before the next revision")); err != nil {
+			return err
+		}
+	}
+	b := tx.Bucket([]byte(jobBucketName))
+	if b == nil {
+		return fmt.Errorf("Bucket %s does not exist", jobBucketName)
+	}
+	buf, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	if err := b.Put([]byte(job.JobID), buf); err != nil {
+		return err
+	}
+	return putRevision(tx, datatype.NewJobRevision(job, author, reason))
+}
+
+// revisionKey keeps revisions in order in the bucket
+func revisionKey(revision int) []byte {
+	return []byte(fmt.Sprintf("%010d", revision))
+}
+
+func putRevision(tx *bolt.Tx, r *datatype.JobRevision) error {
+	b := tx.Bucket([]byte(revisionBucketName))
+	if b == nil {
+		return fmt.Errorf("Bucket %s does not exist", revisionBucketName)
+	}
+	jb, err := b.CreateBucketIfNotExists([]byte(r.JobID))
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return jb.Put(revisionKey(r.Revision), buf)
+}
+
+func getRevision(tx *bolt.Tx, jobID string, revision int) (*datatype.JobRevision, error) {
+	b := tx.Bucket([]byte(revisionBucketName))
+	if b == nil {
+		return nil, fmt.Errorf("Bucket %s does not exist", revisionBucketName)
+	}
+	var v []byte
+	if jb := b.Bucket([]byte(jobID)); jb != nil {
+		v = jb.Get(revisionKey(revision))
+	}
+	if v == nil {
+		return nil, fmt.Errorf("revision %d of job %q does not exist", revision, jobID)
+	}
+	var r datatype.JobRevision
+	if err := json.Unmarshal(v, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// linkScienceGoalToRevision records the science goal of the job in the revision it was made from
+func linkScienceGoalToRevision(tx *bolt.Tx, job *datatype.Job) error {
+	r, err := getRevision(tx, job.JobID, job.Revision)
+	if err != nil {
+		r = datatype.NewJobRevision(job, job.User, "recorded at submission")
+	}
+	for _, goalID := range r.ScienceGoals {
+		if goalID == job.ScienceGoal.ID {
+			return nil
+		}
+	}
+	r.ScienceGoals = append(r.ScienceGoals, job.ScienceGoal.ID)
+	return putRevision(tx, r)
+}
+
 func (cgm *CloudGoalManager) SuspendJob(jobID string) (err error) {
 	var job datatype.Job
 	err = cgm.jobDB.Update(func(tx *bolt.Tx) error {
@@ -243,10 +434,10 @@ func (cgm *CloudGoalManager) UpdateScienceGoal(scienceGoal *datatype.ScienceGoal
 	// 	for _, subGoal := range scienceGoal.SubGoals {
 	// 		message, err := yaml.Marshal([]*datatype.ScienceGoal{scienceGoal})
 	// 		if err != nil {
-	// 			logger.Error.Printf("Unable to parse the science goal <%s> into YAML: %s", scienceGoal.ID, err.Error())
+	// 			gmLog.Errorf("Unable to parse the science goal <%s> into YAML: %s", scienceGoal.ID, err.Error())
 	// 			continue
 	// 		}
-	// 		logger.Debug.Printf("%+v", string(message))
+	// 		gmLog.Debugf("%+v", string(message))
 	// 		cgm.rmqHandler.SendYAML(subGoal.Name, message)
 	// 	}
 	// }
@@ -293,6 +484,61 @@ func (cgm *CloudGoalManager) EditRecord(job *datatype.Job) error {
 	})
 }
 
+// PutTemplate stores the job template. A template with the same name is replaced
+func (cgm *CloudGoalManager) PutTemplate(template *datatype.JobTemplate) error {
+	return cgm.jobDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(templateBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", templateBucketName)
+		}
+		buf, err := json.Marshal(template)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(template.Name), buf)
+	})
+}
+
+// GetTemplate returns the job template of the name
+func (cgm *CloudGoalManager) GetTemplate(name string) (template *datatype.JobTemplate, err error) {
+	err = cgm.jobDB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(templateBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", templateBucketName)
+		}
+		v := b.Get([]byte(name))
+		if v == nil {
+			return fmt.Errorf("Template %q does not exist", name)
+		}
+		var t datatype.JobTemplate
+		if err := json.Unmarshal(v, &t); err != nil {
+			return err
+		}
+		template = &t
+		return nil
+	})
+	return
+}
+
+// GetTemplates returns all job templates. Templates are shared among users
+func (cgm *CloudGoalManager) GetTemplates() (templates []*datatype.JobTemplate, err error) {
+	err = cgm.jobDB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(templateBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", templateBucketName)
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var t datatype.JobTemplate
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+			templates = append(templates, &t)
+			return nil
+		})
+	})
+	return
+}
+
 func (cgm *CloudGoalManager) OpenJobDB() error {
 	db, err := bolt.Open(path.Join(cgm.dataPath, "job.db"), 0600, &bolt.Options{Timeout: 1 * time.Second})
 	if err != nil {
@@ -300,8 +546,12 @@ func (cgm *CloudGoalManager) OpenJobDB() error {
 	}
 	cgm.jobDB = db
 	cgm.jobDB.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(jobBucketName))
-		return err
+		for _, bucketName := range []string{jobBucketName, templateBucketName, revisionBucketName} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(bucketName)); err != nil {
+				return err
+			}
+		}
+		return nil
 	})
 	return nil
 }
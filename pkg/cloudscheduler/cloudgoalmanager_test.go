@@ -0,0 +1,73 @@
+package cloudscheduler
+
+import (
+	"testing"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
+)
+
+func TestJobRevisions(t *testing.T) {
+	cgm := &CloudGoalManager{
+		scienceGoals: make(map[string]*datatype.ScienceGoal),
+		Notifier:     interfacing.NewNotifier(),
+		dataPath:     t.TempDir(),
+	}
+	if err := cgm.OpenJobDB(); err != nil {
+		t.Fatal(err)
+	}
+	defer cgm.jobDB.Close()
+
+	job := datatype.NewJob("myjob", "theone", "")
+	job.ScienceRules = []string{"schedule(imagesampler): cronjob('imagesampler', '* * * * *')"}
+	jobID := cgm.AddJob(job)
+
+	edited := datatype.NewJob("myjob", "theone", jobID)
+	edited.ScienceRules = []string{"schedule(imagesampler): cronjob('imagesampler', '*/30 * * * *')"}
+	if err := cgm.EditJob(edited, 0, "theone"); err != nil {
+		t.Fatal(err)
+	}
+	// another editor still at revision 0 must not overwrite the edit
+	stale := datatype.NewJob("staledit", "theone", jobID)
+	err := cgm.EditJob(stale, 0, "someone")
+	if _, conflict := err.(*RevisionConflictError); !conflict {
+		t.Fatalf("expected a revision conflict, but got %v", err)
+	}
+
+	rolledBack, err := cgm.RollbackJob(jobID, 0, "theone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rolledBack.Revision != 2 || rolledBack.ScienceRules[0] != job.ScienceRules[0] || rolledBack.User != "theone" {
+		t.Errorf("expected revision 2 with the rule of revision 0, but got %+v", rolledBack)
+	}
+	if _, err := cgm.RollbackJob(jobID, 5, "theone"); err == nil {
+		t.Errorf("expected an error for rolling back to a revision that does not exist")
+	}
+
+	revisions, err := cgm.GetRevisions(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 3 {
+		t.Fatalf("expected 3 revisions, but got %d", len(revisions))
+	}
+	for i, want := range []string{"created", "edited", "rollback to revision 0"} {
+		if revisions[i].Revision != i || revisions[i].Reason != want {
+			t.Errorf("expected revision %d %q, but got %d %q", i, want, revisions[i].Revision, revisions[i].Reason)
+		}
+	}
+	// earlier revisions stay as they were
+	if revisions[1].Spec.ScienceRules[0] != edited.ScienceRules[0] {
+		t.Errorf("expected revision 1 unchanged, but got %v", revisions[1].Spec.ScienceRules)
+	}
+
+	rolledBack.ScienceGoal = &datatype.ScienceGoal{ID: "goal-1", JobID: jobID}
+	if err := cgm.UpdateJob(rolledBack, true); err != nil {
+		t.Fatal(err)
+	}
+	revisions, _ = cgm.GetRevisions(jobID)
+	if goals := revisions[2].ScienceGoals; len(goals) != 1 || goals[0] != "goal-1" {
+		t.Errorf("expected goal-1 linked to revision 2, but got %v", goals)
+	}
+}
@@ -10,8 +10,11 @@ import (
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
 	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+	"github.com/waggle-sensor/edge-scheduler/pkg/tracing"
 )
 
+var csLog = logger.New("cloudscheduler")
+
 const maxChannelBuffer = 100
 
 // CloudScheduler structs the cloud scheduler
@@ -25,6 +28,11 @@ type CloudScheduler struct {
 	chanFromGoalManager chan datatype.Event
 	MetricsCollector    *prometheus.Collector
 	eventListener       *interfacing.RabbitMQHandler
+	Tracer              *tracing.Tracer
+	// reactionLastRun keeps when each reaction of jobs last ran for cooldown
+	reactionLastRun map[string]time.Time
+	// webhooks posts triggers to webhooks of reactions
+	webhooks *webhookPoster
 }
 
 func (cs *CloudScheduler) Configure() error {
@@ -51,7 +59,7 @@ func (cs *CloudScheduler) Configure() error {
 
 	// Setting up RabbitMQ connection to receive scheduling events from nodes
 	if !cs.Config.NoRabbitMQ {
-		logger.Info.Printf(
+		csLog.Infof(
 			"Using RabbitMQ at %s with user %s",
 			cs.Config.RabbitmqURL,
 			cs.Config.RabbitmqUsername,
@@ -69,80 +77,100 @@ func (cs *CloudScheduler) Configure() error {
 
 func (cs *CloudScheduler) ValidateJobAndCreateScienceGoal(job *datatype.Job, user *User) (scienceGoal *datatype.ScienceGoal, errorList []error) {
 	scienceGoalBuilder := datatype.NewScienceGoalBuilder(job.Name, job.JobID)
-	logger.Info.Printf("Validating %s...", job.Name)
+	csLog.With(job.LogFields()).Infof("Validating %s...", job.Name)
 	// Step 1: Resolve node tags
 	job.AddNodes(cs.Validator.GetNodeNamesByTags(job.NodeTags))
 	// TODO: Jobs may be submitted without nodes in the future
 	//       For example, Chicago nodes without having any node in Chicago yet
 	if len(job.Nodes) < 1 {
-		errorList = append(errorList, fmt.Errorf("Node is not selected"))
+		errorList = append(errorList, datatype.NewValidationError("nodes", datatype.ValidationRequired, "Node is not selected"))
+		return
+	}
+	if job.MaxConcurrency < 0 {
+		errorList = append(errorList, datatype.NewValidationError("maxConcurrency", datatype.ValidationInvalid, "max_concurrency of the job must not be negative"))
 		return
 	}
+	scienceGoalBuilder = scienceGoalBuilder.
+		SetMaxConcurrency(job.MaxConcurrency).
+		SetUser(job.User)
 	// Check if email is set for notification
 	if len(job.NotificationOn) > 0 {
 		if job.Email == "" {
-			errorList = append(errorList, fmt.Errorf("No email is set for notification"))
+			errorList = append(errorList, datatype.NewValidationError("email", datatype.ValidationRequired, "No email is set for notification"))
 			return
 		}
 		// Check if given notification types are valid
-		for _, s := range job.NotificationOn {
-			switch s {
-			case datatype.JobCreated,
-				datatype.JobDrafted,
-				datatype.JobSubmitted,
-				datatype.JobRunning,
-				datatype.JobComplete,
-				datatype.JobSuspended,
-				datatype.JobRemoved:
-				continue
-			default:
-				errorList = append(errorList, fmt.Errorf("No type %q in Job notification", s))
+		for i, s := range job.NotificationOn {
+			if !datatype.IsJobStateValid(s) {
+				errorList = append(errorList, datatype.NewValidationError(fmt.Sprintf("notificationOn[%d]", i), datatype.ValidationInvalid, "No type %q in Job notification", s))
 			}
 		}
-		if len(errorList) > 1 {
+		if len(errorList) > 0 {
 			return
 		}
 	}
+	// Jobs submitted by reactions must exist and be owned by the user
+	for i, r := range job.Reactions {
+		if r.SubmitJob == "" {
+			continue
+		}
+		field := fmt.Sprintf("reactions[%d].submitJob", i)
+		if target, err := cs.GoalManager.GetJob(r.SubmitJob); err != nil {
+			errorList = append(errorList, datatype.NewValidationError(field, datatype.ValidationNotFound, "job %q to submit does not exist", r.SubmitJob))
+		} else if target.User != job.User {
+			errorList = append(errorList, datatype.NewValidationError(field, datatype.ValidationPermissionDenied, "job %q to submit is not owned by %s", r.SubmitJob, job.User))
+		}
+	}
 	for nodeName := range job.Nodes {
 		// Check 0: if the user can schedule
 		ret, err := user.CanScheduleOnNode(nodeName)
 		if err != nil {
-			errorList = append(errorList, err)
+			errorList = append(errorList, datatype.NewValidationError("nodes."+nodeName, datatype.ValidationPermissionDenied, "%s", err.Error()))
 			continue
 		} else if ret == false {
-			errorList = append(errorList, fmt.Errorf("User %s does not have permission for node %s", user.GetUserName(), nodeName))
+			errorList = append(errorList, datatype.NewValidationError("nodes."+nodeName, datatype.ValidationPermissionDenied, "User %s does not have permission for node %s", user.GetUserName(), nodeName))
 			continue
 		}
 		approvedPlugins := []*datatype.Plugin{}
 		nodeManifest := cs.Validator.GetNodeManifest(nodeName)
 		if nodeManifest == nil {
-			errorList = append(errorList, fmt.Errorf("%s does not exist", nodeName))
+			errorList = append(errorList, datatype.NewValidationError("nodes."+nodeName, datatype.ValidationNotFound, "%s does not exist", nodeName))
 			continue
 		}
 		// pluginNameForDuplication checks if plugin names are duplicate
 		pluginNameForDuplication := map[string]bool{}
-		for _, plugin := range job.Plugins {
-			if !cs.Validator.IsPluginNameValid(plugin.Name) {
-				errorList = append(errorList, fmt.Errorf("plugin name %q must consist of up to 256 alphanumeric characters with '-' or '.' in the middle, RFC1123", plugin.Name))
+		for i, plugin := range job.Plugins {
+			field := fmt.Sprintf("plugins[%d]", i)
+			if err := datatype.LintPluginName(field+".name", plugin.Name); err != nil {
+				errorList = append(errorList, err)
 				continue
 			}
 			if _, found := pluginNameForDuplication[plugin.Name]; found {
-				errorList = append(errorList, fmt.Errorf("the plugin name %q is duplicated. plugin names must be unique", plugin.Name))
+				errorList = append(errorList, datatype.NewValidationError(field+".name", datatype.ValidationDuplicate, "the plugin name %q is duplicated. plugin names must be unique", plugin.Name))
+				continue
+			}
+			if plugin.MaxConcurrency < 0 {
+				errorList = append(errorList, datatype.NewValidationError(field+".maxConcurrency", datatype.ValidationInvalid, "max_concurrency of the plugin %q must not be negative", plugin.Name))
 				continue
 			}
 			pluginImage, err := plugin.GetPluginImage()
 			if err != nil {
-				errorList = append(errorList, fmt.Errorf("%s does not specify plugin image", plugin.Name))
+				errorList = append(errorList, datatype.NewValidationError(field+".pluginSpec.image", datatype.ValidationRequired, "%s does not specify plugin image", plugin.Name))
+				continue
+			}
+			// host paths are checked by the node as only the node knows which ones are allowed
+			if _, err := plugin.PluginSpec.GetVolumes(); err != nil {
+				errorList = append(errorList, datatype.NewValidationError(field+".pluginSpec.volume", datatype.ValidationInvalid, "%s", err.Error()))
 				continue
 			}
 			pluginManifest := cs.Validator.GetPluginManifest(pluginImage, true)
 			if pluginManifest == nil {
 				// we also check if the image is in the whitelist. If so, we approve for the plugin
 				if cs.Validator.IsPluginWhitelisted(pluginImage) {
-					logger.Info.Printf("%s is whitelisted", pluginImage)
+					csLog.With(job.LogFields()).WithField("plugin", plugin.Name).Infof("%s is whitelisted", pluginImage)
 					approvedPlugins = append(approvedPlugins, plugin)
 				} else {
-					errorList = append(errorList, fmt.Errorf("%s does not exist in ECR", plugin.PluginSpec.Image))
+					errorList = append(errorList, datatype.NewValidationError(field+".pluginSpec.image", datatype.ValidationNotFound, "%s does not exist in ECR", plugin.PluginSpec.Image))
 				}
 				continue
 			}
@@ -152,7 +180,7 @@ func (cs *CloudScheduler) ValidateJobAndCreateScienceGoal(job *datatype.Job, use
 			// 	errorList = append(errorList, fmt.Errorf("%s:%s not exist in ECR", plugin.Name, plugin.Version))
 			// 	continue
 			// }
-			// logger.Info.Printf("%s:%s exists in ECR", plugin.Name, plugin.Version)
+			// csLog.Infof("%s:%s exists in ECR", plugin.Name, plugin.Version)
 
 			// Check 2: node supports hardware requirements of the plugin
 			// TODO: plugin manifest does not yet have sensor requirement
@@ -161,15 +189,15 @@ func (cs *CloudScheduler) ValidateJobAndCreateScienceGoal(job *datatype.Job, use
 			// 	errorList = append(errorList, fmt.Errorf("%s does not support hardware %v required by %s (%s)", nodeName, unsupportedHardwareList, plugin.Name, plugin.PluginSpec.Image))
 			// 	continue
 			// }
-			// logger.Info.Printf("%s passed Check 2", plugin.Name)
+			// csLog.Infof("%s passed Check 2", plugin.Name)
 
 			// Check 3: architecture of the plugin is supported by node
 			supported, _ := nodeManifest.GetPluginArchitectureSupportedComputes(pluginManifest)
 			if !supported {
-				errorList = append(errorList, fmt.Errorf("%s does not support architecture %v required by %s (%s)", nodeName, pluginManifest.GetArchitectures(), plugin.Name, plugin.PluginSpec.Image))
+				errorList = append(errorList, datatype.NewValidationError(field+".pluginSpec.image", datatype.ValidationUnsupported, "%s does not support architecture %v required by %s (%s)", nodeName, pluginManifest.GetArchitectures(), plugin.Name, plugin.PluginSpec.Image))
 				continue
 			}
-			logger.Info.Printf("%s passed Check 3", plugin.Name)
+			csLog.With(job.LogFields()).WithField("plugin", plugin.Name).Infof("%s passed Check 3", plugin.Name)
 			// Check 4: the required resource is available in node devices
 			// for _, c := range supportedComputes {
 			// 	supported, _ := c.GetUnsupportedPluginProfiles(pluginManifest)
@@ -181,7 +209,7 @@ func (cs *CloudScheduler) ValidateJobAndCreateScienceGoal(job *datatype.Job, use
 			// for _, profile := range profiles {
 			// 	err := plugin.RemoveProfile(profile)
 			// 	if err != nil {
-			// 		logger.Error.Printf("%s", err)
+			// 		csLog.Errorf("%s", err)
 			// 	}
 			// }
 			// }
@@ -192,11 +220,11 @@ func (cs *CloudScheduler) ValidateJobAndCreateScienceGoal(job *datatype.Job, use
 
 		// Check 5: valiables are valid
 		var rules []datatype.ScienceRule
-		for _, rule := range job.ScienceRules {
+		for i, rule := range job.ScienceRules {
 			r, err := datatype.NewScienceRule(rule)
 			if err != nil {
 				errorList = append(errorList,
-					fmt.Errorf("Failed to parse science rule %q: %s", rule, err.Error()))
+					datatype.NewValidationError(fmt.Sprintf("scienceRules[%d]", i), datatype.ValidationInvalid, "Failed to parse science rule %q: %s", rule, err.Error()))
 				continue
 			}
 			rules = append(rules, *r)
@@ -204,15 +232,17 @@ func (cs *CloudScheduler) ValidateJobAndCreateScienceGoal(job *datatype.Job, use
 		scienceGoalBuilder = scienceGoalBuilder.AddSubGoal(nodeName, approvedPlugins, rules)
 	}
 	if len(errorList) > 0 {
-		logger.Info.Printf("Validation failed for Job %q: %v", job.Name, errorList)
+		csLog.With(job.LogFields()).Infof("Validation failed for Job %q: %v", job.Name, errorList)
 	} else {
 		scienceGoal = scienceGoalBuilder.Build()
-		logger.Info.Printf("A new goal %q is generated for Job %q", scienceGoal.ID, job.Name)
+		csLog.With(scienceGoal.LogFields()).Infof("A new goal %q is generated for Job %q", scienceGoal.ID, job.Name)
 	}
 	return
 }
 
-func (cs *CloudScheduler) ValidateJobAndCreateScienceGoalForExistingJob(jobID string, user *User, dryrun bool) (errorList []error) {
+// ValidateJobAndCreateScienceGoalForExistingJob validates the job and replaces its science goal
+// with a new one. The new goal continues the trace of trace
+func (cs *CloudScheduler) ValidateJobAndCreateScienceGoalForExistingJob(jobID string, user *User, dryrun bool, trace tracing.SpanContext) (errorList []error) {
 	job, err := cs.GoalManager.GetJob(jobID)
 	if err != nil {
 		return []error{err}
@@ -221,11 +251,12 @@ func (cs *CloudScheduler) ValidateJobAndCreateScienceGoalForExistingJob(jobID st
 	if len(errorList) > 0 {
 		return
 	}
-	logger.Info.Printf("Updating science goal for JOB ID %q", jobID)
+	csLog.WithField("job_id", jobID).Infof("Updating science goal for JOB ID %q", jobID)
 	if job.ScienceGoal != nil {
-		logger.Info.Printf("job ID %q has an existing goal %q. dropping it first...", jobID, job.ScienceGoal.ID)
+		csLog.With(logger.Fields{"job_id": jobID, "goal_id": job.ScienceGoal.ID}).Infof("job ID %q has an existing goal %q. dropping it first...", jobID, job.ScienceGoal.ID)
 		cs.GoalManager.RemoveScienceGoal(job.ScienceGoal.ID)
 	}
+	sg.TraceID, sg.SpanID = trace.TraceID, trace.SpanID
 	job.ScienceGoal = sg
 	if dryrun {
 		cs.GoalManager.UpdateJob(job, false)
@@ -238,8 +269,19 @@ func (cs *CloudScheduler) ValidateJobAndCreateScienceGoalForExistingJob(jobID st
 func (cs *CloudScheduler) updateNodes(nodes []string) {
 	for _, nodeName := range nodes {
 		var goals []*datatype.ScienceGoal
+		var spans []*tracing.Span
 		for _, g := range cs.GoalManager.GetScienceGoalsForNode(nodeName) {
-			goals = append(goals, g.ShowMyScienceGoal(nodeName))
+			myGoal := g.ShowMyScienceGoal(nodeName)
+			// the node continues the trace from the push
+			if g.TraceID != "" {
+				span := cs.Tracer.StartSpan("goal.push", g.TraceContext())
+				span.SetAttribute("node", nodeName).
+					SetAttribute("goal_id", g.ID).
+					SetAttribute("job_id", g.JobID)
+				myGoal.SpanID = span.SpanID
+				spans = append(spans, span)
+			}
+			goals = append(goals, myGoal)
 		}
 		// if no science goal is assigned to the node return an empty list []
 		// returning null may raise an exception in edge scheduler
@@ -248,29 +290,53 @@ func (cs *CloudScheduler) updateNodes(nodes []string) {
 		}
 		blob, err := json.MarshalIndent(goals, "", "  ")
 		if err != nil {
-			logger.Error.Printf("Failed to compress goals for node %q before pushing", nodeName)
+			csLog.WithField("node", nodeName).Errorf("Failed to compress goals for node %q before pushing", nodeName)
+			for _, span := range spans {
+				span.SetError(err.Error())
+			}
 		} else {
 			event := datatype.NewSchedulerEventBuilder(datatype.EventGoalStatusUpdated).AddEntry("goals", string(blob)).Build()
 			cs.APIServer.Push(nodeName, &event)
 		}
+		for _, span := range spans {
+			span.Finish()
+		}
 	}
 }
 
 func (cs *CloudScheduler) Run() {
-	logger.Info.Printf("Cloud Scheduler %s starts...", cs.Name)
+	csLog.Infof("Cloud Scheduler %s starts...", cs.Name)
 	go cs.APIServer.Run()
 	chanEventFromNode := make(chan datatype.Event)
 	if cs.eventListener != nil {
-		logger.Info.Printf("Connecting to RabbitMQ to receive node events")
+		csLog.Infof("Connecting to RabbitMQ to receive node events")
 		queueName := fmt.Sprintf("to-scheduler-%s", cs.Config.Name)
-		logger.Debug.Printf("RabbitMQ Queue name for messages is %s", queueName)
+		csLog.Debugf("RabbitMQ Queue name for messages is %s", queueName)
 		err := cs.eventListener.SubscribeEvents(
 			"waggle.msg",
 			queueName,
 			datatype.EventRabbitMQSubscriptionPatternGoals,
 			chanEventFromNode)
 		if err != nil {
-			logger.Error.Printf("Failed to set up a connection to RabbitMQ: %s", err.Error())
+			csLog.Errorf("Failed to set up a connection to RabbitMQ: %s", err.Error())
+		}
+		// plugin events carry spans of plugin runs on nodes
+		err = cs.eventListener.SubscribeEvents(
+			"waggle.msg",
+			queueName+"-plugins",
+			datatype.EventRabbitMQSubscriptionPatternPlugins,
+			chanEventFromNode)
+		if err != nil {
+			csLog.Errorf("Failed to set up a connection to RabbitMQ: %s", err.Error())
+		}
+		// trigger() rules on nodes run reactions of jobs
+		err = cs.eventListener.SubscribeEvents(
+			"waggle.msg",
+			queueName+"-triggers",
+			datatype.EventRabbitMQSubscriptionPatternTrigger,
+			chanEventFromNode)
+		if err != nil {
+			csLog.Errorf("Failed to set up a connection to RabbitMQ: %s", err.Error())
 		}
 	}
 	// Timer for job re-evaluation
@@ -283,91 +349,96 @@ func (cs *CloudScheduler) Run() {
 	for {
 		select {
 		case <-ticker.C:
-			logger.Debug.Printf("Job re-evaluation")
+			csLog.Debugf("Job re-evaluation")
 		case event := <-chanEventFromNode:
 			e := event.(datatype.SchedulerEvent)
-			logger.Debug.Printf("%s:%v", e.ToString(), event)
+			csLog.Debugf("%s:%v", e.ToString(), event)
 			// TODO: stat aggregator for jobs may use this event
 			sender := e.GetEntry("vsn")
+			if span, found := e.GetTraceSpan(); found {
+				cs.Tracer.RecordSpan(span)
+			}
 			// sender must be identified
 			switch e.Type {
 			case datatype.EventGoalStatusReceived, datatype.EventGoalStatusUpdated:
 				goalID := e.GetGoalID()
-				logger.Debug.Printf("%s received science goal %s", sender, goalID)
+				csLog.WithField("goal_id", goalID).Debugf("%s received science goal %s", sender, goalID)
 				scienceGoal, err := cs.GoalManager.GetScienceGoal(goalID)
 				if err != nil {
-					logger.Error.Printf("Failed to find science goal %s", goalID)
+					csLog.WithField("goal_id", goalID).Errorf("Failed to find science goal %s", goalID)
 					break
 				}
 				job, err := cs.GoalManager.GetJob(scienceGoal.JobID)
 				if err != nil {
-					logger.Error.Printf("Failed to get job of the science goal %q: %s", goalID, err.Error())
+					csLog.WithField("goal_id", goalID).Errorf("Failed to get job of the science goal %q: %s", goalID, err.Error())
 					break
 				}
 				job.Runs()
 				err = cs.GoalManager.UpdateJob(job, false)
 				if err != nil {
-					logger.Error.Printf("Failed to update status of job %q: %s", scienceGoal.JobID, err.Error())
+					csLog.With(scienceGoal.LogFields()).Errorf("Failed to update status of job %q: %s", scienceGoal.JobID, err.Error())
 					break
 				}
+			case datatype.EventTriggerFired:
+				cs.handleTrigger(e)
 			}
 			// TODO: How do we determine if a job is failed
 			//       by looking at EventPluginStatusFailed?
 		case event := <-cs.chanFromGoalManager:
 			e := event.(datatype.SchedulerEvent)
-			logger.Debug.Printf("%s: %q", e.ToString(), e.GetGoalName())
+			csLog.Debugf("%s: %q", e.ToString(), e.GetGoalName())
 			switch e.Type {
 			case datatype.EventJobStatusRemoved:
 				// job, err := cs.GoalManager.GetJob(event.GetJobID())
 				// if err != nil {
-				// 	logger.Error.Printf("Failed to get job %q", event.GetJobID())
+				// 	csLog.Errorf("Failed to get job %q", event.GetJobID())
 				// 	break
 				// }
 				// The job is removed. Corresponding science goal should also be removed
 				if goalID := e.GetGoalID(); goalID != "" {
 					scienceGoal, err := cs.GoalManager.GetScienceGoal(goalID)
 					if err != nil {
-						logger.Error.Printf("Failed to get science goal %q", goalID)
+						csLog.WithField("goal_id", goalID).Errorf("Failed to get science goal %q", goalID)
 						break
 					}
 					NodesToUpdate := scienceGoal.GetSubjectNodes()
 					if err = cs.GoalManager.RemoveScienceGoal(scienceGoal.ID); err != nil {
-						logger.Error.Printf("Failed to remove science goal %q", scienceGoal.ID)
+						csLog.With(scienceGoal.LogFields()).Errorf("Failed to remove science goal %q", scienceGoal.ID)
 						break
 					}
-					logger.Info.Printf("Goal %q is removed for job %q.", scienceGoal.Name, scienceGoal.JobID)
+					csLog.With(scienceGoal.LogFields()).Infof("Goal %q is removed for job %q.", scienceGoal.Name, scienceGoal.JobID)
 					cs.updateNodes(NodesToUpdate)
 				} else {
-					logger.Info.Printf("failed to retreive goal ID from the event")
+					csLog.Infof("failed to retreive goal ID from the event")
 				}
 			case datatype.EventJobStatusSuspended:
 				job, err := cs.GoalManager.GetJob(e.GetJobID())
 				if err != nil {
-					logger.Error.Printf("Failed to get job %q", e.GetJobID())
+					csLog.WithField("job_id", e.GetJobID()).Errorf("Failed to get job %q", e.GetJobID())
 					break
 				}
 				// The job is removed. Corresponding science goal should also be removed
 				if job.ScienceGoal != nil {
 					scienceGoal, err := cs.GoalManager.GetScienceGoal(job.ScienceGoal.ID)
 					if err != nil {
-						logger.Error.Printf("Failed to get science goal %q", job.ScienceGoal.ID)
+						csLog.With(job.LogFields()).WithField("goal_id", job.ScienceGoal.ID).Errorf("Failed to get science goal %q", job.ScienceGoal.ID)
 						break
 					}
 					NodesToUpdate := scienceGoal.GetSubjectNodes()
 					if err = cs.GoalManager.RemoveScienceGoal(scienceGoal.ID); err != nil {
-						logger.Error.Printf("Failed to remove science goal %q", scienceGoal.ID)
+						csLog.With(scienceGoal.LogFields()).Errorf("Failed to remove science goal %q", scienceGoal.ID)
 						break
 					}
-					logger.Info.Printf("Goal %q is suspended for job %q.", scienceGoal.Name, scienceGoal.JobID)
+					csLog.With(scienceGoal.LogFields()).Infof("Goal %q is suspended for job %q.", scienceGoal.Name, scienceGoal.JobID)
 					cs.updateNodes(NodesToUpdate)
 				}
 			case datatype.EventGoalStatusSubmitted:
 				scienceGoal, err := cs.GoalManager.GetScienceGoal(e.GetGoalID())
 				if err != nil {
-					logger.Error.Printf("Failed to get science goal %q", e.GetGoalID())
+					csLog.WithField("goal_id", e.GetGoalID()).Errorf("Failed to get science goal %q", e.GetGoalID())
 					break
 				}
-				logger.Info.Printf("Goal %q is submitted for job id %q.", scienceGoal.Name, scienceGoal.JobID)
+				csLog.With(scienceGoal.LogFields()).Infof("Goal %q is submitted for job id %q.", scienceGoal.Name, scienceGoal.JobID)
 				NodesToUpdate := scienceGoal.GetSubjectNodes()
 				cs.updateNodes(NodesToUpdate)
 			}
@@ -0,0 +1,330 @@
+package cloudscheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+	"github.com/waggle-sensor/edge-scheduler/pkg/tracing"
+)
+
+// reactionAuthor is the author of revisions the scheduler makes by reactions
+const reactionAuthor = "cloudscheduler"
+
+// webhookTimeout is how long the scheduler waits for a webhook to respond
+const webhookTimeout = 10 * time.Second
+
+// maxWebhooksInFlight is how many webhooks the scheduler calls at the same time.
+// Webhook reactions that run while all of them are busy fail
+const maxWebhooksInFlight = 16
+
+// Trigger is a trigger fired by a trigger() rule on a node
+type Trigger struct {
+	Name      string            `json:"name"`
+	JobID     string            `json:"job_id"`
+	GoalID    string            `json:"goal_id"`
+	Node      string            `json:"node,omitempty"`
+	Params    map[string]string `json:"params,omitempty"`
+	Reason    string            `json:"reason,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+	trace     tracing.SpanContext
+}
+
+// NewTriggerFromEvent returns the trigger sent from a node
+func NewTriggerFromEvent(e datatype.SchedulerEvent) (*Trigger, error) {
+	t := &Trigger{
+		Params:    make(map[string]string),
+		Timestamp: time.Unix(0, e.Timestamp).UTC(),
+	}
+	t.Name, _ = e.GetEntry("trigger_name").(string)
+	t.JobID, _ = e.GetEntry("job_id").(string)
+	t.GoalID, _ = e.GetEntry("goal_id").(string)
+	t.Node, _ = e.GetEntry("vsn").(string)
+	t.Reason, _ = e.GetEntry("reason").(string)
+	t.trace.TraceID, _ = e.GetEntry("trace_id").(string)
+	t.trace.SpanID, _ = e.GetEntry("span_id").(string)
+	if params, ok := e.GetEntry("trigger_params").(map[string]interface{}); ok {
+		for k, v := range params {
+			t.Params[k] = fmt.Sprint(v)
+		}
+	}
+	if t.Name == "" || t.JobID == "" {
+		return nil, fmt.Errorf("trigger event must have trigger_name and job_id")
+	}
+	return t, nil
+}
+
+// LogFields returns fields identifying the trigger in logs
+func (t *Trigger) LogFields() logger.Fields {
+	return logger.Fields{
+		"trigger": t.Name,
+		"job_id":  t.JobID,
+		"goal_id": t.GoalID,
+		"node":    t.Node,
+	}
+}
+
+// handleTrigger runs reactions of the job registered for the trigger. Triggers from
+// goals that the job no longer has are ignored, and each reaction waits for its
+// cooldown before it runs again
+func (cs *CloudScheduler) handleTrigger(e datatype.SchedulerEvent) {
+	trigger, err := NewTriggerFromEvent(e)
+	if err != nil {
+		csLog.Errorf("Failed to parse trigger: %s", err.Error())
+		return
+	}
+	log := csLog.With(trigger.LogFields())
+	job, err := cs.GoalManager.GetJob(trigger.JobID)
+	if err != nil {
+		log.Errorf("Failed to get job %q of trigger %q: %s", trigger.JobID, trigger.Name, err.Error())
+		return
+	}
+	if job.ScienceGoal == nil || job.ScienceGoal.ID != trigger.GoalID {
+		log.Infof("trigger %q is from goal %q that job %q no longer has. Ignoring it", trigger.Name, trigger.GoalID, job.JobID)
+		return
+	}
+	now := time.Now()
+	for i, r := range job.Reactions {
+		if r.On != trigger.Name {
+			continue
+		}
+		cooldown, err := r.GetCooldown()
+		if err != nil {
+			log.Errorf("reactions[%d] of job %q has invalid cooldown: %s", i, job.JobID, err.Error())
+			continue
+		}
+		key := fmt.Sprintf("%s/%d", job.JobID, i)
+		if last, exist := cs.reactionLastRun[key]; exist && now.Sub(last) < cooldown {
+			log.Debugf("reactions[%d] of job %q is cooling down until %s", i, job.JobID, last.Add(cooldown).Format(time.RFC3339))
+			continue
+		}
+		cs.reactionLastRun[key] = now
+		if err := cs.runReaction(job, r, trigger); err != nil {
+			log.Errorf("Failed to run reaction %s of job %q on trigger %q: %s", r.Kind(), job.JobID, trigger.Name, err.Error())
+		} else {
+			log.Infof("Reaction %s of job %q ran on trigger %q from %s", r.Kind(), job.JobID, trigger.Name, trigger.Node)
+		}
+	}
+}
+
+// runReaction runs the reaction on behalf of the owner of the job
+func (cs *CloudScheduler) runReaction(job *datatype.Job, r *datatype.Reaction, trigger *Trigger) error {
+	span := cs.Tracer.StartSpan("reaction.run", trigger.trace)
+	span.SetAttribute("trigger", trigger.Name).
+		SetAttribute("job_id", job.JobID).
+		SetAttribute("reaction", string(r.Kind())).
+		SetAttribute("node", trigger.Node)
+	defer span.Finish()
+	var err error
+	switch r.Kind() {
+	case datatype.ReactionSubmitJob:
+		err = cs.submitJobByReaction(job, r.SubmitJob, span.Context())
+	case datatype.ReactionWiden:
+		err = cs.widenJobByReaction(job, r.WidenToNodeTags, trigger, span.Context())
+	case datatype.ReactionWebhook:
+		err = cs.webhooks.post(r.Webhook, trigger)
+	default:
+		err = fmt.Errorf("reaction must have exactly one of submitJob, widenToNodeTags, and webhook")
+	}
+	if err != nil {
+		span.SetError(err.Error())
+	}
+	return err
+}
+
+// reactionUser returns the owner of the job with the node permissions of the owner
+func (cs *CloudScheduler) reactionUser(userName string) (*User, error) {
+	user := &User{Auth: &UserAuth{UserName: userName}}
+	if err := cs.APIServer.authenticator.UpdatePermissionTableForUser(user); err != nil {
+		return nil, fmt.Errorf("failed to get permissions of user %q: %s", userName, err.Error())
+	}
+	return user, nil
+}
+
+// submitJobByReaction submits the job of the ID. A suspended job is resumed.
+// The job must be owned by the owner of the job that has the reaction
+func (cs *CloudScheduler) submitJobByReaction(job *datatype.Job, targetJobID string, trace tracing.SpanContext) error {
+	target, err := cs.GoalManager.GetJob(targetJobID)
+	if err != nil {
+		return err
+	}
+	if target.User != job.User {
+		return fmt.Errorf("job %q is not owned by %s", targetJobID, job.User)
+	}
+	switch target.State.GetState() {
+	case datatype.JobSubmitted, datatype.JobRunning:
+		csLog.With(target.LogFields()).Infof("job %q is already %s. no need to submit it", targetJobID, target.State.GetState())
+		return nil
+	case datatype.JobRemoved:
+		return fmt.Errorf("job %q is removed", targetJobID)
+	}
+	user, err := cs.reactionUser(job.User)
+	if err != nil {
+		return err
+	}
+	if errorList := cs.ValidateJobAndCreateScienceGoalForExistingJob(targetJobID, user, false, trace); len(errorList) > 0 {
+		return fmt.Errorf("failed to submit job %q: %v", targetJobID, errorList)
+	}
+	return nil
+}
+
+// widenJobByReaction adds nodes that have all of the tags and the owner can schedule
+// on to the job. The job is revised and submitted again if any node is added
+func (cs *CloudScheduler) widenJobByReaction(job *datatype.Job, tags []string, trigger *Trigger, trace tracing.SpanContext) error {
+	user, err := cs.reactionUser(job.User)
+	if err != nil {
+		return err
+	}
+	var added []string
+	for _, nodeName := range cs.Validator.GetNodeNamesByTags(tags) {
+		if _, exist := job.Nodes[nodeName]; exist {
+			continue
+		}
+		if ok, err := user.CanScheduleOnNode(nodeName); err != nil || !ok {
+			csLog.With(job.LogFields()).Infof("user %q cannot schedule on node %q. not widening job %q to it", job.User, nodeName, job.JobID)
+			continue
+		}
+		added = append(added, nodeName)
+	}
+	if len(added) < 1 {
+		csLog.With(job.LogFields()).Debugf("no new node has tags %v for job %q", tags, job.JobID)
+		return nil
+	}
+	sort.Strings(added)
+	job.AddNodes(added)
+	reason := fmt.Sprintf("widened to %s by trigger %q from %s", strings.Join(added, ", "), trigger.Name, trigger.Node)
+	if err := cs.GoalManager.ReviseJob(job, job.Revision, reactionAuthor, reason); err != nil {
+		return err
+	}
+	if errorList := cs.ValidateJobAndCreateScienceGoalForExistingJob(job.JobID, user, false, trace); len(errorList) > 0 {
+		return fmt.Errorf("failed to submit job %q widened to %v: %v", job.JobID, added, errorList)
+	}
+	return nil
+}
+
+// webhookPoster posts triggers to webhooks of reactions. Webhooks may call hosts
+// in allowedHosts only if given. Otherwise, they may call any host that does not
+// resolve to a loopback, private, or link-local address, so that jobs cannot reach
+// services inside the cluster through webhooks
+type webhookPoster struct {
+	allowedHosts map[string]bool
+	client       *http.Client
+	// slots limits webhooks in flight
+	slots chan struct{}
+}
+
+func newWebhookPoster(allowedHosts []string) *webhookPoster {
+	w := &webhookPoster{
+		allowedHosts: make(map[string]bool),
+		slots:        make(chan struct{}, maxWebhooksInFlight),
+	}
+	for _, host := range allowedHosts {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			w.allowedHosts[host] = true
+		}
+	}
+	w.client = &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext: w.dial,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return fmt.Errorf("stopped after %d redirects", len(via))
+			}
+			return w.checkURL(req.URL)
+		},
+	}
+	return w
+}
+
+// checkURL returns an error if webhooks may not call the URL
+func (w *webhookPoster) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("webhook %q must be an http or https URL", u.String())
+	}
+	if len(w.allowedHosts) > 0 && !w.allowedHosts[strings.ToLower(u.Hostname())] {
+		return fmt.Errorf("host %q of webhook is not allowed", u.Hostname())
+	}
+	return nil
+}
+
+// dial connects to the address. Addresses of hosts that are not allowed explicitly
+// are checked after they are resolved
+func (w *webhookPoster) dial(ctx context.Context, network string, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	if !w.allowedHosts[strings.ToLower(host)] {
+		dialer.Control = rejectInternalAddress
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// rejectInternalAddress returns an error if the resolved address is not a public address
+func rejectInternalAddress(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("webhook must not call internal address %s", host)
+	}
+	return nil
+}
+
+// post posts the trigger to the URL in the background. It fails if the URL is not
+// allowed or too many webhooks are in flight
+func (w *webhookPoster) post(rawURL string, trigger *Trigger) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid webhook %q: %s", rawURL, err.Error())
+	}
+	if err := w.checkURL(u); err != nil {
+		return err
+	}
+	select {
+	case w.slots <- struct{}{}:
+	default:
+		return fmt.Errorf("%d webhooks are already in flight", maxWebhooksInFlight)
+	}
+	go func() {
+		defer func() { <-w.slots }()
+		log := csLog.With(trigger.LogFields()).WithField("webhook", rawURL)
+		if err := w.send(rawURL, trigger); err != nil {
+			log.Errorf("Failed to call webhook for trigger %q: %s", trigger.Name, err.Error())
+		}
+	}()
+	return nil
+}
+
+// send posts the trigger in JSON to the URL
+func (w *webhookPoster) send(rawURL string, trigger *Trigger) error {
+	blob, err := json.Marshal(trigger)
+	if err != nil {
+		return fmt.Errorf("failed to encode trigger: %s", err.Error())
+	}
+	resp, err := w.client.Post(rawURL, "application/json", bytes.NewReader(blob))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
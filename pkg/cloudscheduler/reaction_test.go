@@ -0,0 +1,117 @@
+package cloudscheduler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
+	"github.com/waggle-sensor/edge-scheduler/pkg/tracing"
+)
+
+func TestHandleTrigger(t *testing.T) {
+	received := make(chan Trigger, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var trigger Trigger
+		if err := json.NewDecoder(r.Body).Decode(&trigger); err != nil {
+			t.Error(err)
+		}
+		received <- trigger
+	}))
+	defer server.Close()
+
+	cs := &CloudScheduler{
+		GoalManager: &CloudGoalManager{
+			scienceGoals: make(map[string]*datatype.ScienceGoal),
+			Notifier:     interfacing.NewNotifier(),
+			dataPath:     t.TempDir(),
+		},
+		Tracer:          tracing.NewTracer("cloudscheduler", nil),
+		reactionLastRun: make(map[string]time.Time),
+		webhooks:        newWebhookPoster([]string{"127.0.0.1"}),
+	}
+	if err := cs.GoalManager.OpenJobDB(); err != nil {
+		t.Fatal(err)
+	}
+	defer cs.GoalManager.jobDB.Close()
+
+	job := datatype.NewJob("flood", "theone", "")
+	job.ScienceRules = []string{"trigger(flood, level=high): v('env.water.level') > 3"}
+	job.Reactions = []*datatype.Reaction{
+		{On: "flood", Webhook: server.URL},
+		{On: "drought", Webhook: server.URL},
+	}
+	jobID := cs.GoalManager.AddJob(job)
+	job.UpdateJobID(jobID)
+	job.ScienceGoal = &datatype.ScienceGoal{ID: "goal-1", JobID: jobID}
+	if err := cs.GoalManager.UpdateJob(job, false); err != nil {
+		t.Fatal(err)
+	}
+
+	fire := func(goalID string) {
+		sent := datatype.NewSchedulerEventBuilder(datatype.EventTriggerFired).
+			AddGoal(&datatype.ScienceGoal{ID: goalID, JobID: jobID}).
+			AddEntry("job_id", jobID).
+			AddEntry("trigger_name", "flood").
+			AddEntry("trigger_params", map[string]string{"level": "high"}).
+			AddReason("triggered by v('env.water.level') > 3").
+			Build().(datatype.SchedulerEvent)
+		// the event goes through the message pipeline as nodes send it
+		builder, err := datatype.NewSchedulerEventBuilderFromWaggleMessage(sent.ToWaggleMessage())
+		if err != nil {
+			t.Fatal(err)
+		}
+		cs.handleTrigger(builder.AddEntry("vsn", "W001").Build().(datatype.SchedulerEvent))
+	}
+
+	fire("goal-1")
+	select {
+	case trigger := <-received:
+		if trigger.Name != "flood" || trigger.JobID != jobID || trigger.Node != "W001" || trigger.Params["level"] != "high" {
+			t.Errorf("unexpected trigger posted to the webhook: %+v", trigger)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not called")
+	}
+
+	// the reaction is cooling down, and triggers from old goals are ignored
+	fire("goal-1")
+	fire("goal-0")
+	select {
+	case trigger := <-received:
+		t.Errorf("webhook must not be called again, but got %+v", trigger)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestWebhookPoster(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	trigger := &Trigger{Name: "flood", JobID: "1"}
+
+	// webhooks must not call internal addresses unless their hosts are allowed
+	if err := newWebhookPoster(nil).send(server.URL, trigger); err == nil {
+		t.Errorf("wanted the webhook to loopback address %s refused", server.URL)
+	}
+	if err := newWebhookPoster([]string{"127.0.0.1"}).send(server.URL, trigger); err != nil {
+		t.Errorf("wanted the webhook to the allowed host called but got %s", err.Error())
+	}
+	allowed := newWebhookPoster([]string{"hooks.example.com"})
+	for _, u := range []string{"https://other.example.com/hook", "ftp://hooks.example.com/hook", server.URL} {
+		if err := allowed.post(u, trigger); err == nil {
+			t.Errorf("wanted webhook %s refused", u)
+		}
+	}
+
+	// webhooks fail while all slots are in flight
+	busy := newWebhookPoster([]string{"127.0.0.1"})
+	for i := 0; i < maxWebhooksInFlight; i++ {
+		busy.slots <- struct{}{}
+	}
+	if err := busy.post(server.URL, trigger); err == nil {
+		t.Errorf("wanted the webhook refused while %d webhooks are in flight", maxWebhooksInFlight)
+	}
+}
@@ -13,6 +13,8 @@ import (
 	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
 )
 
+var validatorLog = logger.New("validator")
+
 type JobValidator struct {
 	dataPath         string
 	pluginDBURL      string
@@ -48,7 +50,7 @@ func (jv *JobValidator) GetPluginManifest(pluginImage string, updateDBIfNotExist
 		if updateDBIfNotExist {
 			newP, err := jv.GetPluginManifestFromECR(pluginImage)
 			if err != nil {
-				logger.Error.Printf("failed to fetch plugin manifest: %s", err.Error())
+				validatorLog.Errorf("failed to fetch plugin manifest: %s", err.Error())
 				return nil
 			} else {
 				jv.Plugins[newP.ID] = *newP
@@ -60,16 +62,9 @@ func (jv *JobValidator) GetPluginManifest(pluginImage string, updateDBIfNotExist
 }
 
 // IsPluginNameValid checks if given plugin name is valid.
-// Plugin name must follow RFC 1123.
-// Reference: https://kubernetes.io/docs/concepts/overview/working-with-objects/names/#dns-subdomain-names
+// See datatype.IsPluginNameValid
 func (jv *JobValidator) IsPluginNameValid(name string) bool {
-	// the maximum length allowed is 256, but the scheduler may use several characters
-	// to indicate job ID when it names a plugin, thus reduce length of user plugins to 200
-	if len(name) > 200 {
-		return false
-	}
-	var validNamePattern = regexp.MustCompile("^[a-z0-9-]+$")
-	return validNamePattern.MatchString(name)
+	return datatype.IsPluginNameValid(name)
 }
 
 // LoadDatabase loads node and plugin manifests
@@ -87,13 +82,13 @@ func (jv *JobValidator) LoadDatabase() error {
 	// 	pluginFilePath := path.Join(jv.dataPath, "plugins", pluginFile.Name())
 	// 	raw, err := os.ReadFile(pluginFilePath)
 	// 	if err != nil {
-	// 		logger.Debug.Printf("Failed to read %s:%s", pluginFilePath, err.Error())
+	// 		validatorLog.Debugf("Failed to read %s:%s", pluginFilePath, err.Error())
 	// 		continue
 	// 	}
 	// 	var p datatype.PluginManifest
 	// 	err = json.Unmarshal(raw, &p)
 	// 	if err != nil {
-	// 		logger.Debug.Printf("Failed to parse %s:%s", pluginFilePath, err.Error())
+	// 		validatorLog.Debugf("Failed to parse %s:%s", pluginFilePath, err.Error())
 	// 		continue
 	// 	}
 	// 	jv.Plugins[p.ID] = &p
@@ -137,13 +132,13 @@ func (jv *JobValidator) LoadDatabase() error {
 	// 	nodeFilePath := path.Join(jv.dataPath, "nodes", nodeFile.Name())
 	// 	raw, err := os.ReadFile(nodeFilePath)
 	// 	if err != nil {
-	// 		logger.Debug.Printf("Failed to read %s:%s", nodeFilePath, err.Error())
+	// 		validatorLog.Debugf("Failed to read %s:%s", nodeFilePath, err.Error())
 	// 		continue
 	// 	}
 	// 	var n datatype.NodeManifest
 	// 	err = json.Unmarshal(raw, &n)
 	// 	if err != nil {
-	// 		logger.Debug.Printf("Failed to parse %s:%s", nodeFilePath, err.Error())
+	// 		validatorLog.Debugf("Failed to parse %s:%s", nodeFilePath, err.Error())
 	// 		continue
 	// 	}
 	// 	jv.Nodes[n.Name] = &n
@@ -181,7 +176,7 @@ func (jv *JobValidator) LoadPluginWhitelist() {
 			jv.AddPluginWhitelist(fileScanner.Text())
 		}
 	} else {
-		logger.Error.Printf("failed to create or open %q: %s", whitelistFilePath, err.Error())
+		validatorLog.Errorf("failed to create or open %q: %s", whitelistFilePath, err.Error())
 	}
 }
 
@@ -220,7 +215,7 @@ func (jv *JobValidator) WritePluginWhitelist() {
 			file.WriteString(whitelist + "\n")
 		}
 	} else {
-		logger.Error.Printf("failed to create or open %q: %s", whitelistFilePath, err.Error())
+		validatorLog.Errorf("failed to create or open %q: %s", whitelistFilePath, err.Error())
 	}
 }
 
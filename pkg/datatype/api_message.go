@@ -31,6 +31,14 @@ func (builder *APIMessageBuilder) AddError(reason string) *APIMessageBuilder {
 	return builder
 }
 
+// AddErrorList adds the errors as a single error message as well as
+// a list of structured errors with field paths and codes
+func (builder *APIMessageBuilder) AddErrorList(errorList []error) *APIMessageBuilder {
+	builder.AddError(fmt.Sprintf("%v", errorList))
+	builder.AddEntity("errors", ToValidationErrors(errorList))
+	return builder
+}
+
 func (builder *APIMessageBuilder) AddEntity(key string, value interface{}) *APIMessageBuilder {
 	builder.message.body[key] = value
 	return builder
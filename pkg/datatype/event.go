@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+	"github.com/waggle-sensor/edge-scheduler/pkg/tracing"
 	batchv1 "k8s.io/api/batch/v1"
 	apiv1 "k8s.io/api/core/v1"
 )
@@ -51,6 +52,29 @@ func (s *SchedulerEventBuilder) AddJob(j *Job) *SchedulerEventBuilder {
 func (s *SchedulerEventBuilder) AddGoal(goal *ScienceGoal) *SchedulerEventBuilder {
 	s.e.Meta["goal_name"] = goal.Name
 	s.e.Meta["goal_id"] = goal.ID
+	if goal.TraceID != "" {
+		s.e.Meta["trace_id"] = goal.TraceID
+		s.e.Meta["span_id"] = goal.SpanID
+	}
+	return s
+}
+
+// AddSpan adds the trace context of the span. A finished span is also added
+// as a whole so that the receiver can show it in the trace
+func (s *SchedulerEventBuilder) AddSpan(span *tracing.Span) *SchedulerEventBuilder {
+	if span == nil {
+		return s
+	}
+	s.e.Meta["trace_id"] = span.TraceID
+	s.e.Meta["span_id"] = span.SpanID
+	if span.ParentSpanID != "" {
+		s.e.Meta["parent_span_id"] = span.ParentSpanID
+	}
+	if span.Ended() {
+		if blob, err := tracing.EncodeSpan(span); err == nil {
+			s.e.Meta["trace_span"] = blob
+		}
+	}
 	return s
 }
 
@@ -61,6 +85,12 @@ func (s *SchedulerEventBuilder) AddEntry(k string, v interface{}) *SchedulerEven
 
 func (s *SchedulerEventBuilder) AddPluginRuntimeMeta(pr PluginRuntime) *SchedulerEventBuilder {
 	s.e.Meta["pluginruntime_pod_instance"] = pr.PodInstance
+	if pr.Span != nil {
+		s.AddSpan(pr.Span)
+	} else if pr.TraceID != "" {
+		s.e.Meta["trace_id"] = pr.TraceID
+		s.e.Meta["span_id"] = pr.ParentSpanID
+	}
 	return s
 }
 
@@ -135,6 +165,19 @@ func (e *SchedulerEvent) GetReason() string {
 	return e.get("reason").(string)
 }
 
+// GetTraceSpan returns the span carried in the event, if any
+func (e *SchedulerEvent) GetTraceSpan() (*tracing.Span, bool) {
+	blob, ok := e.get("trace_span").(string)
+	if !ok || blob == "" {
+		return nil, false
+	}
+	span, err := tracing.DecodeSpan(blob)
+	if err != nil {
+		return nil, false
+	}
+	return span, true
+}
+
 func (e *SchedulerEvent) GetEntry(k string) interface{} {
 	return e.get(k)
 }
@@ -192,6 +235,7 @@ const (
 	EventRabbitMQSubscriptionPatternAll     string = "sys.scheduler.#"
 	EventRabbitMQSubscriptionPatternGoals   string = "sys.scheduler.status.goal.#"
 	EventRabbitMQSubscriptionPatternPlugins string = "sys.scheduler.status.plugin.#"
+	EventRabbitMQSubscriptionPatternTrigger string = "sys.scheduler.trigger.#"
 	// EventSchedulingDecisionScheduled EventType = "sys.scheduler.decision.scheduled"
 	EventJobStatusSuspended     EventType = "sys.scheduler.status.job.suspended"
 	EventJobStatusRemoved       EventType = "sys.scheduler.status.job.removed"
@@ -203,6 +247,7 @@ const (
 
 	EventPluginStatusQueued       EventType = "sys.scheduler.status.plugin.queued"
 	EventPluginStatusSelected     EventType = "sys.scheduler.status.plugin.selected"
+	EventPluginStatusThrottled    EventType = "sys.scheduler.status.plugin.throttled"
 	EventPluginStatusScheduled    EventType = "sys.scheduler.status.plugin.scheduled"
 	EventPluginStatusInitializing EventType = "sys.scheduler.status.plugin.initializing"
 	EventPluginStatusRunning      EventType = "sys.scheduler.status.plugin.running"
@@ -210,8 +255,14 @@ const (
 	EventPluginLastExecution      EventType = "sys.scheduler.plugin.lastexecution"
 	EventPluginStatusFailed       EventType = "sys.scheduler.status.plugin.failed"
 	EventPluginStatusEvent        EventType = "sys.scheduler.status.plugin.event"
+	EventPluginStatusStopped      EventType = "sys.scheduler.status.plugin.stopped"
+	EventPluginStatusSuspended    EventType = "sys.scheduler.status.plugin.suspended"
+	EventPluginStatusResumed      EventType = "sys.scheduler.status.plugin.resumed"
 	EventFailure                  EventType = "sys.scheduler.failure"
 
+	// EventTriggerFired is sent to the cloud scheduler by trigger() rules
+	EventTriggerFired EventType = "sys.scheduler.trigger.fired"
+
 	// Deprecated: use EventPluginStatusScheduled instead
 	EventPluginStatusLaunched EventType = "sys.scheduler.status.plugin.launched"
 
@@ -3,6 +3,8 @@ package datatype
 import (
 	"reflect"
 	"testing"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/tracing"
 )
 
 func TestEventWaggleConversion(t *testing.T) {
@@ -42,3 +44,34 @@ func TestEventWaggleConversion(t *testing.T) {
 		}
 	}
 }
+
+func TestEventTraceSpan(t *testing.T) {
+	tracer := tracing.NewTracer("nodescheduler", nil)
+	pr := NewPluginRuntime(Plugin{Name: "a"})
+	pr.TraceID = tracing.NewTraceID()
+	pr.ParentSpanID = tracing.NewSpanID()
+	pr.Span = tracer.StartSpan("plugin.run", pr.TraceContext())
+
+	running := NewSchedulerEventBuilder(EventPluginStatusRunning).AddPluginRuntimeMeta(*pr).Build().(SchedulerEvent)
+	if running.GetEntry("trace_id") != pr.TraceID || running.GetEntry("parent_span_id") != pr.ParentSpanID {
+		t.Errorf("expected the event in trace %s under %s, but got %v", pr.TraceID, pr.ParentSpanID, running.Meta)
+	}
+	if _, found := running.GetTraceSpan(); found {
+		t.Errorf("expected no span in the event while the plugin runs")
+	}
+
+	pr.Span.Finish()
+	complete := NewSchedulerEventBuilder(EventPluginStatusComplete).AddPluginRuntimeMeta(*pr).Build().(SchedulerEvent)
+	builder, err := NewSchedulerEventBuilderFromWaggleMessage(complete.ToWaggleMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := builder.Build().(SchedulerEvent)
+	span, found := received.GetTraceSpan()
+	if !found {
+		t.Fatalf("expected the span in the event, but got %v", received.Meta)
+	}
+	if span.SpanID != pr.Span.SpanID || span.ParentSpanID != pr.ParentSpanID || span.Name != "plugin.run" {
+		t.Errorf("unexpected span in the event: %+v", span)
+	}
+}
@@ -3,9 +3,12 @@ package datatype
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"strings"
 	"time"
 
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
 	"gopkg.in/yaml.v2"
 )
 
@@ -84,8 +87,20 @@ type Job struct {
 	Nodes           map[string]interface{} `json:"nodes" yaml:"nodes"`
 	ScienceRules    []string               `json:"science_rules" yaml:"scienceRules"`
 	SuccessCriteria []string               `json:"success_criteria" yaml:"successCriteria"`
+	Reactions       []*Reaction            `json:"reactions,omitempty" yaml:"reactions,omitempty"`
+	MaxConcurrency  int                    `json:"max_concurrency,omitempty" yaml:"maxConcurrency,omitempty"`
 	ScienceGoal     *ScienceGoal           `json:"science_goal,omitempty" yaml:"scienceGoal,omitempty"`
 	State           State                  `json:"state,omitempty" yaml:"state,omitempty"`
+	// Revision increases every time the job description is edited
+	Revision int `json:"revision,omitempty" yaml:"revision,omitempty"`
+}
+
+// LogFields returns fields identifying the job in logs
+func (j *Job) LogFields() logger.Fields {
+	return logger.Fields{
+		"job_id": j.JobID,
+		"user":   j.User,
+	}
 }
 
 func NewJob(name string, user string, jobID string) *Job {
@@ -180,9 +195,91 @@ func (j *Job) ConvertToTemplate() (template Job) {
 	}
 	successCriteria := j.SuccessCriteria
 	template.SuccessCriteria = successCriteria
+	for _, reaction := range j.Reactions {
+		r := *reaction
+		template.Reactions = append(template.Reactions, &r)
+	}
+	return
+}
+
+// EditableSpec returns the part of the job description that its owner can edit. Unlike
+// ConvertToTemplate, it keeps the notification and concurrency settings of the job
+func (j *Job) EditableSpec() (spec Job) {
+	spec = j.ConvertToTemplate()
+	spec.Email = j.Email
+	spec.NotificationOn = append([]JobState(nil), j.NotificationOn...)
+	spec.MaxConcurrency = j.MaxConcurrency
 	return
 }
 
+// JobRevision is an immutable snapshot of the description of a job. A new revision
+// is made when the job is created, edited, or rolled back
+type JobRevision struct {
+	JobID     string `json:"job_id" yaml:"jobID"`
+	Revision  int    `json:"revision" yaml:"revision"`
+	Author    string `json:"author,omitempty" yaml:"author,omitempty"`
+	Reason    string `json:"reason,omitempty" yaml:"reason,omitempty"`
+	CreatedAt Time   `json:"created_at" yaml:"createdAt"`
+	Spec      Job    `json:"spec" yaml:"spec"`
+	// ScienceGoals lists IDs of the science goals made by submitting the revision
+	ScienceGoals []string `json:"science_goals,omitempty" yaml:"scienceGoals,omitempty"`
+}
+
+// NewJobRevision returns a revision of the current description of the job
+func NewJobRevision(j *Job, author string, reason string) *JobRevision {
+	spec := *j
+	spec.ScienceGoal = nil
+	spec.State = State{}
+	spec.Revision = 0
+	spec.Plugins = nil
+	for _, plugin := range j.Plugins {
+		p := *plugin
+		p.GoalID = ""
+		spec.Plugins = append(spec.Plugins, &p)
+	}
+	spec.Nodes = make(map[string]interface{})
+	for k, v := range j.Nodes {
+		spec.Nodes[k] = v
+	}
+	return &JobRevision{
+		JobID:     j.JobID,
+		Revision:  j.Revision,
+		Author:    author,
+		Reason:    reason,
+		CreatedAt: Time{time.Now().UTC()},
+		Spec:      spec,
+	}
+}
+
+// RollbackTo replaces the description of the job with the one in the revision.
+// The job keeps its ID, owner, and state
+func (j *Job) RollbackTo(r *JobRevision) {
+	// copies plugins and nodes of the revision
+	spec := NewJobRevision(&r.Spec, "", "").Spec
+	spec.JobID, spec.User, spec.State, spec.Revision = j.JobID, j.User, j.State, j.Revision
+	*j = spec
+}
+
+// DiffJobDescription returns a unified diff between descriptions of the jobs in YAML.
+// It returns an empty string if the descriptions are the same
+func DiffJobDescription(oldJob *Job, newJob *Job) (string, error) {
+	oldBlob, err := yaml.Marshal(oldJob.EditableSpec())
+	if err != nil {
+		return "", fmt.Errorf("failed to encode job %q: %s", oldJob.JobID, err.Error())
+	}
+	newBlob, err := yaml.Marshal(newJob.EditableSpec())
+	if err != nil {
+		return "", fmt.Errorf("failed to encode job %q: %s", newJob.JobID, err.Error())
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(oldBlob)),
+		B:        difflib.SplitLines(string(newBlob)),
+		FromFile: fmt.Sprintf("revision %d", oldJob.Revision),
+		ToFile:   "edited",
+		Context:  3,
+	})
+}
+
 // EncodeToJson returns encoded json of the job.
 func (j *Job) EncodeToJson() ([]byte, error) {
 	bf := bytes.NewBuffer([]byte{})
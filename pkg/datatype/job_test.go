@@ -0,0 +1,55 @@
+package datatype
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestDiffJobDescription(t *testing.T) {
+	oldJob := NewJob("mynewjob", "theone", "1")
+	oldJob.Revision = 2
+	oldJob.NodeTags = []string{"lake"}
+	oldJob.ScienceRules = []string{"schedule(imagesampler-top): cronjob('imagesampler-top', '* * * * *')"}
+	oldJob.SetNotification("theone@example.com", []JobState{JobComplete})
+	oldJob.MaxConcurrency = 2
+	// the template of a job should be editable and read back as is
+	blob, err := yaml.Marshal(oldJob.EditableSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var newJob Job
+	if err := yaml.UnmarshalStrict(blob, &newJob); err != nil {
+		t.Fatal(err)
+	}
+	diff, err := DiffJobDescription(oldJob, &newJob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != "" {
+		t.Errorf("expected no difference, but got %q", diff)
+	}
+	// settings of the job are part of the description
+	concurrencyEdited := newJob
+	concurrencyEdited.MaxConcurrency = 4
+	diff, err = DiffJobDescription(oldJob, &concurrencyEdited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"-maxConcurrency: 2", "+maxConcurrency: 4"} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("expected %q in the diff, but got %q", want, diff)
+		}
+	}
+	newJob.NodeTags = []string{"forest"}
+	diff, err = DiffJobDescription(oldJob, &newJob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"--- revision 2", "-- lake", "+- forest"} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("expected %q in the diff, but got %q", want, diff)
+		}
+	}
+}
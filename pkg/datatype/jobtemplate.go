@@ -0,0 +1,196 @@
+package datatype
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// templateVariable matches a placeholder of a variable in job templates, e.g. ${THRESHOLD}
+var templateVariable = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// notVariableChar matches characters that cannot be in names of variables
+var notVariableChar = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// JobTemplate is a named job description with ${VAR} placeholders that can be
+// instantiated to jobs. Placeholders can be used in the job name, plugin args,
+// plugin env values, node tags, and science rules.
+type JobTemplate struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	User        string `json:"user,omitempty" yaml:"user,omitempty"`
+	// Public templates are visible to all users. Others are visible only to the owner
+	Public bool `json:"public,omitempty" yaml:"public,omitempty"`
+	// Variables holds default values of variables. Variables without a default
+	// must be set when the template is instantiated
+	Variables map[string]string `json:"variables,omitempty" yaml:"variables,omitempty"`
+	Job       Job               `json:"job" yaml:"job"`
+}
+
+// NewJobTemplateFromJob returns a template of the job description. Env values of
+// plugins may be secrets, so they are not copied. Each becomes a variable named
+// after the env, e.g. ${API_KEY}, that must be given when the template is instantiated
+func NewJobTemplateFromJob(name string, user string, j *Job) *JobTemplate {
+	job := j.ConvertToTemplate()
+	for _, p := range job.Plugins {
+		if p.PluginSpec == nil || len(p.PluginSpec.Env) == 0 {
+			continue
+		}
+		spec := *p.PluginSpec
+		spec.Env = make(map[string]string)
+		for k := range p.PluginSpec.Env {
+			spec.Env[k] = "${" + templateVariableName(k) + "}"
+		}
+		p.PluginSpec = &spec
+	}
+	return &JobTemplate{
+		Name: name,
+		User: user,
+		Job:  job,
+	}
+}
+
+// templateVariableName returns the name as a name of variables, e.g. my-key becomes my_key
+func templateVariableName(name string) string {
+	name = notVariableChar.ReplaceAllString(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// VisibleTo returns true if the user can see and instantiate the template
+func (t *JobTemplate) VisibleTo(user string) bool {
+	return t.Public || t.User == user
+}
+
+// mapTemplateFields replaces the fields that may have placeholders with what f returns
+func mapTemplateFields(j *Job, f func(string) string) {
+	j.Name = f(j.Name)
+	for _, p := range j.Plugins {
+		if p.PluginSpec == nil {
+			continue
+		}
+		for i, arg := range p.PluginSpec.Args {
+			p.PluginSpec.Args[i] = f(arg)
+		}
+		for k, v := range p.PluginSpec.Env {
+			p.PluginSpec.Env[k] = f(v)
+		}
+	}
+	for i, tag := range j.NodeTags {
+		j.NodeTags[i] = f(tag)
+	}
+	for i, rule := range j.ScienceRules {
+		j.ScienceRules[i] = f(rule)
+	}
+}
+
+// GetVariables returns the sorted names of variables used in the template
+func (t *JobTemplate) GetVariables() (names []string) {
+	found := make(map[string]bool)
+	// the job is copied as mapTemplateFields writes back to the fields
+	j, err := t.copyJob()
+	if err != nil {
+		return
+	}
+	mapTemplateFields(j, func(s string) string {
+		for _, m := range templateVariable.FindAllStringSubmatch(s, -1) {
+			found[m[1]] = true
+		}
+		return s
+	})
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// Validate checks that the template has a name and that defaults are given only
+// for variables used in the template
+func (t *JobTemplate) Validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("template name is required")
+	}
+	used := make(map[string]bool)
+	for _, name := range t.GetVariables() {
+		used[name] = true
+	}
+	for name := range t.Variables {
+		if !used[name] {
+			return fmt.Errorf("variable %q has a default value but is not used in the template", name)
+		}
+	}
+	return nil
+}
+
+// Instantiate returns a new job with the placeholders replaced by values.
+// Values not given fall back to the defaults of the template. It returns an error
+// if a value is given for an unknown variable or a variable has no value
+func (t *JobTemplate) Instantiate(values map[string]string) (*Job, error) {
+	variables := t.GetVariables()
+	merged := make(map[string]string)
+	known := make(map[string]bool)
+	for _, name := range variables {
+		known[name] = true
+		if v, exist := t.Variables[name]; exist {
+			merged[name] = v
+		}
+	}
+	for name, v := range values {
+		if !known[name] {
+			return nil, fmt.Errorf("template %q does not have variable %q", t.Name, name)
+		}
+		merged[name] = v
+	}
+	var missing []string
+	for _, name := range variables {
+		if _, exist := merged[name]; !exist {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("no value given for variables of template %q: %s", t.Name, strings.Join(missing, ", "))
+	}
+	j, err := t.copyJob()
+	if err != nil {
+		return nil, err
+	}
+	mapTemplateFields(j, func(s string) string {
+		return templateVariable.ReplaceAllStringFunc(s, func(placeholder string) string {
+			return merged[templateVariable.FindStringSubmatch(placeholder)[1]]
+		})
+	})
+	if j.Nodes == nil {
+		j.Nodes = make(map[string]interface{})
+	}
+	return j, nil
+}
+
+func (t *JobTemplate) copyJob() (*Job, error) {
+	blob, err := json.Marshal(&t.Job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy job of template %q: %s", t.Name, err.Error())
+	}
+	var j Job
+	if err := json.Unmarshal(blob, &j); err != nil {
+		return nil, fmt.Errorf("failed to copy job of template %q: %s", t.Name, err.Error())
+	}
+	return &j, nil
+}
+
+// ParseTemplateValues parses VAR=VALUE pairs, e.g. from the command line
+func ParseTemplateValues(pairs []string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, pair := range pairs {
+		sp := strings.SplitN(pair, "=", 2)
+		if len(sp) != 2 || sp[0] == "" {
+			return nil, fmt.Errorf("%q is not in the form of VAR=VALUE", pair)
+		}
+		values[sp[0]] = sp[1]
+	}
+	return values, nil
+}
@@ -0,0 +1,152 @@
+package datatype
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+const testJobTemplate = `
+name: camera-pipeline
+variables:
+  THRESHOLD: "0.5"
+job:
+  name: camera-${SITE}
+  plugins:
+  - name: object-counter
+    pluginSpec:
+      image: registry.sagecontinuum.org/yonghokim/object-counter:0.5.1
+      args:
+      - -threshold
+      - ${THRESHOLD}
+      env:
+        SITE: ${SITE}
+  nodeTags:
+  - ${SITE}
+  scienceRules:
+  - "schedule(object-counter): cronjob('object-counter', '*/${MINUTES} * * * *')"
+`
+
+func TestJobTemplate(t *testing.T) {
+	var template JobTemplate
+	if err := yaml.Unmarshal([]byte(testJobTemplate), &template); err != nil {
+		t.Fatal(err)
+	}
+	if err := template.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := template.GetVariables(), []string{"MINUTES", "SITE", "THRESHOLD"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected variables %v, but got %v", want, got)
+	}
+	tests := map[string]struct {
+		Values      map[string]string
+		ShouldFail  bool
+		WantName    string
+		WantArgs    []string
+		WantTags    []string
+		WantRule    string
+		WantSiteEnv string
+	}{
+		"default": {
+			Values:      map[string]string{"SITE": "lake", "MINUTES": "5"},
+			WantName:    "camera-lake",
+			WantArgs:    []string{"-threshold", "0.5"},
+			WantTags:    []string{"lake"},
+			WantRule:    "schedule(object-counter): cronjob('object-counter', '*/5 * * * *')",
+			WantSiteEnv: "lake",
+		},
+		"override default": {
+			Values:      map[string]string{"SITE": "forest", "MINUTES": "10", "THRESHOLD": "0.8"},
+			WantName:    "camera-forest",
+			WantArgs:    []string{"-threshold", "0.8"},
+			WantTags:    []string{"forest"},
+			WantRule:    "schedule(object-counter): cronjob('object-counter', '*/10 * * * *')",
+			WantSiteEnv: "forest",
+		},
+		"missing variable": {
+			Values:     map[string]string{"SITE": "lake"},
+			ShouldFail: true,
+		},
+		"unknown variable": {
+			Values:     map[string]string{"SITE": "lake", "MINUTES": "5", "SIET": "lake"},
+			ShouldFail: true,
+		},
+	}
+	for name, test := range tests {
+		j, err := template.Instantiate(test.Values)
+		if test.ShouldFail {
+			if err == nil {
+				t.Errorf("%s: expected an error, but got none", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", name, err.Error())
+			continue
+		}
+		if j.Name != test.WantName {
+			t.Errorf("%s: expected name %q, but got %q", name, test.WantName, j.Name)
+		}
+		if !reflect.DeepEqual(j.Plugins[0].PluginSpec.Args, test.WantArgs) {
+			t.Errorf("%s: expected args %v, but got %v", name, test.WantArgs, j.Plugins[0].PluginSpec.Args)
+		}
+		if j.Plugins[0].PluginSpec.Env["SITE"] != test.WantSiteEnv {
+			t.Errorf("%s: expected env SITE=%q, but got %q", name, test.WantSiteEnv, j.Plugins[0].PluginSpec.Env["SITE"])
+		}
+		if !reflect.DeepEqual(j.NodeTags, test.WantTags) {
+			t.Errorf("%s: expected node tags %v, but got %v", name, test.WantTags, j.NodeTags)
+		}
+		if j.ScienceRules[0] != test.WantRule {
+			t.Errorf("%s: expected science rule %q, but got %q", name, test.WantRule, j.ScienceRules[0])
+		}
+	}
+	// instantiation does not change the template
+	if template.Job.Name != "camera-${SITE}" || template.Job.Plugins[0].PluginSpec.Args[1] != "${THRESHOLD}" {
+		t.Errorf("expected the template unchanged, but got %+v", template.Job)
+	}
+
+	template.Variables["UNUSED"] = "1"
+	if err := template.Validate(); err == nil {
+		t.Errorf("expected an error for a default of an unused variable")
+	}
+}
+
+func TestParseTemplateValues(t *testing.T) {
+	values, err := ParseTemplateValues([]string{"SITE=lake", "EXPR=a=b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"SITE": "lake", "EXPR": "a=b"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("expected %v, but got %v", want, values)
+	}
+	if _, err := ParseTemplateValues([]string{"SITE"}); err == nil {
+		t.Errorf("expected an error for a value without =")
+	}
+}
+
+func TestNewJobTemplateFromJob(t *testing.T) {
+	job := NewJob("camera", "theone", "")
+	job.Plugins = []*Plugin{{Name: "object-counter", PluginSpec: &PluginSpec{
+		Image: "registry.sagecontinuum.org/yonghokim/object-counter:0.5.1",
+		Env:   map[string]string{"API_KEY": "secret", "my-token": "secret"},
+	}}}
+	template := NewJobTemplateFromJob("camera-pipeline", "theone", job)
+	want := map[string]string{"API_KEY": "${API_KEY}", "my-token": "${my_token}"}
+	if got := template.Job.Plugins[0].PluginSpec.Env; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected env %v, but got %v", want, got)
+	}
+	if got := job.Plugins[0].PluginSpec.Env["API_KEY"]; got != "secret" {
+		t.Errorf("expected env of the job unchanged, but got %q", got)
+	}
+	if got, want := template.GetVariables(), []string{"API_KEY", "my_token"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected variables %v, but got %v", want, got)
+	}
+	if template.Public || !template.VisibleTo("theone") || template.VisibleTo("other") {
+		t.Errorf("expected the template visible only to the owner")
+	}
+	template.Public = true
+	if !template.VisibleTo("other") {
+		t.Errorf("expected the public template visible to other users")
+	}
+}
@@ -118,6 +118,15 @@ type ComputeHardwareManifest struct {
 	SharedRam    bool     `json:"shared_ram" yaml:"sharedRam"`
 }
 
+// GetGPUMemory returns the memory that GPU of the hardware can use.
+// When GPU shares RAM with CPU and GPU RAM is not given, CPU RAM is returned.
+func (c *ComputeHardwareManifest) GetGPUMemory() string {
+	if c.GPURAM == "" && c.SharedRam {
+		return c.CPURAM
+	}
+	return c.GPURAM
+}
+
 // GetArchitecture returns architecture of the hardware.
 // Capabilities should have one of arm64,amd64,armv7
 func (c *ComputeHardwareManifest) GetArchitecture() string {
@@ -9,6 +9,8 @@ import (
 	"time"
 
 	"github.com/looplab/fsm"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+	"github.com/waggle-sensor/edge-scheduler/pkg/tracing"
 )
 
 const (
@@ -21,6 +23,12 @@ type Plugin struct {
 	PluginSpec *PluginSpec `json:"plugin_spec" yaml:"pluginSpec,omitempty"`
 	GoalID     string      `json:"goal_id,omitempty" yaml:"goalID,omitempty"`
 	JobID      string      `json:"job_id,omitempty" yaml:"jobID,omitempty"`
+	// MaxConcurrency limits the number of instances of the plugin image running at the same time on a node.
+	// 0 means no limit
+	MaxConcurrency int `json:"max_concurrency,omitempty" yaml:"maxConcurrency,omitempty"`
+	// Priority is used by the priority scorer of the scheduling policy chain.
+	// Plugins with higher priority are preferred
+	Priority int `json:"priority,omitempty" yaml:"priority,omitempty"`
 }
 
 func (p *Plugin) GetPluginImage() (string, error) {
@@ -41,7 +49,16 @@ type PluginSpec struct {
 	Env         map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
 	DevelopMode bool              `json:"develop,omitempty" yaml:"develop,omitempty"`
 	Resource    map[string]string `json:"resource,omitempty" yaml:"resource,omitempty"`
-	Volume      map[string]string `json:"volume,omitempty" yaml:"volume,omitempty`
+	Volume      map[string]string `json:"volume,omitempty" yaml:"volume,omitempty"`
+}
+
+// LogFields returns fields identifying the plugin in logs
+func (p *Plugin) LogFields() logger.Fields {
+	return logger.Fields{
+		"job_id":  p.JobID,
+		"goal_id": p.GoalID,
+		"plugin":  p.Name,
+	}
 }
 
 func (ps *PluginSpec) GetImageTag() (string, error) {
@@ -80,11 +97,21 @@ const (
 	Stoppable ContextStatus = "Stoppable"
 )
 
-// EventPluginContext structs a message about plugin context change
+// EventPluginContext structs a message about plugin context change. Running plugins
+// send it to control themselves,
+//
+// - Stoppable stops the plugin as it is done
+//
+// - Runnable with RunAfter queues the plugin again after the duration
+//
+// - Runnable without RunAfter keeps the plugin running against stop() and suspend() rules
 type EventPluginContext struct {
 	GoalID     string        `json:"goal_id"`
 	PluginName string        `json:"plugin_name"`
 	Status     ContextStatus `json:"status"`
+	// PodUID is the Pod of the plugin that sent the event. Plugins know it as WAGGLE_APP_ID
+	PodUID   string        `json:"pod_uid,omitempty"`
+	RunAfter time.Duration `json:"run_after,omitempty"`
 }
 
 // PluginState is a label of Plugin state
@@ -136,8 +163,28 @@ type PluginRuntime struct {
 	PodUID                 string
 	Status                 *fsm.FSM
 	PodInstance            string
+	QueuedAt               time.Time
+	// TraceID and ParentSpanID are of the trace the plugin runs in. Span traces
+	// the current run of the plugin
+	TraceID      string
+	ParentSpanID string
+	Span         *tracing.Span
+	// Suspended keeps schedule() rules from queuing the plugin until it is resumed
+	Suspended bool
+	// StopReason is set when the scheduler terminates the plugin on purpose,
+	// e.g. by a stop() rule, so that the removal of its Pod is not a failure
+	StopReason string
+	// KeepRunning is set when the plugin asks to keep running. stop() and suspend()
+	// rules do not terminate the current run
+	KeepRunning bool
+	// RunRequestedAt is when the plugin asked to be queued again. It is zero if not asked
+	RunRequestedAt time.Time
+	stateObservers []StateObserver
 }
 
+// StateObserver is called after a PluginRuntime transitions from one state to another
+type StateObserver func(pr *PluginRuntime, from string, to string)
+
 func NewPluginRuntime(p Plugin) *PluginRuntime {
 	pr := &PluginRuntime{
 		Plugin: p,
@@ -193,6 +240,15 @@ func NewPluginRuntimeWithScienceRule(p Plugin, runtimeArgs ScienceRule) *PluginR
 	return pr
 }
 
+// LogFields returns fields identifying the plugin and its instance in logs
+func (pr *PluginRuntime) LogFields() logger.Fields {
+	fields := pr.Plugin.LogFields()
+	if pr.PodInstance != "" {
+		fields["instance"] = pr.PodInstance
+	}
+	return fields
+}
+
 func (pr *PluginRuntime) SetPluginController(flag bool) {
 	pr.EnablePluginController = flag
 }
@@ -229,32 +285,78 @@ func (pr *PluginRuntime) SetPodUID(UID string) {
 	pr.PodUID = UID
 }
 
+// SetStateObserver sets the observer that gets notified on state transitions,
+// replacing any observer added before
+func (pr *PluginRuntime) SetStateObserver(o StateObserver) {
+	pr.stateObservers = []StateObserver{o}
+}
+
+// AddStateObserver adds an observer that gets notified on state transitions.
+// Observers are called in the order they are added
+func (pr *PluginRuntime) AddStateObserver(o StateObserver) {
+	pr.stateObservers = append(pr.stateObservers, o)
+}
+
+// TraceContext returns the context to start the span of a plugin run from
+func (pr *PluginRuntime) TraceContext() tracing.SpanContext {
+	return tracing.SpanContext{TraceID: pr.TraceID, SpanID: pr.ParentSpanID}
+}
+
+func (pr *PluginRuntime) transition(s PluginState) error {
+	from := pr.Status.Current()
+	if err := pr.Status.Event(context.Background(), string(s)); err != nil {
+		return err
+	}
+	for _, o := range pr.stateObservers {
+		o(pr, from, string(s))
+	}
+	return nil
+}
+
 func (pr *PluginRuntime) Inactive() error {
-	return pr.Status.Event(context.Background(), string(Inactive))
+	if err := pr.transition(Inactive); err != nil {
+		return err
+	}
+	// asking to keep running lasts for the run
+	pr.KeepRunning = false
+	return nil
+}
+
+// IsRunRequested returns true if the plugin asked to be queued again by now, and
+// it is inactive and not suspended
+func (pr *PluginRuntime) IsRunRequested(now time.Time) bool {
+	return !pr.RunRequestedAt.IsZero() &&
+		!now.Before(pr.RunRequestedAt) &&
+		pr.Status.Is(string(Inactive)) &&
+		!pr.Suspended
 }
 
 func (pr *PluginRuntime) Queued() error {
-	return pr.Status.Event(context.Background(), string(Queued))
+	if err := pr.transition(Queued); err != nil {
+		return err
+	}
+	pr.QueuedAt = time.Now()
+	return nil
 }
 
 func (pr *PluginRuntime) Scheduled() error {
-	return pr.Status.Event(context.Background(), string(Scheduled))
+	return pr.transition(Scheduled)
 }
 
 func (pr *PluginRuntime) Initializing() error {
-	return pr.Status.Event(context.Background(), string(Initializing))
+	return pr.transition(Initializing)
 }
 
 func (pr *PluginRuntime) Running() error {
-	return pr.Status.Event(context.Background(), string(Running))
+	return pr.transition(Running)
 }
 
 func (pr *PluginRuntime) Completed() error {
-	return pr.Status.Event(context.Background(), string(Completed))
+	return pr.transition(Completed)
 }
 
 func (pr *PluginRuntime) Failed() error {
-	return pr.Status.Event(context.Background(), string(Failed))
+	return pr.transition(Failed)
 }
 
 // type Plugin struct {
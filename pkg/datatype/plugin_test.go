@@ -0,0 +1,35 @@
+package datatype
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPluginRuntimeRunRequested(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	pr := NewPluginRuntime(Plugin{Name: "sampler"})
+	if pr.IsRunRequested(now) {
+		t.Errorf("wanted no run requested")
+	}
+	pr.RunRequestedAt = now.Add(10 * time.Minute)
+	if pr.IsRunRequested(now) {
+		t.Errorf("wanted the run requested later")
+	}
+	if !pr.IsRunRequested(now.Add(10 * time.Minute)) {
+		t.Errorf("wanted the run requested in 10 minutes")
+	}
+	pr.Suspended = true
+	if pr.IsRunRequested(now.Add(10 * time.Minute)) {
+		t.Errorf("wanted a suspended plugin not to run")
+	}
+	pr.Suspended = false
+	pr.Queued()
+	pr.KeepRunning = true
+	if pr.IsRunRequested(now.Add(10 * time.Minute)) {
+		t.Errorf("wanted an active plugin not to be queued again")
+	}
+	pr.Inactive()
+	if pr.KeepRunning {
+		t.Errorf("wanted keeping running to end with the run")
+	}
+}
@@ -0,0 +1,93 @@
+package datatype
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/sciencerule"
+)
+
+// DefaultReactionCooldown is the minimum interval between two runs of a reaction
+// when the reaction does not set its cooldown. Nodes send the trigger every
+// time they evaluate the rule as valid
+const DefaultReactionCooldown = 1 * time.Minute
+
+// ReactionKind is what the cloud scheduler does for a reaction
+type ReactionKind string
+
+const (
+	// ReactionSubmitJob submits another job of the same user, or resumes the job if suspended
+	ReactionSubmitJob ReactionKind = "submit_job"
+	// ReactionWiden adds nodes matching the tags to the job and submits the job again
+	ReactionWiden ReactionKind = "widen"
+	// ReactionWebhook posts the trigger to the URL
+	ReactionWebhook ReactionKind = "webhook"
+)
+
+// Reaction is run by the cloud scheduler when a node fires the trigger() rule
+// of the job with the name. A reaction does exactly one of SubmitJob,
+// WidenToNodeTags, and Webhook
+type Reaction struct {
+	// On is the name of the trigger, e.g. flood for trigger(flood)
+	On              string   `json:"on" yaml:"on"`
+	SubmitJob       string   `json:"submit_job,omitempty" yaml:"submitJob,omitempty"`
+	WidenToNodeTags []string `json:"widen_to_node_tags,omitempty" yaml:"widenToNodeTags,omitempty"`
+	Webhook         string   `json:"webhook,omitempty" yaml:"webhook,omitempty"`
+	// Cooldown is the minimum interval between two runs of the reaction, e.g. 10m
+	Cooldown string `json:"cooldown,omitempty" yaml:"cooldown,omitempty"`
+}
+
+// Kind returns what the reaction does. It returns an empty kind if the
+// reaction does nothing or more than one thing
+func (r *Reaction) Kind() ReactionKind {
+	var kinds []ReactionKind
+	if r.SubmitJob != "" {
+		kinds = append(kinds, ReactionSubmitJob)
+	}
+	if len(r.WidenToNodeTags) > 0 {
+		kinds = append(kinds, ReactionWiden)
+	}
+	if r.Webhook != "" {
+		kinds = append(kinds, ReactionWebhook)
+	}
+	if len(kinds) != 1 {
+		return ""
+	}
+	return kinds[0]
+}
+
+// GetCooldown returns the cooldown of the reaction, or DefaultReactionCooldown if not set
+func (r *Reaction) GetCooldown() (time.Duration, error) {
+	if r.Cooldown == "" {
+		return DefaultReactionCooldown, nil
+	}
+	return sciencerule.ParseDuration(r.Cooldown)
+}
+
+// lintReactions checks reactions of the job. triggers are names of trigger() rules in the job
+func (j *Job) lintReactions(triggers map[string]bool) (errorList []*ValidationError) {
+	for i, r := range j.Reactions {
+		field := fmt.Sprintf("reactions[%d]", i)
+		if r.On == "" {
+			errorList = append(errorList, NewValidationError(field+".on", ValidationRequired, "the name of the trigger is required"))
+		} else if !triggers[r.On] {
+			errorList = append(errorList, NewValidationError(field+".on", ValidationNotFound, "no trigger(%s) rule is found in the science rules", r.On))
+		}
+		if r.Kind() == "" {
+			errorList = append(errorList, NewValidationError(field, ValidationInvalid, "a reaction must have exactly one of submitJob, widenToNodeTags, and webhook"))
+		}
+		if r.Webhook != "" {
+			if u, err := url.Parse(r.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errorList = append(errorList, NewValidationError(field+".webhook", ValidationInvalid, "webhook %q must be an http or https URL", r.Webhook))
+			}
+		}
+		if r.SubmitJob != "" && r.SubmitJob == j.JobID {
+			errorList = append(errorList, NewValidationError(field+".submitJob", ValidationInvalid, "a job cannot submit itself"))
+		}
+		if d, err := r.GetCooldown(); err != nil || d < 0 {
+			errorList = append(errorList, NewValidationError(field+".cooldown", ValidationInvalid, "cooldown %q must be a duration, e.g. 10m", r.Cooldown))
+		}
+	}
+	return
+}
@@ -1,6 +1,7 @@
 package datatype
 
 import (
+	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
@@ -28,6 +29,28 @@ func (r *Resource) CanAccommodate(c *Resource) bool {
 	}
 }
 
+// GetGPUMemoryInMega returns GPU memory of the resource in Mi
+func (r *Resource) GetGPUMemoryInMega() int {
+	r.convert()
+	return r.gpuMemInMega
+}
+
+// Add returns a new Resource that sums up the resource and given resource.
+// Unset or invalid quantities are counted as 0.
+func (r *Resource) Add(c *Resource) Resource {
+	r.convert()
+	c.convert()
+	sum := Resource{
+		cpuInMilli:   nonNegative(r.cpuInMilli) + nonNegative(c.cpuInMilli),
+		memInMega:    nonNegative(r.memInMega) + nonNegative(c.memInMega),
+		gpuMemInMega: nonNegative(r.gpuMemInMega) + nonNegative(c.gpuMemInMega),
+	}
+	sum.CPU = fmt.Sprintf("%dm", sum.cpuInMilli)
+	sum.Memory = fmt.Sprintf("%dMi", sum.memInMega)
+	sum.GPUMemory = fmt.Sprintf("%dMi", sum.gpuMemInMega)
+	return sum
+}
+
 func (r *Resource) convert() {
 	if strings.HasSuffix(r.CPU, "m") {
 		if cpuInInt, err := strconv.Atoi(r.CPU[:len(r.CPU)-1]); err == nil {
@@ -56,13 +79,13 @@ func (r *Resource) convert() {
 	value, unit = splitValueAndUnit(r.GPUMemory)
 	switch unit {
 	case "Ki":
-		r.gpuMemInMega = value * 1024
+		r.gpuMemInMega = int(value / 1024.)
 	case "Mi":
 		r.gpuMemInMega = value
 	case "Gi":
-		r.gpuMemInMega = int(value / 1024.)
+		r.gpuMemInMega = value * 1024
 	case "Ti":
-		r.gpuMemInMega = int(value / 1024. / 1024.)
+		r.gpuMemInMega = value * 1024 * 1024
 	}
 }
 
@@ -79,3 +102,10 @@ func splitValueAndUnit(v string) (int, string) {
 		return value, "Mi"
 	}
 }
+
+func nonNegative(v int) int {
+	if v < 0 {
+		return 0
+	}
+	return v
+}
@@ -27,6 +27,38 @@ func TestResourceConversion(t *testing.T) {
 				GpuMemory: 8000,
 			},
 		},
+		"gpuMemoryConversion": {
+			input: &Resource{
+				CPU:       "1.5",
+				Memory:    "2048Ki",
+				GPUMemory: "4Gi",
+			},
+			want: struct {
+				CPU       int
+				Memory    int
+				GpuMemory int
+			}{
+				CPU:       1500,
+				Memory:    2,
+				GpuMemory: 4 * 1024,
+			},
+		},
+		"gpuMemoryConversionKiAndTi": {
+			input: &Resource{
+				CPU:       "1",
+				Memory:    "1Ti",
+				GPUMemory: "2048Ki",
+			},
+			want: struct {
+				CPU       int
+				Memory    int
+				GpuMemory int
+			}{
+				CPU:       1000,
+				Memory:    1024 * 1024,
+				GpuMemory: 2,
+			},
+		},
 	}
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -7,6 +7,8 @@ import (
 	"strings"
 
 	uuid "github.com/nu7hatch/gouuid"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+	"github.com/waggle-sensor/edge-scheduler/pkg/tracing"
 )
 
 type ScienceGoalBuilder struct {
@@ -39,17 +41,57 @@ func (sgb *ScienceGoalBuilder) AddSubGoal(nodeID string, plugins []*Plugin, scie
 	return sgb
 }
 
+func (sgb *ScienceGoalBuilder) SetMaxConcurrency(maxConcurrency int) *ScienceGoalBuilder {
+	sgb.sg.MaxConcurrency = maxConcurrency
+	return sgb
+}
+
+func (sgb *ScienceGoalBuilder) SetUser(user string) *ScienceGoalBuilder {
+	sgb.sg.User = user
+	return sgb
+}
+
 func (sgb *ScienceGoalBuilder) Build() *ScienceGoal {
 	return &sgb.sg
 }
 
 // ScienceGoal structs local goals and success criteria
 type ScienceGoal struct {
-	ID         string     `json:"id" yaml:"id"`
-	JobID      string     `json:"job_id" yaml:"jobID"`
-	Name       string     `json:"name,omitempty" yaml:"name,omitempty"`
-	SubGoals   []*SubGoal `json:"sub_goals,omitempty" yaml:"subgoals,omitempty"`
-	Conditions []string   `json:"conditions,omitempty" yaml:"conditions,omitempty"`
+	ID             string     `json:"id" yaml:"id"`
+	JobID          string     `json:"job_id" yaml:"jobID"`
+	Name           string     `json:"name,omitempty" yaml:"name,omitempty"`
+	SubGoals       []*SubGoal `json:"sub_goals,omitempty" yaml:"subgoals,omitempty"`
+	Conditions     []string   `json:"conditions,omitempty" yaml:"conditions,omitempty"`
+	MaxConcurrency int        `json:"max_concurrency,omitempty" yaml:"maxConcurrency,omitempty"`
+	User           string     `json:"user,omitempty" yaml:"user,omitempty"`
+	// TraceID and SpanID carry the trace of the job submission to nodes
+	TraceID string `json:"trace_id,omitempty" yaml:"traceID,omitempty"`
+	SpanID  string `json:"span_id,omitempty" yaml:"spanID,omitempty"`
+}
+
+// TraceContext returns the context to continue the trace of the goal from
+func (g *ScienceGoal) TraceContext() tracing.SpanContext {
+	return tracing.SpanContext{TraceID: g.TraceID, SpanID: g.SpanID}
+}
+
+// LogFields returns fields identifying the goal in logs
+func (g *ScienceGoal) LogFields() logger.Fields {
+	return logger.Fields{
+		"job_id":  g.JobID,
+		"goal_id": g.ID,
+	}
+}
+
+// MessageMeta returns the meta of messages that science rules of the goal publish
+func (g *ScienceGoal) MessageMeta() map[string]string {
+	meta := map[string]string{
+		"job_id":  g.JobID,
+		"goal_id": g.ID,
+	}
+	if g.Name != "" {
+		meta["job"] = g.Name
+	}
+	return meta
 }
 
 // GetMySubGoal returns the subgoal assigned to node
@@ -67,11 +109,15 @@ func (g *ScienceGoal) GetMySubGoal(nodeName string) *SubGoal {
 func (g *ScienceGoal) ShowMyScienceGoal(nodeName string) *ScienceGoal {
 	mySubgoal := *g.GetMySubGoal(nodeName)
 	return &ScienceGoal{
-		ID:         g.ID,
-		JobID:      g.JobID,
-		Name:       g.Name,
-		SubGoals:   []*SubGoal{&mySubgoal},
-		Conditions: g.Conditions,
+		ID:             g.ID,
+		JobID:          g.JobID,
+		Name:           g.Name,
+		SubGoals:       []*SubGoal{&mySubgoal},
+		Conditions:     g.Conditions,
+		MaxConcurrency: g.MaxConcurrency,
+		User:           g.User,
+		TraceID:        g.TraceID,
+		SpanID:         g.SpanID,
 	}
 }
 
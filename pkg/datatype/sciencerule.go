@@ -2,8 +2,11 @@ package datatype
 
 import (
 	"fmt"
-	"regexp"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/sciencerule"
 )
 
 type ScienceRule struct {
@@ -12,6 +15,209 @@ type ScienceRule struct {
 	ActionObject     string                `json:"-" yaml:"-"`
 	ActionParameters map[string]string     `json:"-" yaml:"-"`
 	Condition        string                `json:"-" yaml:"-"`
+	// AST is the parsed rule with typed parameters and the condition
+	AST *sciencerule.Rule `json:"-" yaml:"-"`
+	// Modifiers control when the valid rule performs the action
+	Modifiers RuleModifiers `json:"-" yaml:"-"`
+	// SetOptions control how the set action writes the state
+	SetOptions SetOptions `json:"-" yaml:"-"`
+	// Value is what publish and set send
+	Value ActionValue `json:"-" yaml:"-"`
+}
+
+// ActionParameterValue is the parameter of publish and set that gives the value to send
+const ActionParameterValue = "value"
+
+// ActionValue is the value that publish and set send. Either the value is given
+// in the rule, or the expression computes the value when the rule fires
+type ActionValue struct {
+	// Static is the value typed as int64, float64, bool, string, or map[string]interface{}
+	// for JSON objects
+	Static interface{}
+	// Expr is the expression of the value, e.g. avg(v('env.temperature'))
+	Expr sciencerule.Expr
+}
+
+// newActionValue types the value of the parameter. Numbers without a decimal point
+// are integers, and true and false are booleans. Other words are strings
+func newActionValue(v sciencerule.Value) ActionValue {
+	switch v.Kind {
+	case sciencerule.ValueExpr:
+		return ActionValue{Expr: v.Expr}
+	case sciencerule.ValueObject:
+		return ActionValue{Static: v.Object}
+	case sciencerule.ValueNumber:
+		if !strings.ContainsAny(v.Raw, ".eE") {
+			if n, err := strconv.ParseInt(v.Raw, 10, 64); err == nil {
+				return ActionValue{Static: n}
+			}
+		}
+		return ActionValue{Static: v.Number}
+	case sciencerule.ValueWord:
+		switch v.Text {
+		case "true", "True":
+			return ActionValue{Static: true}
+		case "false", "False":
+			return ActionValue{Static: false}
+		}
+	}
+	return ActionValue{Static: v.Text}
+}
+
+// Parameters of any action that modify when the action is performed
+const (
+	RuleModifierCooldown = "cooldown"
+	RuleModifierOn       = "on"
+	RuleModifierFor      = "for"
+)
+
+// RuleModifiers control when a valid rule performs its action. Without modifiers
+// the action is performed every time the rule is evaluated as valid
+type RuleModifiers struct {
+	// Cooldown is the minimum interval between two actions of the rule
+	Cooldown time.Duration
+	// OnRising performs the action only once every time the condition becomes valid
+	OnRising bool
+	// For is how long the condition must stay valid before the action is performed
+	For time.Duration
+}
+
+// IsZero returns true if the rule has no modifier
+func (m RuleModifiers) IsZero() bool {
+	return m == RuleModifiers{}
+}
+
+func parseRuleModifier(m *RuleModifiers, p sciencerule.Param) error {
+	switch p.Name {
+	case RuleModifierCooldown, RuleModifierFor:
+		d, err := p.Value.Duration, error(nil)
+		switch p.Value.Kind {
+		case sciencerule.ValueDuration:
+		case sciencerule.ValueString:
+			d, err = sciencerule.ParseDuration(p.Value.Text)
+		default:
+			err = fmt.Errorf("not a duration")
+		}
+		if err != nil || d < 0 {
+			return fmt.Errorf("%s must be a duration, e.g. 10m, but %s is given at column %d", p.Name, p.Value.Raw, p.Value.Position+1)
+		}
+		if p.Name == RuleModifierCooldown {
+			m.Cooldown = d
+		} else {
+			m.For = d
+		}
+	case RuleModifierOn:
+		switch p.Value.Text {
+		case "rising":
+			m.OnRising = true
+		case "level":
+			m.OnRising = false
+		default:
+			return fmt.Errorf("on must be rising or level, but %s is given at column %d", p.Value.Raw, p.Value.Position+1)
+		}
+	}
+	return nil
+}
+
+// Parameters of the set action
+const (
+	SetParameterTTL    = "ttl"
+	SetParameterGlobal = "global"
+)
+
+// SetOptions control how the set action writes the state to the node's scoreboard
+type SetOptions struct {
+	// TTL is how long the state stays in the scoreboard. The state stays until
+	// it is set again if TTL is zero
+	TTL time.Duration
+	// Global makes the state shared by all jobs on the node. Otherwise, the state
+	// belongs to the job of the rule
+	Global bool
+}
+
+func parseSetOption(o *SetOptions, p sciencerule.Param) error {
+	switch p.Name {
+	case SetParameterTTL:
+		d, err := p.Value.Duration, error(nil)
+		switch p.Value.Kind {
+		case sciencerule.ValueDuration:
+		case sciencerule.ValueString:
+			d, err = sciencerule.ParseDuration(p.Value.Text)
+		default:
+			err = fmt.Errorf("not a duration")
+		}
+		if err != nil || d < 0 {
+			return fmt.Errorf("ttl must be a duration, e.g. 10m, but %s is given at column %d", p.Value.Raw, p.Value.Position+1)
+		}
+		o.TTL = d
+	case SetParameterGlobal:
+		switch p.Value.Text {
+		case "true", "True":
+			o.Global = true
+		case "false", "False":
+			o.Global = false
+		default:
+			return fmt.Errorf("global must be true or false, but %s is given at column %d", p.Value.Raw, p.Value.Position+1)
+		}
+	}
+	return nil
+}
+
+// scoreboardJobPrefix is the prefix of scoreboard keys that belong to a job
+const scoreboardJobPrefix = "job."
+
+// ScoreboardPrefix returns the prefix of the scoreboard keys of the job, e.g. job.42.
+// States without a job are global
+func ScoreboardPrefix(jobID string) string {
+	if jobID == "" {
+		return ""
+	}
+	return scoreboardJobPrefix + jobID + "."
+}
+
+// ScoreboardKey returns the key of the state in the node's scoreboard. The state
+// belongs to the job unless it is global. Names under the namespace of jobs always
+// belong to the job so that a global name cannot reach states of other jobs
+func ScoreboardKey(jobID string, name string, global bool) string {
+	if global && !strings.HasPrefix(name, scoreboardJobPrefix) {
+		return name
+	}
+	return ScoreboardPrefix(jobID) + name
+}
+
+// checkScoreboardName returns an error if the name of the state is in the namespace
+// reserved for states of jobs
+func checkScoreboardName(name string, pos int) error {
+	if strings.HasPrefix(name, scoreboardJobPrefix) {
+		return fmt.Errorf("state name %q found at column %d must not start with %q", name, pos+1, scoreboardJobPrefix)
+	}
+	return nil
+}
+
+// checkScoreboardCalls returns an error if scoreboard() in the expression reads
+// a state in the namespace reserved for states of jobs
+func checkScoreboardCalls(e sciencerule.Expr) (err error) {
+	sciencerule.ReplaceCalls(e, func(c *sciencerule.Call) sciencerule.Expr {
+		if err != nil || c.Func != sciencerule.ScoreboardFunction || len(c.Args) != 1 {
+			return nil
+		}
+		if name, ok := c.Args[0].(*sciencerule.Literal); ok {
+			err = checkScoreboardName(name.Value.Text, name.Value.Position)
+		}
+		return nil
+	})
+	return
+}
+
+// ParseScoreboardKey returns the job and the name of the state of the key.
+// The job is empty for global states
+func ParseScoreboardKey(key string) (jobID string, name string) {
+	if rest := strings.TrimPrefix(key, scoreboardJobPrefix); rest != key {
+		if i := strings.Index(rest, "."); i > 0 && i < len(rest)-1 {
+			return rest[:i], rest[i+1:]
+		}
+	}
+	return "", key
 }
 
 func NewScienceRule(rule string) (*ScienceRule, error) {
@@ -29,45 +235,97 @@ const (
 	ScienceRuleActionSchedule ScienceRuleActionType = "schedule"
 	ScienceRuleActionPublish  ScienceRuleActionType = "publish"
 	ScienceRuleActionSet      ScienceRuleActionType = "set"
+	// ScienceRuleActionStop terminates the plugin if it is queued or running
+	ScienceRuleActionStop ScienceRuleActionType = "stop"
+	// ScienceRuleActionSuspend stops the plugin and keeps schedule() rules
+	// from queuing it until it is resumed
+	ScienceRuleActionSuspend ScienceRuleActionType = "suspend"
+	// ScienceRuleActionResume lets schedule() rules queue the suspended plugin again
+	ScienceRuleActionResume ScienceRuleActionType = "resume"
+	// ScienceRuleActionTrigger sends the trigger to the cloud scheduler to run
+	// reactions of the job registered for the trigger
+	ScienceRuleActionTrigger ScienceRuleActionType = "trigger"
 )
 
+// TargetsPlugin returns true if the action of the rule applies to a plugin of the goal
+func (r *ScienceRule) TargetsPlugin() bool {
+	switch r.ActionType {
+	case ScienceRuleActionSchedule,
+		ScienceRuleActionStop,
+		ScienceRuleActionSuspend,
+		ScienceRuleActionResume:
+		return true
+	}
+	return false
+}
+
+// Parse parses the rule using the grammar shared with the node and sesctl.
+// Errors report the column where the rule fails to parse
 func (r *ScienceRule) Parse(rule string) error {
 	r.Rule = rule
-	re := regexp.MustCompile(`^(\w+)\((.*?)\):(.*?)$`)
-	sp := re.FindStringSubmatch(r.Rule)
-	// length of sp should be 4: the rule, action, parameters, and condition
-	if len(sp) != 4 {
-		return fmt.Errorf("Failed to parse rule %q: rule must consist of an action, target object, and corresponding condition:", r.Rule)
-	}
-	switch strings.Trim(sp[1], " ") {
-	case string(ScienceRuleActionSchedule):
-		r.ActionType = ScienceRuleActionSchedule
-	case string(ScienceRuleActionPublish):
-		r.ActionType = ScienceRuleActionPublish
-	case string(ScienceRuleActionSet):
-		r.ActionType = ScienceRuleActionSet
+	ast, err := sciencerule.Parse(rule)
+	if err != nil {
+		return fmt.Errorf("Failed to parse rule %q: %s", r.Rule, err.Error())
+	}
+	switch ScienceRuleActionType(ast.Action) {
+	case ScienceRuleActionSchedule,
+		ScienceRuleActionPublish,
+		ScienceRuleActionSet,
+		ScienceRuleActionStop,
+		ScienceRuleActionSuspend,
+		ScienceRuleActionResume,
+		ScienceRuleActionTrigger:
+		r.ActionType = ScienceRuleActionType(ast.Action)
 	default:
-		return fmt.Errorf("Failed to parse rule %q: unknown action type %q found", r.Rule, strings.Trim(sp[0], " "))
+		return fmt.Errorf("Failed to parse rule %q: unknown action type %q found at column %d", r.Rule, ast.Action, ast.ActionPosition+1)
 	}
-	actionParams := strings.Split(sp[2], ",")
-	if len(actionParams) < 1 {
+	object, exist := ast.Object()
+	if !exist {
 		return fmt.Errorf("Failed to parse rule %q: no action object found", r.Rule)
 	}
-	r.ActionObject = strings.Trim(actionParams[0], " ")
-	r.ActionObject = strings.Trim(r.ActionObject, `'`)
-	r.ActionObject = strings.Trim(r.ActionObject, `"`)
+	r.ActionObject = object.Text
+	if r.ActionType == ScienceRuleActionSet {
+		if err := checkScoreboardName(object.Text, object.Position); err != nil {
+			return fmt.Errorf("Failed to parse rule %q: %s", r.Rule, err.Error())
+		}
+	}
+	if err := checkScoreboardCalls(ast.Condition); err != nil {
+		return fmt.Errorf("Failed to parse rule %q: %s", r.Rule, err.Error())
+	}
 	r.ActionParameters = make(map[string]string)
-	for _, param := range actionParams[1:] {
-		kv := strings.Split(param, "=")
-		if len(kv) != 2 {
-			return fmt.Errorf("Failed to parse rule %q: failed to parse param %s", r.Rule, param)
+	r.Modifiers = RuleModifiers{}
+	r.SetOptions = SetOptions{}
+	for _, param := range ast.Params {
+		switch {
+		case param.Name == "":
+		case param.Name == RuleModifierCooldown, param.Name == RuleModifierOn, param.Name == RuleModifierFor:
+			if err := parseRuleModifier(&r.Modifiers, param); err != nil {
+				return fmt.Errorf("Failed to parse rule %q: %s", r.Rule, err.Error())
+			}
+		case r.ActionType == ScienceRuleActionSet && (param.Name == SetParameterTTL || param.Name == SetParameterGlobal):
+			if err := parseSetOption(&r.SetOptions, param); err != nil {
+				return fmt.Errorf("Failed to parse rule %q: %s", r.Rule, err.Error())
+			}
+		default:
+			r.ActionParameters[param.Name] = param.Value.Text
+		}
+	}
+	r.Value = ActionValue{}
+	switch r.ActionType {
+	case ScienceRuleActionPublish, ScienceRuleActionSet:
+		if v, exist := ast.Keyword(ActionParameterValue); exist {
+			if v.Kind == sciencerule.ValueExpr {
+				if err := checkScoreboardCalls(v.Expr); err != nil {
+					return fmt.Errorf("Failed to parse rule %q: %s", r.Rule, err.Error())
+				}
+			}
+			r.Value = newActionValue(v)
 		} else {
-			v := strings.Trim(kv[1], " ")
-			v = strings.Trim(v, `"`)
-			v = strings.Trim(v, `'`)
-			r.ActionParameters[strings.Trim(kv[0], " ")] = v
+			// the action sends 1 if no value is given
+			r.Value = ActionValue{Static: 1.}
 		}
 	}
-	r.Condition = strings.Trim(sp[3], " ")
+	r.Condition = ast.ConditionText
+	r.AST = ast
 	return nil
 }
@@ -3,6 +3,7 @@ package datatype
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 type ScienceRuleTestWants struct {
@@ -10,6 +11,8 @@ type ScienceRuleTestWants struct {
 	ActionType        ScienceRuleActionType
 	ActionObject      string
 	ActionArguments   map[string]string
+	Modifiers         RuleModifiers
+	SetOptions        SetOptions
 }
 
 func TestScienceRule(t *testing.T) {
@@ -80,6 +83,30 @@ func TestScienceRule(t *testing.T) {
 				},
 			},
 		},
+		"Stop type test1": {
+			ScienceRule: "stop(recorder): v('env.raingauge.event_acc') == 0",
+			Wants: ScienceRuleTestWants{
+				ShouldFailToParse: false,
+				ActionType:        ScienceRuleActionStop,
+				ActionObject:      "recorder",
+			},
+		},
+		"Suspend type test1": {
+			ScienceRule: "suspend(recorder): v('sys.time.hour') >= 20",
+			Wants: ScienceRuleTestWants{
+				ShouldFailToParse: false,
+				ActionType:        ScienceRuleActionSuspend,
+				ActionObject:      "recorder",
+			},
+		},
+		"Resume type test1": {
+			ScienceRule: "resume(recorder): v('sys.time.hour') < 20",
+			Wants: ScienceRuleTestWants{
+				ShouldFailToParse: false,
+				ActionType:        ScienceRuleActionResume,
+				ActionObject:      "recorder",
+			},
+		},
 		"Set type test1": {
 			ScienceRule: "set(sys.time.sunrise, value=06:39:00): True",
 			Wants: ScienceRuleTestWants{
@@ -91,6 +118,88 @@ func TestScienceRule(t *testing.T) {
 				},
 			},
 		},
+		"Modifiers test1": {
+			ScienceRule: "publish(env.alert, cooldown=10m, on=rising, for='2m'): v('env.temperature') > 30",
+			Wants: ScienceRuleTestWants{
+				ShouldFailToParse: false,
+				ActionType:        ScienceRuleActionPublish,
+				ActionObject:      "env.alert",
+				ActionArguments:   map[string]string{},
+				Modifiers: RuleModifiers{
+					Cooldown: 10 * time.Minute,
+					OnRising: true,
+					For:      2 * time.Minute,
+				},
+			},
+		},
+		"Modifiers test2": {
+			ScienceRule: "set(rainy, value=1, on=level): v('env.raingauge.event_acc') > 0",
+			Wants: ScienceRuleTestWants{
+				ShouldFailToParse: false,
+				ActionType:        ScienceRuleActionSet,
+				ActionObject:      "rainy",
+				ActionArguments: map[string]string{
+					"value": "1",
+				},
+			},
+		},
+		"Set options test1": {
+			ScienceRule: "set(rainy, value=1, ttl=30m, global=true): v('env.raingauge.event_acc') > 0",
+			Wants: ScienceRuleTestWants{
+				ShouldFailToParse: false,
+				ActionType:        ScienceRuleActionSet,
+				ActionObject:      "rainy",
+				ActionArguments: map[string]string{
+					"value": "1",
+				},
+				SetOptions: SetOptions{
+					TTL:    30 * time.Minute,
+					Global: true,
+				},
+			},
+		},
+		"Invalid ttl": {
+			ScienceRule: "set(rainy, value=1, ttl=forever): True",
+			Wants: ScienceRuleTestWants{
+				ShouldFailToParse: true,
+			},
+		},
+		"Invalid global": {
+			ScienceRule: "set(rainy, value=1, global=yes): True",
+			Wants: ScienceRuleTestWants{
+				ShouldFailToParse: true,
+			},
+		},
+		"Set state of another job": {
+			ScienceRule: "set(job.43.rainy, value=1, global=true): True",
+			Wants: ScienceRuleTestWants{
+				ShouldFailToParse: true,
+			},
+		},
+		"Read state of another job": {
+			ScienceRule: "publish(env.alert): scoreboard('job.43.rainy', global=True) == 1",
+			Wants: ScienceRuleTestWants{
+				ShouldFailToParse: true,
+			},
+		},
+		"Publish state of another job": {
+			ScienceRule: "publish(env.alert, value=scoreboard('job.43.count')): True",
+			Wants: ScienceRuleTestWants{
+				ShouldFailToParse: true,
+			},
+		},
+		"Invalid cooldown": {
+			ScienceRule: "publish(env.alert, cooldown=soon): True",
+			Wants: ScienceRuleTestWants{
+				ShouldFailToParse: true,
+			},
+		},
+		"Invalid on": {
+			ScienceRule: "publish(env.alert, on=falling): True",
+			Wants: ScienceRuleTestWants{
+				ShouldFailToParse: true,
+			},
+		},
 	}
 	for name, test := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -119,6 +228,68 @@ func TestScienceRule(t *testing.T) {
 					return
 				}
 			}
+			if r.Modifiers != test.Wants.Modifiers {
+				t.Errorf("Wanted modifiers %+v but found %+v", test.Wants.Modifiers, r.Modifiers)
+			}
+			if r.SetOptions != test.Wants.SetOptions {
+				t.Errorf("Wanted set options %+v but found %+v", test.Wants.SetOptions, r.SetOptions)
+			}
+		})
+	}
+}
+
+func TestScienceRuleValue(t *testing.T) {
+	tests := map[string]struct {
+		ScienceRule string
+		Static      interface{}
+		Expr        string
+	}{
+		"Default":            {ScienceRule: "publish(env.event): True", Static: 1.},
+		"Integer":            {ScienceRule: "publish(env.event, value=3): True", Static: int64(3)},
+		"Float":              {ScienceRule: "publish(env.event, value=3.5): True", Static: 3.5},
+		"Bool":               {ScienceRule: "set(rainy, value=true): True", Static: true},
+		"String":             {ScienceRule: "set(mode, value='3'): True", Static: "3"},
+		"Word":               {ScienceRule: "set(sys.time.sunrise, value=06:39:00): True", Static: "06:39:00"},
+		"Object":             {ScienceRule: `publish(env.event, value={"mode": "night", "level": 2}): True`, Static: map[string]interface{}{"mode": "night", "level": 2.}},
+		"Expression":         {ScienceRule: "publish(env.avg, value=avg(v('env.temperature'))): True", Expr: "avg(v('env.temperature'))"},
+		"Not a value action": {ScienceRule: "schedule(plugin-a, value=3): True"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r, err := NewScienceRule(test.ScienceRule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(r.Value.Static, test.Static) {
+				t.Errorf("Wanted value %#v but found %#v", test.Static, r.Value.Static)
+			}
+			if test.Expr == "" && r.Value.Expr != nil {
+				t.Errorf("Wanted no expression but found %s", r.Value.Expr.String())
+			} else if test.Expr != "" && (r.Value.Expr == nil || r.Value.Expr.String() != test.Expr) {
+				t.Errorf("Wanted expression %s but found %v", test.Expr, r.Value.Expr)
+			}
+		})
+	}
+}
+
+func TestScoreboardKey(t *testing.T) {
+	tests := map[string]struct {
+		JobID  string
+		Name   string
+		Global bool
+		Want   string
+	}{
+		"State of the job":           {JobID: "42", Name: "rainy", Want: "job.42.rainy"},
+		"Global state":               {JobID: "42", Name: "rainy", Global: true, Want: "rainy"},
+		"Global name of another job": {JobID: "42", Name: "job.43.rainy", Global: true, Want: "job.42.job.43.rainy"},
+		"Name of another job":        {JobID: "42", Name: "job.43.rainy", Want: "job.42.job.43.rainy"},
+		"Global state without a job": {Name: "rainy", Global: true, Want: "rainy"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := ScoreboardKey(test.JobID, test.Name, test.Global); got != test.Want {
+				t.Errorf("wanted key %q but got %q", test.Want, got)
+			}
 		})
 	}
 }
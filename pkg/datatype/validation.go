@@ -0,0 +1,202 @@
+package datatype
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Codes of validation errors
+const (
+	ValidationRequired         = "required"
+	ValidationInvalid          = "invalid"
+	ValidationDuplicate        = "duplicate"
+	ValidationNotFound         = "not_found"
+	ValidationPermissionDenied = "permission_denied"
+	ValidationUnsupported      = "unsupported"
+)
+
+// ValidationError describes a problem found in a job. Field is the path to
+// the field in the job description using the YAML keys, e.g. plugins[1].name
+type ValidationError struct {
+	Field   string `json:"field,omitempty" yaml:"field,omitempty"`
+	Code    string `json:"code" yaml:"code"`
+	Message string `json:"message" yaml:"message"`
+	// Line is the line of the field in the job file, if known
+	Line int `json:"line,omitempty" yaml:"line,omitempty"`
+}
+
+func NewValidationError(field string, code string, format string, a ...interface{}) *ValidationError {
+	return &ValidationError{
+		Field:   field,
+		Code:    code,
+		Message: fmt.Sprintf(format, a...),
+	}
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ToValidationErrors converts errors to validation errors. Errors that are not
+// validation errors are reported as invalid without a field
+func ToValidationErrors(errorList []error) (validationErrors []*ValidationError) {
+	for _, err := range errorList {
+		if e, ok := err.(*ValidationError); ok {
+			validationErrors = append(validationErrors, e)
+		} else {
+			validationErrors = append(validationErrors, &ValidationError{Code: ValidationInvalid, Message: err.Error()})
+		}
+	}
+	return
+}
+
+var validPluginNamePattern = regexp.MustCompile("^[a-z0-9-]+$")
+
+// IsPluginNameValid checks if given plugin name is valid.
+// Plugin name must follow RFC 1123.
+// Reference: https://kubernetes.io/docs/concepts/overview/working-with-objects/names/#dns-subdomain-names
+func IsPluginNameValid(name string) bool {
+	// the maximum length allowed is 256, but the scheduler may use several characters
+	// to indicate job ID when it names a plugin, thus reduce length of user plugins to 200
+	if len(name) > 200 {
+		return false
+	}
+	return validPluginNamePattern.MatchString(name)
+}
+
+// LintPluginName returns the problem of the plugin name at the field, or nil if
+// the name is valid. The job is linted and validated with the same message
+func LintPluginName(field string, name string) *ValidationError {
+	if IsPluginNameValid(name) {
+		return nil
+	}
+	return NewValidationError(field, ValidationInvalid, "plugin name %q must consist of up to 200 lowercase alphanumeric characters or '-', RFC1123", name)
+}
+
+// IsJobStateValid checks if the state is one of job states, e.g. for notification
+func IsJobStateValid(s JobState) bool {
+	switch s {
+	case JobCreated,
+		JobDrafted,
+		JobSubmitted,
+		JobRunning,
+		JobComplete,
+		JobSuspended,
+		JobRemoved:
+		return true
+	}
+	return false
+}
+
+// Lint returns problems found in the job description without looking up
+// nodes and plugins. The cloud scheduler checks the rest when the job is submitted
+func (j *Job) Lint() (errorList []*ValidationError) {
+	if j.Name == "" {
+		errorList = append(errorList, NewValidationError("name", ValidationRequired, "job name is required"))
+	}
+	if j.MaxConcurrency < 0 {
+		errorList = append(errorList, NewValidationError("maxConcurrency", ValidationInvalid, "max_concurrency of the job must not be negative"))
+	}
+	if len(j.NotificationOn) > 0 && j.Email == "" {
+		errorList = append(errorList, NewValidationError("email", ValidationRequired, "No email is set for notification"))
+	}
+	for i, s := range j.NotificationOn {
+		if !IsJobStateValid(s) {
+			errorList = append(errorList, NewValidationError(fmt.Sprintf("notificationOn[%d]", i), ValidationInvalid, "No type %q in Job notification", s))
+		}
+	}
+	pluginNames := make(map[string]bool)
+	for i, plugin := range j.Plugins {
+		field := fmt.Sprintf("plugins[%d]", i)
+		if err := LintPluginName(field+".name", plugin.Name); err != nil {
+			errorList = append(errorList, err)
+		} else if pluginNames[plugin.Name] {
+			errorList = append(errorList, NewValidationError(field+".name", ValidationDuplicate, "the plugin name %q is duplicated. plugin names must be unique", plugin.Name))
+		}
+		pluginNames[plugin.Name] = true
+		if image, err := plugin.GetPluginImage(); err != nil || image == "" {
+			errorList = append(errorList, NewValidationError(field+".pluginSpec.image", ValidationRequired, "%s does not specify plugin image", plugin.Name))
+		}
+		if plugin.MaxConcurrency < 0 {
+			errorList = append(errorList, NewValidationError(field+".maxConcurrency", ValidationInvalid, "max_concurrency of the plugin %q must not be negative", plugin.Name))
+		}
+	}
+	triggers := make(map[string]bool)
+	for i, rule := range j.ScienceRules {
+		field := fmt.Sprintf("scienceRules[%d]", i)
+		r, err := NewScienceRule(rule)
+		if err != nil {
+			errorList = append(errorList, NewValidationError(field, ValidationInvalid, "%s", err.Error()))
+			continue
+		}
+		if r.TargetsPlugin() && !pluginNames[r.ActionObject] {
+			errorList = append(errorList, NewValidationError(field, ValidationNotFound, "%s() targets %q, but no plugin has the name", r.ActionType, r.ActionObject))
+		}
+		if r.ActionType == ScienceRuleActionTrigger {
+			triggers[r.ActionObject] = true
+		}
+	}
+	errorList = append(errorList, j.lintReactions(triggers)...)
+	return
+}
+
+// FieldLines returns line numbers of fields in a YAML or JSON document. Keys are
+// field paths as in ValidationError
+func FieldLines(blob []byte) (map[string]int, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(blob, &doc); err != nil {
+		return nil, err
+	}
+	lines := make(map[string]int)
+	var walk func(n *yamlv3.Node, path string)
+	walk = func(n *yamlv3.Node, path string) {
+		switch n.Kind {
+		case yamlv3.DocumentNode:
+			for _, c := range n.Content {
+				walk(c, path)
+			}
+		case yamlv3.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				key := n.Content[i].Value
+				if path != "" {
+					key = path + "." + key
+				}
+				lines[key] = n.Content[i].Line
+				walk(n.Content[i+1], key)
+			}
+		case yamlv3.SequenceNode:
+			for i, c := range n.Content {
+				key := path + "[" + strconv.Itoa(i) + "]"
+				lines[key] = c.Line
+				walk(c, key)
+			}
+		}
+	}
+	walk(&doc, "")
+	return lines, nil
+}
+
+// SetLines sets the line of each error to the line of its field, or of the
+// closest parent of the field found in lines
+func SetLines(errorList []*ValidationError, lines map[string]int) {
+	for _, e := range errorList {
+		for field := e.Field; field != ""; {
+			if line, exist := lines[field]; exist {
+				e.Line = line
+				break
+			}
+			i := strings.LastIndexAny(field, ".[")
+			if i < 0 {
+				break
+			}
+			field = field[:i]
+		}
+	}
+}
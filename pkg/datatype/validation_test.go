@@ -0,0 +1,156 @@
+package datatype
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestLint(t *testing.T) {
+	tests := map[string]struct {
+		Job    string
+		Fields []string
+		Lines  []int
+	}{
+		"valid": {
+			Job: `
+name: mynewjob
+plugins:
+- name: imagesampler-top
+  pluginSpec:
+    image: registry.sagecontinuum.org/theone/imagesampler:0.3.0
+scienceRules:
+- "schedule(imagesampler-top): cronjob('imagesampler-top', '* * * * *')"
+`,
+		},
+		"no image and duplicate plugin": {
+			Job: `
+name: mynewjob
+plugins:
+- name: imagesampler-top
+  pluginSpec:
+    image: registry.sagecontinuum.org/theone/imagesampler:0.3.0
+- name: imagesampler-top
+`,
+			Fields: []string{"plugins[1].name", "plugins[1].pluginSpec.image"},
+			Lines:  []int{7, 7},
+		},
+		"invalid plugin name": {
+			Job: `
+name: mynewjob
+plugins:
+- name: ImageSampler
+  pluginSpec:
+    image: registry.sagecontinuum.org/theone/imagesampler:0.3.0
+`,
+			Fields: []string{"plugins[0].name"},
+			Lines:  []int{4},
+		},
+		"invalid science rule": {
+			Job: `
+name: mynewjob
+scienceRules:
+- "schedule(imagesampler-top) cronjob('imagesampler-top', '* * * * *')"
+`,
+			Fields: []string{"scienceRules[0]"},
+			Lines:  []int{4},
+		},
+		"schedule unknown plugin": {
+			Job: `
+name: mynewjob
+plugins:
+- name: imagesampler-top
+  pluginSpec:
+    image: registry.sagecontinuum.org/theone/imagesampler:0.3.0
+scienceRules:
+- "schedule(imagesampler-bottom): cronjob('imagesampler-bottom', '* * * * *')"
+`,
+			Fields: []string{"scienceRules[0]"},
+			Lines:  []int{8},
+		},
+		"stop unknown plugin": {
+			Job: `
+name: mynewjob
+plugins:
+- name: imagesampler-top
+  pluginSpec:
+    image: registry.sagecontinuum.org/theone/imagesampler:0.3.0
+scienceRules:
+- "schedule(imagesampler-top): v('env.raingauge.event_acc') > 0"
+- "stop(imagesampler-bottom): v('env.raingauge.event_acc') == 0"
+`,
+			Fields: []string{"scienceRules[1]"},
+			Lines:  []int{9},
+		},
+		"reactions": {
+			Job: `
+name: mynewjob
+scienceRules:
+- "trigger(flood, level=high): v('env.water.level') > 3"
+reactions:
+- on: flood
+  submitJob: "42"
+- on: flooding
+  webhook: https://example.com/hook
+- on: flood
+  submitJob: "42"
+  webhook: ftp://example.com
+  cooldown: soon
+`,
+			Fields: []string{"reactions[1].on", "reactions[2]", "reactions[2].webhook", "reactions[2].cooldown"},
+			Lines:  []int{8, 10, 12, 13},
+		},
+		"notification": {
+			Job: `
+name: mynewjob
+notificationOn:
+- Submitted
+- Finished
+`,
+			Fields: []string{"email", "notificationOn[1]"},
+			Lines:  []int{0, 5},
+		},
+	}
+	for name, test := range tests {
+		var j Job
+		if err := yaml.Unmarshal([]byte(test.Job), &j); err != nil {
+			t.Fatalf("%s: %s", name, err.Error())
+		}
+		errorList := j.Lint()
+		lines, err := FieldLines([]byte(test.Job))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err.Error())
+		}
+		SetLines(errorList, lines)
+		if len(errorList) != len(test.Fields) {
+			t.Errorf("%s: expected %d errors, but got %v", name, len(test.Fields), errorList)
+			continue
+		}
+		for i, e := range errorList {
+			if e.Field != test.Fields[i] || e.Line != test.Lines[i] {
+				t.Errorf("%s: expected %s at line %d, but got %s at line %d", name, test.Fields[i], test.Lines[i], e.Field, e.Line)
+			}
+		}
+	}
+}
+
+func TestLintPluginName(t *testing.T) {
+	tests := map[string]bool{
+		"object-counter":         true,
+		"imagesampler-top-2":     true,
+		"Object-Counter":         false,
+		"object.counter":         false,
+		"":                       false,
+		strings.Repeat("a", 200): true,
+		strings.Repeat("a", 201): false,
+	}
+	for name, valid := range tests {
+		err := LintPluginName("plugins[0].name", name)
+		if valid && err != nil {
+			t.Errorf("expected %q valid, but got %s", name, err.Error())
+		} else if !valid && (err == nil || err.Field != "plugins[0].name" || err.Code != ValidationInvalid) {
+			t.Errorf("expected %q invalid at plugins[0].name, but got %v", name, err)
+		}
+	}
+}
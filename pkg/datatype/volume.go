@@ -0,0 +1,92 @@
+package datatype
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Types of volumes that plugins mount. Volume of PluginSpec maps a source to the path
+// in the plugin container, e.g.
+//
+//	/media/plugin-data/shared: /data   a host path allowed on the node
+//	scratch: /scratch                  a persistent directory shared by plugins of the job
+//	configmap=my-config: /etc/config   a ConfigMap mounted read-only
+//	emptydir=512Mi: /tmp/work          an empty directory up to the size
+const (
+	VolumeHostPath  = "hostPath"
+	VolumeScratch   = "scratch"
+	VolumeConfigMap = "configMap"
+	VolumeEmptyDir  = "emptyDir"
+)
+
+// DefaultEmptyDirSizeLimit is the size limit of emptyDir volumes that do not specify one
+const DefaultEmptyDirSizeLimit = "1Gi"
+
+// PluginVolume is a volume that the plugin mounts
+type PluginVolume struct {
+	Type string
+	// Source is the host path, the name of the ConfigMap, or the size limit of emptyDir
+	Source    string
+	MountPath string
+}
+
+// ParseVolume returns the volume of the source mounted at the path in the plugin container
+func ParseVolume(source string, mountPath string) (PluginVolume, error) {
+	source = strings.TrimSpace(source)
+	mountPath = strings.TrimSpace(mountPath)
+	if !path.IsAbs(mountPath) {
+		return PluginVolume{}, fmt.Errorf("mount path %q of volume %q must be absolute", mountPath, source)
+	}
+	v := PluginVolume{MountPath: path.Clean(mountPath)}
+	kind, arg, hasArg := strings.Cut(source, "=")
+	switch {
+	case path.IsAbs(source):
+		v.Type, v.Source = VolumeHostPath, path.Clean(source)
+	case kind == "scratch" && !hasArg:
+		v.Type = VolumeScratch
+	case kind == "configmap":
+		if errs := validation.IsDNS1123Subdomain(arg); len(errs) > 0 {
+			return PluginVolume{}, fmt.Errorf("invalid ConfigMap name %q: %s", arg, strings.Join(errs, ", "))
+		}
+		v.Type, v.Source = VolumeConfigMap, arg
+	case kind == "emptydir":
+		if !hasArg {
+			arg = DefaultEmptyDirSizeLimit
+		}
+		size, err := resource.ParseQuantity(arg)
+		if err != nil || size.Sign() <= 0 {
+			return PluginVolume{}, fmt.Errorf("invalid size limit %q of emptydir", arg)
+		}
+		v.Type, v.Source = VolumeEmptyDir, arg
+	default:
+		return PluginVolume{}, fmt.Errorf("unknown volume %q: it must be a host path, scratch, configmap=NAME, or emptydir=SIZE", source)
+	}
+	return v, nil
+}
+
+// GetVolumes returns the volumes of the plugin sorted by mount path. Two volumes
+// must not be mounted at the same path
+func (ps *PluginSpec) GetVolumes() ([]PluginVolume, error) {
+	var volumes []PluginVolume
+	mountPaths := map[string]string{}
+	for source, mountPath := range ps.Volume {
+		v, err := ParseVolume(source, mountPath)
+		if err != nil {
+			return nil, err
+		}
+		if other, exist := mountPaths[v.MountPath]; exist {
+			return nil, fmt.Errorf("volumes %q and %q are mounted at the same path %q", other, source, v.MountPath)
+		}
+		mountPaths[v.MountPath] = source
+		volumes = append(volumes, v)
+	}
+	sort.Slice(volumes, func(i, j int) bool {
+		return volumes[i].MountPath < volumes[j].MountPath
+	})
+	return volumes, nil
+}
@@ -0,0 +1,67 @@
+package datatype
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseVolume(t *testing.T) {
+	tests := map[string]struct {
+		Source    string
+		MountPath string
+		Want      PluginVolume
+		Error     bool
+	}{
+		"Host path":           {Source: "/media/plugin-data/shared/", MountPath: "/data", Want: PluginVolume{Type: VolumeHostPath, Source: "/media/plugin-data/shared", MountPath: "/data"}},
+		"Host path escaping":  {Source: "/media/plugin-data/../../etc", MountPath: "/data", Want: PluginVolume{Type: VolumeHostPath, Source: "/etc", MountPath: "/data"}},
+		"Scratch":             {Source: "scratch", MountPath: "/scratch", Want: PluginVolume{Type: VolumeScratch, MountPath: "/scratch"}},
+		"ConfigMap":           {Source: "configmap=my-config", MountPath: "/etc/config", Want: PluginVolume{Type: VolumeConfigMap, Source: "my-config", MountPath: "/etc/config"}},
+		"EmptyDir":            {Source: "emptydir=512Mi", MountPath: "/tmp/work", Want: PluginVolume{Type: VolumeEmptyDir, Source: "512Mi", MountPath: "/tmp/work"}},
+		"EmptyDir by default": {Source: "emptydir", MountPath: "/tmp/work", Want: PluginVolume{Type: VolumeEmptyDir, Source: DefaultEmptyDirSizeLimit, MountPath: "/tmp/work"}},
+		"Relative mount path": {Source: "scratch", MountPath: "scratch", Error: true},
+		"Invalid ConfigMap":   {Source: "configmap=My_Config", MountPath: "/etc/config", Error: true},
+		"Invalid size":        {Source: "emptydir=large", MountPath: "/tmp/work", Error: true},
+		"Zero size":           {Source: "emptydir=0", MountPath: "/tmp/work", Error: true},
+		"Unknown volume":      {Source: "nfs=server", MountPath: "/data", Error: true},
+		"Scratch with a size": {Source: "scratch=1Gi", MountPath: "/scratch", Error: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			v, err := ParseVolume(test.Source, test.MountPath)
+			if test.Error {
+				if err == nil {
+					t.Errorf("expected error, got %v", v)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != test.Want {
+				t.Errorf("expected %v, got %v", test.Want, v)
+			}
+		})
+	}
+}
+
+func TestGetVolumes(t *testing.T) {
+	spec := PluginSpec{Volume: map[string]string{
+		"scratch":        "/scratch",
+		"emptydir=512Mi": "/tmp/work",
+	}}
+	volumes, err := spec.GetVolumes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PluginVolume{
+		{Type: VolumeScratch, MountPath: "/scratch"},
+		{Type: VolumeEmptyDir, Source: "512Mi", MountPath: "/tmp/work"},
+	}
+	if !reflect.DeepEqual(volumes, want) {
+		t.Errorf("expected %v, got %v", want, volumes)
+	}
+	spec.Volume["emptydir"] = "/scratch/"
+	if volumes, err := spec.GetVolumes(); err == nil {
+		t.Errorf("expected error for volumes mounted at the same path, got %v", volumes)
+	}
+}
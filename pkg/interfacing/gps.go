@@ -0,0 +1,52 @@
+package interfacing
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+)
+
+// defaultGPSPort is the port of gpsd that the GPS server of nodes runs
+const defaultGPSPort = "2947"
+
+// gpsReport is a report of gpsd. Position reports are of class TPV
+type gpsReport struct {
+	Class string   `json:"class"`
+	Mode  int      `json:"mode"`
+	Lat   *float64 `json:"lat"`
+	Lon   *float64 `json:"lon"`
+}
+
+// ReadGPSPosition returns the latitude and longitude from the gpsd server at the address,
+// e.g. wes-gps-server. It waits for a fix until the timeout
+func ReadGPSPosition(address string, timeout time.Duration) (lat float64, lon float64, err error) {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, defaultGPSPort)
+	}
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to connect to GPS server %s: %s", address, err.Error())
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write([]byte("?WATCH={\"enable\":true,\"json\":true};\n")); err != nil {
+		return 0, 0, fmt.Errorf("failed to watch GPS server %s: %s", address, err.Error())
+	}
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var report gpsReport
+		if err := json.Unmarshal(scanner.Bytes(), &report); err != nil {
+			continue
+		}
+		// mode 2 and 3 are 2D and 3D fixes
+		if report.Class == "TPV" && report.Mode >= 2 && report.Lat != nil && report.Lon != nil {
+			return *report.Lat, *report.Lon, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, fmt.Errorf("failed to read GPS position from %s: %s", address, err.Error())
+	}
+	return 0, 0, fmt.Errorf("GPS server %s closed without a position", address)
+}
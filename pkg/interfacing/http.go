@@ -19,6 +19,8 @@ import (
 	"gopkg.in/cenkalti/backoff.v1"
 )
 
+var httpLog = logger.New("http")
+
 type HTTPRequest struct {
 	BaseURL string
 	c       *http.Client
@@ -145,7 +147,7 @@ func (r *HTTPRequest) Subscribe(streamPath string, ch chan datatype.Event, keepR
 		for {
 			if reader.Scan() {
 				line := reader.Text()
-				logger.Debug.Printf("stream received: %s", line)
+				httpLog.Debugf("stream received: %s", line)
 				eStart := strings.Index(line, "event:")
 				eEnd := strings.Index(line, "data:")
 				e := line[eStart+6 : eEnd]
@@ -182,13 +184,13 @@ func (r *HTTPRequest) Subscribe(streamPath string, ch chan datatype.Event, keepR
 	go func() {
 		for {
 			err := backoff.Retry(operation, backoff.NewExponentialBackOff())
-			logger.Error.Printf("Failed to subscribe %q: %s", streamPath, err.Error())
+			httpLog.Errorf("Failed to subscribe %q: %s", streamPath, err.Error())
 			if !keepRetry {
-				logger.Info.Printf("keepRetry is false. Closing...")
+				httpLog.Infof("keepRetry is false. Closing...")
 				break
 			}
 			time.Sleep(5 * time.Second)
-			logger.Info.Printf("Retrying to connect to %q in 5 seconds...", streamPath)
+			httpLog.Infof("Retrying to connect to %q in 5 seconds...", streamPath)
 		}
 
 	}()
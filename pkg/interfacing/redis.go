@@ -2,6 +2,8 @@ package interfacing
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v9"
@@ -28,11 +30,109 @@ func (r *RedisClient) connect() error {
 }
 
 func (r *RedisClient) Set(k string, v interface{}) error {
+	return r.SetWithTTL(k, v, 0)
+}
+
+// SetWithTTL sets the value of the key that expires after the TTL. The key does not
+// expire if TTL is zero
+func (r *RedisClient) SetWithTTL(k string, v interface{}, ttl time.Duration) error {
 	err := r.connect()
 	if err != nil {
 		return err
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	return r.client.Set(ctx, k, v, 0).Err()
+	return r.client.Set(ctx, k, v, ttl).Err()
+}
+
+// Get returns the value of the key. It returns false if the key does not exist
+func (r *RedisClient) Get(k string) (string, bool, error) {
+	err := r.connect()
+	if err != nil {
+		return "", false, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	v, err := r.client.Get(ctx, k).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	return v, true, nil
+}
+
+// Del deletes the keys
+func (r *RedisClient) Del(keys ...string) error {
+	err := r.connect()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return r.client.Del(ctx, keys...).Err()
+}
+
+// Keys returns the keys matching the pattern, e.g. job.42.*
+func (r *RedisClient) Keys(pattern string) ([]string, error) {
+	err := r.connect()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var keys []string
+	iter := r.client.Scan(ctx, 0, pattern, 0).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+// TTL returns the remaining time to live of the key. It returns a negative
+// duration if the key does not expire
+func (r *RedisClient) TTL(k string) (time.Duration, error) {
+	err := r.connect()
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return r.client.TTL(ctx, k).Result()
+}
+
+// WatchKeyspace sends keys matching the pattern to the channel whenever they are set,
+// deleted, or expired. It enables keyspace notifications of the server
+// and watches in background until the context is done
+func (r *RedisClient) WatchKeyspace(ctx context.Context, pattern string, ch chan<- string) error {
+	err := r.connect()
+	if err != nil {
+		return err
+	}
+	// K for keyspace events, g for generic commands such as DEL, $ for strings, and x for expiry
+	if err := r.client.ConfigSet(ctx, "notify-keyspace-events", "Kg$x").Err(); err != nil {
+		return fmt.Errorf("failed to enable keyspace notifications: %s", err.Error())
+	}
+	channelPrefix := fmt.Sprintf("__keyspace@%d__:", r.client.Options().DB)
+	pubsub := r.client.PSubscribe(ctx, channelPrefix+pattern)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return fmt.Errorf("failed to watch keyspace: %s", err.Error())
+	}
+	go func() {
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case m, ok := <-messages:
+				if !ok {
+					return
+				}
+				ch <- strings.TrimPrefix(m.Channel, channelPrefix)
+			}
+		}
+	}()
+	return nil
 }
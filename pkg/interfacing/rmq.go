@@ -13,6 +13,8 @@ import (
 	"gopkg.in/cenkalti/backoff.v1"
 )
 
+var rmqLog = logger.New("rabbitmq")
+
 type RabbitMQMessageWrapper struct {
 	DestName    string
 	RoutingKey  string
@@ -65,7 +67,7 @@ func (rh *RabbitMQHandler) Connect() error {
 			InsecureSkipVerify: true,
 		}
 		amqpAddress := fmt.Sprintf("amqps://%s:%s@%s", rh.rabbitmqUsername, rh.rabbitmqPassword, rh.RabbitmqURI)
-		logger.Debug.Printf("Connecting to %s...", rh.RabbitmqURI)
+		rmqLog.Debugf("Connecting to %s...", rh.RabbitmqURI)
 		conn, err := amqp.DialTLS(amqpAddress, tlsConf)
 		if err != nil {
 			return err
@@ -78,7 +80,7 @@ func (rh *RabbitMQHandler) Connect() error {
 		rh.rabbitmqChan = ch
 	} else {
 		amqpAddress := fmt.Sprintf("amqp://%s:%s@%s", rh.rabbitmqUsername, rh.rabbitmqPassword, rh.RabbitmqURI)
-		logger.Debug.Printf("Connecting to %s...", rh.RabbitmqURI)
+		rmqLog.Debugf("Connecting to %s...", rh.RabbitmqURI)
 		conn, err := amqp.Dial(amqpAddress)
 		if err != nil {
 			return err
@@ -169,7 +171,7 @@ func (rh *RabbitMQHandler) publish(m RabbitMQMessageWrapper) error {
 //
 // The message is sent to the "to-validator" exchange
 func (rh *RabbitMQHandler) SendWaggleMessageOnNode(message *datatype.WaggleMessage, scope string) error {
-	logger.Debug.Println(string(datatype.Dump(message)))
+	rmqLog.Debug(string(datatype.Dump(message)))
 	return rh.publish(*NewRabbitMQMessageWrapper(
 		"to-validator",
 		scope,
@@ -214,6 +216,37 @@ func (rh *RabbitMQHandler) GetReceiver(queueName string) (<-chan amqp.Delivery,
 // SubscribeEvents subscribes scheduling events from target exchange
 // it will attempt to reconnect if connection is closed
 func (rh *RabbitMQHandler) SubscribeEvents(exchange string, queueName string, topic string, ch chan datatype.Event) error {
+	rh.subscribe(exchange, queueName, topic, func(msg amqp.Delivery) {
+		if waggleMessage, err := datatype.Load(msg.Body); err == nil {
+			eventBuilder, err := datatype.NewSchedulerEventBuilderFromWaggleMessage(waggleMessage)
+			if err != nil {
+				rmqLog.Debugf("Failed to parse %v: %s", waggleMessage, err.Error())
+			} else {
+				if vsn, exist := waggleMessage.Meta["vsn"]; exist {
+					eventBuilder.AddEntry("vsn", vsn)
+				}
+				ch <- eventBuilder.Build()
+			}
+		}
+	})
+	return nil
+}
+
+// SubscribeMessages subscribes Waggle messages from target exchange
+// it will attempt to reconnect if connection is closed
+func (rh *RabbitMQHandler) SubscribeMessages(exchange string, queueName string, topic string, ch chan *datatype.WaggleMessage) error {
+	rh.subscribe(exchange, queueName, topic, func(msg amqp.Delivery) {
+		if waggleMessage, err := datatype.Load(msg.Body); err != nil {
+			rmqLog.Debugf("Failed to parse message from %q: %s", exchange, err.Error())
+		} else {
+			ch <- waggleMessage
+		}
+	})
+	return nil
+}
+
+// subscribe passes messages of the topic from the exchange to handle in the background
+func (rh *RabbitMQHandler) subscribe(exchange string, queueName string, topic string, handle func(amqp.Delivery)) {
 	operation := func() error {
 		q, err := rh.DeclareQueueAndConnectToExchange(exchange, queueName, topic)
 		if err != nil {
@@ -224,18 +257,7 @@ func (rh *RabbitMQHandler) SubscribeEvents(exchange string, queueName string, to
 			return err
 		}
 		for msg := range c {
-			if waggleMessage, err := datatype.Load(msg.Body); err == nil {
-				eventBuilder, err := datatype.NewSchedulerEventBuilderFromWaggleMessage(waggleMessage)
-				if err != nil {
-					logger.Debug.Printf("Failed to parse %v: %s", waggleMessage, err.Error())
-				} else {
-					if vsn, exist := waggleMessage.Meta["vsn"]; exist {
-						eventBuilder.AddEntry("vsn", vsn)
-					}
-					event := eventBuilder.Build()
-					ch <- &event
-				}
-			}
+			handle(msg)
 		}
 		return nil
 	}
@@ -243,24 +265,23 @@ func (rh *RabbitMQHandler) SubscribeEvents(exchange string, queueName string, to
 		for {
 			err := backoff.Retry(operation, backoff.NewExponentialBackOff())
 			if err != nil {
-				logger.Error.Printf("Failed to subscribe %q: %s", exchange, err.Error())
+				rmqLog.Errorf("Failed to subscribe %q: %s", exchange, err.Error())
 			} else {
-				logger.Info.Printf("Connection to %q is closed", exchange)
+				rmqLog.Infof("Connection to %q is closed", exchange)
 			}
-			logger.Info.Printf("Retrying to connect to %q in 5 seconds...", exchange)
+			rmqLog.Infof("Retrying to connect to %q in 5 seconds...", exchange)
 			time.Sleep(5 * time.Second)
 		}
 
 	}()
-	return nil
 }
 
 func (rh *RabbitMQHandler) StartLoop() {
 	go func() {
 		for m := range rh.chanToPublish {
-			logger.Debug.Printf("to %s with routing key %s: %s", m.DestName, m.RoutingKey, m.Body)
+			rmqLog.Debugf("to %s with routing key %s: %s", m.DestName, m.RoutingKey, m.Body)
 			if err := rh.publish(m); err != nil {
-				logger.Error.Printf("failed to send message to %s: %s", m.DestName, err.Error())
+				rmqLog.Errorf("failed to send message to %s: %s", m.DestName, err.Error())
 			}
 		}
 	}()
@@ -1,17 +1,107 @@
 package logger
 
 import (
+	"fmt"
 	"log"
 	"os"
 )
 
 var (
 	// Debug logs messages verbosely
-	Debug = log.New(os.Stdout, "DEBUG: ", log.Ldate|log.Ltime|log.Lshortfile)
+	Debug = log.New(&levelWriter{level: DebugLevel}, "", 0)
 	// Info logs information helpful to know
-	Info = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
+	Info = log.New(&levelWriter{level: InfoLevel}, "", 0)
 	// Warn logs warnings
-	Warn = log.New(os.Stdout, "WARNING: ", log.Ldate|log.Ltime|log.Lshortfile)
+	Warn = log.New(&levelWriter{level: WarnLevel}, "", 0)
 	// Error logs errors
-	Error = log.New(os.Stdout, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+	Error = log.New(&levelWriter{level: ErrorLevel}, "", 0)
 )
+
+// levelWriter writes messages of the global loggers through the structured logger
+// so that they follow the configured format and level
+type levelWriter struct {
+	level Level
+}
+
+func (w *levelWriter) Write(p []byte) (int, error) {
+	// the caller is above log.(*Logger).Output and Printf, Println, or Print
+	std.emit(4, w.level, string(trimNewline(p)), nil)
+	return len(p), nil
+}
+
+func trimNewline(p []byte) []byte {
+	if len(p) > 0 && p[len(p)-1] == '\n' {
+		return p[:len(p)-1]
+	}
+	return p
+}
+
+// Logger logs messages of a component with structured fields
+type Logger struct {
+	component string
+	fields    Fields
+}
+
+// New returns a logger of the component. The component is logged in every message
+// and its level can be set separately from other components
+func New(component string) *Logger {
+	return &Logger{component: component}
+}
+
+// With returns a logger that logs the fields in addition to the fields of the logger
+func (l *Logger) With(fields Fields) *Logger {
+	merged := make(Fields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &Logger{component: l.component, fields: merged}
+}
+
+// WithField returns a logger that logs the field in addition to the fields of the logger
+func (l *Logger) WithField(key string, value interface{}) *Logger {
+	return l.With(Fields{key: value})
+}
+
+// Enabled returns true if the component logs messages at the level
+func (l *Logger) Enabled(level Level) bool {
+	return std.enabled(l.component, level)
+}
+
+func (l *Logger) logf(level Level, format string, args ...interface{}) {
+	if !std.enabled(l.component, level) {
+		return
+	}
+	std.emit(3, level, fmt.Sprintf(format, args...), l)
+}
+
+func (l *Logger) log(level Level, args ...interface{}) {
+	if !std.enabled(l.component, level) {
+		return
+	}
+	std.emit(3, level, string(trimNewline([]byte(fmt.Sprintln(args...)))), l)
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) { l.logf(DebugLevel, format, args...) }
+func (l *Logger) Infof(format string, args ...interface{})  { l.logf(InfoLevel, format, args...) }
+func (l *Logger) Warnf(format string, args ...interface{})  { l.logf(WarnLevel, format, args...) }
+func (l *Logger) Errorf(format string, args ...interface{}) { l.logf(ErrorLevel, format, args...) }
+
+func (l *Logger) Debug(args ...interface{}) { l.log(DebugLevel, args...) }
+func (l *Logger) Info(args ...interface{})  { l.log(InfoLevel, args...) }
+func (l *Logger) Warn(args ...interface{})  { l.log(WarnLevel, args...) }
+func (l *Logger) Error(args ...interface{}) { l.log(ErrorLevel, args...) }
+
+// Fatalf logs the message as an error and exits
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	std.emit(2, ErrorLevel, fmt.Sprintf(format, args...), l)
+	os.Exit(1)
+}
+
+// Fatal logs the arguments as an error and exits
+func (l *Logger) Fatal(args ...interface{}) {
+	std.emit(2, ErrorLevel, string(trimNewline([]byte(fmt.Sprintln(args...)))), l)
+	os.Exit(1)
+}
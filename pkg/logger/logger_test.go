@@ -0,0 +1,125 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var callerLine = regexp.MustCompile(`logger_test\.go:\d+`)
+
+func withTestOutput(t *testing.T, config Config) *bytes.Buffer {
+	var b bytes.Buffer
+	if err := Configure(config); err != nil {
+		t.Fatal(err)
+	}
+	SetOutput(&b)
+	std.now = func() time.Time { return time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC) }
+	t.Cleanup(func() {
+		Configure(Config{Level: "debug"})
+		SetOutput(os.Stdout)
+		std.now = time.Now
+	})
+	return &b
+}
+
+func TestStructuredLogger(t *testing.T) {
+	tests := map[string]struct {
+		Config Config
+		Log    func()
+		Want   string
+	}{
+		"text": {
+			Config: Config{},
+			Log: func() {
+				New("nodescheduler").With(Fields{"job_id": "1", "plugin": "a b"}).Infof("plugin %q is queued", "a b")
+			},
+			Want: `INFO: 2023/01/02 03:04:05 logger_test.go:N: plugin "a b" is queued component=nodescheduler job_id=1 plugin="a b"`,
+		},
+		"logfmt": {
+			Config: Config{Format: "logfmt"},
+			Log: func() {
+				New("cloudscheduler").WithField("goal_id", "g").Warn("goal", "removed")
+			},
+			Want: `time=2023-01-02T03:04:05Z level=warning component=cloudscheduler caller=logger_test.go:N msg="goal removed" goal_id=g`,
+		},
+		"level": {
+			Config: Config{Level: "warning"},
+			Log: func() {
+				New("nodescheduler").Info("hidden")
+				New("nodescheduler").Error("shown")
+			},
+			Want: `ERROR: 2023/01/02 03:04:05 logger_test.go:N: shown component=nodescheduler`,
+		},
+		"component level": {
+			Config: Config{Level: "error", Components: map[string]string{"resourcemanager": "debug"}},
+			Log: func() {
+				New("nodescheduler").Info("hidden")
+				New("resourcemanager").Debug("shown")
+			},
+			Want: `DEBUG: 2023/01/02 03:04:05 logger_test.go:N: shown component=resourcemanager`,
+		},
+		"global logger": {
+			Config: Config{Format: "logfmt", Level: "info"},
+			Log: func() {
+				Debug.Printf("hidden")
+				Info.Printf("shown %d", 1)
+			},
+			Want: `time=2023-01-02T03:04:05Z level=info caller=logger_test.go:N msg="shown 1"`,
+		},
+	}
+	for name, test := range tests {
+		b := withTestOutput(t, test.Config)
+		test.Log()
+		if got := callerLine.ReplaceAllString(strings.TrimSpace(b.String()), "logger_test.go:N"); got != test.Want {
+			t.Errorf("%s: expected %s, but got %s", name, test.Want, got)
+		}
+	}
+}
+
+func TestStructuredLoggerJSON(t *testing.T) {
+	b := withTestOutput(t, Config{Format: "json"})
+	l := New("nodescheduler").With(Fields{"job_id": "1", "goal_id": "g"})
+	l.WithField("pod", "a-1").Errorf("plugin %q failed", "a")
+	var entry map[string]string
+	if err := json.Unmarshal(b.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"time":      "2023-01-02T03:04:05Z",
+		"level":     "error",
+		"component": "nodescheduler",
+		"msg":       `plugin "a" failed`,
+		"job_id":    "1",
+		"goal_id":   "g",
+		"pod":       "a-1",
+	}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Errorf("expected %s=%q, but got %q", k, v, entry[k])
+		}
+	}
+	if !callerLine.MatchString(entry["caller"]) {
+		t.Errorf("expected the caller in logger_test.go, but got %q", entry["caller"])
+	}
+	// fields of the parent logger are not changed
+	if _, exist := l.fields["pod"]; exist {
+		t.Errorf("expected the parent logger not to have pod")
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	for _, config := range []Config{
+		{Format: "xml"},
+		{Level: "verbose"},
+		{Components: map[string]string{"nodescheduler": "loud"}},
+	} {
+		if err := Configure(config); err == nil {
+			t.Errorf("expected an error for %+v, but got none", config)
+		}
+	}
+}
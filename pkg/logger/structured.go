@@ -0,0 +1,274 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a message
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+func (l Level) String() string {
+	switch l {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warning"
+	default:
+		return "error"
+	}
+}
+
+// ParseLevel returns the level of the name: debug, info, warning (or warn), or error
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return DebugLevel, nil
+	case "info":
+		return InfoLevel, nil
+	case "warning", "warn":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	default:
+		return InfoLevel, fmt.Errorf("unknown log level %q", name)
+	}
+}
+
+// Fields are key-value pairs logged along with a message, e.g. job_id, goal_id, plugin, and pod
+type Fields map[string]interface{}
+
+const (
+	FormatText   = "text"
+	FormatLogfmt = "logfmt"
+	FormatJSON   = "json"
+)
+
+// Config configures the format and levels of logging
+type Config struct {
+	// Format is text (default), logfmt, or json
+	Format string `json:"format,omitempty" yaml:"format,omitempty"`
+	// Level is the level of components not given in Components. Default is info
+	Level string `json:"level,omitempty" yaml:"level,omitempty"`
+	// Components sets the level of components, e.g. resourcemanager: debug
+	Components map[string]string `json:"components,omitempty" yaml:"components,omitempty"`
+}
+
+type structuredLogger struct {
+	mu         sync.RWMutex
+	out        io.Writer
+	format     string
+	level      Level
+	components map[string]Level
+	now        func() time.Time
+}
+
+var std = &structuredLogger{
+	out:        os.Stdout,
+	format:     FormatText,
+	level:      DebugLevel,
+	components: map[string]Level{},
+	now:        time.Now,
+}
+
+// Configure sets the format and levels of logging. It returns an error when
+// the format or a level is unknown, leaving the current configuration as is
+func Configure(config Config) error {
+	format := strings.ToLower(config.Format)
+	switch format {
+	case "":
+		format = FormatText
+	case FormatText, FormatLogfmt, FormatJSON:
+	default:
+		return fmt.Errorf("unknown log format %q", config.Format)
+	}
+	level := InfoLevel
+	if config.Level != "" {
+		l, err := ParseLevel(config.Level)
+		if err != nil {
+			return err
+		}
+		level = l
+	}
+	components := make(map[string]Level)
+	for component, name := range config.Components {
+		l, err := ParseLevel(name)
+		if err != nil {
+			return fmt.Errorf("failed to set log level of %q: %s", component, err.Error())
+		}
+		components[component] = l
+	}
+	std.mu.Lock()
+	defer std.mu.Unlock()
+	std.format = format
+	std.level = level
+	std.components = components
+	return nil
+}
+
+// SetOutput sets where messages are written to
+func SetOutput(w io.Writer) {
+	std.mu.Lock()
+	defer std.mu.Unlock()
+	std.out = w
+}
+
+// SetLevel sets the level of the component. An empty component sets the default level
+func SetLevel(component string, level Level) {
+	std.mu.Lock()
+	defer std.mu.Unlock()
+	if component == "" {
+		std.level = level
+	} else {
+		std.components[component] = level
+	}
+}
+
+func (s *structuredLogger) enabled(component string, level Level) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if l, exist := s.components[component]; exist {
+		return level >= l
+	}
+	return level >= s.level
+}
+
+// emit writes the message. skip is the number of stack frames above emit to the caller
+func (s *structuredLogger) emit(skip int, level Level, msg string, l *Logger) {
+	component := ""
+	var fields Fields
+	if l != nil {
+		component = l.component
+		fields = l.fields
+	}
+	if !s.enabled(component, level) {
+		return
+	}
+	caller := "???:0"
+	if _, file, line, ok := runtime.Caller(skip); ok {
+		caller = filepath.Base(file) + ":" + strconv.Itoa(line)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var b bytes.Buffer
+	switch s.format {
+	case FormatJSON:
+		writeJSON(&b, s.now(), level, component, caller, msg, fields)
+	case FormatLogfmt:
+		writeLogfmt(&b, s.now(), level, component, caller, msg, fields)
+	default:
+		writeText(&b, s.now(), level, component, caller, msg, fields)
+	}
+	b.WriteByte('\n')
+	s.out.Write(b.Bytes())
+}
+
+func sortedKeys(fields Fields) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func fieldValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case error:
+		return value.Error()
+	case fmt.Stringer:
+		return value.String()
+	default:
+		return v
+	}
+}
+
+var textPrefix = map[Level]string{
+	DebugLevel: "DEBUG: ",
+	InfoLevel:  "INFO: ",
+	WarnLevel:  "WARNING: ",
+	ErrorLevel: "ERROR: ",
+}
+
+// writeText writes the message as the standard logger used to, followed by the fields
+func writeText(b *bytes.Buffer, t time.Time, level Level, component string, caller string, msg string, fields Fields) {
+	b.WriteString(textPrefix[level])
+	b.WriteString(t.Format("2006/01/02 15:04:05 "))
+	b.WriteString(caller)
+	b.WriteString(": ")
+	b.WriteString(msg)
+	if component != "" {
+		b.WriteString(" component=")
+		writeLogfmtValue(b, component)
+	}
+	for _, k := range sortedKeys(fields) {
+		b.WriteString(" " + k + "=")
+		writeLogfmtValue(b, fieldValue(fields[k]))
+	}
+}
+
+func writeLogfmt(b *bytes.Buffer, t time.Time, level Level, component string, caller string, msg string, fields Fields) {
+	b.WriteString("time=" + t.Format(time.RFC3339Nano))
+	b.WriteString(" level=" + level.String())
+	if component != "" {
+		b.WriteString(" component=")
+		writeLogfmtValue(b, component)
+	}
+	b.WriteString(" caller=" + caller)
+	b.WriteString(" msg=")
+	writeLogfmtValue(b, msg)
+	for _, k := range sortedKeys(fields) {
+		b.WriteString(" " + k + "=")
+		writeLogfmtValue(b, fieldValue(fields[k]))
+	}
+}
+
+func writeLogfmtValue(b *bytes.Buffer, v interface{}) {
+	s := fmt.Sprint(v)
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		s = strconv.Quote(s)
+	}
+	b.WriteString(s)
+}
+
+func writeJSON(b *bytes.Buffer, t time.Time, level Level, component string, caller string, msg string, fields Fields) {
+	entry := make(map[string]interface{}, len(fields)+5)
+	for k, v := range fields {
+		entry[k] = fieldValue(v)
+	}
+	entry["time"] = t.Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["caller"] = caller
+	entry["msg"] = msg
+	if component != "" {
+		entry["component"] = component
+	}
+	blob, err := json.Marshal(entry)
+	if err != nil {
+		// fields that cannot be marshaled are logged as strings
+		for k, v := range fields {
+			entry[k] = fmt.Sprint(v)
+		}
+		blob, _ = json.Marshal(entry)
+	}
+	b.Write(blob)
+}
@@ -2,18 +2,23 @@ package nodescheduler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	// "net/http/pprof"
 
 	"github.com/gorilla/mux"
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+	"github.com/waggle-sensor/edge-scheduler/pkg/sciencerule"
 	// "github.com/urfave/negroni"
 )
 
+var apiLog = logger.New("apiserver")
+
 type APIServer struct {
 	version       string
 	port          int
@@ -23,7 +28,7 @@ type APIServer struct {
 
 func (api *APIServer) Run() {
 	api_address_port := fmt.Sprintf("0.0.0.0:%d", api.port)
-	logger.Info.Printf("API server starts at %q...", api_address_port)
+	apiLog.Infof("API server starts at %q...", api_address_port)
 	api.mainRouter = mux.NewRouter()
 	r := api.mainRouter
 	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -35,8 +40,13 @@ func (api *APIServer) Run() {
 	// go http.ListenAndServe(":18080", nil)
 	api_route.Handle("/goals", http.HandlerFunc(api.handlerGoals)).Methods(http.MethodGet, http.MethodPost, http.MethodPut)
 	api_route.Handle("/schedule", http.HandlerFunc(api.handlerSchedule)).Methods(http.MethodGet, http.MethodPost, http.MethodPut)
+	api_route.Handle("/fairshare", http.HandlerFunc(api.handlerFairShare)).Methods(http.MethodGet)
+	api_route.Handle("/rules", http.HandlerFunc(api.handlerRules)).Methods(http.MethodGet)
+	api_route.Handle("/rules/evaluate", http.HandlerFunc(api.handlerRulesEvaluate)).Methods(http.MethodPost)
+	api_route.Handle("/scoreboard", http.HandlerFunc(api.handlerScoreboard)).Methods(http.MethodGet)
+	api_route.Handle("/plugins/context", http.HandlerFunc(api.handlerPluginContext)).Methods(http.MethodPost)
 	// api_route.Handle("/status/queue/waiting", http.HandlerFunc(api.handlerGoals)).Methods(http.MethodGet, http.MethodPost, http.MethodPut)
-	logger.Info.Fatalln(http.ListenAndServe(api_address_port, r))
+	apiLog.Fatal(http.ListenAndServe(api_address_port, r))
 }
 
 func respondJSON(w http.ResponseWriter, statusCode int, data []byte) {
@@ -59,7 +69,7 @@ func (api *APIServer) handlerGoals(w http.ResponseWriter, r *http.Request) {
 			respondJSON(w, http.StatusBadRequest, response.ToJson())
 			return
 		} else {
-			logger.Debug.Printf("%s", string(blob))
+			apiLog.Debugf("%s", string(blob))
 			err = json.Unmarshal(blob, &newGoals)
 			if err != nil {
 				response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
@@ -67,7 +77,7 @@ func (api *APIServer) handlerGoals(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 		}
-		logger.Info.Printf("Adding goals by the REST call.")
+		apiLog.Infof("Adding goals by the REST call.")
 		for _, goal := range newGoals {
 			api.nodeScheduler.GoalManager.AddGoal(&goal)
 		}
@@ -90,7 +100,7 @@ func (api *APIServer) handlerSchedule(w http.ResponseWriter, r *http.Request) {
 			respondJSON(w, http.StatusBadRequest, response.ToJson())
 			return
 		} else {
-			logger.Debug.Printf("%s", string(blob))
+			apiLog.Debugf("%s", string(blob))
 			err = json.Unmarshal(blob, &newPlugin)
 			if err != nil {
 				response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
@@ -98,7 +108,7 @@ func (api *APIServer) handlerSchedule(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 		}
-		logger.Info.Printf("locally requested to add plugin %q to schedule", newPlugin.Name)
+		apiLog.With(newPlugin.LogFields()).Infof("locally requested to add plugin %q to schedule", newPlugin.Name)
 		e := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusQueued).AddReason("locally submitted").Build()
 		// api.nodeScheduler.LogToBeehive.SendWaggleMessageOnNodeAsync(response.ToWaggleMessage(), "node")
 		pr := datatype.NewPluginRuntimeWithScienceRule(newPlugin, datatype.ScienceRule{})
@@ -113,3 +123,155 @@ func (api *APIServer) handlerSchedule(w http.ResponseWriter, r *http.Request) {
 		respondJSON(w, http.StatusOK, response.ToJson())
 	}
 }
+
+func (api *APIServer) handlerFairShare(w http.ResponseWriter, r *http.Request) {
+	report := api.nodeScheduler.ShareAccounting.GetReport(time.Now())
+	response := datatype.NewAPIMessageBuilder().
+		AddEntity("time", report.Time).
+		AddEntity("half_life", report.HalfLife).
+		AddEntity("jobs", report.Jobs).
+		AddEntity("users", report.Users).
+		AddEntity("owners", report.Owners).
+		Build()
+	respondJSON(w, http.StatusOK, response.ToJson())
+}
+
+// handlerRules responds with the evaluation history of science rules of the goals
+func (api *APIServer) handlerRules(w http.ResponseWriter, r *http.Request) {
+	goals := make(map[string][]RuleHistory)
+	for _, goalID := range api.nodeScheduler.scienceGoalIDs() {
+		if history, exist := api.nodeScheduler.Knowledgebase.GetRuleHistory(goalID); exist {
+			goals[goalID] = history
+		}
+	}
+	response := datatype.NewAPIMessageBuilder().AddEntity("goals", goals).Build()
+	respondJSON(w, http.StatusOK, response.ToJson())
+}
+
+// handlerRulesEvaluate evaluates the condition in the request immediately, e.g.
+// {"condition": "v('env.temperature') > 30", "job_id": "42"}, and responds with the result and
+// the values the condition read. A syntax error responds with its position
+func (api *APIServer) handlerRulesEvaluate(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Condition string `json:"condition"`
+		// JobID makes scoreboard() read the states of the job
+		JobID string `json:"job_id"`
+	}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+		respondJSON(w, http.StatusBadRequest, response.ToJson())
+		return
+	}
+	result, err := api.nodeScheduler.Knowledgebase.EvaluateCondition(request.Condition, request.JobID)
+	if err != nil {
+		builder := datatype.NewAPIMessageBuilder().AddError(err.Error())
+		var syntaxError *sciencerule.SyntaxError
+		if errors.As(err, &syntaxError) {
+			builder.AddEntity("message", syntaxError.Message).
+				AddEntity("position", syntaxError.Position)
+		}
+		respondJSON(w, http.StatusBadRequest, builder.Build().ToJson())
+		return
+	}
+	response := datatype.NewAPIMessageBuilder().
+		AddEntity("condition", result.Condition).
+		AddEntity("result", result.Result).
+		AddEntity("values", result.Values).
+		AddEntity("inputs", result.Inputs).
+		AddEntity("time_based", result.TimeBased)
+	if result.Error != "" {
+		response.AddError(result.Error)
+	}
+	respondJSON(w, http.StatusOK, response.Build().ToJson())
+}
+
+// handlerPluginContext lets a running plugin control itself, e.g.
+// {"app_id": "<WAGGLE_APP_ID>", "status": "Runnable", "run_after": "10m"}. Stoppable stops
+// the plugin, Runnable with run_after queues the plugin again after the duration, and
+// Runnable without run_after keeps the plugin running against stop() and suspend() rules
+func (api *APIServer) handlerPluginContext(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		AppID    string                 `json:"app_id"`
+		Status   datatype.ContextStatus `json:"status"`
+		RunAfter string                 `json:"run_after"`
+	}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+		respondJSON(w, http.StatusBadRequest, response.ToJson())
+		return
+	}
+	event, err := newPluginContextEvent(request.Status, request.RunAfter)
+	if err != nil {
+		response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+		respondJSON(w, http.StatusBadRequest, response.ToJson())
+		return
+	}
+	notFound := datatype.NewAPIMessageBuilder().AddError(fmt.Sprintf("no plugin runs with app ID %q", request.AppID)).Build()
+	if request.AppID == "" {
+		respondJSON(w, http.StatusNotFound, notFound.ToJson())
+		return
+	}
+	event.PodUID = request.AppID
+	// plugins are looked up in the scheduler loop that changes them
+	reply := make(chan string, 1)
+	api.nodeScheduler.chanContextEventToScheduler <- pluginContextRequest{Event: event, Reply: reply}
+	var pluginName string
+	select {
+	case pluginName = <-reply:
+	case <-r.Context().Done():
+		return
+	}
+	if pluginName == "" {
+		respondJSON(w, http.StatusNotFound, notFound.ToJson())
+		return
+	}
+	apiLog.WithField("pod_uid", request.AppID).Debugf("plugin %q sent %s", pluginName, event.Status)
+	response := datatype.NewAPIMessageBuilder().
+		AddEntity("plugin_name", pluginName).
+		AddEntity("status", "accepted").Build()
+	respondJSON(w, http.StatusAccepted, response.ToJson())
+}
+
+// newPluginContextEvent returns the event of the status. run_after is a duration that
+// only Runnable takes, e.g. 10m
+func newPluginContextEvent(status datatype.ContextStatus, runAfter string) (datatype.EventPluginContext, error) {
+	e := datatype.EventPluginContext{Status: status}
+	switch status {
+	case datatype.Runnable:
+		if runAfter == "" {
+			return e, nil
+		}
+		d, err := sciencerule.ParseDuration(runAfter)
+		if err != nil || d <= 0 {
+			return e, fmt.Errorf("run_after must be a positive duration, e.g. 10m")
+		}
+		e.RunAfter = d
+	case datatype.Stoppable:
+		if runAfter != "" {
+			return e, fmt.Errorf("run_after is only for %s", datatype.Runnable)
+		}
+	default:
+		return e, fmt.Errorf("status must be %s or %s", datatype.Runnable, datatype.Stoppable)
+	}
+	return e, nil
+}
+
+// handlerScoreboard responds with the states in the scoreboard, or the states
+// of the job given by ?job_id=
+func (api *APIServer) handlerScoreboard(w http.ResponseWriter, r *http.Request) {
+	if api.nodeScheduler.ToScoreboard == nil {
+		response := datatype.NewAPIMessageBuilder().AddError("scoreboard is not available").Build()
+		respondJSON(w, http.StatusServiceUnavailable, response.ToJson())
+		return
+	}
+	states, err := ListScoreboard(api.nodeScheduler.ToScoreboard, r.URL.Query().Get("job_id"))
+	if err != nil {
+		response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+		respondJSON(w, http.StatusInternalServerError, response.ToJson())
+		return
+	}
+	response := datatype.NewAPIMessageBuilder().AddEntity("states", states).Build()
+	respondJSON(w, http.StatusOK, response.ToJson())
+}
@@ -0,0 +1,98 @@
+package nodescheduler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestHandlerPluginContext(t *testing.T) {
+	pr := datatype.NewPluginRuntime(datatype.Plugin{Name: "sampler", GoalID: "goal-1", JobID: "42"})
+	pr.SetPodUID("pod-uid-1")
+	ns := &NodeScheduler{
+		GoalManager: &NodeGoalManager{
+			LoadedPlugins: map[PluginIndex]*datatype.PluginRuntime{
+				{name: "sampler", goalID: "goal-1", jobID: "42"}: pr,
+			},
+		},
+		chanContextEventToScheduler: make(chan pluginContextRequest),
+	}
+	// the scheduler loop looks up the plugin and passes on events of plugins it found
+	events := make(chan datatype.EventPluginContext, 1)
+	go func() {
+		for req := range ns.chanContextEventToScheduler {
+			pr := ns.pluginForContext(&req.Event)
+			if pr == nil {
+				req.Reply <- ""
+				continue
+			}
+			events <- req.Event
+			req.Reply <- pr.Plugin.Name
+		}
+	}()
+	defer close(ns.chanContextEventToScheduler)
+	api := &APIServer{nodeScheduler: ns}
+	tests := map[string]struct {
+		Body  string
+		Code  int
+		Event *datatype.EventPluginContext
+	}{
+		"Run again": {
+			Body:  `{"app_id": "pod-uid-1", "status": "Runnable", "run_after": "10m"}`,
+			Code:  http.StatusAccepted,
+			Event: &datatype.EventPluginContext{GoalID: "goal-1", PluginName: "sampler", Status: datatype.Runnable, PodUID: "pod-uid-1", RunAfter: 10 * time.Minute},
+		},
+		"Keep running": {
+			Body:  `{"app_id": "pod-uid-1", "status": "Runnable"}`,
+			Code:  http.StatusAccepted,
+			Event: &datatype.EventPluginContext{GoalID: "goal-1", PluginName: "sampler", Status: datatype.Runnable, PodUID: "pod-uid-1"},
+		},
+		"Stop": {
+			Body:  `{"app_id": "pod-uid-1", "status": "Stoppable"}`,
+			Code:  http.StatusAccepted,
+			Event: &datatype.EventPluginContext{GoalID: "goal-1", PluginName: "sampler", Status: datatype.Stoppable, PodUID: "pod-uid-1"},
+		},
+		"Unknown app ID": {
+			Body: `{"app_id": "pod-uid-2", "status": "Stoppable"}`,
+			Code: http.StatusNotFound,
+		},
+		"Unknown status": {
+			Body: `{"app_id": "pod-uid-1", "status": "Paused"}`,
+			Code: http.StatusBadRequest,
+		},
+		"Stop later": {
+			Body: `{"app_id": "pod-uid-1", "status": "Stoppable", "run_after": "10m"}`,
+			Code: http.StatusBadRequest,
+		},
+		"Invalid duration": {
+			Body: `{"app_id": "pod-uid-1", "status": "Runnable", "run_after": "-10m"}`,
+			Code: http.StatusBadRequest,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/plugins/context", strings.NewReader(test.Body))
+			api.handlerPluginContext(w, r)
+			if w.Code != test.Code {
+				t.Errorf("wanted %d but got %d: %s", test.Code, w.Code, w.Body.String())
+			}
+			select {
+			case e := <-events:
+				if test.Event == nil {
+					t.Errorf("wanted no event but got %+v", e)
+				} else if e != *test.Event {
+					t.Errorf("wanted %+v but got %+v", *test.Event, e)
+				}
+			default:
+				if test.Event != nil {
+					t.Errorf("wanted %+v but got no event", *test.Event)
+				}
+			}
+		})
+	}
+}
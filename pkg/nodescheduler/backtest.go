@@ -0,0 +1,309 @@
+package nodescheduler
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/sciencerule"
+)
+
+const (
+	// maxBacktestChain is how many times states set by rules re-evaluate rules at a time
+	maxBacktestChain = 10
+	// backtestNode is the node that the backtest evaluates science rules for
+	backtestNode = "backtest"
+	// defaultBacktestInterval is how often the node scheduler evaluates time-based rules
+	defaultBacktestInterval = 10 * time.Second
+)
+
+// BacktestConfig configures a backtest
+type BacktestConfig struct {
+	// Start is when the backtest starts. Measurements given with offsets are relative to it.
+	// It is the earliest timestamp of the measurements if not given
+	Start time.Time
+	// End is when the backtest ends. It is the time of the last measurement if not given
+	End time.Time
+	// Interval is how often time-based rules are evaluated
+	Interval time.Duration
+	// PluginRunTime is how long a plugin runs once it is scheduled. Schedule
+	// rules that fire while the plugin is running do not start another run
+	PluginRunTime time.Duration
+	// Location is where the node is for solar functions, e.g. daylight()
+	Location *sciencerule.Location
+}
+
+// BacktestFiring is a science rule that fired in the backtest
+type BacktestFiring struct {
+	Time   time.Time `json:"time"`
+	Rule   string    `json:"rule"`
+	Action string    `json:"action"`
+	Object string    `json:"object"`
+	// Outcome is what happened to the plugin for plugin actions, e.g. started
+	Outcome string `json:"outcome,omitempty"`
+}
+
+// BacktestDay summarizes a day of the backtest
+type BacktestDay struct {
+	Date string `json:"date"`
+	// Firings is the number of times each rule fired
+	Firings map[string]int `json:"firings"`
+	// PluginRuns is the number of runs of each plugin
+	PluginRuns map[string]int `json:"plugin_runs"`
+}
+
+// BacktestReport is the result of a backtest
+type BacktestReport struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Rules are the science rules of the job in order
+	Rules   []string         `json:"rules"`
+	Firings []BacktestFiring `json:"firings"`
+	Days    []*BacktestDay   `json:"days"`
+	// Errors are the first error of each rule that failed to evaluate
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// backtestPlugin is the state of a plugin in the backtest
+type backtestPlugin struct {
+	runningUntil time.Time
+	suspended    bool
+}
+
+// backtestEvaluator keeps the first error of each condition, so that failing
+// rules are reported once instead of every evaluation
+type backtestEvaluator struct {
+	checker *SimulatedRuleChecker
+	errors  map[string]string
+}
+
+func (e *backtestEvaluator) Evaluate(condition string) (bool, error) {
+	valid, err := e.checker.Evaluate(condition)
+	if err != nil {
+		if _, exist := e.errors[condition]; !exist {
+			e.errors[condition] = err.Error()
+		}
+		return false, nil
+	}
+	return valid, nil
+}
+
+// Backtest replays the measurements through the science rules of the job as the node
+// scheduler evaluates them. Event-driven rules are evaluated at every measurement they
+// read, and time-based rules are evaluated at every interval
+func Backtest(job *datatype.Job, measurements []SimulatedMeasurement, config BacktestConfig) (*BacktestReport, error) {
+	if config.Interval <= 0 {
+		config.Interval = defaultBacktestInterval
+	}
+	if config.PluginRunTime <= 0 {
+		config.PluginRunTime = defaultSimulatedPodInitTime + defaultSimulatedPodRunTime
+	}
+	start := config.Start
+	if start.IsZero() {
+		for _, m := range measurements {
+			if !m.Time.IsZero() && (start.IsZero() || m.Time.Before(start)) {
+				start = m.Time
+			}
+		}
+		if start.IsZero() {
+			return nil, fmt.Errorf("start time is required as measurements do not have timestamps")
+		}
+	}
+	resolveMeasurementTimes(measurements, start)
+	end := config.End
+	if end.IsZero() && len(measurements) > 0 {
+		end = start.Add(measurements[len(measurements)-1].Offset)
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("end time %s is before start time %s", end.Format(time.RFC3339), start.Format(time.RFC3339))
+	}
+
+	var rules []datatype.ScienceRule
+	for _, rule := range job.ScienceRules {
+		r, err := datatype.NewScienceRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, *r)
+	}
+	builder := datatype.NewScienceGoalBuilder(job.Name, job.JobID).
+		AddSubGoal(backtestNode, job.Plugins, rules)
+	if builder == nil {
+		return nil, fmt.Errorf("failed to create science goal of job %q", job.Name)
+	}
+	goal := builder.Build()
+
+	now := start
+	clock := func() time.Time { return now }
+	evaluator := &backtestEvaluator{
+		checker: NewSimulatedRuleChecker(clock),
+		errors:  make(map[string]string),
+	}
+	scoreboard := NewMemoryScoreboard(clock)
+	kb := NewKnowledgeBase(backtestNode, "")
+	kb.SetRuleEvaluator(evaluator)
+	kb.SetClock(clock)
+	kb.SetScoreboard(scoreboard)
+	if config.Location != nil {
+		kb.SetLocation(*config.Location)
+	}
+	if err := kb.AddRulesFromScienceGoal(goal); err != nil {
+		return nil, err
+	}
+
+	report := &BacktestReport{
+		Start:  start,
+		End:    end,
+		Rules:  job.ScienceRules,
+		Errors: make(map[string]string),
+	}
+	days := make(map[string]*BacktestDay)
+	for d := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location()); !d.After(end); d = d.AddDate(0, 0, 1) {
+		getBacktestDay(days, d)
+	}
+	plugins := make(map[string]*backtestPlugin)
+	var record func(fired []datatype.ScienceRule, chain int) error
+	record = func(fired []datatype.ScienceRule, chain int) error {
+		states := make(map[sciencerule.Dependency]bool)
+		for _, r := range fired {
+			f := BacktestFiring{
+				Time:   now,
+				Rule:   r.Rule,
+				Action: string(r.ActionType),
+				Object: r.ActionObject,
+			}
+			day := getBacktestDay(days, now)
+			day.Firings[r.Rule] += 1
+			if r.TargetsPlugin() {
+				p, exist := plugins[r.ActionObject]
+				if !exist {
+					p = &backtestPlugin{}
+					plugins[r.ActionObject] = p
+				}
+				f.Outcome = p.apply(r.ActionType, now, config.PluginRunTime)
+				if f.Outcome == "started" {
+					day.PluginRuns[r.ActionObject] += 1
+				}
+			}
+			if r.ActionType == datatype.ScienceRuleActionSet {
+				key := datatype.ScoreboardKey(goal.JobID, r.ActionObject, r.SetOptions.Global)
+				v, err := kb.EvaluateActionValue(r.Value, goal.JobID)
+				if err == nil {
+					var value string
+					if value, err = encodeState(v); err == nil {
+						scoreboard.SetWithTTL(key, value, r.SetOptions.TTL)
+						states[sciencerule.NewScoreboardDependency(key)] = true
+					}
+				}
+				if err != nil {
+					f.Outcome = "failed: " + err.Error()
+				}
+			}
+			report.Firings = append(report.Firings, f)
+		}
+		// rules reading the states are evaluated as the node scheduler does after set
+		if len(states) < 1 || chain >= maxBacktestChain {
+			return nil
+		}
+		fired, err := kb.EvaluateRulesReading(goal.ID, states)
+		if err != nil {
+			return err
+		}
+		return record(fired, chain+1)
+	}
+
+	nextTick := start
+	for i := 0; ; {
+		if i < len(measurements) && !start.Add(measurements[i].Offset).After(nextTick) {
+			m := measurements[i]
+			i++
+			if m.Offset < 0 {
+				continue
+			}
+			if now = start.Add(m.Offset); now.After(end) {
+				break
+			}
+			evaluator.checker.Store(m.Name, m.Value)
+			dep := sciencerule.NewMeasurementDependency(m.Name)
+			if kb.HasDependents(dep) {
+				fired, err := kb.EvaluateRulesReading(goal.ID, map[sciencerule.Dependency]bool{dep: true})
+				if err != nil {
+					return nil, err
+				}
+				if err := record(fired, 0); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		if nextTick.After(end) {
+			break
+		}
+		now = nextTick
+		fired, err := kb.EvaluateTimeBasedRules(goal.ID)
+		if err != nil {
+			return nil, err
+		}
+		if err := record(fired, 0); err != nil {
+			return nil, err
+		}
+		nextTick = nextTick.Add(config.Interval)
+	}
+
+	for _, r := range rules {
+		if err, exist := evaluator.errors[r.Condition]; exist {
+			report.Errors[r.Rule] = err
+		}
+	}
+	for _, day := range days {
+		report.Days = append(report.Days, day)
+	}
+	sort.Slice(report.Days, func(i, j int) bool {
+		return report.Days[i].Date < report.Days[j].Date
+	})
+	return report, nil
+}
+
+// getBacktestDay returns the summary of the day of the time, adding it if not exist
+func getBacktestDay(days map[string]*BacktestDay, t time.Time) *BacktestDay {
+	date := t.Format("2006-01-02")
+	if _, exist := days[date]; !exist {
+		days[date] = &BacktestDay{
+			Date:       date,
+			Firings:    make(map[string]int),
+			PluginRuns: make(map[string]int),
+		}
+	}
+	return days[date]
+}
+
+// apply performs the plugin action as the node scheduler does and returns what
+// happened to the plugin
+func (p *backtestPlugin) apply(action datatype.ScienceRuleActionType, now time.Time, runTime time.Duration) string {
+	running := now.Before(p.runningUntil)
+	switch action {
+	case datatype.ScienceRuleActionSchedule:
+		if p.suspended {
+			return "suspended"
+		}
+		if running {
+			return "running"
+		}
+		p.runningUntil = now.Add(runTime)
+		return "started"
+	case datatype.ScienceRuleActionStop:
+		if running {
+			p.runningUntil = now
+			return "stopped"
+		}
+	case datatype.ScienceRuleActionSuspend:
+		p.suspended = true
+		p.runningUntil = now
+		return "suspended"
+	case datatype.ScienceRuleActionResume:
+		p.suspended = false
+		return "resumed"
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+package nodescheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestBacktest(t *testing.T) {
+	start := time.Date(2023, 6, 1, 23, 50, 0, 0, time.UTC)
+	measurements := func() []SimulatedMeasurement {
+		var ms []SimulatedMeasurement
+		// the temperature rises above 30 for 10 minutes every hour from midnight
+		for m := 0; m < 120; m++ {
+			v := 20.
+			if m >= 10 && (m-10)%60 < 10 {
+				v = 35.
+			}
+			ms = append(ms, SimulatedMeasurement{Time: start.Add(time.Duration(m) * time.Minute), Name: "env.temperature", Value: v})
+		}
+		return ms
+	}
+	tests := map[string]struct {
+		Rules []string
+		// Runs are the plugin runs of detector per day
+		Runs    map[string]int
+		Firings int
+		Error   bool
+	}{
+		"level": {
+			Rules:   []string{"schedule(detector): v('env.temperature') > 30"},
+			Runs:    map[string]int{"2023-06-01": 0, "2023-06-02": 10},
+			Firings: 20,
+		},
+		"rising": {
+			Rules:   []string{"schedule(detector, on=rising): v('env.temperature') > 30"},
+			Runs:    map[string]int{"2023-06-01": 0, "2023-06-02": 2},
+			Firings: 2,
+		},
+		"time window": {
+			// evaluated every 10 seconds as the window moves over time
+			Rules:   []string{"schedule(detector, on=rising): avg(v('env.temperature', since='-5m')) > 30"},
+			Runs:    map[string]int{"2023-06-01": 0, "2023-06-02": 2},
+			Firings: 2,
+		},
+		"suspended": {
+			Rules: []string{
+				"schedule(detector): v('env.temperature') > 30",
+				"suspend(detector): True",
+			},
+			Runs: map[string]int{"2023-06-01": 0, "2023-06-02": 0},
+			// suspend() fires at every 10 seconds for 119 minutes
+			Firings: 20 + 119*6 + 1,
+		},
+		"invalid rule": {
+			Rules: []string{"schedule(detector) v('env.temperature') > 30"},
+			Error: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			job := datatype.NewJob("backtest", "theone", "")
+			job.Plugins = []*datatype.Plugin{{Name: "detector", PluginSpec: &datatype.PluginSpec{Image: "detector:latest"}}}
+			job.ScienceRules = test.Rules
+			report, err := Backtest(job, measurements(), BacktestConfig{})
+			if test.Error {
+				if err == nil {
+					t.Errorf("expected an error, but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Firings) != test.Firings {
+				t.Errorf("expected %d firings, but got %d", test.Firings, len(report.Firings))
+			}
+			if len(report.Days) != len(test.Runs) {
+				t.Fatalf("expected %d days, but got %d", len(test.Runs), len(report.Days))
+			}
+			for _, day := range report.Days {
+				if day.PluginRuns["detector"] != test.Runs[day.Date] {
+					t.Errorf("expected %d runs on %s, but got %d", test.Runs[day.Date], day.Date, day.PluginRuns["detector"])
+				}
+			}
+		})
+	}
+}
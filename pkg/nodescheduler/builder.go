@@ -1,11 +1,16 @@
 package nodescheduler
 
 import (
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
 	"github.com/waggle-sensor/edge-scheduler/pkg/nodescheduler/policy"
+	"github.com/waggle-sensor/edge-scheduler/pkg/sciencerule"
+	"github.com/waggle-sensor/edge-scheduler/pkg/tracing"
 )
 
 type NodeSchedulerConfig struct {
@@ -15,35 +20,116 @@ type NodeSchedulerConfig struct {
 	RabbitmqURI      string `json:"rabbitmq_uri" yaml:"rabbimqURI"`
 	RabbitmqUsername string `json:"rabbitmq_username" yaml:"rabbitMQUsername"`
 	RabbitmqPassword string `json:"rabbitmq_password" yaml:"rabbitMQPassword"`
-	Kubeconfig       string `json:"kubeconfig" yaml:"kubeConfig"`
-	InCluster        bool   `json:"in_cluster" yaml:"inCluster"`
-	RuleCheckerURI   string `json:"rulechecker_uri" yaml:"ruleCheckerURI"`
-	ScoreboardURI    string `json:"scoreboard_uri" yaml:"scoreboardURI"`
-	Simulate         bool   `json:"simulate" yaml:"simulate"`
-	GoalStreamURL    string `json:"goalstream_URI" yaml:"goalStreamURL"`
-	SchedulingPolicy string `json:"policy" yaml:"policy"`
-	Debug            bool   `json:"debug" yaml:"debug"`
+	// RabbitmqManagementURI is the management API of RabbitMQ on the node, e.g.
+	// http://wes-rabbitmq:15672. Plugins get a credential per run if given
+	RabbitmqManagementURI string `json:"rabbitmq_management_uri,omitempty" yaml:"rabbitMQManagementURI,omitempty"`
+	Kubeconfig            string `json:"kubeconfig" yaml:"kubeConfig"`
+	InCluster             bool   `json:"in_cluster" yaml:"inCluster"`
+	RuleCheckerURI        string `json:"rulechecker_uri" yaml:"ruleCheckerURI"`
+	ScoreboardURI         string `json:"scoreboard_uri" yaml:"scoreboardURI"`
+	Simulate              bool   `json:"simulate" yaml:"simulate"`
+	GoalStreamURL         string `json:"goalstream_URI" yaml:"goalStreamURL"`
+	SchedulingPolicy      string `json:"policy" yaml:"policy"`
+	Debug                 bool   `json:"debug" yaml:"debug"`
+	// PolicyChain overrides SchedulingPolicy when given
+	PolicyChain *policy.ChainConfig `json:"policy_chain,omitempty" yaml:"policyChain,omitempty"`
+	// GPUCompute describes the compute that runs GPU-demand plugins
+	GPUCompute *datatype.ComputeHardwareManifest `json:"gpu_compute,omitempty" yaml:"gpuCompute,omitempty"`
+	// FairShareHalfLife is the half-life of pod-seconds consumed by jobs and users, e.g. 1h
+	FairShareHalfLife string `json:"fairshare_half_life,omitempty" yaml:"fairShareHalfLife,omitempty"`
+	// Simulation configures the simulation when Simulate is set
+	Simulation *SimulationConfig `json:"simulation,omitempty" yaml:"simulation,omitempty"`
+	// Logging configures the log format and levels of components
+	Logging logger.Config `json:"logging,omitempty" yaml:"logging,omitempty"`
+	// OTLPEndpoint is the OpenTelemetry collector to export spans to, e.g. http://localhost:4318
+	OTLPEndpoint string `json:"otlp_endpoint,omitempty" yaml:"otlpEndpoint,omitempty"`
+	// Location is the latitude and longitude of the node for solar functions in
+	// science rules, e.g. 41.7,-87.98. It is read from GPSServerURI if not given
+	Location     string `json:"location,omitempty" yaml:"location,omitempty"`
+	GPSServerURI string `json:"gps_server_uri,omitempty" yaml:"gpsServerURI,omitempty"`
+	// VolumeHostPaths are host paths that plugins may mount, e.g. /media/plugin-data/shared
+	// or /etc/waggle:ro for read-only. Plugins cannot mount host paths if not given
+	VolumeHostPaths []string `json:"volume_host_paths,omitempty" yaml:"volumeHostPaths,omitempty"`
+	// HostRoot is where the host filesystem is mounted in the scheduler's container, e.g. /host.
+	// Paths under VolumeHostPaths can be mounted only if it is given
+	HostRoot string `json:"host_root,omitempty" yaml:"hostRoot,omitempty"`
 }
 
 type NodeSchedulerBuilder struct {
 	nodeScheduler *NodeScheduler
+	err           error
 }
 
 func NewNodeSchedulerBuilder(config *NodeSchedulerConfig) *NodeSchedulerBuilder {
+	concurrencyLimits := policy.NewConcurrencyLimits()
+	shareAccounting := policy.NewShareAccounting(parseHalfLife(config.FairShareHalfLife))
+	schedulingPolicy, err := newSchedulingPolicy(config, concurrencyLimits, shareAccounting)
 	return &NodeSchedulerBuilder{
+		err: err,
 		nodeScheduler: &NodeScheduler{
 			Version:                     config.Version,
 			NodeID:                      strings.ToLower(config.Name),
 			Config:                      config,
-			SchedulingPolicy:            policy.GetSchedulingPolicyByName(config.SchedulingPolicy),
-			chanContextEventToScheduler: make(chan datatype.EventPluginContext, maxChannelBuffer),
+			SchedulingPolicy:            schedulingPolicy,
+			ConcurrencyLimits:           concurrencyLimits,
+			ShareAccounting:             shareAccounting,
+			chanContextEventToScheduler: make(chan pluginContextRequest, maxChannelBuffer),
 			chanFromResourceManager:     make(chan datatype.Event, maxChannelBuffer),
 			chanFromCloudScheduler:      make(chan datatype.Event, maxChannelBuffer),
 			chanNeedScheduling:          make(chan datatype.Event, maxChannelBuffer),
+			chanRuleInputs:              make(chan ruleInput, maxChannelBuffer),
+			scoreboardWrites:            newRecentWrites(scoreboardWriteWindow),
+			chanPluginLaunchFailed:      make(chan *datatype.PluginRuntime, maxChannelBuffer),
 		},
 	}
 }
 
+func parseHalfLife(v string) time.Duration {
+	if v == "" {
+		return policy.DefaultShareHalfLife
+	}
+	halfLife, err := time.ParseDuration(v)
+	if err != nil || halfLife <= 0 {
+		nsLog.Errorf("Invalid fair-share half-life %q. %s is used", v, policy.DefaultShareHalfLife)
+		return policy.DefaultShareHalfLife
+	}
+	return halfLife
+}
+
+// newSchedulingPolicy returns the policy chain if configured. Otherwise, it returns
+// the policy named in the config wrapped by the concurrency limits. Max concurrency
+// of jobs and plugins is enforced either way
+func newSchedulingPolicy(config *NodeSchedulerConfig, limits *policy.ConcurrencyLimits, accounting *policy.ShareAccounting) (policy.SchedulingPolicy, error) {
+	if config.PolicyChain != nil {
+		chainConfig := *config.PolicyChain
+		if !hasChainStep(chainConfig.Filters, "concurrency") {
+			nsLog.Info("Policy chain has no concurrency filter. The filter is added to enforce max_concurrency of jobs and plugins")
+			chainConfig.Filters = append(append([]policy.ChainStepConfig(nil), chainConfig.Filters...), policy.ChainStepConfig{Name: "concurrency"})
+		}
+		chain, err := policy.NewChainPolicy(&chainConfig, limits, accounting)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the policy chain: %s", err.Error())
+		}
+		nsLog.Infof("Policy chain is selected: filters %v, scorers %v", chainConfig.Filters, chainConfig.Scorers)
+		return chain, nil
+	}
+	// fair-share policy needs the accounting shared with the scheduler
+	if config.SchedulingPolicy == "fairshare" {
+		nsLog.Info("Fair-share policy is selected")
+		return policy.NewConcurrencyLimitPolicy(policy.NewFairSharePolicy(accounting), limits), nil
+	}
+	return policy.NewConcurrencyLimitPolicy(policy.GetSchedulingPolicyByName(config.SchedulingPolicy), limits), nil
+}
+
+func hasChainStep(steps []policy.ChainStepConfig, name string) bool {
+	for _, s := range steps {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (nsb *NodeSchedulerBuilder) AddGoalManager(appID string) *NodeSchedulerBuilder {
 	nsb.nodeScheduler.GoalManager = &NodeGoalManager{
 		ScienceGoals:  make(map[string]datatype.ScienceGoal),
@@ -53,14 +139,32 @@ func (nsb *NodeSchedulerBuilder) AddGoalManager(appID string) *NodeSchedulerBuil
 }
 
 func (nsb *NodeSchedulerBuilder) AddResourceManager() *NodeSchedulerBuilder {
-	nsb.nodeScheduler.ResourceManager = &ResourceManager{
-		Namespace:     "ses",
-		Clientset:     nil,
-		MetricsClient: nil,
-		Simulate:      nsb.nodeScheduler.Config.Simulate,
-		Notifier:      interfacing.NewNotifier(),
-		runner:        "nodescheduler",
+	if nsb.nodeScheduler.Config.Simulate {
+		rm := NewSimulatedResourceManager()
+		rm.Notifier = interfacing.NewNotifier()
+		rm.runner = "nodescheduler"
+		nsb.nodeScheduler.ResourceManager = rm
+	} else {
+		nsb.nodeScheduler.ResourceManager = &ResourceManager{
+			Namespace:     "ses",
+			Clientset:     nil,
+			MetricsClient: nil,
+			Notifier:      interfacing.NewNotifier(),
+			runner:        "nodescheduler",
+		}
+		config := nsb.nodeScheduler.Config
+		if config.RabbitmqManagementURI != "" {
+			rmq, err := NewRMQManagement(config.RabbitmqManagementURI, config.RabbitmqUsername, config.RabbitmqPassword, false)
+			if err != nil {
+				nsLog.Errorf("Failed to connect to RabbitMQ management at %s: %s. Plugins share the plugin credential", config.RabbitmqManagementURI, err.Error())
+			} else {
+				nsLog.Infof("Plugins get a credential per run from RabbitMQ management at %s", config.RabbitmqManagementURI)
+				nsb.nodeScheduler.ResourceManager.RMQManagement = rmq
+			}
+		}
 	}
+	nsb.nodeScheduler.ResourceManager.VolumeHostPaths = nsb.nodeScheduler.Config.VolumeHostPaths
+	nsb.nodeScheduler.ResourceManager.HostRoot = nsb.nodeScheduler.Config.HostRoot
 	nsb.nodeScheduler.ResourceManager.Notifier.Subscribe(nsb.nodeScheduler.chanFromResourceManager)
 	return nsb
 }
@@ -71,6 +175,9 @@ func (nsb *NodeSchedulerBuilder) AddKnowledgebase() *NodeSchedulerBuilder {
 		rules:          make(map[string][]datatype.ScienceRule),
 		measures:       map[string]interface{}{},
 		ruleCheckerURI: nsb.nodeScheduler.Config.RuleCheckerURI,
+		history:        make(map[string][]*RuleHistory),
+		dependents:     make(map[sciencerule.Dependency]map[string]bool),
+		getCurrentTime: time.Now,
 	}
 	return nsb
 }
@@ -99,6 +206,19 @@ func (nsb *NodeSchedulerBuilder) AddConnToScoreboard() *NodeSchedulerBuilder {
 	return nsb
 }
 
-func (nsb *NodeSchedulerBuilder) Build() *NodeScheduler {
-	return nsb.nodeScheduler
+func (nsb *NodeSchedulerBuilder) AddTracer() *NodeSchedulerBuilder {
+	var exporter tracing.Exporter
+	if nsb.nodeScheduler.Config.OTLPEndpoint != "" {
+		exporter = tracing.NewOTLPExporter(nsb.nodeScheduler.Config.OTLPEndpoint)
+	}
+	nsb.nodeScheduler.Tracer = tracing.NewTracer("nodescheduler", exporter)
+	return nsb
+}
+
+// Build returns the node scheduler, or the error if the config is invalid
+func (nsb *NodeSchedulerBuilder) Build() (*NodeScheduler, error) {
+	if nsb.err != nil {
+		return nil, nsb.err
+	}
+	return nsb.nodeScheduler, nil
 }
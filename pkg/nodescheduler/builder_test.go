@@ -0,0 +1,67 @@
+package nodescheduler
+
+import (
+	"testing"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/nodescheduler/policy"
+)
+
+func TestNewSchedulingPolicy(t *testing.T) {
+	tests := map[string]struct {
+		Config *NodeSchedulerConfig
+		Error  bool
+	}{
+		"Named policy": {
+			Config: &NodeSchedulerConfig{SchedulingPolicy: "default"},
+		},
+		"Chain without concurrency": {
+			Config: &NodeSchedulerConfig{PolicyChain: &policy.ChainConfig{
+				Filters: []policy.ChainStepConfig{{Name: "gpu-exclusive"}},
+				Scorers: []policy.ChainStepConfig{{Name: "age"}},
+			}},
+		},
+		"Chain with concurrency": {
+			Config: &NodeSchedulerConfig{PolicyChain: &policy.ChainConfig{
+				Filters: []policy.ChainStepConfig{{Name: "concurrency"}},
+			}},
+		},
+		"Invalid chain": {
+			Config: &NodeSchedulerConfig{SchedulingPolicy: "default", PolicyChain: &policy.ChainConfig{
+				Filters: []policy.ChainStepConfig{{Name: "unknown"}},
+			}},
+			Error: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := newSchedulingPolicy(test.Config, policy.NewConcurrencyLimits(), policy.NewShareAccounting(policy.DefaultShareHalfLife))
+			if test.Error {
+				if err == nil {
+					t.Errorf("wanted error but got policy %T", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// max concurrency is enforced by any policy
+			switch p := p.(type) {
+			case *policy.ChainPolicy:
+				if !p.HasFilter("concurrency") {
+					t.Errorf("wanted the concurrency filter in the chain")
+				}
+			case *policy.ConcurrencyLimitPolicy:
+			default:
+				t.Errorf("wanted the concurrency limits enforced but got %T", p)
+			}
+		})
+	}
+	// the config is not changed
+	config := &NodeSchedulerConfig{PolicyChain: &policy.ChainConfig{Filters: []policy.ChainStepConfig{{Name: "gpu-exclusive"}}}}
+	if _, err := newSchedulingPolicy(config, policy.NewConcurrencyLimits(), policy.NewShareAccounting(policy.DefaultShareHalfLife)); err != nil {
+		t.Fatal(err)
+	}
+	if len(config.PolicyChain.Filters) != 1 {
+		t.Errorf("wanted the config unchanged but got filters %v", config.PolicyChain.Filters)
+	}
+}
@@ -4,18 +4,154 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
 	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+	"github.com/waggle-sensor/edge-scheduler/pkg/sciencerule"
 )
 
+var kbLog = logger.New("knowledgebase")
+
+// RuleEvaluator evaluates the condition of science rules
+type RuleEvaluator interface {
+	Evaluate(condition string) (bool, error)
+}
+
+// ValueEvaluator returns the value of an expression of conditions, e.g. v('env.temperature')
+type ValueEvaluator interface {
+	EvaluateValue(expr string) (interface{}, error)
+}
+
+// EvaluatedValue is the value of an input that a condition read
+type EvaluatedValue struct {
+	Expr  string      `json:"expr"`
+	Value interface{} `json:"value"`
+	Error string      `json:"error,omitempty"`
+}
+
+// ConditionEvaluation is the result of evaluating a condition on demand
+type ConditionEvaluation struct {
+	Condition string `json:"condition"`
+	Result    bool   `json:"result"`
+	// Values are the values of the inputs and solar functions the condition read, in the order they appear
+	Values []EvaluatedValue         `json:"values,omitempty"`
+	Inputs []sciencerule.Dependency `json:"inputs,omitempty"`
+	// TimeBased is true if the condition would be evaluated periodically in a rule
+	TimeBased bool `json:"time_based"`
+	// Error is why the condition failed to evaluate
+	Error string `json:"error,omitempty"`
+}
+
+// maxRuleEvaluations is the number of recent evaluations kept for each rule
+const maxRuleEvaluations = 100
+
+// RuleEvaluation is the result of evaluating a science rule once
+type RuleEvaluation struct {
+	Time   time.Time `json:"time"`
+	Result bool      `json:"result"`
+	Fired  bool      `json:"fired"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// RuleHistory keeps the evaluation history of a science rule. Rule modifiers
+// decide whether the rule fires based on the history
+type RuleHistory struct {
+	Rule string `json:"rule"`
+	// Inputs are what the condition reads. New data of the inputs re-evaluates the rule
+	Inputs []sciencerule.Dependency `json:"inputs,omitempty"`
+	// EventDriven is true if the rule is evaluated only when its inputs change.
+	// Other rules are evaluated periodically
+	EventDriven bool `json:"event_driven"`
+	// ValidSince is when the condition became valid. It is zero if the condition is not valid
+	ValidSince time.Time `json:"valid_since,omitempty"`
+	LastFired  time.Time `json:"last_fired,omitempty"`
+	FiredCount int       `json:"fired_count"`
+	// Evaluations are the recent evaluations, oldest first
+	Evaluations []RuleEvaluation `json:"evaluations"`
+	// firedInStreak is true if the rule fired since the condition became valid
+	firedInStreak bool
+}
+
+// newRuleHistory returns an empty history of the rule with the inputs of the rule
+func newRuleHistory(r datatype.ScienceRule) *RuleHistory {
+	h := &RuleHistory{Rule: r.Rule}
+	// a rule that failed to parse is evaluated periodically to report the error
+	if r.AST == nil || r.AST.Condition == nil {
+		return h
+	}
+	deps := sciencerule.FindDependencies(r.AST.Condition)
+	h.Inputs = deps.Inputs
+	// for= needs the rule evaluated after the duration even without new inputs
+	h.EventDriven = !deps.TimeBased && r.Modifiers.For == 0
+	return h
+}
+
+// record adds the evaluation to the history and returns true if the rule fires
+// under the modifiers. A failed evaluation does not change the condition state
+func (h *RuleHistory) record(m datatype.RuleModifiers, now time.Time, valid bool, err error) bool {
+	e := RuleEvaluation{
+		Time:   now,
+		Result: valid,
+	}
+	switch {
+	case err != nil:
+		e.Error = err.Error()
+	case !valid:
+		h.ValidSince = time.Time{}
+		h.firedInStreak = false
+	default:
+		if h.ValidSince.IsZero() {
+			h.ValidSince = now
+		}
+		e.Fired = h.shouldFire(m, now)
+	}
+	if e.Fired {
+		h.LastFired = now
+		h.FiredCount += 1
+		h.firedInStreak = true
+	}
+	h.Evaluations = append(h.Evaluations, e)
+	if len(h.Evaluations) > maxRuleEvaluations {
+		h.Evaluations = h.Evaluations[len(h.Evaluations)-maxRuleEvaluations:]
+	}
+	return e.Fired
+}
+
+func (h *RuleHistory) shouldFire(m datatype.RuleModifiers, now time.Time) bool {
+	if now.Sub(h.ValidSince) < m.For {
+		return false
+	}
+	if m.OnRising && h.firedInStreak {
+		return false
+	}
+	if !h.LastFired.IsZero() && now.Sub(h.LastFired) < m.Cooldown {
+		return false
+	}
+	return true
+}
+
 type KnowledgeBase struct {
 	nodeID         string
 	rules          map[string][]datatype.ScienceRule
 	measures       map[string]interface{}
 	ruleCheckerURI string
+	evaluator      RuleEvaluator
+	// scoreboard is where conditions read states of the node with scoreboard()
+	scoreboard Scoreboard
+	// location is where the node is for solar functions, e.g. daylight(). It is nil until known
+	location *sciencerule.Location
+	// solarEventsFired are the minutes of sunrise() and sunset() events that rules
+	// of goals already fired at
+	solarEventsFired map[string]time.Time
+	// history is evaluation history of the rules, in the same order as the rules of the goal
+	history map[string][]*RuleHistory
+	// dependents are IDs of the goals that have rules reading the input
+	dependents     map[sciencerule.Dependency]map[string]bool
+	mu             sync.Mutex
+	getCurrentTime func() time.Time
 }
 
 func NewKnowledgeBase(nodeID string, ruleCheckerURI string) *KnowledgeBase {
@@ -24,6 +160,11 @@ func NewKnowledgeBase(nodeID string, ruleCheckerURI string) *KnowledgeBase {
 		rules:          make(map[string][]datatype.ScienceRule),
 		measures:       map[string]interface{}{},
 		ruleCheckerURI: ruleCheckerURI,
+		history:        make(map[string][]*RuleHistory),
+		dependents:     make(map[sciencerule.Dependency]map[string]bool),
+		getCurrentTime: time.Now,
+
+		solarEventsFired: make(map[string]time.Time),
 	}
 }
 
@@ -49,11 +190,35 @@ func (kb *KnowledgeBase) AddRulesFromScienceGoal(s *datatype.ScienceGoal) error
 		parsedScienceRules := []datatype.ScienceRule{}
 		for _, r := range mySubGoal.ScienceRules {
 			if err := r.Parse(r.Rule); err != nil {
-				logger.Error.Printf("Failed to parse ScienceRule %q: %s", r.Rule, err.Error())
+				kbLog.With(s.LogFields()).Errorf("Failed to parse ScienceRule %q: %s", r.Rule, err.Error())
+			} else if r.AST.Condition != nil {
+				// states read by the rule belong to the job of the goal
+				scoped := *r.AST
+				scoped.Condition = scopeScoreboard(r.AST.Condition, s.JobID)
+				r.AST = &scoped
 			}
 			parsedScienceRules = append(parsedScienceRules, r)
 		}
+		kb.mu.Lock()
+		defer kb.mu.Unlock()
+		// rules that did not change keep their history so that updating
+		// the goal does not fire them again
+		previous := make(map[string]*RuleHistory)
+		for _, h := range kb.history[s.ID] {
+			previous[h.Rule] = h
+		}
+		history := make([]*RuleHistory, len(parsedScienceRules))
+		for i, r := range parsedScienceRules {
+			if h, exist := previous[r.Rule]; exist {
+				history[i] = h
+				delete(previous, r.Rule)
+			} else {
+				history[i] = newRuleHistory(r)
+			}
+		}
 		kb.rules[s.ID] = parsedScienceRules
+		kb.history[s.ID] = history
+		kb.updateDependents()
 		return nil
 	} else {
 		return fmt.Errorf("failed to find my sub goal from science goal %q", s.ID)
@@ -61,12 +226,75 @@ func (kb *KnowledgeBase) AddRulesFromScienceGoal(s *datatype.ScienceGoal) error
 }
 
 func (kb *KnowledgeBase) DropRules(goalID string) {
+	kb.mu.Lock()
+	defer kb.mu.Unlock()
 	delete(kb.rules, goalID)
+	delete(kb.history, goalID)
+	kb.updateDependents()
+}
+
+// updateDependents indexes goals by the inputs of their event-driven rules.
+// The caller must hold the lock
+func (kb *KnowledgeBase) updateDependents() {
+	kb.dependents = make(map[sciencerule.Dependency]map[string]bool)
+	for goalID, history := range kb.history {
+		for _, h := range history {
+			if !h.EventDriven {
+				continue
+			}
+			for _, dep := range h.Inputs {
+				if _, exist := kb.dependents[dep]; !exist {
+					kb.dependents[dep] = make(map[string]bool)
+				}
+				kb.dependents[dep][goalID] = true
+			}
+		}
+	}
+}
+
+// HasDependents returns true if any event-driven rule reads the input
+func (kb *KnowledgeBase) HasDependents(dep sciencerule.Dependency) bool {
+	kb.mu.Lock()
+	defer kb.mu.Unlock()
+	return len(kb.dependents[dep]) > 0
+}
+
+// GetDependentGoals returns IDs of the goals that have event-driven rules reading any of the inputs
+func (kb *KnowledgeBase) GetDependentGoals(deps map[sciencerule.Dependency]bool) (goalIDs []string) {
+	kb.mu.Lock()
+	defer kb.mu.Unlock()
+	found := make(map[string]bool)
+	for dep := range deps {
+		for goalID := range kb.dependents[dep] {
+			if !found[goalID] {
+				found[goalID] = true
+				goalIDs = append(goalIDs, goalID)
+			}
+		}
+	}
+	return
+}
+
+// GetRuleHistory returns a copy of the evaluation history of the rules of the goal
+func (kb *KnowledgeBase) GetRuleHistory(goalID string) ([]RuleHistory, bool) {
+	kb.mu.Lock()
+	defer kb.mu.Unlock()
+	history, exist := kb.history[goalID]
+	if !exist {
+		return nil, false
+	}
+	copied := make([]RuleHistory, len(history))
+	for i, h := range history {
+		copied[i] = *h
+		copied[i].Inputs = append([]sciencerule.Dependency{}, h.Inputs...)
+		copied[i].Evaluations = append([]RuleEvaluation{}, h.Evaluations...)
+	}
+	return copied, true
 }
 
 // Archived
 func (kb *KnowledgeBase) AddRawMeasure(k string, v interface{}) {
-	logger.Debug.Printf("Added raw measure %q:%s", k, v)
+	kbLog.Debugf("Added raw measure %q:%s", k, v)
 	// kb.add(kb.measures, k, v)
 	r := interfacing.NewHTTPRequest(kb.ruleCheckerURI)
 	data, _ := json.Marshal(map[string]interface{}{
@@ -81,8 +309,8 @@ func (kb *KnowledgeBase) AddRawMeasure(k string, v interface{}) {
 	}
 	var body map[string]interface{}
 	decoder.Decode(&body)
-	logger.Debug.Printf("%v", body)
-	// logger.Debug.Printf("Added raw measure %q:%s", k, v.(string))
+	kbLog.Debugf("%v", body)
+	// kbLog.Debugf("Added raw measure %q:%s", k, v.(string))
 	// v, err := strconv.ParseFloat(v.(string), 64)
 	// if err != nil {
 	// 	kb.measures[k] = v.(string)
@@ -91,44 +319,322 @@ func (kb *KnowledgeBase) AddRawMeasure(k string, v interface{}) {
 	// }
 }
 
-func (kb *KnowledgeBase) EvaluateRule(rule *datatype.ScienceRule) (bool, error) {
+// SetClock makes the knowledgebase record rule evaluations at the time the clock tells
+func (kb *KnowledgeBase) SetClock(now func() time.Time) {
+	kb.getCurrentTime = now
+}
+
+// SetScoreboard makes conditions read states of the scoreboard with scoreboard()
+func (kb *KnowledgeBase) SetScoreboard(s Scoreboard) {
+	kb.scoreboard = s
+}
+
+// readState returns the state that the scoreboard() call reads. It returns nil if
+// the state does not exist. Names of the call must have been scoped to keys
+func (kb *KnowledgeBase) readState(c *sciencerule.Call) (interface{}, error) {
+	if len(c.Args) != 1 || len(c.Kwargs) > 0 {
+		return nil, fmt.Errorf("%s() takes a state name and global= at column %d", c.Func, c.Position+1)
+	}
+	key, ok := c.Args[0].(*sciencerule.Literal)
+	if !ok || (key.Value.Kind != sciencerule.ValueString && key.Value.Kind != sciencerule.ValueWord) {
+		return nil, fmt.Errorf("%s() needs a quoted state name at column %d", c.Func, c.Position+1)
+	}
+	if kb.scoreboard == nil {
+		return nil, fmt.Errorf("scoreboard is not available")
+	}
+	v, exist, err := kb.scoreboard.Get(key.Value.Text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q from scoreboard: %s", key.Value.Text, err.Error())
+	} else if !exist {
+		return nil, nil
+	}
+	return decodeState(v), nil
+}
+
+// SetLocation makes conditions compute solar functions, e.g. daylight(), at the location
+func (kb *KnowledgeBase) SetLocation(loc sciencerule.Location) {
+	kb.mu.Lock()
+	defer kb.mu.Unlock()
+	kb.location = &loc
+}
+
+// GetLocation returns the location of the node if known
+func (kb *KnowledgeBase) GetLocation() (sciencerule.Location, bool) {
+	kb.mu.Lock()
+	defer kb.mu.Unlock()
+	if kb.location == nil {
+		return sciencerule.Location{}, false
+	}
+	return *kb.location, true
+}
+
+// evaluateSolar returns the result of the solar function call now. sunrise() and
+// sunset() of the rule of the goal are valid once in the minute of the event so that
+// the rule fires once although it is evaluated many times in the minute. The rule is
+// empty for conditions evaluated on demand
+func (kb *KnowledgeBase) evaluateSolar(c *sciencerule.Call, goalID string, rule string) (interface{}, error) {
+	loc, exist := kb.GetLocation()
+	if !exist {
+		return nil, fmt.Errorf("%s() needs the location of the node, which is not known", c.Func)
+	}
+	now := kb.getCurrentTime()
+	v, err := sciencerule.EvaluateSolarFunction(c, now, loc)
+	if valid, _ := v.(bool); err != nil || !valid || rule == "" {
+		return v, err
+	}
+	if c.Func != sciencerule.SunriseFunction && c.Func != sciencerule.SunsetFunction {
+		return v, nil
+	}
+	key := goalID + "|" + rule + "|" + c.String()
+	minute := now.Truncate(time.Minute)
+	kb.mu.Lock()
+	defer kb.mu.Unlock()
+	if kb.solarEventsFired[key].Equal(minute) {
+		return false, nil
+	}
+	// events fired before the minute no longer hold rules back
+	for k, firedAt := range kb.solarEventsFired {
+		if firedAt.Before(minute) {
+			delete(kb.solarEventsFired, k)
+		}
+	}
+	kb.solarEventsFired[key] = minute
+	return true, nil
+}
+
+// evaluateNative returns the result of the function call that the node scheduler
+// evaluates itself, which is scoreboard() or a solar function
+func (kb *KnowledgeBase) evaluateNative(c *sciencerule.Call, goalID string, rule string) (interface{}, error) {
+	if c.Func == sciencerule.ScoreboardFunction {
+		return kb.readState(c)
+	}
+	return kb.evaluateSolar(c, goalID, rule)
+}
+
+// isNativeFunction returns true if the node scheduler evaluates the function itself
+func isNativeFunction(name string) bool {
+	return name == sciencerule.ScoreboardFunction || sciencerule.IsSolarFunction(name)
+}
+
+// fillNativeCalls returns the expression with scoreboard() calls replaced by the states
+// they read and solar functions replaced by their results, so that the rule checker
+// evaluates the expression without the scoreboard and the location of the node.
+// The goal and the rule are empty unless the expression is the condition of the rule
+func (kb *KnowledgeBase) fillNativeCalls(e sciencerule.Expr, goalID string, rule string) (filled sciencerule.Expr, err error) {
+	filled = sciencerule.ReplaceCalls(e, func(c *sciencerule.Call) sciencerule.Expr {
+		if !isNativeFunction(c.Func) || err != nil {
+			return nil
+		}
+		v, evalErr := kb.evaluateNative(c, goalID, rule)
+		if evalErr != nil {
+			err = evalErr
+			return nil
+		}
+		return sciencerule.NewLiteral(v, c.Position)
+	})
+	return
+}
+
+// EvaluateActionValue returns the value that publish or set sends. The expression of
+// the value is evaluated now, reading the states of the job
+func (kb *KnowledgeBase) EvaluateActionValue(v datatype.ActionValue, jobID string) (interface{}, error) {
+	if v.Expr == nil {
+		return v.Static, nil
+	}
+	filled, err := kb.fillNativeCalls(scopeScoreboard(v.Expr, jobID), "", "")
+	if err != nil {
+		return nil, err
+	}
+	value, err := kb.evaluateValue(filled.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate value %s: %s", v.Expr.String(), err.Error())
+	}
+	return value, nil
+}
+
+// callsNative returns true if the expression calls scoreboard() or solar functions
+func callsNative(e sciencerule.Expr) (found bool) {
+	sciencerule.ReplaceCalls(e, func(c *sciencerule.Call) sciencerule.Expr {
+		found = found || isNativeFunction(c.Func)
+		return nil
+	})
+	return
+}
+
+// SetRuleEvaluator makes the knowledgebase evaluate rules with the evaluator
+// instead of the rule checker
+func (kb *KnowledgeBase) SetRuleEvaluator(e RuleEvaluator) {
+	kb.evaluator = e
+}
+
+// EvaluateRule evaluates the condition of the rule of the goal. The goal is empty for
+// rules that do not belong to any goal
+func (kb *KnowledgeBase) EvaluateRule(goalID string, rule *datatype.ScienceRule) (bool, error) {
+	condition := rule.Condition
+	if rule.AST != nil && rule.AST.Condition != nil && callsNative(rule.AST.Condition) {
+		filled, err := kb.fillNativeCalls(rule.AST.Condition, goalID, rule.Rule)
+		if err != nil {
+			return false, err
+		}
+		condition = filled.String()
+	}
+	if kb.evaluator != nil {
+		return kb.evaluator.Evaluate(condition)
+	}
+	v, err := kb.requestRuleChecker(condition)
+	if err != nil {
+		return false, err
+	}
+	if valid, ok := v.(bool); ok {
+		return valid, nil
+	}
+	return false, fmt.Errorf("result of the rule is not a boolean: %v", v)
+}
+
+// requestRuleChecker asks the rule checker to evaluate the expression and returns the result
+func (kb *KnowledgeBase) requestRuleChecker(expr string) (interface{}, error) {
 	r := interfacing.NewHTTPRequest(kb.ruleCheckerURI)
 	data, _ := json.Marshal(map[string]interface{}{
-		"rule": rule.Condition,
+		"rule": expr,
 	})
 	resp, err := r.RequestPost("evaluate", data, nil)
 	if err != nil {
-		return false, fmt.Errorf("failed to get data from checker: %s", err.Error())
+		return nil, fmt.Errorf("failed to get data from checker: %s", err.Error())
 	}
 	decoder, err := r.ParseJSONHTTPResponse(resp)
 	if err != nil {
-		return false, fmt.Errorf("failed to parse response: %s", err.Error())
+		return nil, fmt.Errorf("failed to parse response: %s", err.Error())
 	}
 	var body map[string]interface{}
 	decoder.Decode(&body)
 	if r, exists := body["response"]; exists {
-		if r.(string) == "failed" {
-			return false, fmt.Errorf("failed to evaluate rule: %s", body["error"])
+		if r == "failed" {
+			return nil, fmt.Errorf("failed to evaluate rule: %s", body["error"])
 		}
 	}
 	if v, exists := body["result"]; exists {
-		return v.(bool), nil
+		return v, nil
 	} else {
-		return false, fmt.Errorf("response does not contain result: %v", body)
+		return nil, fmt.Errorf("response does not contain result: %v", body)
+	}
+}
+
+// evaluateValue returns the value of the expression from the evaluator if it
+// supports values, or from the rule checker
+func (kb *KnowledgeBase) evaluateValue(expr string) (interface{}, error) {
+	if kb.evaluator != nil {
+		if e, ok := kb.evaluator.(ValueEvaluator); ok {
+			return e.EvaluateValue(expr)
+		}
+		return nil, fmt.Errorf("evaluator does not support values of expressions")
+	}
+	return kb.requestRuleChecker(expr)
+}
+
+// EvaluateCondition evaluates the condition immediately, without recording it to any
+// rule history, and returns the result with the values of the inputs it read.
+// States in the scoreboard are read as the job reads them if the job ID is given.
+// It returns *sciencerule.SyntaxError if the condition fails to parse
+func (kb *KnowledgeBase) EvaluateCondition(condition string, jobID string) (*ConditionEvaluation, error) {
+	expr, err := sciencerule.ParseCondition(condition)
+	if err != nil {
+		return nil, err
+	}
+	expr = scopeScoreboard(expr, jobID)
+	deps := sciencerule.FindDependencies(expr)
+	result := &ConditionEvaluation{
+		Condition: condition,
+		Inputs:    deps.Inputs,
+		TimeBased: deps.TimeBased,
+	}
+	seen := make(map[string]bool)
+	var walk func(sciencerule.Expr)
+	walk = func(e sciencerule.Expr) {
+		for _, c := range sciencerule.Children(e) {
+			walk(c)
+		}
+		c, ok := e.(*sciencerule.Call)
+		if !ok || !(sciencerule.IsInputFunction(c.Func) || sciencerule.IsSolarFunction(c.Func)) || seen[c.String()] {
+			return
+		}
+		seen[c.String()] = true
+		value := EvaluatedValue{Expr: c.String()}
+		if isNativeFunction(c.Func) {
+			value.Value, err = kb.evaluateNative(c, "", "")
+		} else if filled, fillErr := kb.fillNativeCalls(c, "", ""); fillErr != nil {
+			err = fillErr
+		} else {
+			value.Value, err = kb.evaluateValue(filled.String())
+		}
+		if err != nil {
+			value.Error = err.Error()
+		}
+		result.Values = append(result.Values, value)
+	}
+	walk(expr)
+	rule := datatype.ScienceRule{Condition: condition, AST: &sciencerule.Rule{Condition: expr}}
+	if result.Result, err = kb.EvaluateRule("", &rule); err != nil {
+		result.Error = err.Error()
 	}
+	return result, nil
 }
 
+// EvaluateGoal evaluates the rules of the goal and returns the rules that fire.
+// A valid rule fires every time it is evaluated unless its modifiers say otherwise
 func (kb *KnowledgeBase) EvaluateGoal(goalID string) (results []datatype.ScienceRule, err error) {
-	if rules, exist := kb.rules[goalID]; exist {
-		for _, rule := range rules {
-			if valid, err := kb.EvaluateRule(&rule); err != nil {
-				logger.Error.Printf("Failed to evaluate rule %q: %s", rule, err.Error())
-			} else if valid {
-				results = append(results, rule)
+	return kb.evaluateRules(goalID, func(h *RuleHistory) bool {
+		return true
+	})
+}
+
+// EvaluateTimeBasedRules evaluates the rules of the goal that are not event-driven
+// and returns the rules that fire
+func (kb *KnowledgeBase) EvaluateTimeBasedRules(goalID string) (results []datatype.ScienceRule, err error) {
+	return kb.evaluateRules(goalID, func(h *RuleHistory) bool {
+		return !h.EventDriven
+	})
+}
+
+// EvaluateRulesReading evaluates the event-driven rules of the goal that read any
+// of the inputs and returns the rules that fire
+func (kb *KnowledgeBase) EvaluateRulesReading(goalID string, deps map[sciencerule.Dependency]bool) (results []datatype.ScienceRule, err error) {
+	return kb.evaluateRules(goalID, func(h *RuleHistory) bool {
+		if !h.EventDriven {
+			return false
+		}
+		for _, dep := range h.Inputs {
+			if deps[dep] {
+				return true
 			}
 		}
-	} else {
-		err = fmt.Errorf("failed to find rules: rules for goal ID %q does not exist", goalID)
+		return false
+	})
+}
+
+func (kb *KnowledgeBase) evaluateRules(goalID string, filter func(*RuleHistory) bool) (results []datatype.ScienceRule, err error) {
+	kb.mu.Lock()
+	rules, exist := kb.rules[goalID]
+	history := kb.history[goalID]
+	kb.mu.Unlock()
+	if !exist {
+		return nil, fmt.Errorf("failed to find rules: rules for goal ID %q does not exist", goalID)
+	}
+	for i, rule := range rules {
+		if !filter(history[i]) {
+			continue
+		}
+		valid, err := kb.EvaluateRule(goalID, &rule)
+		if err != nil {
+			kbLog.WithField("goal_id", goalID).Errorf("Failed to evaluate rule %q: %s", rule.Rule, err.Error())
+		}
+		kb.mu.Lock()
+		fired := history[i].record(rule.Modifiers, kb.getCurrentTime(), valid, err)
+		kb.mu.Unlock()
+		if fired {
+			results = append(results, rule)
+		} else if valid && err == nil && !rule.Modifiers.IsZero() {
+			kbLog.WithField("goal_id", goalID).Debugf("Science rule %q is valid but held by its modifiers", rule.Rule)
+		}
 	}
 	return
 }
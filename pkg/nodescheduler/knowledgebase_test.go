@@ -1,9 +1,13 @@
 package nodescheduler
 
 import (
+	"fmt"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/sciencerule"
 )
 
 func TestKnowledgeBaseEvaluate(t *testing.T) {
@@ -51,7 +55,7 @@ func TestKnowledgeBaseEvaluate(t *testing.T) {
 				if err != nil {
 					t.Fatal(err.Error())
 				}
-				result, err := kb.EvaluateRule(scienceRule)
+				result, err := kb.EvaluateRule("", scienceRule)
 				if err != nil {
 					t.Fatal(err.Error())
 				} else {
@@ -63,3 +67,401 @@ func TestKnowledgeBaseEvaluate(t *testing.T) {
 		})
 	}
 }
+
+// stubEvaluator evaluates conditions to the values set by the test
+type stubEvaluator map[string]bool
+
+func (e stubEvaluator) Evaluate(condition string) (bool, error) {
+	v, exist := e[condition]
+	if !exist {
+		return false, fmt.Errorf("unknown condition %q", condition)
+	}
+	return v, nil
+}
+
+func TestKnowledgeBaseRuleModifiers(t *testing.T) {
+	tests := map[string]struct {
+		Rule string
+		// Conditions are the results of the condition at every 10 seconds
+		Conditions []bool
+		WantFired  []bool
+	}{
+		"level": {
+			Rule:       "publish(env.alert): c",
+			Conditions: []bool{true, true, false, true},
+			WantFired:  []bool{true, true, false, true},
+		},
+		"cooldown": {
+			Rule:       "publish(env.alert, cooldown=25s): c",
+			Conditions: []bool{true, true, true, true, false, true},
+			WantFired:  []bool{true, false, false, true, false, false},
+		},
+		"rising": {
+			Rule:       "publish(env.alert, on=rising): c",
+			Conditions: []bool{true, true, false, true, true},
+			WantFired:  []bool{true, false, false, true, false},
+		},
+		"for": {
+			Rule:       "publish(env.alert, for=20s): c",
+			Conditions: []bool{true, true, true, true, false, true, true},
+			WantFired:  []bool{false, false, true, true, false, false, false},
+		},
+		"for and rising": {
+			Rule:       "publish(env.alert, for=10s, on=rising): c",
+			Conditions: []bool{true, true, true, false, true, true},
+			WantFired:  []bool{false, true, false, false, false, true},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			evaluator := stubEvaluator{}
+			now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+			kb := NewKnowledgeBase("W000", "")
+			kb.SetRuleEvaluator(evaluator)
+			kb.SetClock(func() time.Time { return now })
+			goal := &datatype.ScienceGoal{
+				ID: "goal-1",
+				SubGoals: []*datatype.SubGoal{
+					{Name: "W000", ScienceRules: []datatype.ScienceRule{{Rule: tc.Rule}}},
+				},
+			}
+			if err := kb.AddRulesFromScienceGoal(goal); err != nil {
+				t.Fatal(err)
+			}
+			for i, c := range tc.Conditions {
+				evaluator["c"] = c
+				fired, err := kb.EvaluateGoal(goal.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if (len(fired) > 0) != tc.WantFired[i] {
+					t.Errorf("evaluation %d: wanted fired %t but got %t", i, tc.WantFired[i], len(fired) > 0)
+				}
+				now = now.Add(10 * time.Second)
+			}
+			history, exist := kb.GetRuleHistory(goal.ID)
+			if !exist || len(history) != 1 || len(history[0].Evaluations) != len(tc.Conditions) {
+				t.Errorf("history must have %d evaluations: %+v", len(tc.Conditions), history)
+			}
+		})
+	}
+}
+
+func TestKnowledgeBaseRuleHistory(t *testing.T) {
+	evaluator := stubEvaluator{"a": true, "b": true}
+	kb := NewKnowledgeBase("W000", "")
+	kb.SetRuleEvaluator(evaluator)
+	goal := &datatype.ScienceGoal{
+		ID: "goal-1",
+		SubGoals: []*datatype.SubGoal{
+			{Name: "W000", ScienceRules: []datatype.ScienceRule{
+				{Rule: "publish(env.a, on=rising): a"},
+				{Rule: "publish(env.b, on=rising): b"},
+				{Rule: "publish(env.c): c"},
+			}},
+		},
+	}
+	if err := kb.AddRulesFromScienceGoal(goal); err != nil {
+		t.Fatal(err)
+	}
+	if fired, _ := kb.EvaluateGoal(goal.ID); len(fired) != 2 {
+		t.Fatalf("wanted 2 rules fired but got %d", len(fired))
+	}
+	history, _ := kb.GetRuleHistory(goal.ID)
+	if history[2].Evaluations[0].Error == "" {
+		t.Errorf("failed evaluation must be recorded with the error")
+	}
+
+	// updating the goal keeps history of the rules that did not change
+	goal.SubGoals[0].ScienceRules = []datatype.ScienceRule{
+		{Rule: "publish(env.b, on=rising): b"},
+		{Rule: "publish(env.a2, on=rising): a"},
+	}
+	if err := kb.AddRulesFromScienceGoal(goal); err != nil {
+		t.Fatal(err)
+	}
+	fired, _ := kb.EvaluateGoal(goal.ID)
+	if len(fired) != 1 || fired[0].ActionObject != "env.a2" {
+		t.Errorf("wanted only the new rule fired but got %v", fired)
+	}
+
+	kb.DropRules(goal.ID)
+	if _, exist := kb.GetRuleHistory(goal.ID); exist {
+		t.Errorf("history must be dropped with the rules")
+	}
+}
+
+func TestKnowledgeBaseRuleInputs(t *testing.T) {
+	evaluator := stubEvaluator{
+		"v('env.temperature') > 30":                      true,
+		"v('env.raingauge.event_acc') > 0":               true,
+		"cronjob('a', '* * * * *')":                      true,
+		"v('env.temperature', since='-5m')":              true,
+		"any(e('sys.scheduler.status.plugin.complete'))": true,
+	}
+	kb := NewKnowledgeBase("W000", "")
+	kb.SetRuleEvaluator(evaluator)
+	goal := &datatype.ScienceGoal{
+		ID: "goal-1",
+		SubGoals: []*datatype.SubGoal{
+			{Name: "W000", ScienceRules: []datatype.ScienceRule{
+				{Rule: "publish(env.hot): v('env.temperature') > 30"},
+				{Rule: "publish(env.rain): v('env.raingauge.event_acc') > 0"},
+				{Rule: "publish(env.minute): cronjob('a', '* * * * *')"},
+				{Rule: "publish(env.warm): v('env.temperature', since='-5m')"},
+				{Rule: "publish(env.held, for=1m): v('env.temperature') > 30"},
+				{Rule: "publish(env.next): any(e('sys.scheduler.status.plugin.complete'))"},
+			}},
+		},
+	}
+	if err := kb.AddRulesFromScienceGoal(goal); err != nil {
+		t.Fatal(err)
+	}
+	fired := func(rules []datatype.ScienceRule) (objects []string) {
+		for _, r := range rules {
+			objects = append(objects, r.ActionObject)
+		}
+		return
+	}
+
+	rules, err := kb.EvaluateTimeBasedRules(goal.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fired(rules), []string{"env.minute", "env.warm"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wanted time-based rules %v fired but got %v", want, got)
+	}
+	// the rule with for= is evaluated periodically even though it reads a measurement only
+	if history, _ := kb.GetRuleHistory(goal.ID); len(history[4].Evaluations) != 1 || len(history[0].Evaluations) != 0 {
+		t.Errorf("wanted only time-based rules evaluated: %+v", history)
+	}
+
+	temperature := sciencerule.NewMeasurementDependency("env.temperature")
+	if !kb.HasDependents(temperature) {
+		t.Errorf("rules reading %s must be indexed", temperature)
+	}
+	inputs := map[sciencerule.Dependency]bool{temperature: true}
+	if goals := kb.GetDependentGoals(inputs); !reflect.DeepEqual(goals, []string{goal.ID}) {
+		t.Errorf("wanted goal %q depending on %s but got %v", goal.ID, temperature, goals)
+	}
+	rules, err = kb.EvaluateRulesReading(goal.ID, inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fired(rules), []string{"env.hot"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wanted rules %v fired by %s but got %v", want, temperature, got)
+	}
+
+	pluginEvent := sciencerule.NewMeasurementDependency("sys.scheduler.status.plugin.complete")
+	if pluginEvent.Kind != sciencerule.DependencyPluginEvent || !kb.HasDependents(pluginEvent) {
+		t.Errorf("rules reading plugin event %s must be indexed", pluginEvent)
+	}
+
+	kb.DropRules(goal.ID)
+	if kb.HasDependents(temperature) {
+		t.Errorf("inputs of dropped rules must not be indexed")
+	}
+}
+
+func TestKnowledgeBaseEvaluateCondition(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	checker := NewSimulatedRuleChecker(func() time.Time { return now })
+	for _, v := range []float64{20, 31, 33} {
+		checker.Store("env.temperature", v)
+		now = now.Add(time.Minute)
+	}
+	kb := NewKnowledgeBase("W000", "")
+	kb.SetRuleEvaluator(checker)
+
+	tests := map[string]struct {
+		Condition string
+		Result    bool
+		Values    []EvaluatedValue
+		TimeBased bool
+		Position  int
+		Error     bool
+	}{
+		"Latest value": {
+			Condition: "v('env.temperature') > 30",
+			Result:    true,
+			Values:    []EvaluatedValue{{Expr: "v('env.temperature')", Value: 33.0}},
+		},
+		"Series": {
+			Condition: "avg(v('env.temperature', since='-150s')) > 30 and v('env.temperature') > 40",
+			Result:    false,
+			Values: []EvaluatedValue{
+				{Expr: "v('env.temperature', since='-150s')", Value: []interface{}{31.0, 33.0}},
+				{Expr: "v('env.temperature')", Value: 33.0},
+			},
+			TimeBased: true,
+		},
+		"No data": {
+			Condition: "v('env.humidity') > 30",
+			Values:    []EvaluatedValue{{Expr: "v('env.humidity')"}},
+		},
+		"Syntax error": {
+			Condition: "v('env.temperature') >",
+			Position:  22,
+			Error:     true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, err := kb.EvaluateCondition(test.Condition, "")
+			if test.Error {
+				syntaxError, ok := err.(*sciencerule.SyntaxError)
+				if !ok {
+					t.Fatalf("wanted a syntax error but got %v", err)
+				}
+				if syntaxError.Position != test.Position {
+					t.Errorf("wanted the syntax error at %d but got %d", test.Position, syntaxError.Position)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Result != test.Result || result.TimeBased != test.TimeBased {
+				t.Errorf("wanted result %t and time-based %t but got %+v", test.Result, test.TimeBased, result)
+			}
+			if !reflect.DeepEqual(result.Values, test.Values) {
+				t.Errorf("wanted values %+v but got %+v", test.Values, result.Values)
+			}
+		})
+	}
+	// evaluating a condition on demand must not leave any history
+	if _, exist := kb.GetRuleHistory(""); exist {
+		t.Errorf("evaluating a condition must not add rule history")
+	}
+}
+
+func TestKnowledgeBaseEvaluateActionValue(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	checker := NewSimulatedRuleChecker(clock)
+	for _, v := range []float64{20, 30} {
+		checker.Store("env.temperature", v)
+	}
+	scoreboard := NewMemoryScoreboard(clock)
+	scoreboard.SetWithTTL("job.42.offset", "5", 0)
+	kb := NewKnowledgeBase("W000", "")
+	kb.SetRuleEvaluator(checker)
+	kb.SetScoreboard(scoreboard)
+
+	tests := map[string]struct {
+		Rule  string
+		Value interface{}
+		State string
+	}{
+		"Static":     {Rule: "set(level, value=3): True", Value: int64(3), State: "3"},
+		"Object":     {Rule: `publish(env.mode, value={"mode": "night"}): True`, Value: map[string]interface{}{"mode": "night"}, State: `{"mode":"night"}`},
+		"Expression": {Rule: "publish(env.avg, value=avg(v('env.temperature', since='-1m'))): True", Value: 25., State: "25"},
+		"Scoreboard": {Rule: "set(level, value=(v('env.temperature') + scoreboard('offset'))): True", Value: 35., State: "35"},
+		"Bool":       {Rule: "set(hot, value=(v('env.temperature') > 25)): True", Value: true, State: "true"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r, err := datatype.NewScienceRule(test.Rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v, err := kb.EvaluateActionValue(r.Value, "42")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(v, test.Value) {
+				t.Errorf("wanted value %#v but got %#v", test.Value, v)
+			}
+			if state, err := encodeState(v); err != nil || state != test.State {
+				t.Errorf("wanted state %q but got %q: %v", test.State, state, err)
+			}
+		})
+	}
+	if v := decodeState("true"); v != true {
+		t.Errorf("wanted true read back as a boolean but got %#v", v)
+	}
+}
+
+func TestKnowledgeBaseSolarFunctions(t *testing.T) {
+	chicago := sciencerule.Location{Latitude: 41.8781, Longitude: -87.6298}
+	sunrise, _, _ := sciencerule.SunriseSunset(time.Date(2024, 6, 21, 17, 0, 0, 0, time.UTC), chicago, -0.833)
+	now := sunrise.Add(-30 * time.Minute).Truncate(time.Minute)
+	clock := func() time.Time { return now }
+	kb := NewKnowledgeBase("W000", "")
+	kb.SetRuleEvaluator(NewSimulatedRuleChecker(clock))
+	kb.SetClock(clock)
+	goal := &datatype.ScienceGoal{
+		ID: "goal-1",
+		SubGoals: []*datatype.SubGoal{
+			{Name: "W000", ScienceRules: []datatype.ScienceRule{
+				{Rule: "schedule(dawn): sunrise(offset='-30m')"},
+				{Rule: "schedule(day): daylight() and sun_elevation() > 10"},
+				{Rule: "schedule(night): cronjob('night', '* * * * *') and not daylight(twilight='civil')"},
+			}},
+		},
+	}
+	// another goal has the same rule
+	other := &datatype.ScienceGoal{
+		ID: "goal-2",
+		SubGoals: []*datatype.SubGoal{
+			{Name: "W000", ScienceRules: []datatype.ScienceRule{
+				{Rule: "schedule(dawn): sunrise(offset='-30m')"},
+			}},
+		},
+	}
+	for _, g := range []*datatype.ScienceGoal{goal, other} {
+		if err := kb.AddRulesFromScienceGoal(g); err != nil {
+			t.Fatal(err)
+		}
+	}
+	firedOf := func(goalID string) (objects []string) {
+		rules, err := kb.EvaluateTimeBasedRules(goalID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range rules {
+			objects = append(objects, r.ActionObject)
+		}
+		return
+	}
+	fired := func() []string { return firedOf(goal.ID) }
+	if got := fired(); len(got) != 0 {
+		t.Errorf("wanted no rule fired without the location but got %v", got)
+	}
+	kb.SetLocation(chicago)
+	// sunrise() of the rule is valid once in the minute
+	if got, want := fired(), []string{"dawn"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wanted rules %v fired 30 minutes before sunrise but got %v", want, got)
+	}
+	if got, want := firedOf(other.ID), []string{"dawn"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wanted rules %v of the other goal fired 30 minutes before sunrise but got %v", want, got)
+	}
+	now = now.Add(10 * time.Second)
+	if got := fired(); len(got) != 0 {
+		t.Errorf("wanted no rule fired again in the minute but got %v", got)
+	}
+	// events of the next day fire again, and those of the past minutes are forgotten
+	now = now.Add(24 * time.Hour)
+	if got, want := firedOf(other.ID), []string{"dawn"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wanted rules %v fired before sunrise of the next day but got %v", want, got)
+	}
+	if n := len(kb.solarEventsFired); n != 1 {
+		t.Errorf("wanted only the event of the minute kept but got %d", n)
+	}
+	now = time.Date(2024, 6, 21, 17, 0, 0, 0, time.UTC)
+	if got, want := fired(), []string{"day"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wanted rules %v fired at noon but got %v", want, got)
+	}
+	now = time.Date(2024, 6, 22, 5, 0, 0, 0, time.UTC)
+	if got, want := fired(), []string{"night"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wanted rules %v fired at midnight but got %v", want, got)
+	}
+
+	result, err := kb.EvaluateCondition("daylight() and sun_elevation() > 10", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Result || len(result.Values) != 2 || result.Values[0].Value != false {
+		t.Errorf("wanted daylight() false at midnight but got %+v", result)
+	}
+}
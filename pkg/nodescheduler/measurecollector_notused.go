@@ -6,7 +6,6 @@ import (
 	"time"
 
 	"github.com/streadway/amqp"
-	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
 )
 
 var (
@@ -29,16 +28,16 @@ func InitializeMeasureCollector(hostUrl string) {
 
 func RunMeasureCollector(toKnowledgebase chan RMQMessage) {
 	for {
-		logger.Info.Print("Measure collector (re)starts...")
+		nsLog.Info("Measure collector (re)starts...")
 		c, err := getConnection()
 		if err != nil {
-			logger.Error.Print(err.Error())
+			nsLog.Error(err.Error())
 			continue
 		}
 
 		ch, err := c.Channel()
 		if err != nil {
-			logger.Error.Print(err.Error())
+			nsLog.Error(err.Error())
 			continue
 		}
 
@@ -74,11 +73,11 @@ func RunMeasureCollector(toKnowledgebase chan RMQMessage) {
 		go func() {
 			for msg := range msgs {
 				// TODO: should drop messages going to Beehive
-				logger.Info.Printf("%s received", msg.Body)
-				logger.Info.Printf("%s", msg.RoutingKey)
+				nsLog.Infof("%s received", msg.Body)
+				nsLog.Infof("%s", msg.RoutingKey)
 				var rmqMessage RMQMessage
 				json.Unmarshal(msg.Body, &rmqMessage)
-				logger.Info.Printf("%v", rmqMessage)
+				nsLog.Infof("%v", rmqMessage)
 				// TODO: We want to filter out ones going to Beehive
 				// TODO: We should do the filtering by setting a proper routingkey
 				if rmqMessage.Scope == "node" {
@@ -88,8 +87,8 @@ func RunMeasureCollector(toKnowledgebase chan RMQMessage) {
 		}()
 
 		err = <-closeNotifyChan
-		logger.Error.Print(err.Error())
-		logger.Info.Print("Measure collector restarting in 5 seconds...")
+		nsLog.Error(err.Error())
+		nsLog.Info("Measure collector restarting in 5 seconds...")
 		time.Sleep(5 * time.Second)
 	}
 }
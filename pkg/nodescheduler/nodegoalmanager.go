@@ -4,7 +4,6 @@ import (
 	"fmt"
 
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
-	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
 )
 
 type PluginIndex struct {
@@ -97,7 +96,7 @@ func (ngm *NodeGoalManager) GetPluginRuntime(index PluginIndex) *datatype.Plugin
 func (ngm *NodeGoalManager) GetPluginRuntimeByNameAndJobID(name string, jobID string) *datatype.PluginRuntime {
 	g, err := ngm.GetScienceGoalByJobID(jobID)
 	if err != nil {
-		logger.Error.Printf("failed to get goal by job ID %q: %s", jobID, err.Error())
+		nsLog.WithField("job_id", jobID).Errorf("failed to get goal by job ID %q: %s", jobID, err.Error())
 		return nil
 	}
 	return ngm.GetPluginRuntime(PluginIndex{
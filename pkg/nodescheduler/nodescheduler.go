@@ -1,6 +1,7 @@
 package nodescheduler
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,11 +17,24 @@ import (
 	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
 	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
 	"github.com/waggle-sensor/edge-scheduler/pkg/nodescheduler/policy"
+	"github.com/waggle-sensor/edge-scheduler/pkg/sciencerule"
+	"github.com/waggle-sensor/edge-scheduler/pkg/tracing"
 	v1 "k8s.io/api/core/v1"
 )
 
+var nsLog = logger.New("nodescheduler")
+
 const (
 	maxChannelBuffer = 100
+	// ruleInputDelay is how long the scheduler waits for more inputs before it
+	// evaluates rules reading them. It also gives the rule checker time to
+	// receive the same inputs
+	ruleInputDelay = 200 * time.Millisecond
+	// dataExchangeName is where plugins' measurements are published on the node
+	dataExchangeName = "data.topic"
+	// scoreboardWriteWindow is how long keyspace events of states that the scheduler
+	// set are dropped. A write with a TTL makes more than one event
+	scoreboardWriteWindow = 2 * time.Second
 )
 
 type NodeScheduler struct {
@@ -33,14 +47,21 @@ type NodeScheduler struct {
 	GoalManager                 *NodeGoalManager
 	APIServer                   *APIServer
 	SchedulingPolicy            policy.SchedulingPolicy
+	ConcurrencyLimits           *policy.ConcurrencyLimits
+	ShareAccounting             *policy.ShareAccounting
 	LogToBeehive                *interfacing.RabbitMQHandler
-	ToScoreboard                *interfacing.RedisClient
+	ToScoreboard                Scoreboard
+	Simulator                   *Simulator
+	Tracer                      *tracing.Tracer
 	readyQueue                  datatype.Queue // act a job queue for resource management
 	scheduledPlugins            datatype.Queue
-	chanContextEventToScheduler chan datatype.EventPluginContext
+	chanContextEventToScheduler chan pluginContextRequest
 	chanFromResourceManager     chan datatype.Event
 	chanFromCloudScheduler      chan datatype.Event
 	chanNeedScheduling          chan datatype.Event
+	chanRuleInputs              chan ruleInput
+	chanPluginLaunchFailed      chan *datatype.PluginRuntime
+	scoreboardWrites            *recentWrites
 }
 
 
@@ -96,9 +117,15 @@ func (ns *NodeScheduler) checkResourceAvailability() error {
 //
 // - "wes-ses-goal" configmap that accepts user goals
 func (ns *NodeScheduler) Configure() (err error) {
-	if ns.Config.Simulate {
+	if err = ns.configureLocation(); err != nil {
 		return
 	}
+	if ns.Config.Simulate {
+		return ns.configureSimulation()
+	}
+	if ns.ToScoreboard != nil {
+		ns.Knowledgebase.SetScoreboard(ns.ToScoreboard)
+	}
 	err = ns.ResourceManager.ConfigureKubernetes(ns.Config.InCluster, ns.Config.Kubeconfig)
 	if err != nil {
 		return
@@ -108,7 +135,7 @@ func (ns *NodeScheduler) Configure() (err error) {
 		return
 	}
 	if ns.Config.GoalStreamURL != "" {
-		logger.Info.Printf("subscribing goal downstream from %s", ns.Config.GoalStreamURL)
+		nsLog.Infof("subscribing goal downstream from %s", ns.Config.GoalStreamURL)
 		u, err := url.Parse(ns.Config.GoalStreamURL)
 		if err != nil {
 			return err
@@ -117,23 +144,134 @@ func (ns *NodeScheduler) Configure() (err error) {
 		s.Subscribe(u.Path, ns.chanFromCloudScheduler, true)
 	}
 	if ns.LogToBeehive != nil {
-		logger.Info.Println("starting THE RMQ handler loop for message publishing")
+		nsLog.Info("starting THE RMQ handler loop for message publishing")
 		ns.LogToBeehive.StartLoop()
+		ns.subscribeRuleInputs()
+	}
+	if r, ok := ns.ToScoreboard.(*interfacing.RedisClient); ok {
+		ns.watchScoreboard(r)
 	}
 	return
 }
 
+// gpsReadInterval is how often the location of the node is read from the GPS server
+const gpsReadInterval = 10 * time.Minute
+
+// configureLocation sets the location of the node that solar functions in science rules
+// are computed at. The location is read from the GPS server if not configured
+func (ns *NodeScheduler) configureLocation() error {
+	if ns.Config.Location != "" {
+		loc, err := sciencerule.ParseLocation(ns.Config.Location)
+		if err != nil {
+			return fmt.Errorf("failed to parse location: %s", err.Error())
+		}
+		ns.Knowledgebase.SetLocation(loc)
+		nsLog.Infof("location of the node is %s", loc)
+		return nil
+	}
+	if ns.Config.GPSServerURI == "" || ns.Config.Simulate {
+		nsLog.Info("location of the node is not given. Science rules cannot use solar functions")
+		return nil
+	}
+	go ns.followGPS(ns.Config.GPSServerURI)
+	return nil
+}
+
+// followGPS reads the location of the node from the GPS server periodically. Solar
+// functions fail to evaluate until the GPS has a fix
+func (ns *NodeScheduler) followGPS(address string) {
+	for {
+		interval := gpsReadInterval
+		lat, lon, err := interfacing.ReadGPSPosition(address, 30*time.Second)
+		if err != nil {
+			nsLog.Errorf("Failed to read location of the node: %s", err.Error())
+			interval = time.Minute
+		} else {
+			loc := sciencerule.Location{Latitude: lat, Longitude: lon}
+			if previous, exist := ns.Knowledgebase.GetLocation(); !exist {
+				nsLog.Infof("location of the node is %s from GPS", loc)
+			} else if previous != loc {
+				nsLog.Debugf("location of the node moved to %s", loc)
+			}
+			ns.Knowledgebase.SetLocation(loc)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// watchScoreboard passes states changed in the scoreboard, including states that plugins
+// set or that expire, to evaluate event-driven rules reading them
+func (ns *NodeScheduler) watchScoreboard(r *interfacing.RedisClient) {
+	ch := make(chan string, maxChannelBuffer)
+	if err := r.WatchKeyspace(context.Background(), "*", ch); err != nil {
+		nsLog.Errorf("Failed to watch scoreboard: %s. Rules reading the scoreboard are evaluated only when rules set states", err.Error())
+		return
+	}
+	go func() {
+		for key := range ch {
+			// states that rules set are notified when they are set
+			if ns.scoreboardWrites.has(key) {
+				continue
+			}
+			ns.NotifyRuleInput(sciencerule.NewScoreboardDependency(key))
+		}
+	}()
+}
+
+// subscribeRuleInputs passes measurements published on the node to evaluate
+// event-driven rules reading them. The scheduler receives what its rules publish
+// as well; the meta of those messages names the job and goal of the rule
+func (ns *NodeScheduler) subscribeRuleInputs() {
+	ch := make(chan *datatype.WaggleMessage, maxChannelBuffer)
+	ns.LogToBeehive.SubscribeMessages(dataExchangeName, "nodescheduler-rule-inputs", "#", ch)
+	go func() {
+		for m := range ch {
+			ns.notifyRuleInput(ruleInput{
+				Dependency: sciencerule.NewMeasurementDependency(m.Name),
+				Publisher:  ruleInputPublisher(m.Meta["job_id"], m.Meta["goal_id"]),
+			})
+		}
+	}()
+}
+
+// NotifyRuleInput lets the scheduler evaluate event-driven rules reading the input.
+// Inputs that no rule reads are ignored
+func (ns *NodeScheduler) NotifyRuleInput(dep sciencerule.Dependency) {
+	ns.notifyRuleInput(ruleInput{Dependency: dep})
+}
+
+func (ns *NodeScheduler) notifyRuleInput(in ruleInput) {
+	if ns.Knowledgebase.HasDependents(in.Dependency) {
+		ns.chanRuleInputs <- in
+	}
+}
+
 // Run handles communications between components for scheduling
 func (ns *NodeScheduler) Run() {
 	go ns.ResourceManager.Run()
 	go ns.APIServer.Run()
-	ruleCheckingTicker := time.NewTicker(10 * time.Second)
+	ruleCheckingInterval := 10 * time.Second
+	var simulationDone <-chan struct{}
+	if ns.Simulator != nil {
+		go ns.Simulator.Run()
+		simulationDone = ns.Simulator.Done()
+		ruleCheckingInterval = ns.Simulator.Clock.Real(ruleCheckingInterval)
+	}
+	ruleCheckingTicker := time.NewTicker(ruleCheckingInterval)
+	pendingInputs := make(pendingRuleInputs)
+	var ruleInputsReady <-chan time.Time
 	for {
 		select {
+		case <-simulationDone:
+			nsLog.Info("Simulation finished")
+			if err := ns.Simulator.SaveTimeline(); err != nil {
+				nsLog.Errorf("Failed to save the timeline: %s", err.Error())
+			}
+			return
 		case event := <-ns.chanFromCloudScheduler:
 			e := event.(datatype.SchedulerEvent)
 			goals := e.GetEntry("goals").(string)
-			logger.Debug.Printf("%s: %s", e.ToString(), goals)
+			nsLog.Debugf("%s: %s", e.ToString(), goals)
 			err := ns.ResourceManager.CreateConfigMap(
 				configMapNameForGoals,
 				map[string]string{"goals": goals},
@@ -141,91 +279,61 @@ func (ns *NodeScheduler) Run() {
 				true,
 			)
 			if err != nil {
-				logger.Error.Printf("Failed to update goals for event %q", e.Type)
+				nsLog.Errorf("Failed to update goals for event %q", e.Type)
 			}
 		case <-ruleCheckingTicker.C:
-			logger.Debug.Print("Rule evaluation triggered")
+			nsLog.Debug("Rule evaluation triggered")
 			triggerScheduling := false
 			// for goalID, _ := range ns.waitingQueue.GetGoalIDs() {
 			// NOTE: Getting only goals of the plugins from the ready queue is useful only for scheduling action.
 			//       To accommodate other types of action (i.e. publishing data to beehive) we need to
 			//       evaluate all science rules no matter what plugins in the waiting queue.
+			// Event-driven rules are evaluated when their inputs change
 			for goalID, sg := range ns.GoalManager.ScienceGoals {
-				validRules, err := ns.Knowledgebase.EvaluateGoal(goalID)
+				validRules, err := ns.Knowledgebase.EvaluateTimeBasedRules(goalID)
 				if err != nil {
-					logger.Error.Printf("Failed to evaluate goal %q: %s", goalID, err.Error())
-				} else {
-					for _, r := range validRules {
-						logger.Debug.Printf("Science rule %q is valid", r)
-						switch r.ActionType {
-						case datatype.ScienceRuleActionSchedule:
-							pluginName := r.ActionObject
-							if pr := ns.GoalManager.GetPluginRuntime(PluginIndex{
-								name: pluginName,
-								jobID: sg.JobID,
-								goalID: sg.ID,
-							}); pr == nil {
-								logger.Error.Printf("failed to promote plugin: plugin name %q for goal %q not registered", pluginName, goalID)
-							} else if !pr.Status.Is(string(datatype.Inactive)) {
-								logger.Debug.Printf("plugin %q is already active. no need to activate it", pr.Plugin.Name)
-							} else {
-								// Check resource availability before scheduling
-								if err := ns.checkResourceAvailability(); err != nil {
-									logger.Error.Printf("insufficient resources to schedule plugin %q: %v", pr.Plugin.Name, err)
-									continue
-								}
-						
-								if err := pr.Queued(); err != nil {
-									logger.Error.Printf("plugin %q failed to transition from %s to %s: %s", 
-										pr.Plugin.Name, pr.Status.Current(), datatype.Queued, err.Error())
-								} else {
-									pr.UpdateWithScienceRule(r)
-									pr.GeneratePodInstance()
-									msg := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusQueued).
-										AddPluginRuntimeMeta(*pr).
-										AddPluginMeta(pr.Plugin).
-										AddReason(fmt.Sprintf("triggered by %s", r.Condition)).
-										Build().(datatype.SchedulerEvent)
-									ns.LogToBeehive.SendWaggleMessageOnNodeAsync(msg.ToWaggleMessage(), "all")
-									ns.readyQueue.Push(pr)
-									triggerScheduling = true
-									logger.Info.Printf("Plugin %s is queued by %s", pr.Plugin.Name, r.Condition)
-								}
-							}
-						case datatype.ScienceRuleActionPublish:
-							eventName := r.ActionObject
-							var value interface{}
-							if v, found := r.ActionParameters["value"]; found {
-								value = v
-							} else {
-								value = 1.
-							}
-							message := datatype.NewMessage(eventName, value, time.Now().UnixNano(), nil)
-							var to string
-							if v, found := r.ActionParameters["to"]; found {
-								to = v
-							} else {
-								to = "all"
-							}
-							ns.LogToBeehive.SendWaggleMessageOnNodeAsync(message, to)
-						case datatype.ScienceRuleActionSet:
-							stateName := r.ActionObject
-							var value interface{}
-							if v, found := r.ActionParameters["value"]; found {
-								value = v
-							} else {
-								value = 1.
-							}
-							go func() {
-								err := ns.ToScoreboard.Set(stateName, value)
-								if err != nil {
-									logger.Error.Printf("Failed to set %q: %s", stateName, err.Error())
-								}
-							}()
-						}
-					}
+					nsLog.With(sg.LogFields()).Errorf("Failed to evaluate goal %q: %s", goalID, err.Error())
+				} else if ns.runScienceRuleActions(sg, validRules) {
+					triggerScheduling = true
+				}
+			}
+			if ns.queueRequestedRuns() {
+				triggerScheduling = true
+			}
+			if triggerScheduling {
+				privateMessage := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusQueued).
+					AddReason("kb triggered").
+					Build().(datatype.SchedulerEvent)
+				ns.chanNeedScheduling <- privateMessage
+			}
+		case in := <-ns.chanRuleInputs:
+			// inputs arriving together are evaluated at once
+			pendingInputs.add(in)
+			if ruleInputsReady == nil {
+				ruleInputsReady = time.After(ruleInputDelay)
+			}
+		case <-ruleInputsReady:
+			ruleInputsReady = nil
+			nsLog.Debugf("Rule evaluation triggered by %d inputs", len(pendingInputs))
+			triggerScheduling := false
+			for _, goalID := range ns.Knowledgebase.GetDependentGoals(pendingInputs.dependencies()) {
+				sg, exist := ns.GoalManager.ScienceGoals[goalID]
+				if !exist {
+					continue
+				}
+				// what the goal published by itself does not re-evaluate its rules
+				deps := pendingInputs.dependenciesFor(sg.JobID, goalID)
+				if len(deps) == 0 {
+					continue
+				}
+				validRules, err := ns.Knowledgebase.EvaluateRulesReading(goalID, deps)
+				if err != nil {
+					nsLog.With(sg.LogFields()).Errorf("Failed to evaluate goal %q: %s", goalID, err.Error())
+				} else if ns.runScienceRuleActions(sg, validRules) {
+					triggerScheduling = true
 				}
 			}
+			pendingInputs = make(pendingRuleInputs)
 			if triggerScheduling {
 				privateMessage := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusQueued).
 					AddReason("kb triggered").
@@ -234,74 +342,103 @@ func (ns *NodeScheduler) Run() {
 			}
 		case event := <-ns.chanNeedScheduling:
 			e := event.(datatype.SchedulerEvent)
-			logger.Info.Printf("Reason for (re)scheduling %q", e.Type)
-			logger.Debug.Printf("Plugins in ready queue: %+v", ns.readyQueue.GetPluginNames())
+			nsLog.Infof("Reason for (re)scheduling %q", e.Type)
+			nsLog.Debugf("Plugins in ready queue: %+v", ns.readyQueue.GetPluginNames())
 			// Select the best task
 			pluginsToRun, err := ns.SchedulingPolicy.SelectBestPlugins(
 				&ns.readyQueue,
 				&ns.scheduledPlugins,
-				datatype.Resource{
-					CPU:       "999000m",
-					Memory:    "999999Gi",
-					GPUMemory: "999999Gi",
-				},
+				ns.getAvailableResource(),
 			)
 			if err != nil {
-				logger.Error.Printf("Failed to get the best task to run %q", err.Error())
+				nsLog.Errorf("Failed to get the best task to run %q", err.Error())
 			} else {
+				if r, ok := ns.SchedulingPolicy.(policy.ThrottleReporter); ok {
+					for pr, reason := range r.GetNewlyThrottledPlugins() {
+						msg := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusThrottled).
+							AddReason(reason).
+							AddPluginRuntimeMeta(*pr).
+							AddPluginMeta(pr.Plugin).
+							Build().(datatype.SchedulerEvent)
+						ns.LogToBeehive.SendWaggleMessageOnNodeAsync(msg.ToWaggleMessage(), "all")
+						nsLog.With(pr.LogFields()).Infof("Plugin %s is %s", pr.Plugin.Name, reason)
+					}
+				}
+				decisionReporter, hasDecision := ns.SchedulingPolicy.(policy.DecisionReporter)
+				var filteredPlugins string
+				if hasDecision {
+					filtered := make(map[string]string)
+					for pr, reason := range decisionReporter.GetFilteredPlugins() {
+						filtered[pr.Plugin.Name] = reason
+						nsLog.With(pr.LogFields()).Debugf("Plugin %s is filtered: %s", pr.Plugin.Name, reason)
+					}
+					if blob, err := json.Marshal(filtered); err == nil {
+						filteredPlugins = string(blob)
+					}
+				}
 				for _, _pr := range pluginsToRun {
-					pluginEvent := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusSelected).
+					eventBuilder := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusSelected).
 						AddReason("Fit to resource").
 						AddPluginRuntimeMeta(*_pr).
-						AddPluginMeta(_pr.Plugin).
-						Build().(datatype.SchedulerEvent)
-					logger.Debug.Printf("%s: %q (%q)", pluginEvent.ToString(), pluginEvent.GetPluginName(), pluginEvent.GetReason())
+						AddPluginMeta(_pr.Plugin)
+					if hasDecision {
+						decision := decisionReporter.GetDecision(_pr)
+						nsLog.With(_pr.LogFields()).Infof("Plugin %s is %s", _pr.Plugin.Name, decision)
+						eventBuilder = eventBuilder.
+							AddReason(decision).
+							AddEntry("filtered_plugins", filteredPlugins)
+					}
+					pluginEvent := eventBuilder.Build().(datatype.SchedulerEvent)
+					nsLog.Debugf("%s: %q (%q)", pluginEvent.ToString(), pluginEvent.GetPluginName(), pluginEvent.GetReason())
 					ns.LogToBeehive.SendWaggleMessageOnNodeAsync(pluginEvent.ToWaggleMessage(), "all")
 					pr := ns.readyQueue.Pop(_pr)
 					ns.scheduledPlugins.Push(pr)
 					go func() {
-						// TODO: when failed we need to put the pr back to inactive...???
-						logger.Debug.Printf("Running plugin %q...", pr.Plugin.Name)
+						nsLog.With(pr.LogFields()).Debugf("Running plugin %q...", pr.Plugin.Name)
 						pod, err := ns.ResourceManager.CreatePodTemplate(pr)
 						if err != nil {
-							logger.Error.Printf("Failed to create Kubernetes Pod for %q: %q", pr.Plugin.Name, err.Error())
-							msg := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusFailed).
-								AddPluginRuntimeMeta(*pr).
-								AddReason(err.Error()).
-								AddPluginMeta(pr.Plugin).
-								Build().(datatype.SchedulerEvent)
-							ns.LogToBeehive.SendWaggleMessageOnNodeAsync(msg.ToWaggleMessage(), "all")
+							nsLog.With(pr.LogFields()).Errorf("Failed to create Kubernetes Pod for %q: %q", pr.Plugin.Name, err.Error())
+							ns.failPluginLaunch(pr, err)
 							return
 						}
 						// we override the plugin name to distinguish the same plugin name from different jobs
 						if pr.Plugin.JobID != "" {
 							pod.SetName(fmt.Sprintf("%s-%s", pod.GetName(), pr.Plugin.JobID))
 						}
+						// the plugin does not run without its own credential
+						if err = ns.ResourceManager.AttachPluginCredential(pr, pod); err != nil {
+							nsLog.With(pr.LogFields()).WithField("pod", pod.Name).Errorf("Failed to attach a credential to %q: %q", pod.Name, err.Error())
+							ns.failPluginLaunch(pr, err)
+							return
+						}
 						err = ns.ResourceManager.CreatePod(pod)
 						// defer rm.TerminatePod(pod.Name)
 						if err != nil {
-							logger.Error.Printf("Failed to run %q: %q", pod.Name, err.Error())
-							msg := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusFailed).
-								AddPluginRuntimeMeta(*pr).
-								AddReason(err.Error()).
-								AddPluginMeta(pr.Plugin).
-								Build().(datatype.SchedulerEvent)
-							ns.LogToBeehive.SendWaggleMessageOnNodeAsync(msg.ToWaggleMessage(), "all")
-							if err = ns.ResourceManager.TerminatePod(pod.Name); err != nil {
-								logger.Error.Printf("Failed to delete %s: %s", pod.Name, err.Error())
+							nsLog.With(pr.LogFields()).WithField("pod", pod.Name).Errorf("Failed to run %q: %q", pod.Name, err.Error())
+							if err := ns.ResourceManager.TerminatePod(pod.Name); err != nil {
+								nsLog.With(pr.LogFields()).WithField("pod", pod.Name).Errorf("Failed to delete %s: %s", pod.Name, err.Error())
 							} else {
-								logger.Info.Printf("%s is deleted as it failed to run", pod.Name)
+								nsLog.With(pr.LogFields()).WithField("pod", pod.Name).Infof("%s is deleted as it failed to run", pod.Name)
+							}
+							if err := ns.ResourceManager.RevokePluginCredential(pod); err != nil {
+								nsLog.With(pr.LogFields()).WithField("pod", pod.Name).Errorf("Failed to revoke the credential of %s: %s", pod.Name, err.Error())
 							}
+							ns.failPluginLaunch(pr, err)
 							return
 						}
-						logger.Info.Printf("Plugin %q is created", pod.Name)
+						nsLog.With(pr.LogFields()).WithField("pod", pod.Name).Infof("Plugin %q is created", pod.Name)
+						pr.Span.AddEvent("pod created", time.Now(), map[string]string{"pod": pod.Name})
 						pr.Plugin.PluginSpec.Job = pod.Name
 					}()
 				}
 			}
+		case req := <-ns.chanContextEventToScheduler:
+			ns.handlePluginContextRequest(req)
+		case pr := <-ns.chanPluginLaunchFailed:
+			ns.handlePluginLaunchFailure(pr)
 		case event := <-ns.chanFromResourceManager:
 			e := event.(KubernetesEvent)
-			logger.Debug.Printf("Event received from Resource Manager: %s %q", e.Type, e.Action)
+			nsLog.Debugf("Event received from Resource Manager: %s %q", e.Type, e.Action)
 			switch e.Type {
 			case KubernetesEventTypePod:
 				ns.handleKubernetesPodEvent(e)
@@ -317,21 +454,125 @@ func (ns *NodeScheduler) Run() {
 	}
 }
 
+// runScienceRuleActions performs actions of the rules of the goal. It returns true
+// if any plugin is queued and the scheduler needs to schedule
+func (ns *NodeScheduler) runScienceRuleActions(sg datatype.ScienceGoal, validRules []datatype.ScienceRule) (triggerScheduling bool) {
+	for _, r := range validRules {
+		nsLog.With(sg.LogFields()).Debugf("Science rule %q is valid", r.Rule)
+		switch r.ActionType {
+		case datatype.ScienceRuleActionSchedule:
+			pluginName := r.ActionObject
+			if pr := ns.GoalManager.GetPluginRuntime(PluginIndex{
+				name: pluginName,
+				jobID: sg.JobID,
+				goalID: sg.ID,
+			}); pr == nil {
+				nsLog.With(sg.LogFields()).WithField("plugin", pluginName).Errorf("failed to promote plugin: plugin name %q for goal %q not registered", pluginName, sg.ID)
+			} else if !pr.Status.Is(string(datatype.Inactive)) {
+				nsLog.With(pr.LogFields()).Debugf("plugin %q is already active. no need to activate it", pr.Plugin.Name)
+			} else if pr.Suspended {
+				nsLog.With(pr.LogFields()).Debugf("plugin %q is suspended. not queuing it until it is resumed", pr.Plugin.Name)
+			} else if ns.queuePlugin(pr, r, fmt.Sprintf("triggered by %s", r.Condition)) {
+				triggerScheduling = true
+			}
+		case datatype.ScienceRuleActionStop,
+			datatype.ScienceRuleActionSuspend,
+			datatype.ScienceRuleActionResume:
+			pluginName := r.ActionObject
+			if pr := ns.GoalManager.GetPluginRuntime(PluginIndex{
+				name:   pluginName,
+				jobID:  sg.JobID,
+				goalID: sg.ID,
+			}); pr == nil {
+				nsLog.With(sg.LogFields()).WithField("plugin", pluginName).Errorf("failed to %s plugin: plugin name %q for goal %q not registered", r.ActionType, pluginName, sg.ID)
+			} else {
+				ns.controlPlugin(pr, r)
+			}
+		case datatype.ScienceRuleActionPublish:
+			eventName := r.ActionObject
+			value, err := ns.Knowledgebase.EvaluateActionValue(r.Value, sg.JobID)
+			if err != nil {
+				nsLog.With(sg.LogFields()).Errorf("Failed to publish %q: %s", eventName, err.Error())
+				continue
+			}
+			// the meta tells which job and goal published the message
+			message := datatype.NewMessage(eventName, value, time.Now().UnixNano(), sg.MessageMeta())
+			var to string
+			if v, found := r.ActionParameters["to"]; found {
+				to = v
+			} else {
+				to = "all"
+			}
+			ns.LogToBeehive.SendWaggleMessageOnNodeAsync(message, to)
+		case datatype.ScienceRuleActionSet:
+			// the state belongs to the job unless global=true is given
+			stateName := datatype.ScoreboardKey(sg.JobID, r.ActionObject, r.SetOptions.Global)
+			log := nsLog.With(sg.LogFields())
+			v, err := ns.Knowledgebase.EvaluateActionValue(r.Value, sg.JobID)
+			if err != nil {
+				log.Errorf("Failed to set %q: %s", stateName, err.Error())
+				continue
+			}
+			value, err := encodeState(v)
+			if err != nil {
+				log.Errorf("Failed to set %q: %s", stateName, err.Error())
+				continue
+			}
+			ttl := r.SetOptions.TTL
+			publisher := ruleInputPublisher(sg.JobID, sg.ID)
+			go func() {
+				ns.scoreboardWrites.add(stateName)
+				err := ns.ToScoreboard.SetWithTTL(stateName, value, ttl)
+				if err != nil {
+					log.Errorf("Failed to set %q: %s", stateName, err.Error())
+				} else {
+					// the goal's own rules are not evaluated again by the state it set
+					ns.notifyRuleInput(ruleInput{
+						Dependency: sciencerule.NewScoreboardDependency(stateName),
+						Publisher:  publisher,
+					})
+				}
+			}()
+		case datatype.ScienceRuleActionTrigger:
+			// the cloud scheduler runs reactions of the job registered for the trigger
+			msg := datatype.NewSchedulerEventBuilder(datatype.EventTriggerFired).
+				AddGoal(&sg).
+				AddEntry("job_id", sg.JobID).
+				AddEntry("trigger_name", r.ActionObject).
+				AddEntry("trigger_params", r.ActionParameters).
+				AddReason(fmt.Sprintf("triggered by %s", r.Condition)).
+				Build().(datatype.SchedulerEvent)
+			ns.LogToBeehive.SendWaggleMessageOnNodeAsync(msg.ToWaggleMessage(), "all")
+			nsLog.With(sg.LogFields()).Debugf("Trigger %q is sent by %s", r.ActionObject, r.Condition)
+		}
+	}
+	return
+}
+
 func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 	pod := e.Pod
-	logger.Debug.Printf("pod status: %s", string(pod.Status.Phase))
+	// credentials are revoked for any plugin Pod that is gone, including
+	// ones that the scheduler no longer tracks
+	if e.Action == KubernetesEventTypeDeleted {
+		go func() {
+			if err := ns.ResourceManager.RevokePluginCredential(pod); err != nil {
+				nsLog.WithField("pod", pod.Name).Errorf("Failed to revoke the credential of %s: %s", pod.Name, err.Error())
+			}
+		}()
+	}
+	nsLog.Debugf("pod status: %s", string(pod.Status.Phase))
 	for _, i := range pod.Status.InitContainerStatuses {
-		logger.Debug.Printf("%s: (%s) %s", pod.Name, i.Name, &i.State)
+		nsLog.WithField("pod", pod.Name).Debugf("%s: (%s) %s", pod.Name, i.Name, &i.State)
 	}
 	for _, c := range pod.Status.ContainerStatuses {
-		logger.Debug.Printf("%s: (%s) %s", pod.Name, c.Name, &c.State)
+		nsLog.WithField("pod", pod.Name).Debugf("%s: (%s) %s", pod.Name, c.Name, &c.State)
 	}
 
 	pluginName, pluginNameExist := pod.Labels[PodLabelPluginTask]
 	goalID, goalIDExist := pod.Labels[PodLabelGoalID]
 	jobID, jobIDExist := pod.Labels[PodLabelJobID]
 	if !pluginNameExist || !goalIDExist || !jobIDExist {
-		logger.Error.Printf("Pod %q labels do not have information for Plugin Runtime from Pod: %v", pod.Name, pod.Labels)
+		nsLog.WithField("pod", pod.Name).Errorf("Pod %q labels do not have information for Plugin Runtime from Pod: %v", pod.Name, pod.Labels)
 		return
 	}
 	pluginIndex := PluginIndex{
@@ -341,25 +582,26 @@ func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 	}
 	pr := ns.GoalManager.GetPluginRuntime(pluginIndex)
 	if pr == nil {
-		logger.Error.Printf("Failed to find Plugin Runtime using index %v", pluginIndex)
+		nsLog.WithField("pod", pod.Name).Errorf("Failed to find Plugin Runtime using index %v", pluginIndex)
 		return
 	}
-	logger.Debug.Printf("current Plugin %q state %s", pod.Name, pr.Status.Current())
+	log := nsLog.With(pr.LogFields()).WithField("pod", pod.Name)
+	log.Debugf("current Plugin %q state %s", pod.Name, pr.Status.Current())
 
 	// we may receive Pod events from Kubernetes on already existing ones
 	// TODO: we need to not sending messages to cloud about those already exist
 	//       by skipping the following steps
 	if !ns.scheduledPlugins.IsExist(pr) {
 		// probably unmanaged one, we should ignore it
-		logger.Info.Printf("pod %q has no associated Plugin in the queue. Ignoring the event", pod.Name)
+		log.Infof("pod %q has no associated Plugin in the queue. Ignoring the event", pod.Name)
 		return
 	}
 
 	switch e.Action {
 	case KubernetesEventTypeAdd:
-		logger.Info.Printf("Plugin %q is scheduled", pod.Name)
+		log.Infof("Plugin %q is scheduled", pod.Name)
 		if err := pr.Scheduled(); err != nil {
-			logger.Error.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Scheduled, err.Error())
+			log.Errorf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Scheduled, err.Error())
 		} else {
 			pr.SetPodUID(string(pod.UID))
 			msg := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusScheduled).
@@ -383,12 +625,12 @@ func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 			// we expect init container running and completion
 			if err := pr.Initializing(); err != nil {
 				if errors.Is(err, fsm.NoTransitionError{}) {
-					logger.Debug.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Initializing, err.Error())
+					log.Debugf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Initializing, err.Error())
 				} else {
-					logger.Error.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Initializing, err.Error())
+					log.Errorf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Initializing, err.Error())
 				}
 			} else {
-				logger.Info.Printf("plugin %q is being initialized", pod.Name)
+				log.Infof("plugin %q is being initialized", pod.Name)
 				msg := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusInitializing).
 					AddPluginRuntimeMeta(*pr).
 					AddPodMeta(pod).
@@ -402,17 +644,17 @@ func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 			if pluginContainerStatus, err := ns.ResourceManager.GetContainerStatusFromPod(pod, pluginName); err != nil {
 				// Failed to retrieve the status
 				e := fmt.Sprintf("Failed to get container status: %s", err.Error())
-				logger.Error.Println(e)
+				log.Error(e)
 				if err := pr.Failed(); err != nil {
 					if errors.Is(err, fsm.NoTransitionError{}) {
-						logger.Debug.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Failed, err.Error())
+						log.Debugf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Failed, err.Error())
 					} else {
-						logger.Error.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Failed, err.Error())
+						log.Errorf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Failed, err.Error())
 					}
 				} else {
 					messageBuilder, err := ns.ResourceManager.AnalyzeFailureOfPod(pod)
 					if err != nil {
-						logger.Error.Println(err.Error())
+						log.Error(err.Error())
 					}
 					message := messageBuilder.AddPluginRuntimeMeta(*pr).
 						AddPodMeta(pod).
@@ -433,7 +675,7 @@ func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 
 				// pluginControllerContainerStatus := ns.ResourceManager.GetContainerStatusFromPod(pod, PluginControllerContainerName)
 				// if pluginControllerContainerStatus.State.Terminated != nil {
-				// 	logger.Error.Printf("plugin %q exited with return code %d, but the Pod remains as the plugin-controller still runs", pod.Name, t.ExitCode)
+				// 	log.Errorf("plugin %q exited with return code %d, but the Pod remains as the plugin-controller still runs", pod.Name, t.ExitCode)
 				// 	if t.ExitCode == 0 {
 				// 		pr.Completed()
 				// 	} else {
@@ -444,12 +686,13 @@ func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 				// 	defer ns.ResourceManager.TerminatePod(pod.Name)
 				// }
 			} else if pluginContainerStatus.State.Running != nil {
-				logger.Info.Printf("Plugin %q starts to run", pod.Name)
+				log.Infof("Plugin %q starts to run", pod.Name)
+				ns.ShareAccounting.StartPod(jobID, string(pod.UID), pluginContainerStatus.State.Running.StartedAt.Time)
 				if err := pr.Running(); err != nil {
 					if errors.Is(err, fsm.NoTransitionError{}) {
-						logger.Warn.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Running, err.Error())
+						log.Warnf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Running, err.Error())
 					} else {
-						logger.Error.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Running, err.Error())
+						log.Errorf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Running, err.Error())
 					}
 				} else {
 					msg := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusRunning).
@@ -466,12 +709,13 @@ func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 			//       trigger message multiple times.
 			if err := pr.Completed(); err != nil {
 				if errors.Is(err, fsm.NoTransitionError{}) {
-					logger.Warn.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Completed, err.Error())
+					log.Warnf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Completed, err.Error())
 				} else {
-					logger.Error.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Completed, err.Error())
+					log.Errorf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Completed, err.Error())
 				}
 			} else {
-				logger.Info.Printf("Plugin %q succeeded", pod.Name)
+				log.Infof("Plugin %q succeeded", pod.Name)
+				ns.ShareAccounting.FinishPod(string(pod.UID), ns.getPluginFinishedTime(pod, pluginName))
 				// 	// publish plugin completion message locally so that
 				// 	// rule checker knows when the last execution was
 				// 	// TODO: The message takes time to get into DB so the rule checker may not notice
@@ -502,15 +746,16 @@ func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 			//       Thus, we ignore duplicated events.
 			if err := pr.Failed(); err != nil {
 				if errors.Is(err, fsm.NoTransitionError{}) {
-					logger.Warn.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Failed, err.Error())
+					log.Warnf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Failed, err.Error())
 				} else {
-					logger.Error.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Failed, err.Error())
+					log.Errorf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Failed, err.Error())
 				}
 			} else {
-				logger.Info.Printf("Plugin %q failed", pod.Name)
+				log.Infof("Plugin %q failed", pod.Name)
+				ns.ShareAccounting.FinishPod(string(pod.UID), ns.getPluginFinishedTime(pod, pluginName))
 				messageBuilder, err := ns.ResourceManager.AnalyzeFailureOfPod(pod)
 				if err != nil {
-					logger.Error.Println(err.Error())
+					log.Error(err.Error())
 				}
 				message := messageBuilder.AddPluginRuntimeMeta(*pr).
 					AddPluginMeta(pr.Plugin).
@@ -523,10 +768,12 @@ func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 		default:
 			// unknown Pod phase; we should notify us in case we
 			// care this event
-			logger.Error.Printf("plugin %q Pod is in unknown state: %s", pod.Name, pod.Status.Phase)
+			log.Errorf("plugin %q Pod is in unknown state: %s", pod.Name, pod.Status.Phase)
 		}
 	case KubernetesEventTypeDeleted:
-		logger.Info.Printf("Plugin %q removed", pod.Name)
+		log.Infof("Plugin %q removed", pod.Name)
+		// charges the plugin if the pod is deleted before it finishes
+		ns.ShareAccounting.FinishPod(string(pod.UID), time.Now())
 		var privateMessage datatype.SchedulerEvent
 		switch pr.Status.Current() {
 		case string(datatype.Completed):
@@ -541,14 +788,28 @@ func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 				AddReason(fmt.Sprintf("plugin %q removed due to a failure", pod.Name)).
 				Build().(datatype.SchedulerEvent)
 		default:
+			if pr.StopReason != "" {
+				// The pod was deleted by the scheduler on purpose
+				privateMessage = datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusStopped).
+					AddReason(fmt.Sprintf("plugin %q stopped", pod.Name)).
+					Build().(datatype.SchedulerEvent)
+				message := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusStopped).
+					AddReason(pr.StopReason).
+					AddPluginRuntimeMeta(*pr).
+					AddPluginMeta(pr.Plugin).
+					AddPodMeta(pod).
+					Build().(datatype.SchedulerEvent)
+				ns.LogToBeehive.SendWaggleMessageOnNodeAsync(message.ToWaggleMessage(), "all")
+				break
+			}
 			// The pod was deleted for unknown reason. One of the reasons might be
 			// that the Pod was deleted from external, e.g. kubectl delete pod.
 			// We mark this as a failure.
 			if err := pr.Failed(); err != nil {
 				if errors.Is(err, fsm.NoTransitionError{}) {
-					logger.Warn.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Failed, err.Error())
+					log.Warnf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Failed, err.Error())
 				} else {
-					logger.Error.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Failed, err.Error())
+					log.Errorf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Failed, err.Error())
 				}
 			} else {
 				privateMessage = datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusFailed).
@@ -566,11 +827,13 @@ func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 		}
 		// trigger the scheduler to schedule next Plugins
 		ns.scheduledPlugins.Pop(pr)
-		if err := pr.Inactive(); err != nil {
+		err := pr.Inactive()
+		pr.StopReason = ""
+		if err != nil {
 			if errors.Is(err, fsm.NoTransitionError{}) {
-				logger.Warn.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Inactive, err.Error())
+				log.Warnf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Inactive, err.Error())
 			} else {
-				logger.Error.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Inactive, err.Error())
+				log.Errorf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Inactive, err.Error())
 			}
 		} else {
 			ns.chanNeedScheduling <- privateMessage
@@ -578,6 +841,250 @@ func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 	}
 }
 
+// failPluginLaunch reports that the plugin failed to launch before its Pod runs and
+// lets the scheduler loop put the plugin back. It is called outside the scheduler loop
+func (ns *NodeScheduler) failPluginLaunch(pr *datatype.PluginRuntime, err error) {
+	pr.Span.SetError(err.Error())
+	pr.Span.Finish()
+	msg := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusFailed).
+		AddPluginRuntimeMeta(*pr).
+		AddReason(err.Error()).
+		AddPluginMeta(pr.Plugin).
+		Build().(datatype.SchedulerEvent)
+	ns.LogToBeehive.SendWaggleMessageOnNodeAsync(msg.ToWaggleMessage(), "all")
+	ns.chanPluginLaunchFailed <- pr
+}
+
+// handlePluginLaunchFailure makes the plugin that failed to launch inactive. No Pod
+// of the plugin reports its end, so the plugin would otherwise hold its place among
+// scheduled plugins and never be queued again
+func (ns *NodeScheduler) handlePluginLaunchFailure(pr *datatype.PluginRuntime) {
+	log := nsLog.With(pr.LogFields())
+	if ns.scheduledPlugins.Pop(pr) == nil {
+		log.Debugf("plugin %q is not scheduled. nothing to put back", pr.Plugin.Name)
+		return
+	}
+	pr.KeepRunning = false
+	if err := pr.Inactive(); err != nil {
+		log.Errorf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Inactive, err.Error())
+		return
+	}
+	log.Infof("Plugin %s is inactive as it failed to launch", pr.Plugin.Name)
+	ns.chanNeedScheduling <- datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusFailed).
+		AddReason(fmt.Sprintf("plugin %q failed to launch", pr.Plugin.Name)).
+		Build().(datatype.SchedulerEvent)
+}
+
+// queuePlugin puts the inactive plugin in the ready queue for the rule, and returns
+// true if the plugin is queued
+func (ns *NodeScheduler) queuePlugin(pr *datatype.PluginRuntime, r datatype.ScienceRule, reason string) bool {
+	log := nsLog.With(pr.LogFields())
+	// Check resource availability before scheduling. The host resource
+	// does not matter in simulation
+	if ns.Simulator == nil {
+		if err := ns.checkResourceAvailability(); err != nil {
+			log.Errorf("insufficient resources to schedule plugin %q: %v", pr.Plugin.Name, err)
+			return false
+		}
+	}
+	if err := pr.Queued(); err != nil {
+		log.Errorf("plugin %q failed to transition from %s to %s: %s",
+			pr.Plugin.Name, pr.Status.Current(), datatype.Queued, err.Error())
+		return false
+	}
+	// the run the plugin asked for is fulfilled by any run
+	pr.RunRequestedAt = time.Time{}
+	pr.UpdateWithScienceRule(r)
+	pr.GeneratePodInstance()
+	pr.Span.SetAttribute("instance", pr.PodInstance)
+	if r.Condition != "" {
+		pr.Span.SetAttribute("condition", r.Condition)
+	}
+	msg := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusQueued).
+		AddPluginRuntimeMeta(*pr).
+		AddPluginMeta(pr.Plugin).
+		AddReason(reason).
+		Build().(datatype.SchedulerEvent)
+	ns.LogToBeehive.SendWaggleMessageOnNodeAsync(msg.ToWaggleMessage(), "all")
+	ns.readyQueue.Push(pr)
+	log.Infof("Plugin %s is queued: %s", pr.Plugin.Name, reason)
+	return true
+}
+
+// queueRequestedRuns queues the plugins that asked to run again by now, and returns
+// true if any plugin is queued
+func (ns *NodeScheduler) queueRequestedRuns() (triggerScheduling bool) {
+	now := time.Now()
+	for _, pr := range ns.GoalManager.LoadedPlugins {
+		if pr.IsRunRequested(now) && ns.queuePlugin(pr, datatype.ScienceRule{}, "requested by the plugin") {
+			triggerScheduling = true
+		}
+	}
+	return
+}
+
+// pluginContextRequest is a context event from a plugin through the API server.
+// Reply receives the name of the plugin, or an empty name if no plugin runs in the Pod
+type pluginContextRequest struct {
+	Event datatype.EventPluginContext
+	Reply chan<- string
+}
+
+// pluginForContext returns the plugin that sent the event and fills the event with it
+func (ns *NodeScheduler) pluginForContext(e *datatype.EventPluginContext) *datatype.PluginRuntime {
+	pr := ns.GoalManager.GetPluginRuntimeByPodUID(e.PodUID)
+	if pr == nil {
+		return nil
+	}
+	e.GoalID = pr.Plugin.GoalID
+	e.PluginName = pr.Plugin.Name
+	return pr
+}
+
+// handlePluginContextRequest replies to the API server with the plugin that sent the
+// event and acts on the event
+func (ns *NodeScheduler) handlePluginContextRequest(req pluginContextRequest) {
+	pr := ns.pluginForContext(&req.Event)
+	if pr == nil {
+		nsLog.WithField("pod_uid", req.Event.PodUID).Errorf("Failed to find plugin of Pod UID %q that sent %s", req.Event.PodUID, req.Event.Status)
+		req.Reply <- ""
+		return
+	}
+	req.Reply <- pr.Plugin.Name
+	ns.handlePluginContextEvent(pr, req.Event)
+}
+
+// handlePluginContextEvent acts on the plugin that asked to stop, keep running,
+// or run again later
+func (ns *NodeScheduler) handlePluginContextEvent(pr *datatype.PluginRuntime, e datatype.EventPluginContext) {
+	log := nsLog.With(pr.LogFields())
+	switch {
+	case e.Status == datatype.Stoppable:
+		pr.KeepRunning = false
+		ns.stopPlugin(pr, "stopped by the plugin")
+	case e.Status == datatype.Runnable && e.RunAfter > 0:
+		pr.RunRequestedAt = time.Now().Add(e.RunAfter)
+		log.Infof("Plugin %s asked to run again in %s", pr.Plugin.Name, e.RunAfter)
+	case e.Status == datatype.Runnable:
+		if !pr.Status.Is(string(datatype.Inactive)) {
+			pr.KeepRunning = true
+			log.Infof("Plugin %s asked to keep running", pr.Plugin.Name)
+		}
+	default:
+		log.Errorf("Unknown context status %q from plugin %s", e.Status, pr.Plugin.Name)
+	}
+}
+
+// controlPlugin applies stop(), suspend(), or resume() rules to the plugin.
+// Suspending a plugin also stops it
+func (ns *NodeScheduler) controlPlugin(pr *datatype.PluginRuntime, r datatype.ScienceRule) {
+	log := nsLog.With(pr.LogFields())
+	switch r.ActionType {
+	case datatype.ScienceRuleActionStop:
+		ns.stopPlugin(pr, fmt.Sprintf("stopped by %s", r.Condition))
+	case datatype.ScienceRuleActionSuspend:
+		if !pr.Suspended {
+			pr.Suspended = true
+			log.Infof("Plugin %s is suspended by %s", pr.Plugin.Name, r.Condition)
+			msg := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusSuspended).
+				AddPluginRuntimeMeta(*pr).
+				AddPluginMeta(pr.Plugin).
+				AddReason(fmt.Sprintf("suspended by %s", r.Condition)).
+				Build().(datatype.SchedulerEvent)
+			ns.LogToBeehive.SendWaggleMessageOnNodeAsync(msg.ToWaggleMessage(), "all")
+		}
+		ns.stopPlugin(pr, fmt.Sprintf("suspended by %s", r.Condition))
+	case datatype.ScienceRuleActionResume:
+		if !pr.Suspended {
+			return
+		}
+		pr.Suspended = false
+		log.Infof("Plugin %s is resumed by %s", pr.Plugin.Name, r.Condition)
+		msg := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusResumed).
+			AddPluginRuntimeMeta(*pr).
+			AddPluginMeta(pr.Plugin).
+			AddReason(fmt.Sprintf("resumed by %s", r.Condition)).
+			Build().(datatype.SchedulerEvent)
+		ns.LogToBeehive.SendWaggleMessageOnNodeAsync(msg.ToWaggleMessage(), "all")
+	}
+}
+
+// stopPlugin moves the plugin to Inactive. A queued plugin is taken out of the ready queue.
+// The Pod of a scheduled plugin is terminated, and the plugin becomes Inactive
+// when the Pod is deleted
+func (ns *NodeScheduler) stopPlugin(pr *datatype.PluginRuntime, reason string) {
+	log := nsLog.With(pr.LogFields())
+	switch {
+	case pr.Status.Is(string(datatype.Inactive)):
+		log.Debugf("plugin %q is not active. nothing to stop", pr.Plugin.Name)
+	case ns.readyQueue.IsExist(pr):
+		ns.readyQueue.Pop(pr)
+		pr.StopReason = reason
+		err := pr.Inactive()
+		pr.StopReason = ""
+		if err != nil {
+			log.Errorf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Inactive, err.Error())
+			return
+		}
+		log.Infof("Plugin %s is %s", pr.Plugin.Name, reason)
+		msg := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusStopped).
+			AddPluginRuntimeMeta(*pr).
+			AddPluginMeta(pr.Plugin).
+			AddReason(reason).
+			Build().(datatype.SchedulerEvent)
+		ns.LogToBeehive.SendWaggleMessageOnNodeAsync(msg.ToWaggleMessage(), "all")
+	case ns.scheduledPlugins.IsExist(pr):
+		if pr.KeepRunning {
+			log.Debugf("plugin %q asked to keep running. not stopping it", pr.Plugin.Name)
+			return
+		}
+		if pr.StopReason != "" {
+			log.Debugf("plugin %q is already being stopped", pr.Plugin.Name)
+			return
+		}
+		podName := pr.Plugin.PluginSpec.Job
+		if podName == "" {
+			// the rule will be evaluated again and stop the plugin once its Pod exists
+			log.Debugf("Pod of plugin %q is not created yet. will stop it later", pr.Plugin.Name)
+			return
+		}
+		pr.StopReason = reason
+		if err := ns.ResourceManager.TerminatePod(podName); err != nil {
+			pr.StopReason = ""
+			log.WithField("pod", podName).Errorf("Failed to stop plugin %q: %s", pr.Plugin.Name, err.Error())
+			return
+		}
+		log.WithField("pod", podName).Infof("Plugin %s is being %s", pr.Plugin.Name, reason)
+	}
+}
+
+// getAvailableResource returns the resource that scheduling policies can allocate to plugins.
+// GPU memory comes from the GPU compute in the config, if given.
+func (ns *NodeScheduler) getAvailableResource() datatype.Resource {
+	r := datatype.Resource{
+		CPU:       "999000m",
+		Memory:    "999999Gi",
+		GPUMemory: "999999Gi",
+	}
+	if ns.Config.GPUCompute != nil {
+		if gpuMemory := ns.Config.GPUCompute.GetGPUMemory(); gpuMemory != "" {
+			r.GPUMemory = gpuMemory
+		}
+	}
+	return r
+}
+
+// getPluginFinishedTime returns the time the plugin container terminated.
+// It returns the current time if the container has not terminated.
+func (ns *NodeScheduler) getPluginFinishedTime(pod *v1.Pod, pluginName string) time.Time {
+	if status, err := ns.ResourceManager.GetContainerStatusFromPod(pod, pluginName); err == nil {
+		if t := status.State.Terminated; t != nil && !t.FinishedAt.IsZero() {
+			return t.FinishedAt.Time
+		}
+	}
+	return time.Now()
+}
+
 // handleKubernetesEventEvent processes Event messages sent from Kubernetes.
 // When starting, Kubernetes Informer sends all events from any existing resources.
 //
@@ -587,8 +1094,8 @@ func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 // and resume managing them, instead of killing all of them due to a scheduler restart.
 func (ns *NodeScheduler) handleKubernetesEventEvent(e KubernetesEvent) {
 	event := e.Event
-	logger.Debug.Printf("event %s: %s, %s", event.Name, event.Reason, event.Message)
-	logger.Debug.Printf("%v", event)
+	nsLog.Debugf("event %s: %s, %s", event.Name, event.Reason, event.Message)
+	nsLog.Debugf("%v", event)
 
 	// we assume Events are always Add type
 	// switch e.Action {
@@ -605,7 +1112,7 @@ func (ns *NodeScheduler) handleKubernetesEventEvent(e KubernetesEvent) {
 			case "FailedPostStartHook", "Failed", "FailedMount", "FailedCreatePodSandBox":
 				// NOTE: There can be multiple Reasons of a failure. We try to capture them
 				//       as much as possible.
-				logger.Info.Printf("Plugin %q failed due to %s", obj.Name, event.Reason)
+				nsLog.With(pr.LogFields()).WithField("pod", obj.Name).Infof("Plugin %q failed due to %s", obj.Name, event.Reason)
 				pr.Failed()
 				message := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusFailed).
 					AddPluginRuntimeMeta(*pr).
@@ -638,17 +1145,17 @@ func (ns *NodeScheduler) handleKubernetesConfigMapEvent(e KubernetesEvent) {
 	}
 	switch e.Action {
 	case KubernetesEventTypeAdd, KubernetesEventTypeModified:
-		logger.Debug.Printf("A bulk goal is received: %v", cm.Data)
+		nsLog.Debugf("A bulk goal is received: %v", cm.Data)
 		if data, found := cm.Data["goals"]; found {
 			var goals []datatype.ScienceGoal
 			err := json.Unmarshal([]byte(data), &goals)
 			if err != nil {
-				logger.Error.Printf("Failed to load bulk goals %s: %q", data, err.Error())
+				nsLog.Errorf("Failed to load bulk goals %s: %q", data, err.Error())
 			} else {
 				ns.handleBulkGoals(goals)
 			}
 		} else {
-			logger.Error.Printf("Kubernetes ConfigMap %q for goals does not have \"goals\" data: %s",
+			nsLog.Errorf("Kubernetes ConfigMap %q for goals does not have \"goals\" data: %s",
 				cm.Name,
 				cm.Data)
 		}
@@ -656,14 +1163,18 @@ func (ns *NodeScheduler) handleKubernetesConfigMapEvent(e KubernetesEvent) {
 	}
 }
 
-func (ns *NodeScheduler) registerGoal(goal *datatype.ScienceGoal) {
+// registerGoal adds the goal and its plugins. Runs of the plugins are traced
+// as children of trace
+func (ns *NodeScheduler) registerGoal(goal *datatype.ScienceGoal, trace tracing.SpanContext) {
 	ns.GoalManager.AddGoal(goal)
+	ns.ConcurrencyLimits.SetJobLimit(goal.JobID, goal.MaxConcurrency)
+	ns.ShareAccounting.SetJobOwner(goal.JobID, goal.User)
 	if mySubGoal := goal.GetMySubGoal(ns.NodeID); mySubGoal == nil {
-		logger.Error.Printf("Failed to find my sub goal from science goal %q. Failed to register the goal.", goal.ID)
+		nsLog.With(goal.LogFields()).Errorf("Failed to find my sub goal from science goal %q. Failed to register the goal.", goal.ID)
 	} else {
 		err := ns.Knowledgebase.AddRulesFromScienceGoal(goal)
 		if err != nil {
-			logger.Error.Printf("Failed to add science rules of goal %q: %s", goal.ID, err.Error())
+			nsLog.With(goal.LogFields()).Errorf("Failed to add science rules of goal %q: %s", goal.ID, err.Error())
 		}
 		for _, p := range mySubGoal.GetPlugins() {
 			// copy plugin object
@@ -673,14 +1184,51 @@ func (ns *NodeScheduler) registerGoal(goal *datatype.ScienceGoal) {
 			_p.JobID = goal.JobID
 
 			pr := datatype.NewPluginRuntime(_p)
+			pr.TraceID, pr.ParentSpanID = trace.TraceID, trace.SpanID
+			if ns.Simulator != nil {
+				pr.AddStateObserver(ns.Simulator.RecordTransition)
+			}
+			pr.AddStateObserver(ns.tracePluginRun)
 			ns.GoalManager.AddPluginRuntime(pr)
-			logger.Debug.Printf("plugin %s is added to the watiting queue", p.Name)
+			nsLog.With(p.LogFields()).Debugf("plugin %s is added to the watiting queue", p.Name)
+		}
+	}
+}
+
+// tracePluginRun traces a run of the plugin from when it is queued until it finishes
+func (ns *NodeScheduler) tracePluginRun(pr *datatype.PluginRuntime, from string, to string) {
+	now := time.Now()
+	switch datatype.PluginState(to) {
+	case datatype.Queued:
+		pr.Span = ns.Tracer.StartSpanAt("plugin.run", pr.TraceContext(), now)
+		pr.Span.SetAttribute("node", ns.NodeID).
+			SetAttribute("plugin", pr.Plugin.Name).
+			SetAttribute("job_id", pr.Plugin.JobID).
+			SetAttribute("goal_id", pr.Plugin.GoalID)
+	case datatype.Completed:
+		pr.Span.AddEvent(to, now, nil)
+		pr.Span.FinishAt(now)
+	case datatype.Failed:
+		pr.Span.AddEvent(to, now, nil)
+		pr.Span.SetError("plugin failed")
+		pr.Span.FinishAt(now)
+	case datatype.Inactive:
+		// the plugin may be dropped or stopped before it finishes
+		if !pr.Span.Ended() {
+			if pr.StopReason != "" {
+				pr.Span.SetAttribute("stop_reason", pr.StopReason)
+			} else {
+				pr.Span.SetError(fmt.Sprintf("plugin became inactive while %s", from))
+			}
+			pr.Span.FinishAt(now)
 		}
+	default:
+		pr.Span.AddEvent(to, now, nil)
 	}
 }
 
 func (ns *NodeScheduler) cleanUpGoal(goal *datatype.ScienceGoal) {
-	ns.Knowledgebase.DropRules(goal.Name)
+	ns.Knowledgebase.DropRules(goal.ID)
 	if mySubGoal := goal.GetMySubGoal(ns.NodeID); mySubGoal != nil {
 		for _, p := range goal.GetMySubGoal(ns.NodeID).GetPlugins() {
 			if pr := ns.GoalManager.GetPluginRuntime(PluginIndex{
@@ -688,11 +1236,11 @@ func (ns *NodeScheduler) cleanUpGoal(goal *datatype.ScienceGoal) {
 				goalID: goal.ID,
 				jobID:  goal.JobID,
 			}); pr == nil {
-				logger.Error.Printf("failed to remove plugin: plugin name %q for goal %q not registered", p.Name, goal.ID)
+				nsLog.With(goal.LogFields()).Errorf("failed to remove plugin: plugin name %q for goal %q not registered", p.Name, goal.ID)
 				// TODO: we may want to verify what exist and why this happens
 			} else {
 				if a := ns.readyQueue.Pop(pr); a != nil {
-					logger.Debug.Printf("plugin %s is removed from the ready queue", p.Name)
+					nsLog.With(p.LogFields()).Debugf("plugin %s is removed from the ready queue", p.Name)
 				}
 				if a := ns.scheduledPlugins.Pop(pr); a != nil {
 					// Pods have their job ID in the name
@@ -703,7 +1251,7 @@ func (ns *NodeScheduler) cleanUpGoal(goal *datatype.ScienceGoal) {
 						podName = a.Plugin.Name
 					}
 					if pod, err := ns.ResourceManager.GetPod(podName); err != nil {
-						logger.Error.Printf("Failed to get pod of the plugin %q", a.Plugin.Name)
+						nsLog.With(a.LogFields()).Errorf("Failed to get pod of the plugin %q", a.Plugin.Name)
 					} else {
 						e := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusFailed).
 							AddPluginRuntimeMeta(*pr).
@@ -713,7 +1261,7 @@ func (ns *NodeScheduler) cleanUpGoal(goal *datatype.ScienceGoal) {
 							Build().(datatype.SchedulerEvent)
 						ns.LogToBeehive.SendWaggleMessageOnNodeAsync(e.ToWaggleMessage(), "all")
 						ns.ResourceManager.TerminatePod(podName)
-						logger.Info.Printf("plugin %s is removed from running", p.Name)
+						nsLog.With(p.LogFields()).Infof("plugin %s is removed from running", p.Name)
 					}
 					ns.GoalManager.DropPluginRuntime(PluginIndex{
 						name:   p.Name,
@@ -725,6 +1273,29 @@ func (ns *NodeScheduler) cleanUpGoal(goal *datatype.ScienceGoal) {
 		}
 	}
 	ns.GoalManager.DropGoal(goal.ID)
+	ns.ConcurrencyLimits.DropJob(goal.JobID)
+	ns.ShareAccounting.DropJob(goal.JobID)
+}
+
+// startGoalSpan starts the span of receiving the goal. It continues the trace
+// of the goal if the goal was pushed with one
+func (ns *NodeScheduler) startGoalSpan(goal *datatype.ScienceGoal) *tracing.Span {
+	span := ns.Tracer.StartSpan("goal.receive", goal.TraceContext())
+	span.SetAttribute("node", ns.NodeID).
+		SetAttribute("goal_id", goal.ID).
+		SetAttribute("job_id", goal.JobID)
+	return span
+}
+
+// scienceGoalIDs returns IDs of the goals. It is safe to call outside the scheduler loop
+// as goals are added and dropped under the lock
+func (ns *NodeScheduler) scienceGoalIDs() (goalIDs []string) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	for goalID := range ns.GoalManager.ScienceGoals {
+		goalIDs = append(goalIDs, goalID)
+	}
+	return
 }
 
 // handleBulkGoals adds or updates each goal in given goal list
@@ -743,22 +1314,28 @@ func (ns *NodeScheduler) handleBulkGoals(goals []datatype.ScienceGoal) {
 		if existingGoal, _ := ns.GoalManager.GetScienceGoalByJobID(goal.JobID); existingGoal != nil {
 			// We assume that if the goal ID are the same, the goal has not changed.
 			if existingGoal.ID == goal.ID {
-				logger.Info.Printf("The goal %s exists and no changes in the goal. Skipping adding the goal", goal.Name)
+				nsLog.With(goal.LogFields()).Infof("The goal %s exists and no changes in the goal. Skipping adding the goal", goal.Name)
 				continue
 			} else {
-				logger.Info.Printf("The goal %s %q exists and has changed its content. Cleaning up the existing goal %q", goal.Name, goal.ID, existingGoal.ID)
+				nsLog.With(goal.LogFields()).Infof("The goal %s %q exists and has changed its content. Cleaning up the existing goal %q", goal.Name, goal.ID, existingGoal.ID)
 				ns.cleanUpGoal(existingGoal)
-				ns.registerGoal(&goal)
+				span := ns.startGoalSpan(&goal)
+				ns.registerGoal(&goal, span.Context())
+				span.Finish()
 				e := datatype.NewSchedulerEventBuilder(datatype.EventGoalStatusUpdated).
 					AddGoal(&goal).
+					AddSpan(span).
 					Build().(datatype.SchedulerEvent)
 				ns.LogToBeehive.SendWaggleMessageOnNodeAsync(e.ToWaggleMessage(), "all")
 			}
 		} else {
-			logger.Info.Printf("Adding the new goal %s %q", goal.Name, goal.ID)
-			ns.registerGoal(&goal)
+			nsLog.With(goal.LogFields()).Infof("Adding the new goal %s %q", goal.Name, goal.ID)
+			span := ns.startGoalSpan(&goal)
+			ns.registerGoal(&goal, span.Context())
+			span.Finish()
 			e := datatype.NewSchedulerEventBuilder(datatype.EventGoalStatusReceived).
 				AddGoal(&goal).
+				AddSpan(span).
 				Build().(datatype.SchedulerEvent)
 			ns.LogToBeehive.SendWaggleMessageOnNodeAsync(e.ToWaggleMessage(), "all")
 		}
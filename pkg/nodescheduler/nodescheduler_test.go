@@ -0,0 +1,41 @@
+package nodescheduler
+
+import (
+	"testing"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestHandlePluginLaunchFailure(t *testing.T) {
+	ns := &NodeScheduler{
+		chanNeedScheduling: make(chan datatype.Event, 1),
+	}
+	pr := datatype.NewPluginRuntime(datatype.Plugin{Name: "sampler", GoalID: "goal-1", JobID: "42"})
+	if err := pr.Queued(); err != nil {
+		t.Fatal(err)
+	}
+	// the plugin was selected but its Pod was never created, e.g. the credential was not minted
+	ns.scheduledPlugins.Push(pr)
+	ns.handlePluginLaunchFailure(pr)
+	if ns.scheduledPlugins.IsExist(pr) {
+		t.Errorf("wanted the plugin out of the scheduled plugins")
+	}
+	if !pr.Status.Is(string(datatype.Inactive)) {
+		t.Errorf("wanted the plugin inactive but got %s", pr.Status.Current())
+	}
+	select {
+	case <-ns.chanNeedScheduling:
+	default:
+		t.Errorf("wanted scheduling triggered")
+	}
+	// the plugin can be queued again
+	if err := pr.Queued(); err != nil {
+		t.Errorf("wanted the plugin to be queued again: %s", err.Error())
+	}
+
+	// plugins no longer scheduled are left as they are
+	ns.handlePluginLaunchFailure(pr)
+	if !pr.Status.Is(string(datatype.Queued)) {
+		t.Errorf("wanted the plugin queued but got %s", pr.Status.Current())
+	}
+}
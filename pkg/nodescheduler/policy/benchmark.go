@@ -0,0 +1,401 @@
+package policy
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+const (
+	defaultStarvationThreshold = 10 * time.Minute
+	defaultBenchmarkHorizon    = 24 * time.Hour
+)
+
+// WorkloadConfig describes a synthetic workload for benchmarking policies
+type WorkloadConfig struct {
+	Seed int64
+	// Tasks is the number of plugin runs in the workload
+	Tasks int
+	// Jobs and Users spread the tasks over jobs and their owners. Each job has one plugin image
+	Jobs  int
+	Users int
+	// JobMaxConcurrency is the max_concurrency of each job. 0 means no limit
+	JobMaxConcurrency int
+	// Arrival is the arrival process of tasks: poisson, periodic, or burst
+	Arrival          string
+	MeanInterarrival time.Duration
+	// BurstSize is the number of tasks arriving at once in the burst arrival
+	BurstSize int
+	// GPUFraction is the fraction of GPU-demand tasks
+	GPUFraction float64
+	// GPUMemoryChoices are request.gpu_memory picked for GPU-demand tasks, e.g. 1Gi.
+	// An empty string makes the task need the GPU exclusively
+	GPUMemoryChoices []string
+	// Durations are uniformly distributed between MinDuration and MaxDuration
+	MinDuration time.Duration
+	MaxDuration time.Duration
+	// MaxPriority gives tasks a priority between 0 and MaxPriority
+	MaxPriority int
+}
+
+// WorkloadTask is a plugin run arriving at the ready queue
+type WorkloadTask struct {
+	Arrival  time.Duration
+	Duration time.Duration
+	Plugin   datatype.Plugin
+	User     string
+	// JobMaxConcurrency is the max_concurrency of the task's job
+	JobMaxConcurrency int
+}
+
+// GenerateWorkload returns tasks of the synthetic workload in the order of their arrival
+func GenerateWorkload(config WorkloadConfig) ([]WorkloadTask, error) {
+	if config.Tasks < 1 || config.Jobs < 1 || config.Users < 1 {
+		return nil, fmt.Errorf("tasks, jobs, and users must be positive")
+	}
+	if config.MinDuration <= 0 || config.MaxDuration < config.MinDuration {
+		return nil, fmt.Errorf("durations must be positive and min duration must not exceed max duration")
+	}
+	random := rand.New(rand.NewSource(config.Seed))
+	burstSize := config.BurstSize
+	if burstSize < 1 {
+		burstSize = 1
+	}
+	var (
+		tasks   []WorkloadTask
+		arrival time.Duration
+	)
+	for i := 0; i < config.Tasks; i++ {
+		switch config.Arrival {
+		case "", "poisson":
+			arrival += time.Duration(random.ExpFloat64() * float64(config.MeanInterarrival))
+		case "periodic":
+			if i > 0 {
+				arrival += config.MeanInterarrival
+			}
+		case "burst":
+			if i > 0 && i%burstSize == 0 {
+				arrival += config.MeanInterarrival * time.Duration(burstSize)
+			}
+		default:
+			return nil, fmt.Errorf("unknown arrival process %q", config.Arrival)
+		}
+		job := random.Intn(config.Jobs)
+		plugin := datatype.Plugin{
+			// plugin names must be unique as queues find plugins by their name
+			Name:  fmt.Sprintf("job%d-task%d", job, i),
+			JobID: fmt.Sprint(job),
+			PluginSpec: &datatype.PluginSpec{
+				Image:    fmt.Sprintf("plugin-%d:latest", job),
+				Selector: map[string]string{},
+				Resource: map[string]string{},
+			},
+		}
+		if config.MaxPriority > 0 {
+			plugin.Priority = random.Intn(config.MaxPriority + 1)
+		}
+		if random.Float64() < config.GPUFraction {
+			plugin.PluginSpec.Selector["resource.gpu"] = "true"
+			if len(config.GPUMemoryChoices) > 0 {
+				if memory := config.GPUMemoryChoices[random.Intn(len(config.GPUMemoryChoices))]; memory != "" {
+					plugin.PluginSpec.Resource["request.gpu_memory"] = memory
+				}
+			}
+		}
+		duration := config.MinDuration
+		if config.MaxDuration > config.MinDuration {
+			duration += time.Duration(random.Int63n(int64(config.MaxDuration - config.MinDuration)))
+		}
+		tasks = append(tasks, WorkloadTask{
+			Arrival:  arrival,
+			Duration: duration,
+			Plugin:   plugin,
+			User:     fmt.Sprintf("user%d", job%config.Users),
+
+			JobMaxConcurrency: config.JobMaxConcurrency,
+		})
+	}
+	return tasks, nil
+}
+
+// BenchmarkPolicy creates a policy for a benchmark run. now returns the simulated time
+// and the accounting is charged with simulated pod-seconds
+type BenchmarkPolicy struct {
+	Name string
+	New  func(now func() time.Time, limits *ConcurrencyLimits, accounting *ShareAccounting) (SchedulingPolicy, error)
+}
+
+// GetBenchmarkPolicies returns the policies selectable by name, each wrapped by
+// the concurrency limits as the node scheduler does
+func GetBenchmarkPolicies() []BenchmarkPolicy {
+	wrap := func(name string, newPolicy func() SchedulingPolicy) BenchmarkPolicy {
+		return BenchmarkPolicy{
+			Name: name,
+			New: func(now func() time.Time, limits *ConcurrencyLimits, accounting *ShareAccounting) (SchedulingPolicy, error) {
+				return NewConcurrencyLimitPolicy(newPolicy(), limits), nil
+			},
+		}
+	}
+	return []BenchmarkPolicy{
+		wrap("default", func() SchedulingPolicy { return NewSimpleSchedulingPolicy() }),
+		wrap("roundrobin", func() SchedulingPolicy { return NewRoundRobinSchedulingPolicy() }),
+		wrap("gpuaware", func() SchedulingPolicy { return NewGPUAwareSchedulingPolicy() }),
+		{
+			Name: "fairshare",
+			New: func(now func() time.Time, limits *ConcurrencyLimits, accounting *ShareAccounting) (SchedulingPolicy, error) {
+				p := NewFairSharePolicy(accounting)
+				p.getCurrentTime = now
+				return NewConcurrencyLimitPolicy(p, limits), nil
+			},
+		},
+	}
+}
+
+// NewChainBenchmarkPolicy returns a benchmark policy of the policy chain
+func NewChainBenchmarkPolicy(name string, config *ChainConfig) BenchmarkPolicy {
+	return BenchmarkPolicy{
+		Name: name,
+		New: func(now func() time.Time, limits *ConcurrencyLimits, accounting *ShareAccounting) (SchedulingPolicy, error) {
+			p, err := NewChainPolicy(config, limits, accounting)
+			if err != nil {
+				return nil, err
+			}
+			p.getCurrentTime = now
+			return p, nil
+		},
+	}
+}
+
+// BenchmarkConfig describes the node on which the policies are benchmarked
+type BenchmarkConfig struct {
+	// Capacity is given to policies as the available resource
+	Capacity datatype.Resource
+	// StarvationThreshold is the wait time beyond which a task is considered starved
+	StarvationThreshold time.Duration
+	// Horizon stops the simulation after the last arrival
+	Horizon       time.Duration
+	ShareHalfLife time.Duration
+}
+
+// BenchmarkReport summarizes a benchmark run of a policy
+type BenchmarkReport struct {
+	Policy    string
+	Tasks     int
+	Completed int
+	// Makespan is the time from the first arrival to the last completion
+	Makespan time.Duration
+	MeanWait time.Duration
+	P95Wait  time.Duration
+	MaxWait  time.Duration
+	// GPUUtilization is the fraction of the makespan during which GPU-demand tasks run
+	GPUUtilization float64
+	// GPUOversubscription is the fraction of the makespan during which GPU-demand tasks
+	// need more than the GPU, i.e. an exclusive task runs with other GPU-demand tasks or
+	// their GPU memory exceeds the capacity
+	GPUOversubscription float64
+	// Starved is the number of tasks that waited longer than the starvation threshold
+	// or never started
+	Starved int
+}
+
+type benchmarkRun struct {
+	task     *WorkloadTask
+	pr       *datatype.PluginRuntime
+	started  bool
+	start    time.Duration
+	finished bool
+	finish   time.Duration
+}
+
+// RunBenchmark runs the workload through the policy in a discrete-event simulation. The policy
+// is asked to select plugins whenever tasks arrive or finish, and selected tasks start immediately.
+func RunBenchmark(bp BenchmarkPolicy, workload []WorkloadTask, config BenchmarkConfig) (report BenchmarkReport, err error) {
+	report.Policy = bp.Name
+	report.Tasks = len(workload)
+	if len(workload) == 0 {
+		return
+	}
+	if config.StarvationThreshold == 0 {
+		config.StarvationThreshold = defaultStarvationThreshold
+	}
+	if config.Horizon == 0 {
+		config.Horizon = defaultBenchmarkHorizon
+	}
+	base := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	var now time.Duration
+	limits := NewConcurrencyLimits()
+	accounting := NewShareAccounting(config.ShareHalfLife)
+	p, err := bp.New(func() time.Time { return base.Add(now) }, limits, accounting)
+	if err != nil {
+		return report, err
+	}
+	tasks := append([]WorkloadTask{}, workload...)
+	sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].Arrival < tasks[j].Arrival })
+	runs := make([]*benchmarkRun, len(tasks))
+	runByName := make(map[string]*benchmarkRun)
+	for i := range tasks {
+		runs[i] = &benchmarkRun{task: &tasks[i], pr: datatype.NewPluginRuntime(tasks[i].Plugin)}
+		runByName[tasks[i].Plugin.Name] = runs[i]
+	}
+	end := tasks[len(tasks)-1].Arrival + config.Horizon
+	gpuMemoryCapacity := config.Capacity.GetGPUMemoryInMega()
+	var (
+		readyQueue       datatype.Queue
+		scheduledPlugins datatype.Queue
+		running          []*benchmarkRun
+		nextArrival      int
+		gpuBusy          time.Duration
+		gpuOver          time.Duration
+	)
+	for {
+		// find the next event
+		next := time.Duration(math.MaxInt64)
+		if nextArrival < len(runs) {
+			next = runs[nextArrival].task.Arrival
+		}
+		for _, r := range running {
+			if r.finish < next {
+				next = r.finish
+			}
+		}
+		if next == time.Duration(math.MaxInt64) || next > end {
+			break
+		}
+		busy, over := gpuState(running, gpuMemoryCapacity)
+		if busy {
+			gpuBusy += next - now
+		}
+		if over {
+			gpuOver += next - now
+		}
+		now = next
+		// completions come before arrivals at the same time
+		var stillRunning []*benchmarkRun
+		for _, r := range running {
+			if r.finish <= now {
+				r.finished = true
+				scheduledPlugins.Pop(r.pr)
+				accounting.FinishPod(r.pr.Plugin.Name, base.Add(now))
+			} else {
+				stillRunning = append(stillRunning, r)
+			}
+		}
+		running = stillRunning
+		for ; nextArrival < len(runs) && runs[nextArrival].task.Arrival <= now; nextArrival++ {
+			r := runs[nextArrival]
+			limits.SetJobLimit(r.pr.Plugin.JobID, r.task.JobMaxConcurrency)
+			accounting.SetJobOwner(r.pr.Plugin.JobID, r.task.User)
+			r.pr.QueuedAt = base.Add(now)
+			readyQueue.Push(r.pr)
+		}
+		pluginsToRun, err := p.SelectBestPlugins(&readyQueue, &scheduledPlugins, config.Capacity)
+		if err != nil {
+			return report, err
+		}
+		for _, pr := range pluginsToRun {
+			r := runByName[pr.Plugin.Name]
+			if r == nil || r.started {
+				return report, fmt.Errorf("policy %q selected plugin %q not in the ready queue", bp.Name, pr.Plugin.Name)
+			}
+			readyQueue.Pop(pr)
+			scheduledPlugins.Push(pr)
+			r.started, r.start, r.finish = true, now, now+r.task.Duration
+			accounting.StartPod(pr.Plugin.JobID, pr.Plugin.Name, base.Add(now))
+			running = append(running, r)
+		}
+	}
+	return summarizeBenchmark(report, runs, now, gpuBusy, gpuOver, config.StarvationThreshold), nil
+}
+
+// gpuState returns whether GPU-demand tasks run, and whether they need more than the GPU
+func gpuState(running []*benchmarkRun, gpuMemoryCapacity int) (busy bool, over bool) {
+	exclusive, shared, memory := 0, 0, 0
+	for _, r := range running {
+		if !r.pr.Plugin.PluginSpec.IsGPURequired() {
+			continue
+		}
+		if m, declared := getRequestedGPUMemory(r.pr); declared {
+			shared += 1
+			memory += m
+		} else {
+			exclusive += 1
+		}
+	}
+	busy = exclusive+shared > 0
+	over = (exclusive > 0 && exclusive+shared > 1) || memory > gpuMemoryCapacity
+	return
+}
+
+func summarizeBenchmark(report BenchmarkReport, runs []*benchmarkRun, now time.Duration, gpuBusy time.Duration, gpuOver time.Duration, starvationThreshold time.Duration) BenchmarkReport {
+	var (
+		waits     []time.Duration
+		totalWait time.Duration
+		lastEnd   time.Duration
+	)
+	firstArrival := runs[0].task.Arrival
+	for _, r := range runs {
+		wait := now - r.task.Arrival
+		if r.started {
+			wait = r.start - r.task.Arrival
+		}
+		if !r.started || wait > starvationThreshold {
+			report.Starved += 1
+		}
+		if r.finished {
+			report.Completed += 1
+			if r.finish > lastEnd {
+				lastEnd = r.finish
+			}
+		}
+		waits = append(waits, wait)
+		totalWait += wait
+	}
+	sort.Slice(waits, func(i, j int) bool { return waits[i] < waits[j] })
+	report.MeanWait = totalWait / time.Duration(len(waits))
+	report.P95Wait = waits[int(math.Ceil(0.95*float64(len(waits))))-1]
+	report.MaxWait = waits[len(waits)-1]
+	if lastEnd > firstArrival {
+		report.Makespan = lastEnd - firstArrival
+		report.GPUUtilization = gpuBusy.Seconds() / report.Makespan.Seconds()
+		report.GPUOversubscription = gpuOver.Seconds() / report.Makespan.Seconds()
+	}
+	return report
+}
+
+// RunBenchmarks runs the workload through each policy
+func RunBenchmarks(policies []BenchmarkPolicy, workload []WorkloadTask, config BenchmarkConfig) (reports []BenchmarkReport, err error) {
+	for _, p := range policies {
+		report, err := RunBenchmark(p, workload, config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to benchmark policy %q: %s", p.Name, err.Error())
+		}
+		reports = append(reports, report)
+	}
+	return
+}
+
+// WriteBenchmarkReports writes the reports as a table
+func WriteBenchmarkReports(w io.Writer, reports []BenchmarkReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "POLICY\tCOMPLETED\tMAKESPAN\tMEAN WAIT\tP95 WAIT\tMAX WAIT\tGPU UTIL\tGPU OVERSUB\tSTARVED")
+	for _, r := range reports {
+		fmt.Fprintf(tw, "%s\t%d/%d\t%s\t%s\t%s\t%s\t%.1f%%\t%.1f%%\t%d\n",
+			r.Policy,
+			r.Completed,
+			r.Tasks,
+			r.Makespan.Round(time.Second),
+			r.MeanWait.Round(time.Second),
+			r.P95Wait.Round(time.Second),
+			r.MaxWait.Round(time.Second),
+			100*r.GPUUtilization,
+			100*r.GPUOversubscription,
+			r.Starved)
+	}
+	return tw.Flush()
+}
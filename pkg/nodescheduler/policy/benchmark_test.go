@@ -0,0 +1,185 @@
+package policy
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+)
+
+var benchmarkWorkload = WorkloadConfig{
+	Seed:              1,
+	Tasks:             200,
+	Jobs:              6,
+	Users:             3,
+	JobMaxConcurrency: 2,
+	Arrival:           "poisson",
+	MeanInterarrival:  30 * time.Second,
+	GPUFraction:       0.4,
+	GPUMemoryChoices:  []string{"", "1Gi", "2Gi", "4Gi"},
+	MinDuration:       30 * time.Second,
+	MaxDuration:       3 * time.Minute,
+	MaxPriority:       3,
+}
+
+var benchmarkConfig = BenchmarkConfig{
+	Capacity: datatype.Resource{
+		CPU:       "8000m",
+		Memory:    "16Gi",
+		GPUMemory: "4Gi",
+	},
+}
+
+func getBenchmarkPolicies() []BenchmarkPolicy {
+	logger.SetLevel("policy", logger.InfoLevel)
+	return append(GetBenchmarkPolicies(), NewChainBenchmarkPolicy("chain", &ChainConfig{
+		Filters: []ChainStepConfig{{Name: "gpu-exclusive"}, {Name: "concurrency"}},
+		Scorers: []ChainStepConfig{{Name: "age"}, {Name: "priority"}},
+	}))
+}
+
+func TestGenerateWorkload(t *testing.T) {
+	tests := map[string]struct {
+		Config WorkloadConfig
+		Check  func([]WorkloadTask) bool
+		Error  bool
+	}{
+		"periodic": {
+			Config: WorkloadConfig{Tasks: 3, Jobs: 1, Users: 1, Arrival: "periodic", MeanInterarrival: time.Minute, MinDuration: time.Second, MaxDuration: time.Second},
+			Check: func(tasks []WorkloadTask) bool {
+				return tasks[0].Arrival == 0 && tasks[2].Arrival == 2*time.Minute && tasks[1].Duration == time.Second
+			},
+		},
+		"burst": {
+			Config: WorkloadConfig{Tasks: 4, Jobs: 2, Users: 1, Arrival: "burst", BurstSize: 2, MeanInterarrival: time.Minute, MinDuration: time.Second, MaxDuration: time.Minute},
+			Check: func(tasks []WorkloadTask) bool {
+				return tasks[1].Arrival == 0 && tasks[2].Arrival == 2*time.Minute && tasks[3].Arrival == 2*time.Minute
+			},
+		},
+		"gpu": {
+			Config: WorkloadConfig{Tasks: 10, Jobs: 2, Users: 1, GPUFraction: 1, GPUMemoryChoices: []string{"1Gi"}, MeanInterarrival: time.Minute, MinDuration: time.Second, MaxDuration: time.Minute},
+			Check: func(tasks []WorkloadTask) bool {
+				for _, task := range tasks {
+					if !task.Plugin.PluginSpec.IsGPURequired() || task.Plugin.PluginSpec.Resource["request.gpu_memory"] != "1Gi" {
+						return false
+					}
+				}
+				return true
+			},
+		},
+		"unknown arrival": {
+			Config: WorkloadConfig{Tasks: 1, Jobs: 1, Users: 1, Arrival: "weibull", MinDuration: time.Second, MaxDuration: time.Second},
+			Error:  true,
+		},
+		"no duration": {
+			Config: WorkloadConfig{Tasks: 1, Jobs: 1, Users: 1},
+			Error:  true,
+		},
+	}
+	for name, test := range tests {
+		tasks, err := GenerateWorkload(test.Config)
+		if test.Error {
+			if err == nil {
+				t.Errorf("%s: expected an error, but got none", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", name, err.Error())
+		} else if len(tasks) != test.Config.Tasks || !test.Check(tasks) {
+			t.Errorf("%s: unexpected workload %+v", name, tasks)
+		}
+	}
+
+	// the same seed generates the same workload
+	first, _ := GenerateWorkload(benchmarkWorkload)
+	second, _ := GenerateWorkload(benchmarkWorkload)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("expected the same workload from the same seed")
+	}
+}
+
+func TestRunBenchmark(t *testing.T) {
+	workload, err := GenerateWorkload(benchmarkWorkload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports, err := RunBenchmarks(getBenchmarkPolicies(), workload, benchmarkConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	WriteBenchmarkReports(&b, reports)
+	t.Logf("\n%s", b.String())
+
+	byPolicy := make(map[string]BenchmarkReport)
+	for _, r := range reports {
+		byPolicy[r.Policy] = r
+		if r.Completed != r.Tasks {
+			t.Errorf("%s: expected all %d tasks completed, but got %d", r.Policy, r.Tasks, r.Completed)
+		}
+	}
+	// the default policy runs everything the concurrency limits allow
+	if r := byPolicy["default"]; r.GPUOversubscription == 0 {
+		t.Errorf("default: expected GPU oversubscription, but got %+v", r)
+	}
+	for _, name := range []string{"gpuaware", "chain"} {
+		if r := byPolicy[name]; r.GPUOversubscription != 0 {
+			t.Errorf("%s: expected no GPU oversubscription, but got %.3f", name, r.GPUOversubscription)
+		}
+	}
+	// round-robin runs one plugin at a time
+	if byPolicy["roundrobin"].Makespan <= byPolicy["default"].Makespan {
+		t.Errorf("expected round-robin makespan longer than default, but got %s and %s", byPolicy["roundrobin"].Makespan, byPolicy["default"].Makespan)
+	}
+}
+
+func TestRunBenchmarkSingleTask(t *testing.T) {
+	workload := []WorkloadTask{{
+		Arrival:  time.Minute,
+		Duration: 2 * time.Minute,
+		Plugin: datatype.Plugin{
+			Name:       "a",
+			JobID:      "1",
+			PluginSpec: &datatype.PluginSpec{Image: "plugin-a:latest", Selector: map[string]string{"resource.gpu": "true"}},
+		},
+	}}
+	for _, p := range getBenchmarkPolicies() {
+		r, err := RunBenchmark(p, workload, benchmarkConfig)
+		if err != nil {
+			t.Errorf("%s: %s", p.Name, err.Error())
+			continue
+		}
+		if r.Completed != 1 || r.Makespan != 2*time.Minute || r.MeanWait != 0 || r.GPUUtilization != 1 || r.Starved != 0 {
+			t.Errorf("%s: unexpected report %+v", p.Name, r)
+		}
+	}
+}
+
+// BenchmarkPolicies reports scheduling metrics of each policy on the benchmark workload, e.g.
+// go test ./pkg/nodescheduler/policy -run '^$' -bench Policies
+func BenchmarkPolicies(b *testing.B) {
+	workload, err := GenerateWorkload(benchmarkWorkload)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, p := range getBenchmarkPolicies() {
+		b.Run(p.Name, func(b *testing.B) {
+			var r BenchmarkReport
+			for i := 0; i < b.N; i++ {
+				if r, err = RunBenchmark(p, workload, benchmarkConfig); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(r.Makespan.Seconds(), "makespan-s")
+			b.ReportMetric(r.MeanWait.Seconds(), "mean-wait-s")
+			b.ReportMetric(r.P95Wait.Seconds(), "p95-wait-s")
+			b.ReportMetric(100*r.GPUUtilization, "gpu-util-%")
+			b.ReportMetric(100*r.GPUOversubscription, "gpu-oversub-%")
+			b.ReportMetric(float64(r.Starved), "starved")
+		})
+	}
+}
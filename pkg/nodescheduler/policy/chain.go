@@ -0,0 +1,254 @@
+package policy
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+// DecisionReporter is implemented by policies that can explain their decisions
+type DecisionReporter interface {
+	// GetDecision returns why the plugin was selected in the last selection
+	GetDecision(*datatype.PluginRuntime) string
+	// GetFilteredPlugins returns plugins filtered out in the last selection along with the reason
+	GetFilteredPlugins() map[*datatype.PluginRuntime]string
+}
+
+// ChainStepConfig configures a filter or scorer in a policy chain
+type ChainStepConfig struct {
+	Name   string            `json:"name" yaml:"name"`
+	Weight float64           `json:"weight,omitempty" yaml:"weight,omitempty"`
+	Args   map[string]string `json:"args,omitempty" yaml:"args,omitempty"`
+}
+
+// ChainConfig configures a policy chain from the node scheduler's config file
+type ChainConfig struct {
+	Filters []ChainStepConfig `json:"filters,omitempty" yaml:"filters,omitempty"`
+	Scorers []ChainStepConfig `json:"scorers,omitempty" yaml:"scorers,omitempty"`
+}
+
+type chainFilter struct {
+	name   string
+	filter Filter
+}
+
+type chainScorer struct {
+	name   string
+	weight float64
+	scorer Scorer
+}
+
+// ChainPolicy selects plugins by running them through a chain of filters and scorers.
+// Plugins that pass all filters are selected one by one in the order of their weighted score.
+// Filters and scorers see plugins selected earlier in the same selection.
+type ChainPolicy struct {
+	filters        []chainFilter
+	scorers        []chainScorer
+	decisions      map[*datatype.PluginRuntime]string
+	filtered       map[*datatype.PluginRuntime]string
+	throttled      map[*datatype.PluginRuntime]string
+	newlyThrottled map[*datatype.PluginRuntime]string
+	getCurrentTime func() time.Time
+}
+
+func NewChainPolicy(config *ChainConfig, limits *ConcurrencyLimits, accounting *ShareAccounting) (*ChainPolicy, error) {
+	cp := &ChainPolicy{
+		decisions:      make(map[*datatype.PluginRuntime]string),
+		filtered:       make(map[*datatype.PluginRuntime]string),
+		throttled:      make(map[*datatype.PluginRuntime]string),
+		newlyThrottled: make(map[*datatype.PluginRuntime]string),
+		getCurrentTime: time.Now,
+	}
+	for _, c := range config.Filters {
+		var (
+			f   Filter
+			err error
+		)
+		switch c.Name {
+		case "gpu-exclusive":
+			f, err = NewGPUExclusiveFilter(c.Args)
+		case "concurrency":
+			f = NewConcurrencyFilter(limits)
+		case "resource-fit":
+			f, err = NewResourceFitFilter(c.Args)
+		case "quiet-hours":
+			f, err = NewQuietHoursFilter(c.Args)
+		default:
+			err = fmt.Errorf("unknown filter")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create filter %q: %s", c.Name, err.Error())
+		}
+		cp.filters = append(cp.filters, chainFilter{name: c.Name, filter: f})
+	}
+	for _, c := range config.Scorers {
+		var (
+			s   Scorer
+			err error
+		)
+		switch c.Name {
+		case "age":
+			s, err = NewAgeScorer(c.Args)
+		case "priority":
+			s, err = NewPriorityScorer(c.Args)
+		case "fairness":
+			s, err = NewFairnessScorer(c.Args)
+		case "fairshare":
+			s = NewFairShareScorer(accounting)
+		default:
+			err = fmt.Errorf("unknown scorer")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create scorer %q: %s", c.Name, err.Error())
+		}
+		weight := c.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		cp.scorers = append(cp.scorers, chainScorer{name: c.Name, weight: weight, scorer: s})
+	}
+	return cp, nil
+}
+
+// HasFilter returns true if the chain has the filter
+func (cp *ChainPolicy) HasFilter(name string) bool {
+	for _, f := range cp.filters {
+		if f.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectBestPlugins returns plugins that pass all the filters in the order of their score
+func (cp *ChainPolicy) SelectBestPlugins(readyQueue *datatype.Queue, scheduledPlugins *datatype.Queue, availableResource datatype.Resource) (pluginsToRun []*datatype.PluginRuntime, err error) {
+	s := &Selection{
+		Available: availableResource,
+		Now:       cp.getCurrentTime(),
+	}
+	scheduledPlugins.ResetIter()
+	for scheduledPlugins.More() {
+		s.Scheduled = append(s.Scheduled, scheduledPlugins.Next())
+	}
+	var candidates []*datatype.PluginRuntime
+	readyQueue.ResetIter()
+	for readyQueue.More() {
+		candidates = append(candidates, readyQueue.Next())
+	}
+	decisions := make(map[*datatype.PluginRuntime]string)
+	filtered := make(map[*datatype.PluginRuntime]string)
+	// plugins held back by the concurrency filter are throttled as in ConcurrencyLimitPolicy
+	throttled := make(map[*datatype.PluginRuntime]string)
+	for len(candidates) > 0 {
+		// filters are evaluated again after each selection as the selection affects
+		// the decision, e.g. a GPU plugin selected makes other GPU plugins filtered
+		var passed []*datatype.PluginRuntime
+		for _, pr := range candidates {
+			if name, reason, ok := cp.filter(pr, s); ok {
+				passed = append(passed, pr)
+			} else {
+				filtered[pr] = fmt.Sprintf("%s: %s", name, reason)
+				if name == "concurrency" {
+					throttled[pr] = reason
+				}
+				policyLog.With(pr.LogFields()).Debugf("plugin %q is filtered: %s", pr.Plugin.Name, filtered[pr])
+			}
+		}
+		if len(passed) == 0 {
+			break
+		}
+		best, decision := cp.selectBest(passed, s)
+		decisions[best] = decision
+		policyLog.With(best.LogFields()).Debugf("plugin %q is %s", best.Plugin.Name, decision)
+		s.Selected = append(s.Selected, best)
+		candidates = nil
+		for _, pr := range passed {
+			if pr != best {
+				candidates = append(candidates, pr)
+			}
+		}
+	}
+	cp.newlyThrottled = make(map[*datatype.PluginRuntime]string)
+	for pr, reason := range throttled {
+		if _, found := cp.throttled[pr]; !found {
+			cp.newlyThrottled[pr] = reason
+		}
+	}
+	cp.throttled = throttled
+	cp.filtered = filtered
+	cp.decisions = decisions
+	return s.Selected, nil
+}
+
+// filter returns the name of the first filter that filters the plugin out and its reason
+func (cp *ChainPolicy) filter(pr *datatype.PluginRuntime, s *Selection) (string, string, bool) {
+	for _, f := range cp.filters {
+		if reason, ok := f.filter.Filter(pr, s); !ok {
+			return f.name, reason, false
+		}
+	}
+	return "", "", true
+}
+
+// selectBest returns the plugin with the highest weighted score among the candidates.
+// Scores of each scorer are min-max normalized among the candidates. Ties are broken
+// by the order in the ready queue.
+func (cp *ChainPolicy) selectBest(candidates []*datatype.PluginRuntime, s *Selection) (*datatype.PluginRuntime, string) {
+	if len(cp.scorers) == 0 {
+		return candidates[0], "selected in queue order"
+	}
+	scores := make([][]float64, len(cp.scorers))
+	for i, c := range cp.scorers {
+		scores[i] = make([]float64, len(candidates))
+		low, high := math.Inf(1), math.Inf(-1)
+		for j, pr := range candidates {
+			v := c.scorer.Score(pr, s)
+			scores[i][j] = v
+			low, high = math.Min(low, v), math.Max(high, v)
+		}
+		for j := range candidates {
+			if high > low {
+				scores[i][j] = (scores[i][j] - low) / (high - low)
+			} else {
+				scores[i][j] = 0
+			}
+		}
+	}
+	total := make([]float64, len(candidates))
+	for j := range candidates {
+		for i, c := range cp.scorers {
+			total[j] += c.weight * scores[i][j]
+		}
+	}
+	order := make([]int, len(candidates))
+	for j := range order {
+		order[j] = j
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return total[order[a]] > total[order[b]]
+	})
+	best := order[0]
+	var details []string
+	for i, c := range cp.scorers {
+		details = append(details, fmt.Sprintf("%s=%.2fx%g", c.name, scores[i][best], c.weight))
+	}
+	return candidates[best], fmt.Sprintf("selected by score %.2f (%s)", total[best], strings.Join(details, ", "))
+}
+
+func (cp *ChainPolicy) GetDecision(pr *datatype.PluginRuntime) string {
+	return cp.decisions[pr]
+}
+
+func (cp *ChainPolicy) GetFilteredPlugins() map[*datatype.PluginRuntime]string {
+	return cp.filtered
+}
+
+// GetNewlyThrottledPlugins returns the plugins that started being held back by the
+// concurrency filter. Plugins filtered by other filters are not throttled
+func (cp *ChainPolicy) GetNewlyThrottledPlugins() map[*datatype.PluginRuntime]string {
+	return cp.newlyThrottled
+}
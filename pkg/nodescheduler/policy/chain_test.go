@@ -0,0 +1,214 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestChainPolicy(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.Local)
+	gpuPlugin := func(name string, jobID string) *datatype.PluginRuntime {
+		pr := newTestPluginRuntime(name, jobID, name+":latest", 0)
+		pr.Plugin.PluginSpec.Selector = map[string]string{"resource.gpu": "true"}
+		return pr
+	}
+	withPriority := func(pr *datatype.PluginRuntime, priority int) *datatype.PluginRuntime {
+		pr.Plugin.Priority = priority
+		return pr
+	}
+	withAge := func(pr *datatype.PluginRuntime, age time.Duration) *datatype.PluginRuntime {
+		pr.QueuedAt = now.Add(-age)
+		return pr
+	}
+	withRequest := func(pr *datatype.PluginRuntime, cpu string) *datatype.PluginRuntime {
+		pr.Plugin.PluginSpec.Resource = map[string]string{"request.cpu": cpu}
+		return pr
+	}
+	tests := map[string]struct {
+		Config    ChainConfig
+		Scheduled []*datatype.PluginRuntime
+		Ready     []*datatype.PluginRuntime
+		Expected  []string
+		Filtered  []string
+	}{
+		"no steps keeps queue order": {
+			Ready: []*datatype.PluginRuntime{
+				newTestPluginRuntime("a", "1", "a:latest", 0),
+				newTestPluginRuntime("b", "1", "b:latest", 0),
+			},
+			Expected: []string{"a", "b"},
+		},
+		"gpu exclusive": {
+			Config: ChainConfig{
+				Filters: []ChainStepConfig{{Name: "gpu-exclusive"}},
+			},
+			Ready: []*datatype.PluginRuntime{
+				gpuPlugin("a", "1"),
+				newTestPluginRuntime("b", "1", "b:latest", 0),
+				gpuPlugin("c", "1"),
+			},
+			Expected: []string{"a", "b"},
+			Filtered: []string{"c"},
+		},
+		"priority over age": {
+			Config: ChainConfig{
+				Scorers: []ChainStepConfig{
+					{Name: "age"},
+					{Name: "priority", Weight: 2},
+				},
+			},
+			Ready: []*datatype.PluginRuntime{
+				withAge(newTestPluginRuntime("a", "1", "a:latest", 0), time.Minute),
+				withAge(withPriority(newTestPluginRuntime("b", "1", "b:latest", 0), 10), time.Second),
+			},
+			Expected: []string{"b", "a"},
+		},
+		"fairness across jobs": {
+			Config: ChainConfig{
+				Scorers: []ChainStepConfig{{Name: "fairness"}},
+			},
+			Scheduled: []*datatype.PluginRuntime{
+				newTestPluginRuntime("a", "1", "a:latest", 0),
+			},
+			Ready: []*datatype.PluginRuntime{
+				newTestPluginRuntime("b", "1", "b:latest", 0),
+				newTestPluginRuntime("c", "1", "c:latest", 0),
+				newTestPluginRuntime("d", "2", "d:latest", 0),
+			},
+			Expected: []string{"d", "b", "c"},
+		},
+		"resource fit": {
+			Config: ChainConfig{
+				Filters: []ChainStepConfig{{Name: "resource-fit"}},
+			},
+			Scheduled: []*datatype.PluginRuntime{
+				withRequest(newTestPluginRuntime("a", "1", "a:latest", 0), "2"),
+			},
+			Ready: []*datatype.PluginRuntime{
+				withRequest(newTestPluginRuntime("b", "1", "b:latest", 0), "1500m"),
+				withRequest(newTestPluginRuntime("c", "1", "c:latest", 0), "600m"),
+			},
+			Expected: []string{"b"},
+			Filtered: []string{"c"},
+		},
+		"quiet hours": {
+			Config: ChainConfig{
+				Filters: []ChainStepConfig{{
+					Name: "quiet-hours",
+					Args: map[string]string{"start": "11:00", "end": "01:00", "exempt": "b"},
+				}},
+			},
+			Ready: []*datatype.PluginRuntime{
+				newTestPluginRuntime("a", "1", "a:latest", 0),
+				newTestPluginRuntime("b", "1", "b:latest", 0),
+			},
+			Expected: []string{"b"},
+			Filtered: []string{"a"},
+		},
+	}
+	for name, test := range tests {
+		var (
+			readyQueue       datatype.Queue
+			scheduledPlugins datatype.Queue
+		)
+		for _, pr := range test.Scheduled {
+			scheduledPlugins.Push(pr)
+		}
+		for _, pr := range test.Ready {
+			readyQueue.Push(pr)
+		}
+		chain, err := NewChainPolicy(&test.Config, NewConcurrencyLimits(), NewShareAccounting(DefaultShareHalfLife))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err.Error())
+		}
+		chain.getCurrentTime = func() time.Time { return now }
+		pluginsToSchedule, err := chain.SelectBestPlugins(
+			&readyQueue,
+			&scheduledPlugins,
+			datatype.Resource{
+				CPU:       "4",
+				Memory:    "999999Gi",
+				GPUMemory: "999999Gi",
+			})
+		if err != nil {
+			t.Errorf("%s: %s", name, err.Error())
+			continue
+		}
+		var selected []string
+		for _, pr := range pluginsToSchedule {
+			selected = append(selected, pr.Plugin.Name)
+			if chain.GetDecision(pr) == "" {
+				t.Errorf("%s: plugin %q has no decision", name, pr.Plugin.Name)
+			}
+		}
+		if len(selected) != len(test.Expected) {
+			t.Errorf("%s: expected %v to be selected, but got %v", name, test.Expected, selected)
+			continue
+		}
+		for i := range selected {
+			if selected[i] != test.Expected[i] {
+				t.Errorf("%s: expected %v to be selected, but got %v", name, test.Expected, selected)
+				break
+			}
+		}
+		filtered := chain.GetFilteredPlugins()
+		if len(filtered) != len(test.Filtered) {
+			t.Errorf("%s: expected %v to be filtered, but got %v", name, test.Filtered, filtered)
+		}
+		for pr, reason := range filtered {
+			t.Logf("%s: %s is filtered: %s", name, pr.Plugin.Name, reason)
+		}
+	}
+}
+
+func TestChainPolicyUnknownStep(t *testing.T) {
+	_, err := NewChainPolicy(&ChainConfig{
+		Filters: []ChainStepConfig{{Name: "unknown"}},
+	}, NewConcurrencyLimits(), NewShareAccounting(DefaultShareHalfLife))
+	if err == nil {
+		t.Errorf("an unknown filter must fail the chain")
+	}
+	_, err = NewChainPolicy(&ChainConfig{
+		Filters: []ChainStepConfig{{Name: "quiet-hours", Args: map[string]string{"start": "25:00", "end": "01:00"}}},
+	}, NewConcurrencyLimits(), NewShareAccounting(DefaultShareHalfLife))
+	if err == nil {
+		t.Errorf("an invalid quiet hours must fail the chain")
+	}
+}
+
+func TestChainPolicyThrottled(t *testing.T) {
+	limits := NewConcurrencyLimits()
+	limits.SetJobLimit("1", 1)
+	chain, err := NewChainPolicy(&ChainConfig{
+		Filters: []ChainStepConfig{
+			{Name: "quiet-hours", Args: map[string]string{"start": "11:00", "end": "13:00", "exempt": "a,b"}},
+			{Name: "concurrency"},
+		},
+	}, limits, NewShareAccounting(DefaultShareHalfLife))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.getCurrentTime = func() time.Time { return time.Date(2023, 1, 1, 12, 0, 0, 0, time.Local) }
+	var readyQueue, scheduledPlugins datatype.Queue
+	scheduledPlugins.Push(newTestPluginRuntime("a", "1", "a:latest", 0))
+	b := newTestPluginRuntime("b", "1", "b:latest", 0)
+	readyQueue.Push(b)
+	readyQueue.Push(newTestPluginRuntime("c", "2", "c:latest", 0))
+	for i := 0; i < 2; i++ {
+		if _, err := chain.SelectBestPlugins(&readyQueue, &scheduledPlugins, datatype.Resource{CPU: "4", Memory: "999999Gi", GPUMemory: "999999Gi"}); err != nil {
+			t.Fatal(err)
+		}
+		throttled := chain.GetNewlyThrottledPlugins()
+		if len(chain.GetFilteredPlugins()) != 2 {
+			t.Errorf("expected b and c to be filtered, but got %v", chain.GetFilteredPlugins())
+		}
+		// c filtered by quiet hours is not throttled, and b is throttled only once
+		if i == 0 && (len(throttled) != 1 || throttled[b] == "") {
+			t.Errorf("expected only b to be throttled, but got %v", throttled)
+		} else if i == 1 && len(throttled) != 0 {
+			t.Errorf("expected b not to be reported again, but got %v", throttled)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package policy
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+// ThrottleReporter is implemented by policies that may hold back plugins in the ready queue.
+// The scheduler uses it to tell users why a queued plugin is not selected.
+type ThrottleReporter interface {
+	// GetNewlyThrottledPlugins returns the plugins that started being held back
+	// in the last selection along with the reason
+	GetNewlyThrottledPlugins() map[*datatype.PluginRuntime]string
+}
+
+// ConcurrencyLimits keeps max concurrency of the jobs known to the scheduler.
+// Limits of plugins come from Plugin.MaxConcurrency and are counted against
+// all scheduled plugins that use the same plugin image, regardless of their job.
+type ConcurrencyLimits struct {
+	mu   sync.Mutex
+	jobs map[string]int
+}
+
+func NewConcurrencyLimits() *ConcurrencyLimits {
+	return &ConcurrencyLimits{
+		jobs: make(map[string]int),
+	}
+}
+
+// SetJobLimit sets the max concurrency of the job. A limit less than 1 means no limit
+func (cl *ConcurrencyLimits) SetJobLimit(jobID string, limit int) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if limit < 1 {
+		delete(cl.jobs, jobID)
+		return
+	}
+	cl.jobs[jobID] = limit
+}
+
+// DropJob removes the limit of the job
+func (cl *ConcurrencyLimits) DropJob(jobID string) {
+	cl.SetJobLimit(jobID, 0)
+}
+
+// GetJobLimit returns the max concurrency of the job. It returns 0 if the job has no limit
+func (cl *ConcurrencyLimits) GetJobLimit(jobID string) int {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.jobs[jobID]
+}
+
+// concurrencyCounter counts plugins running per job and per plugin image
+type concurrencyCounter struct {
+	limits *ConcurrencyLimits
+	jobs   map[string]int
+	images map[string]int
+}
+
+func newConcurrencyCounter(limits *ConcurrencyLimits, scheduledPlugins *datatype.Queue) *concurrencyCounter {
+	c := &concurrencyCounter{
+		limits: limits,
+		jobs:   make(map[string]int),
+		images: make(map[string]int),
+	}
+	scheduledPlugins.ResetIter()
+	for scheduledPlugins.More() {
+		c.add(scheduledPlugins.Next())
+	}
+	return c
+}
+
+func (c *concurrencyCounter) add(pr *datatype.PluginRuntime) {
+	c.jobs[pr.Plugin.JobID] += 1
+	if image, err := pr.Plugin.GetPluginImage(); err == nil {
+		c.images[image] += 1
+	}
+}
+
+// check returns a reason if running the plugin would exceed any of its limits
+func (c *concurrencyCounter) check(pr *datatype.PluginRuntime) (string, bool) {
+	if limit := c.limits.GetJobLimit(pr.Plugin.JobID); limit > 0 && c.jobs[pr.Plugin.JobID] >= limit {
+		return fmt.Sprintf("throttled: job %q reached its max concurrency %d", pr.Plugin.JobID, limit), false
+	}
+	if limit := pr.Plugin.MaxConcurrency; limit > 0 {
+		if image, err := pr.Plugin.GetPluginImage(); err == nil && c.images[image] >= limit {
+			return fmt.Sprintf("throttled: plugin %q reached its max concurrency %d", image, limit), false
+		}
+	}
+	return "", true
+}
+
+// ConcurrencyLimitPolicy wraps a scheduling policy and holds back plugins
+// that would exceed max concurrency of their job or plugin.
+type ConcurrencyLimitPolicy struct {
+	policy         SchedulingPolicy
+	Limits         *ConcurrencyLimits
+	throttled      map[*datatype.PluginRuntime]string
+	newlyThrottled map[*datatype.PluginRuntime]string
+}
+
+func NewConcurrencyLimitPolicy(policy SchedulingPolicy, limits *ConcurrencyLimits) *ConcurrencyLimitPolicy {
+	return &ConcurrencyLimitPolicy{
+		policy:         policy,
+		Limits:         limits,
+		throttled:      make(map[*datatype.PluginRuntime]string),
+		newlyThrottled: make(map[*datatype.PluginRuntime]string),
+	}
+}
+
+// SelectBestPlugins lets the wrapped policy select plugins only among the ones
+// that do not exceed their limits. Selected plugins are checked again in order
+// because the wrapped policy may select multiple plugins of the same job or plugin.
+func (cp *ConcurrencyLimitPolicy) SelectBestPlugins(readyQueue *datatype.Queue, scheduledPlugins *datatype.Queue, availableResource datatype.Resource) (pluginsToRun []*datatype.PluginRuntime, err error) {
+	counter := newConcurrencyCounter(cp.Limits, scheduledPlugins)
+	throttled := make(map[*datatype.PluginRuntime]string)
+	// NOTE: the wrapped policy gets a copy of the ready queue as some policies
+	//       pop plugins from the queue they are given
+	var candidates datatype.Queue
+	readyQueue.ResetIter()
+	for readyQueue.More() {
+		pr := readyQueue.Next()
+		if reason, ok := counter.check(pr); ok {
+			candidates.Push(pr)
+		} else {
+			throttled[pr] = reason
+		}
+	}
+	selected, err := cp.policy.SelectBestPlugins(&candidates, scheduledPlugins, availableResource)
+	if err != nil {
+		return nil, err
+	}
+	for _, pr := range selected {
+		if reason, ok := counter.check(pr); ok {
+			counter.add(pr)
+			pluginsToRun = append(pluginsToRun, pr)
+		} else {
+			throttled[pr] = reason
+		}
+	}
+	cp.newlyThrottled = make(map[*datatype.PluginRuntime]string)
+	for pr, reason := range throttled {
+		policyLog.With(pr.LogFields()).Debugf("plugin %q is %s", pr.Plugin.Name, reason)
+		if _, found := cp.throttled[pr]; !found {
+			cp.newlyThrottled[pr] = reason
+		}
+	}
+	cp.throttled = throttled
+	return
+}
+
+func (cp *ConcurrencyLimitPolicy) GetNewlyThrottledPlugins() map[*datatype.PluginRuntime]string {
+	return cp.newlyThrottled
+}
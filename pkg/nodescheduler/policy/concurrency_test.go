@@ -0,0 +1,130 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func newTestPluginRuntime(name string, jobID string, image string, maxConcurrency int) *datatype.PluginRuntime {
+	return &datatype.PluginRuntime{
+		Plugin: datatype.Plugin{
+			Name:           name,
+			JobID:          jobID,
+			MaxConcurrency: maxConcurrency,
+			PluginSpec: &datatype.PluginSpec{
+				Image: image,
+			},
+		},
+	}
+}
+
+func TestConcurrencyLimitPolicy(t *testing.T) {
+	tests := map[string]struct {
+		Policy    string
+		JobLimits map[string]int
+		Scheduled []*datatype.PluginRuntime
+		Ready     []*datatype.PluginRuntime
+		Expected  []string
+		Throttled []string
+	}{
+		"no limit": {
+			Policy: "default",
+			Ready: []*datatype.PluginRuntime{
+				newTestPluginRuntime("a", "1", "plugin-a:latest", 0),
+				newTestPluginRuntime("b", "1", "plugin-b:latest", 0),
+			},
+			Expected: []string{"a", "b"},
+		},
+		"job limit": {
+			Policy:    "default",
+			JobLimits: map[string]int{"1": 2},
+			Scheduled: []*datatype.PluginRuntime{
+				newTestPluginRuntime("a", "1", "plugin-a:latest", 0),
+			},
+			Ready: []*datatype.PluginRuntime{
+				newTestPluginRuntime("b", "1", "plugin-b:latest", 0),
+				newTestPluginRuntime("c", "1", "plugin-c:latest", 0),
+				newTestPluginRuntime("d", "2", "plugin-d:latest", 0),
+			},
+			Expected:  []string{"b", "d"},
+			Throttled: []string{"c"},
+		},
+		"plugin limit across jobs": {
+			Policy: "default",
+			Scheduled: []*datatype.PluginRuntime{
+				newTestPluginRuntime("a", "1", "plugin-a:latest", 1),
+			},
+			Ready: []*datatype.PluginRuntime{
+				newTestPluginRuntime("a", "2", "plugin-a:latest", 1),
+				newTestPluginRuntime("b", "2", "plugin-b:latest", 1),
+			},
+			Expected:  []string{"b"},
+			Throttled: []string{"a"},
+		},
+		"roundrobin keeps throttled plugins": {
+			Policy:    "roundrobin",
+			JobLimits: map[string]int{"1": 1},
+			Ready: []*datatype.PluginRuntime{
+				newTestPluginRuntime("a", "1", "plugin-a:latest", 0),
+				newTestPluginRuntime("b", "1", "plugin-b:latest", 0),
+			},
+			Expected: []string{"a"},
+		},
+	}
+	for name, test := range tests {
+		var (
+			readyQueue       datatype.Queue
+			scheduledPlugins datatype.Queue
+		)
+		for _, pr := range test.Scheduled {
+			scheduledPlugins.Push(pr)
+		}
+		for _, pr := range test.Ready {
+			readyQueue.Push(pr)
+		}
+		limits := NewConcurrencyLimits()
+		for jobID, limit := range test.JobLimits {
+			limits.SetJobLimit(jobID, limit)
+		}
+		schedulingPolicy := NewConcurrencyLimitPolicy(GetSchedulingPolicyByName(test.Policy), limits)
+		pluginsToSchedule, err := schedulingPolicy.SelectBestPlugins(
+			&readyQueue,
+			&scheduledPlugins,
+			datatype.Resource{
+				CPU:       "999000m",
+				Memory:    "999999Gi",
+				GPUMemory: "999999Gi",
+			})
+		if err != nil {
+			t.Errorf("%s: %s", name, err.Error())
+			continue
+		}
+		var selected []string
+		for _, pr := range pluginsToSchedule {
+			selected = append(selected, pr.Plugin.Name)
+		}
+		if len(selected) != len(test.Expected) {
+			t.Errorf("%s: expected %v to be selected, but got %v", name, test.Expected, selected)
+			continue
+		}
+		for i := range selected {
+			if selected[i] != test.Expected[i] {
+				t.Errorf("%s: expected %v to be selected, but got %v", name, test.Expected, selected)
+				break
+			}
+		}
+		if readyQueue.Length() != len(test.Ready) {
+			t.Errorf("%s: the ready queue must not be changed by the policy", name)
+		}
+		throttled := schedulingPolicy.GetNewlyThrottledPlugins()
+		if len(throttled) != len(test.Throttled) {
+			t.Errorf("%s: expected %v to be throttled, but got %d plugins", name, test.Throttled, len(throttled))
+		}
+		// throttled plugins are reported only once
+		schedulingPolicy.SelectBestPlugins(&readyQueue, &scheduledPlugins, datatype.Resource{})
+		if len(schedulingPolicy.GetNewlyThrottledPlugins()) != 0 {
+			t.Errorf("%s: throttled plugins must not be reported again", name)
+		}
+	}
+}
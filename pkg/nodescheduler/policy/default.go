@@ -5,6 +5,8 @@ import (
 	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
 )
 
+var policyLog = logger.New("policy")
+
 type SchedulingPolicy interface {
 	SelectBestPlugins(*datatype.Queue, *datatype.Queue, datatype.Resource) ([]*datatype.PluginRuntime, error)
 }
@@ -12,16 +14,16 @@ type SchedulingPolicy interface {
 func GetSchedulingPolicyByName(policyName string) SchedulingPolicy {
 	switch policyName {
 	case "default":
-		logger.Info.Println("Default policy is selected")
+		policyLog.Info("Default policy is selected")
 		return NewSimpleSchedulingPolicy()
 	case "roundrobin":
-		logger.Info.Println("Round-robin policy is selected")
+		policyLog.Info("Round-robin policy is selected")
 		return NewRoundRobinSchedulingPolicy()
 	case "gpuaware":
-		logger.Info.Println("GPU-aware policy is selected")
+		policyLog.Info("GPU-aware policy is selected")
 		return NewGPUAwareSchedulingPolicy()
 	default:
-		logger.Error.Printf("Given policy name %q does not exist. Default policy is selected", policyName)
+		policyLog.Errorf("Given policy name %q does not exist. Default policy is selected", policyName)
 		return NewSimpleSchedulingPolicy()
 	}
 }
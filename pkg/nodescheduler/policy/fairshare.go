@@ -0,0 +1,252 @@
+package policy
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+const (
+	// DefaultShareHalfLife is the half-life of consumed pod-seconds
+	DefaultShareHalfLife = 1 * time.Hour
+	// UnknownOwner is the owner of jobs that do not tell their user
+	UnknownOwner = "unknown"
+)
+
+// ShareUsage is the consumed pod-seconds of a job or user
+type ShareUsage struct {
+	PodSeconds  float64   `json:"pod_seconds"`
+	RunningPods int       `json:"running_pods"`
+	LastUpdated time.Time `json:"last_updated"`
+}
+
+// decayTo applies the decay of the usage up to the given time
+func (u *ShareUsage) decayTo(t time.Time, halfLife time.Duration) {
+	if t.After(u.LastUpdated) {
+		if !u.LastUpdated.IsZero() {
+			u.PodSeconds *= math.Pow(0.5, t.Sub(u.LastUpdated).Seconds()/halfLife.Seconds())
+		}
+		u.LastUpdated = t
+	}
+}
+
+type runningPod struct {
+	jobID     string
+	startedAt time.Time
+}
+
+// ShareAccounting keeps pod-seconds consumed by jobs and users on the node.
+// Consumed pod-seconds decay exponentially over time with the half-life such that
+// the past usage matters less than the recent usage.
+type ShareAccounting struct {
+	mu       sync.Mutex
+	halfLife time.Duration
+	owners   map[string]string
+	jobs     map[string]*ShareUsage
+	users    map[string]*ShareUsage
+	running  map[string]runningPod
+}
+
+func NewShareAccounting(halfLife time.Duration) *ShareAccounting {
+	if halfLife <= 0 {
+		halfLife = DefaultShareHalfLife
+	}
+	return &ShareAccounting{
+		halfLife: halfLife,
+		owners:   make(map[string]string),
+		jobs:     make(map[string]*ShareUsage),
+		users:    make(map[string]*ShareUsage),
+		running:  make(map[string]runningPod),
+	}
+}
+
+// SetJobOwner sets the user who owns the job
+func (sa *ShareAccounting) SetJobOwner(jobID string, user string) {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	if user == "" {
+		user = UnknownOwner
+	}
+	sa.owners[jobID] = user
+}
+
+// DropJob removes the job from the accounting. Usage of its owner remains
+func (sa *ShareAccounting) DropJob(jobID string) {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	delete(sa.owners, jobID)
+	delete(sa.jobs, jobID)
+}
+
+func (sa *ShareAccounting) getOwner(jobID string) string {
+	if user, found := sa.owners[jobID]; found {
+		return user
+	}
+	return UnknownOwner
+}
+
+// GetOwner returns the user who owns the job
+func (sa *ShareAccounting) GetOwner(jobID string) string {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	return sa.getOwner(jobID)
+}
+
+// StartPod records the start of a pod of the job. Starting the same pod again is ignored
+func (sa *ShareAccounting) StartPod(jobID string, podID string, startedAt time.Time) {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	if _, found := sa.running[podID]; found {
+		return
+	}
+	sa.running[podID] = runningPod{
+		jobID:     jobID,
+		startedAt: startedAt,
+	}
+}
+
+// FinishPod charges the pod-seconds of the pod to its job and owner.
+// Finishing a pod that did not start is ignored
+func (sa *ShareAccounting) FinishPod(podID string, finishedAt time.Time) {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	pod, found := sa.running[podID]
+	if !found {
+		return
+	}
+	delete(sa.running, podID)
+	if !finishedAt.After(pod.startedAt) {
+		return
+	}
+	sa.charge(sa.usageOf(sa.jobs, pod.jobID), pod.startedAt, finishedAt)
+	sa.charge(sa.usageOf(sa.users, sa.getOwner(pod.jobID)), pod.startedAt, finishedAt)
+}
+
+func (sa *ShareAccounting) usageOf(usages map[string]*ShareUsage, key string) *ShareUsage {
+	u, found := usages[key]
+	if !found {
+		u = &ShareUsage{}
+		usages[key] = u
+	}
+	return u
+}
+
+// charge adds the pod-seconds spent from start to end. The pod-seconds are
+// decayed from the middle of the run as an approximation of integrating the decay
+func (sa *ShareAccounting) charge(u *ShareUsage, start time.Time, end time.Time) {
+	u.decayTo(end, sa.halfLife)
+	middle := start.Add(end.Sub(start) / 2)
+	u.PodSeconds += end.Sub(start).Seconds() * math.Pow(0.5, end.Sub(middle).Seconds()/sa.halfLife.Seconds())
+}
+
+// snapshot returns decayed usages at the time including pods still running
+func (sa *ShareAccounting) snapshot(now time.Time) (jobs map[string]ShareUsage, users map[string]ShareUsage) {
+	jobs = make(map[string]ShareUsage)
+	users = make(map[string]ShareUsage)
+	for jobID := range sa.owners {
+		jobs[jobID] = ShareUsage{LastUpdated: now}
+	}
+	for jobID, u := range sa.jobs {
+		_u := *u
+		_u.decayTo(now, sa.halfLife)
+		jobs[jobID] = _u
+	}
+	for user, u := range sa.users {
+		_u := *u
+		_u.decayTo(now, sa.halfLife)
+		users[user] = _u
+	}
+	for _, pod := range sa.running {
+		if !now.After(pod.startedAt) {
+			continue
+		}
+		jobs[pod.jobID] = sa.chargeRunning(jobs[pod.jobID], pod, now)
+		user := sa.getOwner(pod.jobID)
+		users[user] = sa.chargeRunning(users[user], pod, now)
+	}
+	return
+}
+
+func (sa *ShareAccounting) chargeRunning(u ShareUsage, pod runningPod, now time.Time) ShareUsage {
+	sa.charge(&u, pod.startedAt, now)
+	u.RunningPods += 1
+	return u
+}
+
+// ShareReport is the share accounting at a time
+type ShareReport struct {
+	Time     time.Time             `json:"time"`
+	HalfLife string                `json:"half_life"`
+	Jobs     map[string]ShareUsage `json:"jobs"`
+	Users    map[string]ShareUsage `json:"users"`
+	Owners   map[string]string     `json:"owners"`
+}
+
+// GetOwner returns the user who owns the job
+func (r *ShareReport) GetOwner(jobID string) string {
+	if user, found := r.Owners[jobID]; found {
+		return user
+	}
+	return UnknownOwner
+}
+
+// GetReport returns the share accounting at the time
+func (sa *ShareAccounting) GetReport(now time.Time) ShareReport {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	jobs, users := sa.snapshot(now)
+	owners := make(map[string]string)
+	for jobID, user := range sa.owners {
+		owners[jobID] = user
+	}
+	return ShareReport{
+		Time:     now,
+		HalfLife: sa.halfLife.String(),
+		Jobs:     jobs,
+		Users:    users,
+		Owners:   owners,
+	}
+}
+
+// FairSharePolicy selects the next plugin from the most under-served owner.
+// Owners are compared by their consumed pod-seconds, and jobs of the owner are
+// compared in the same way. Plugins of the same job are selected in queue order.
+// Like RoundRobinSchedulingPolicy, it selects a plugin only when no plugin is scheduled
+// so that plugins compete for the node.
+type FairSharePolicy struct {
+	Accounting     *ShareAccounting
+	getCurrentTime func() time.Time
+}
+
+func NewFairSharePolicy(accounting *ShareAccounting) *FairSharePolicy {
+	return &FairSharePolicy{
+		Accounting:     accounting,
+		getCurrentTime: time.Now,
+	}
+}
+
+func (fs *FairSharePolicy) SelectBestPlugins(readyQueue *datatype.Queue, scheduledPlugins *datatype.Queue, availableResource datatype.Resource) (pluginsToRun []*datatype.PluginRuntime, err error) {
+	if scheduledPlugins.Length() > 0 || readyQueue.Length() == 0 {
+		return
+	}
+	report := fs.Accounting.GetReport(fs.getCurrentTime())
+	var candidates []*datatype.PluginRuntime
+	readyQueue.ResetIter()
+	for readyQueue.More() {
+		candidates = append(candidates, readyQueue.Next())
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		ui := report.Users[report.GetOwner(candidates[i].Plugin.JobID)].PodSeconds
+		uj := report.Users[report.GetOwner(candidates[j].Plugin.JobID)].PodSeconds
+		if ui != uj {
+			return ui < uj
+		}
+		return report.Jobs[candidates[i].Plugin.JobID].PodSeconds < report.Jobs[candidates[j].Plugin.JobID].PodSeconds
+	})
+	pr := candidates[0]
+	policyLog.With(pr.LogFields()).Debugf("plugin %q of the most under-served owner %q is selected", pr.Plugin.Name, report.GetOwner(pr.Plugin.JobID))
+	return []*datatype.PluginRuntime{pr}, nil
+}
@@ -0,0 +1,99 @@
+package policy
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestShareAccountingDecay(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	accounting := NewShareAccounting(time.Hour)
+	accounting.SetJobOwner("1", "alice")
+	accounting.StartPod("1", "pod-a", start)
+	// finishing a pod that did not start is ignored
+	accounting.FinishPod("pod-unknown", start.Add(time.Minute))
+
+	// a running pod is counted up to the time of the report
+	report := accounting.GetReport(start.Add(10 * time.Second))
+	if report.Jobs["1"].RunningPods != 1 || report.Users["alice"].RunningPods != 1 {
+		t.Errorf("expected 1 running pod, but got %+v", report)
+	}
+	if v := report.Users["alice"].PodSeconds; math.Abs(v-10) > 0.1 {
+		t.Errorf("expected about 10 pod-seconds for the running pod, but got %f", v)
+	}
+
+	accounting.FinishPod("pod-a", start.Add(100*time.Second))
+	report = accounting.GetReport(start.Add(100 * time.Second))
+	if report.Users["alice"].RunningPods != 0 {
+		t.Errorf("expected no running pod, but got %d", report.Users["alice"].RunningPods)
+	}
+	charged := report.Users["alice"].PodSeconds
+	if math.Abs(charged-100) > 1 {
+		t.Errorf("expected about 100 pod-seconds, but got %f", charged)
+	}
+	// the usage halves after the half-life
+	report = accounting.GetReport(start.Add(100*time.Second + time.Hour))
+	if v := report.Users["alice"].PodSeconds; math.Abs(v-charged/2) > 0.01 {
+		t.Errorf("expected %f pod-seconds after the half-life, but got %f", charged/2, v)
+	}
+	// dropping the job keeps the usage of its owner
+	accounting.DropJob("1")
+	report = accounting.GetReport(start.Add(100 * time.Second))
+	if _, found := report.Jobs["1"]; found {
+		t.Errorf("job 1 must be dropped")
+	}
+	if report.Users["alice"].PodSeconds == 0 {
+		t.Errorf("usage of alice must remain")
+	}
+}
+
+func TestFairSharePolicy(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	accounting := NewShareAccounting(time.Hour)
+	accounting.SetJobOwner("1", "alice")
+	accounting.SetJobOwner("2", "alice")
+	accounting.SetJobOwner("3", "bob")
+	// alice used the node for 10 minutes with job 1 and bob for 1 minute
+	accounting.StartPod("1", "pod-1", now.Add(-20*time.Minute))
+	accounting.FinishPod("pod-1", now.Add(-10*time.Minute))
+	accounting.StartPod("3", "pod-3", now.Add(-5*time.Minute))
+	accounting.FinishPod("pod-3", now.Add(-4*time.Minute))
+
+	schedulingPolicy := NewFairSharePolicy(accounting)
+	schedulingPolicy.getCurrentTime = func() time.Time { return now }
+
+	var (
+		readyQueue       datatype.Queue
+		scheduledPlugins datatype.Queue
+	)
+	readyQueue.Push(newTestPluginRuntime("a", "1", "a:latest", 0))
+	readyQueue.Push(newTestPluginRuntime("b", "2", "b:latest", 0))
+	readyQueue.Push(newTestPluginRuntime("c", "3", "c:latest", 0))
+	pluginsToSchedule, err := schedulingPolicy.SelectBestPlugins(&readyQueue, &scheduledPlugins, datatype.Resource{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pluginsToSchedule) != 1 || pluginsToSchedule[0].Plugin.Name != "c" {
+		t.Fatalf("expected plugin c of bob to be selected, but got %v", pluginsToSchedule)
+	}
+
+	// among plugins of alice, job 2 has not used the node
+	readyQueue.Pop(pluginsToSchedule[0])
+	pluginsToSchedule, err = schedulingPolicy.SelectBestPlugins(&readyQueue, &scheduledPlugins, datatype.Resource{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pluginsToSchedule) != 1 || pluginsToSchedule[0].Plugin.Name != "b" {
+		t.Fatalf("expected plugin b of alice to be selected, but got %v", pluginsToSchedule)
+	}
+
+	// nothing is selected while a plugin is scheduled
+	scheduledPlugins.Push(pluginsToSchedule[0])
+	pluginsToSchedule, _ = schedulingPolicy.SelectBestPlugins(&readyQueue, &scheduledPlugins, datatype.Resource{})
+	if len(pluginsToSchedule) != 0 {
+		t.Errorf("expected no plugin to be selected, but got %d", len(pluginsToSchedule))
+	}
+}
@@ -0,0 +1,159 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+// Selection holds the state of an ongoing selection that filters and scorers look at
+type Selection struct {
+	Scheduled []*datatype.PluginRuntime
+	Selected  []*datatype.PluginRuntime
+	Available datatype.Resource
+	Now       time.Time
+}
+
+// Active returns plugins that are scheduled or selected so far
+func (s *Selection) Active() (plugins []*datatype.PluginRuntime) {
+	plugins = append(plugins, s.Scheduled...)
+	return append(plugins, s.Selected...)
+}
+
+// Filter decides whether a plugin can be selected given the ongoing selection
+type Filter interface {
+	// Filter returns a reason and false if the plugin must not be selected
+	Filter(pr *datatype.PluginRuntime, s *Selection) (string, bool)
+}
+
+// GPUExclusiveFilter allows one GPU-demand plugin at a time
+type GPUExclusiveFilter struct {
+}
+
+func NewGPUExclusiveFilter(args map[string]string) (Filter, error) {
+	return &GPUExclusiveFilter{}, nil
+}
+
+func (f *GPUExclusiveFilter) Filter(pr *datatype.PluginRuntime, s *Selection) (string, bool) {
+	if !pr.Plugin.PluginSpec.IsGPURequired() {
+		return "", true
+	}
+	for _, active := range s.Active() {
+		if active.Plugin.PluginSpec.IsGPURequired() {
+			return fmt.Sprintf("GPU is used by plugin %q", active.Plugin.Name), false
+		}
+	}
+	return "", true
+}
+
+// ConcurrencyFilter enforces max concurrency of jobs and plugins
+type ConcurrencyFilter struct {
+	limits *ConcurrencyLimits
+}
+
+func NewConcurrencyFilter(limits *ConcurrencyLimits) *ConcurrencyFilter {
+	return &ConcurrencyFilter{
+		limits: limits,
+	}
+}
+
+func (f *ConcurrencyFilter) Filter(pr *datatype.PluginRuntime, s *Selection) (string, bool) {
+	var active datatype.Queue
+	for _, _pr := range s.Active() {
+		active.Push(_pr)
+	}
+	return newConcurrencyCounter(f.limits, &active).check(pr)
+}
+
+// ResourceFitFilter allows plugins whose resource request fits in the available resource
+// along with the resource requested by active plugins. GPU memory is requested by request.gpu_memory
+type ResourceFitFilter struct {
+}
+
+func NewResourceFitFilter(args map[string]string) (Filter, error) {
+	return &ResourceFitFilter{}, nil
+}
+
+// getRequestedResource returns resource requested by the plugin in its plugin spec
+func getRequestedResource(pr *datatype.PluginRuntime) datatype.Resource {
+	var r datatype.Resource
+	if pr.Plugin.PluginSpec == nil {
+		return r
+	}
+	for name, quantity := range pr.Plugin.PluginSpec.Resource {
+		switch name {
+		case "request.cpu":
+			r.CPU = quantity
+		case "request.memory":
+			r.Memory = quantity
+		case "request.gpu_memory":
+			r.GPUMemory = quantity
+		}
+	}
+	return r
+}
+
+func (f *ResourceFitFilter) Filter(pr *datatype.PluginRuntime, s *Selection) (string, bool) {
+	requested := getRequestedResource(pr)
+	for _, active := range s.Active() {
+		activeRequest := getRequestedResource(active)
+		requested = requested.Add(&activeRequest)
+	}
+	if !s.Available.CanAccommodate(&requested) {
+		return fmt.Sprintf("insufficient resource: %s CPU, %s memory, and %s GPU memory needed in total", requested.CPU, requested.Memory, requested.GPUMemory), false
+	}
+	return "", true
+}
+
+// QuietHoursFilter holds back plugins during the quiet hours of the node.
+// The hours are given as "start" and "end" in HH:MM of the node's local time,
+// and may span midnight. Plugins listed in "exempt" separated by comma are not held back.
+type QuietHoursFilter struct {
+	start  time.Duration
+	end    time.Duration
+	exempt map[string]bool
+}
+
+func parseClock(v string) (time.Duration, error) {
+	t, err := time.Parse("15:04", v)
+	if err != nil {
+		return 0, fmt.Errorf("%q must be HH:MM", v)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func NewQuietHoursFilter(args map[string]string) (Filter, error) {
+	f := &QuietHoursFilter{
+		exempt: make(map[string]bool),
+	}
+	var err error
+	if f.start, err = parseClock(args["start"]); err != nil {
+		return nil, fmt.Errorf("failed to parse start: %s", err.Error())
+	}
+	if f.end, err = parseClock(args["end"]); err != nil {
+		return nil, fmt.Errorf("failed to parse end: %s", err.Error())
+	}
+	if v, found := args["exempt"]; found {
+		for _, name := range strings.Split(v, ",") {
+			f.exempt[strings.TrimSpace(name)] = true
+		}
+	}
+	return f, nil
+}
+
+func (f *QuietHoursFilter) isQuiet(now time.Time) bool {
+	clock := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+	if f.start <= f.end {
+		return clock >= f.start && clock < f.end
+	}
+	return clock >= f.start || clock < f.end
+}
+
+func (f *QuietHoursFilter) Filter(pr *datatype.PluginRuntime, s *Selection) (string, bool) {
+	if f.exempt[pr.Plugin.Name] || !f.isQuiet(s.Now) {
+		return "", true
+	}
+	return "quiet hours", false
+}
@@ -2,7 +2,6 @@ package policy
 
 import (
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
-	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
 )
 
 type GPUAwareSchedulingPolicy struct {
@@ -12,34 +11,71 @@ func NewGPUAwareSchedulingPolicy() *GPUAwareSchedulingPolicy {
 	return &GPUAwareSchedulingPolicy{}
 }
 
+// getRequestedGPUMemory returns GPU memory in Mi that the plugin declares in its
+// resource request.gpu_memory. It returns false if the plugin does not declare it
+func getRequestedGPUMemory(pr *datatype.PluginRuntime) (int, bool) {
+	if pr.Plugin.PluginSpec == nil {
+		return 0, false
+	}
+	if v, found := pr.Plugin.PluginSpec.Resource["request.gpu_memory"]; found {
+		r := datatype.Resource{GPUMemory: v}
+		return r.GetGPUMemoryInMega(), true
+	}
+	return 0, false
+}
+
 // SelectBestPlugins returns the best plugin to run at the time
 // For non-GPU-demand plugins, it returns all the plugins.
-// For GPU-demand plugins it returns the oldest one if no GPU-demand plugins in the scheduled plugin list
+// GPU-demand plugins that declare their GPU memory share the GPU as long as the sum of
+// their GPU memory fits in the available GPU memory; the ones that do not fit wait.
+// GPU-demand plugins that do not declare their GPU memory need the GPU exclusively;
+// the oldest one is returned if no GPU-demand plugins in the scheduled plugin list
 func (rs *GPUAwareSchedulingPolicy) SelectBestPlugins(readyQueue *datatype.Queue, scheduledPlugins *datatype.Queue, availableResource datatype.Resource) (pluginsToRun []*datatype.PluginRuntime, err error) {
 	GPUPluginExists := false
+	GPUExclusivelyUsed := false
+	GPUMemoryInUse := 0
+	GPUMemoryAvailable := availableResource.GetGPUMemoryInMega()
 	// Flag if GPU-demand plugin already exists in scheduled plugin list
 	scheduledPlugins.ResetIter()
 	for scheduledPlugins.More() {
 		pr := scheduledPlugins.Next()
 		if pr.Plugin.PluginSpec.IsGPURequired() {
 			GPUPluginExists = true
-			logger.Debug.Printf("GPU-demand plugin %q exists in scheduled plugin list.", pr.Plugin.Name)
-			break
+			if memory, declared := getRequestedGPUMemory(pr); declared {
+				GPUMemoryInUse += memory
+			} else {
+				GPUExclusivelyUsed = true
+				policyLog.With(pr.LogFields()).Debugf("GPU-demand plugin %q exists in scheduled plugin list.", pr.Plugin.Name)
+			}
 		}
 	}
 	readyQueue.ResetIter()
 	for readyQueue.More() {
 		pr := readyQueue.Next()
-		if pr.Plugin.PluginSpec.IsGPURequired() {
-			if GPUPluginExists == false {
+		if !pr.Plugin.PluginSpec.IsGPURequired() {
+			pluginsToRun = append(pluginsToRun, pr)
+			continue
+		}
+		if GPUExclusivelyUsed {
+			policyLog.With(pr.LogFields()).Debugf("GPU-demand plugin %q needs to wait because other GPU-demand plugin is scheduled or being run.", pr.Plugin.Name)
+			continue
+		}
+		if memory, declared := getRequestedGPUMemory(pr); declared {
+			if GPUMemoryInUse+memory <= GPUMemoryAvailable {
 				pluginsToRun = append(pluginsToRun, pr)
-				logger.Debug.Printf("GPU-demand plugin %q is added to scheduled plugin list.", pr.Plugin.Name)
+				policyLog.With(pr.LogFields()).Debugf("GPU-demand plugin %q requesting %d Mi is added to scheduled plugin list. %d Mi in use out of %d Mi", pr.Plugin.Name, memory, GPUMemoryInUse+memory, GPUMemoryAvailable)
+				GPUMemoryInUse += memory
 				GPUPluginExists = true
 			} else {
-				logger.Debug.Printf("GPU-demand plugin %q needs to wait because other GPU-demand plugin is scheduled or being run.", pr.Plugin.Name)
+				policyLog.With(pr.LogFields()).Debugf("GPU-demand plugin %q requesting %d Mi needs to wait because %d Mi is in use out of %d Mi.", pr.Plugin.Name, memory, GPUMemoryInUse, GPUMemoryAvailable)
 			}
-		} else {
+		} else if GPUPluginExists == false {
 			pluginsToRun = append(pluginsToRun, pr)
+			policyLog.With(pr.LogFields()).Debugf("GPU-demand plugin %q is added to scheduled plugin list.", pr.Plugin.Name)
+			GPUPluginExists = true
+			GPUExclusivelyUsed = true
+		} else {
+			policyLog.With(pr.LogFields()).Debugf("GPU-demand plugin %q needs to wait because other GPU-demand plugin is scheduled or being run.", pr.Plugin.Name)
 		}
 	}
 	return
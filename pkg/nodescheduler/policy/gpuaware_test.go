@@ -68,3 +68,109 @@ func TestGPUAwarePolicy(t *testing.T) {
 		}
 	}
 }
+
+func TestGPUAwarePolicyWithGPUMemory(t *testing.T) {
+	gpuPlugin := func(name string, gpuMemory string) *datatype.PluginRuntime {
+		pr := &datatype.PluginRuntime{
+			Plugin: datatype.Plugin{
+				Name: name,
+				PluginSpec: &datatype.PluginSpec{
+					Image: name + ":latest",
+					Selector: map[string]string{
+						"resource.gpu": "true",
+					},
+					Resource: map[string]string{},
+				},
+			},
+		}
+		if gpuMemory != "" {
+			pr.Plugin.PluginSpec.Resource["request.gpu_memory"] = gpuMemory
+		}
+		return pr
+	}
+	compute := datatype.ComputeHardwareManifest{
+		Hardware:  "xaviernx",
+		CPURAM:    "8Gi",
+		SharedRam: true,
+	}
+	tests := map[string]struct {
+		Scheduled []*datatype.PluginRuntime
+		Ready     []*datatype.PluginRuntime
+		Expected  []string
+	}{
+		"small models share the GPU while a large one waits": {
+			Ready: []*datatype.PluginRuntime{
+				gpuPlugin("small-a", "2Gi"),
+				gpuPlugin("large", "7Gi"),
+				gpuPlugin("small-b", "2048Mi"),
+			},
+			Expected: []string{"small-a", "small-b"},
+		},
+		"scheduled plugins use the GPU memory": {
+			Scheduled: []*datatype.PluginRuntime{
+				gpuPlugin("large", "6Gi"),
+			},
+			Ready: []*datatype.PluginRuntime{
+				gpuPlugin("small-a", "2Gi"),
+				gpuPlugin("small-b", "2Gi"),
+			},
+			Expected: []string{"small-a"},
+		},
+		"plugin without GPU memory needs the GPU exclusively": {
+			Ready: []*datatype.PluginRuntime{
+				gpuPlugin("unknown-a", ""),
+				gpuPlugin("small-a", "2Gi"),
+				gpuPlugin("unknown-b", ""),
+			},
+			Expected: []string{"unknown-a"},
+		},
+		"plugin without GPU memory waits for other GPU plugins": {
+			Scheduled: []*datatype.PluginRuntime{
+				gpuPlugin("small-a", "2Gi"),
+			},
+			Ready: []*datatype.PluginRuntime{
+				gpuPlugin("unknown-a", ""),
+				gpuPlugin("small-b", "2Gi"),
+			},
+			Expected: []string{"small-b"},
+		},
+	}
+	for name, test := range tests {
+		var (
+			readyQueue       datatype.Queue
+			scheduledPlugins datatype.Queue
+		)
+		for _, pr := range test.Scheduled {
+			scheduledPlugins.Push(pr)
+		}
+		for _, pr := range test.Ready {
+			readyQueue.Push(pr)
+		}
+		pluginsToSchedule, err := NewGPUAwareSchedulingPolicy().SelectBestPlugins(
+			&readyQueue,
+			&scheduledPlugins,
+			datatype.Resource{
+				CPU:       "999000m",
+				Memory:    "999999Gi",
+				GPUMemory: compute.GetGPUMemory(),
+			})
+		if err != nil {
+			t.Errorf("%s: %s", name, err.Error())
+			continue
+		}
+		var selected []string
+		for _, pr := range pluginsToSchedule {
+			selected = append(selected, pr.Plugin.Name)
+		}
+		if len(selected) != len(test.Expected) {
+			t.Errorf("%s: expected %v to be selected, but got %v", name, test.Expected, selected)
+			continue
+		}
+		for i := range selected {
+			if selected[i] != test.Expected[i] {
+				t.Errorf("%s: expected %v to be selected, but got %v", name, test.Expected, selected)
+				break
+			}
+		}
+	}
+}
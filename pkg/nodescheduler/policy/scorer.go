@@ -0,0 +1,73 @@
+package policy
+
+import (
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+// Scorer rates a plugin given the ongoing selection. Higher score is preferred.
+// Scores are normalized among the candidates before they are weighted,
+// so a scorer does not need to care about the range of its scores.
+type Scorer interface {
+	Score(pr *datatype.PluginRuntime, s *Selection) float64
+}
+
+// AgeScorer prefers plugins that have waited longer in the ready queue
+type AgeScorer struct {
+}
+
+func NewAgeScorer(args map[string]string) (Scorer, error) {
+	return &AgeScorer{}, nil
+}
+
+func (a *AgeScorer) Score(pr *datatype.PluginRuntime, s *Selection) float64 {
+	if pr.QueuedAt.IsZero() {
+		return 0
+	}
+	return s.Now.Sub(pr.QueuedAt).Seconds()
+}
+
+// PriorityScorer prefers plugins with higher priority
+type PriorityScorer struct {
+}
+
+func NewPriorityScorer(args map[string]string) (Scorer, error) {
+	return &PriorityScorer{}, nil
+}
+
+func (p *PriorityScorer) Score(pr *datatype.PluginRuntime, s *Selection) float64 {
+	return float64(pr.Plugin.Priority)
+}
+
+// FairnessScorer prefers plugins whose job has fewer active plugins
+type FairnessScorer struct {
+}
+
+func NewFairnessScorer(args map[string]string) (Scorer, error) {
+	return &FairnessScorer{}, nil
+}
+
+func (f *FairnessScorer) Score(pr *datatype.PluginRuntime, s *Selection) float64 {
+	count := 0
+	for _, active := range s.Active() {
+		if active.Plugin.JobID == pr.Plugin.JobID {
+			count += 1
+		}
+	}
+	return -float64(count)
+}
+
+// FairShareScorer prefers plugins whose owner consumed less pod-seconds
+type FairShareScorer struct {
+	accounting *ShareAccounting
+}
+
+func NewFairShareScorer(accounting *ShareAccounting) *FairShareScorer {
+	return &FairShareScorer{
+		accounting: accounting,
+	}
+}
+
+func (f *FairShareScorer) Score(pr *datatype.PluginRuntime, s *Selection) float64 {
+	report := f.accounting.GetReport(s.Now)
+	return -report.Users[report.GetOwner(pr.Plugin.JobID)].PodSeconds
+}
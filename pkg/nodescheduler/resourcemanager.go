@@ -2,12 +2,13 @@ package nodescheduler
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
-	"math/rand"
+	"net/http"
 	"os"
 	"path"
 	"path/filepath"
@@ -41,14 +42,26 @@ import (
 	metrics "k8s.io/metrics/pkg/client/clientset/versioned"
 )
 
+var rmLog = logger.New("resourcemanager")
+
 const (
 	namespace             = "ses"
 	rancherKubeconfigPath = "/etc/rancher/k3s/k3s.yaml"
 	configMapNameForGoals = "waggle-plugin-scheduler-goals"
+	// scratchDirectory keeps scratch volumes of jobs on the host
+	scratchDirectory = "/media/plugin-data/scratch"
+	// maxHostPathSymlinks is how many symbolic links a host path can follow
+	maxHostPathSymlinks = 40
 
 	PodLabelPluginTask = "sagecontinuum.org/plugin-task"
 	PodLabelGoalID     = "sagecontinuum.org/plugin-goal-id"
 	PodLabelJobID      = "sagecontinuum.org/plugin-job-id"
+	PodLabelJob        = "sagecontinuum.org/plugin-job"
+
+	// PodAnnotationPluginCredential holds the RabbitMQ username minted for the Pod
+	PodAnnotationPluginCredential = "sagecontinuum.org/plugin-credential"
+	// SecretLabelPluginCredential marks Secrets holding credentials of plugin runs
+	SecretLabelPluginCredential = "sagecontinuum.org/plugin-credential"
 
 	InitContainerName             = "init-app-meta-cache"
 	PluginControllerContainerName = "plugin-controller"
@@ -113,6 +126,14 @@ type ResourceManager struct {
 	Notifier            *interfacing.Notifier
 	Simulate            bool
 	runner              string
+
+	// VolumeHostPaths are host paths that plugins may mount, including paths under them.
+	// Paths ending with :ro are mounted read-only
+	VolumeHostPaths []string
+	// HostRoot is where the host filesystem is seen, e.g. / or a mount of it in the
+	// scheduler's container. Symbolic links in host paths are resolved under it. Without it,
+	// only the paths in VolumeHostPaths themselves can be mounted
+	HostRoot string
 }
 
 // NewResourceManager returns an instance of ResourceManager
@@ -188,11 +209,11 @@ func (rm *ResourceManager) AnalyzeFailureOfPod(p *v1.Pod) (*datatype.SchedulerEv
 	} else {
 		if t.ExitCode != 0 {
 			// init container terminated with an error
-			logger.Error.Printf("init container of %s has failed: %s", p.Name, t.String())
+			rmLog.WithField("pod", p.Name).Errorf("init container of %s has failed: %s", p.Name, t.String())
 			if containerLog, err := rm.GetContainerLastLog(p.Name, initContainerStatus.Name, 1024); err == nil {
 				message = message.AddEntry("error_log", containerLog)
 			} else {
-				logger.Error.Printf("failed to get plugin %q container %q log: %s", p.Name, initContainerStatus.Name, err.Error())
+				rmLog.WithField("pod", p.Name).Errorf("failed to get plugin %q container %q log: %s", p.Name, initContainerStatus.Name, err.Error())
 			}
 			message = message.AddEntry("message", "init container failed").
 				AddEntry("return_code", t.ExitCode)
@@ -204,7 +225,7 @@ func (rm *ResourceManager) AnalyzeFailureOfPod(p *v1.Pod) (*datatype.SchedulerEv
 	// we consider the pod succeeded.
 	if pluginContainerStatus, err := rm.GetContainerStatusFromPod(p, pluginName); err != nil {
 		e := fmt.Sprintf("Failed to get container status: %s", err.Error())
-		logger.Error.Printf(e)
+		rmLog.WithField("pod", p.Name).Errorf(e)
 		message = message.AddReason(e)
 		return message, fmt.Errorf("failed to get container status: %s", err.Error())
 	} else if t := pluginContainerStatus.State.Terminated; t == nil {
@@ -218,22 +239,22 @@ func (rm *ResourceManager) AnalyzeFailureOfPod(p *v1.Pod) (*datatype.SchedulerEv
 			// TODO: we will want to send this error to the cloud for further analysis
 			if pluginControllerContainerStatus, err := rm.GetContainerStatusFromPod(p, PluginControllerContainerName); err != nil {
 				e := fmt.Sprintf("Failed to get container status: %s", err.Error())
-				logger.Error.Printf(e)
+				rmLog.WithField("pod", p.Name).Errorf(e)
 			} else if _t := pluginControllerContainerStatus.State.Terminated; _t != nil {
 				containerLog, _ := rm.GetContainerLastLog(p.Name, pluginControllerContainerStatus.Name, 1024)
-				logger.Error.Printf("Pod's %s failed: %s; logs: %s", pluginControllerContainerStatus.Name, t.String(), containerLog)
+				rmLog.WithField("pod", p.Name).Errorf("Pod's %s failed: %s; logs: %s", pluginControllerContainerStatus.Name, t.String(), containerLog)
 			}
-			logger.Info.Printf("Pod failed, but plugin %q succeeded", p.Name)
+			rmLog.WithField("pod", p.Name).Infof("Pod failed, but plugin %q succeeded", p.Name)
 			message2 := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusComplete).
 				AddPodMeta(p)
 			return message2, nil
 		} else {
-			logger.Error.Printf("Plugin %q has failed", p.Name)
+			rmLog.WithField("pod", p.Name).Errorf("Plugin %q has failed", p.Name)
 			if containerLog, err := rm.GetContainerLastLog(p.Name, pluginContainerStatus.Name, 1024); err == nil {
 				message = message.AddEntry("error_log", containerLog).
 					AddEntry("return_code", t.ExitCode)
 			} else {
-				logger.Error.Printf("failed to get plugin %q container %q log: %s", p.Name, pluginContainerStatus.Name, err.Error())
+				rmLog.WithField("pod", p.Name).Errorf("failed to get plugin %q container %q log: %s", p.Name, pluginContainerStatus.Name, err.Error())
 			}
 			return message, nil
 		}
@@ -246,7 +267,7 @@ func (rm *ResourceManager) labelsForPlugin(plugin *datatype.Plugin) map[string]s
 		"app.kubernetes.io/name":       plugin.Name,
 		"app.kubernetes.io/managed-by": rm.runner,
 		"app.kubernetes.io/created-by": rm.runner,
-		"sagecontinuum.org/plugin-job": plugin.PluginSpec.Job,
+		PodLabelJob:                    plugin.PluginSpec.Job,
 		PodLabelPluginTask:             plugin.Name,
 	}
 
@@ -270,6 +291,208 @@ func (rm *ResourceManager) labelsForPlugin(plugin *datatype.Plugin) map[string]s
 	return labels
 }
 
+// ParseVolumeHostPaths returns the host paths in the comma-separated list
+func ParseVolumeHostPaths(s string) (paths []string) {
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return
+}
+
+// allowedHostPath returns true if the host path is one of VolumeHostPaths or under one.
+// The most specific entry decides if the path is mounted read-only. Paths under the entries
+// are allowed only if symbolic links can be resolved under HostRoot
+func (rm *ResourceManager) allowedHostPath(hostPath string) (allowed bool, readOnly bool) {
+	longest := -1
+	for _, entry := range rm.VolumeHostPaths {
+		allowedPath, option, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		if !path.IsAbs(allowedPath) {
+			continue
+		}
+		allowedPath = path.Clean(allowedPath)
+		if rm.HostRoot == "" && hostPath != allowedPath {
+			continue
+		}
+		if len(allowedPath) > longest && isSameOrUnder(hostPath, allowedPath) {
+			longest = len(allowedPath)
+			allowed, readOnly = true, option == "ro"
+		}
+	}
+	return
+}
+
+// resolveHostPath returns the host path with symbolic links resolved. Links are resolved
+// under HostRoot as the host would, so that they cannot lead out of the host filesystem
+// seen by the scheduler. The host path is only cleaned if HostRoot is not given
+func (rm *ResourceManager) resolveHostPath(hostPath string) (string, error) {
+	if !path.IsAbs(hostPath) {
+		return "", fmt.Errorf("host path %q must be absolute", hostPath)
+	}
+	if rm.HostRoot == "" {
+		return path.Clean(hostPath), nil
+	}
+	resolved := "/"
+	rest := strings.Split(hostPath, "/")
+	links := 0
+	for len(rest) > 0 {
+		name := rest[0]
+		rest = rest[1:]
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			resolved = path.Dir(resolved)
+			continue
+		}
+		next := path.Join(resolved, name)
+		onRoot := filepath.Join(rm.HostRoot, filepath.FromSlash(next))
+		info, err := os.Lstat(onRoot)
+		if err != nil {
+			return "", fmt.Errorf("failed to find host path %q: %s", hostPath, err.Error())
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if links++; links > maxHostPathSymlinks {
+			return "", fmt.Errorf("host path %q has too many symbolic links", hostPath)
+		}
+		target, err := os.Readlink(onRoot)
+		if err != nil {
+			return "", fmt.Errorf("failed to read symbolic link %q: %s", next, err.Error())
+		}
+		if path.IsAbs(target) {
+			resolved = "/"
+		}
+		rest = append(strings.Split(target, "/"), rest...)
+	}
+	return resolved, nil
+}
+
+// isSameOrUnder returns true if p is the directory or a path under it
+func isSameOrUnder(p string, dir string) bool {
+	return p == dir || dir == "/" || strings.HasPrefix(p, dir+"/")
+}
+
+// reservedConfigMaps are ConfigMaps of the scheduler and the node that plugins cannot mount
+var reservedConfigMaps = map[string]bool{
+	configMapNameForGoals:          true,
+	"waggle-data-config":           true,
+	"wes-audio-server-plugin-conf": true,
+}
+
+// allowedConfigMap returns an error if the ConfigMap does not belong to the job of the plugin.
+// A ConfigMap belongs to the job if its name starts with the job ID and a hyphen, or it is
+// labeled with the job ID. Plugins run by pluginctl use their job name instead
+func (rm *ResourceManager) allowedConfigMap(pr *datatype.PluginRuntime, name string) error {
+	if reservedConfigMaps[name] {
+		return fmt.Errorf("configmap %q is reserved for the scheduler", name)
+	}
+	label, owner := PodLabelJobID, pr.Plugin.JobID
+	if owner == "" {
+		label, owner = PodLabelJob, pr.Plugin.PluginSpec.Job
+	}
+	if owner == "" {
+		return fmt.Errorf("plugin %q has no job to own configmap %q", pr.Plugin.Name, name)
+	}
+	if strings.HasPrefix(name, strings.ToLower(owner)+"-") {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	configMap, err := rm.Clientset.CoreV1().ConfigMaps(rm.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get configmap %q: %s", name, err.Error())
+	}
+	if configMap.Labels[label] != owner {
+		return fmt.Errorf("configmap %q does not belong to job %q: name it %q or label it %s=%s", name, owner, strings.ToLower(owner)+"-"+name, label, owner)
+	}
+	return nil
+}
+
+// volumesForPlugin returns the volumes that the plugin asks for and their mounts. Host paths
+// must be allowed on the node, ConfigMaps must belong to the job, and the volumes must not overlap the mounts already given
+func (rm *ResourceManager) volumesForPlugin(pr *datatype.PluginRuntime, mounts []apiv1.VolumeMount) (volumes []apiv1.Volume, volumeMounts []apiv1.VolumeMount, err error) {
+	pluginVolumes, err := pr.Plugin.PluginSpec.GetVolumes()
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, v := range pluginVolumes {
+		for _, m := range mounts {
+			if isSameOrUnder(v.MountPath, m.MountPath) || isSameOrUnder(m.MountPath, v.MountPath) {
+				return nil, nil, fmt.Errorf("volume cannot be mounted at %q as it overlaps %q", v.MountPath, m.MountPath)
+			}
+		}
+		name := fmt.Sprintf("uservolume-%d", i+1)
+		mount := apiv1.VolumeMount{
+			Name:      name,
+			MountPath: v.MountPath,
+		}
+		var source apiv1.VolumeSource
+		switch v.Type {
+		case datatype.VolumeHostPath:
+			// the path is checked and mounted after resolving symbolic links so that
+			// links under the allowed paths cannot point elsewhere on the host
+			hostPath, err := rm.resolveHostPath(v.Source)
+			if err != nil {
+				return nil, nil, err
+			}
+			allowed, readOnly := rm.allowedHostPath(hostPath)
+			if !allowed {
+				return nil, nil, fmt.Errorf("host path %q is not allowed to be mounted on the node", v.Source)
+			}
+			source.HostPath = &apiv1.HostPathVolumeSource{
+				Path: hostPath,
+				Type: &hostPathDirectory,
+			}
+			mount.ReadOnly = readOnly
+		case datatype.VolumeScratch:
+			// the scratch directory persists across runs and is shared by plugins of the job
+			owner := pr.Plugin.JobID
+			if owner == "" {
+				owner = pr.Plugin.GoalID
+			}
+			// plugins run by pluginctl share the scratch directory of pluginctl
+			if owner == "" {
+				owner = pr.Plugin.PluginSpec.Job
+			}
+			if owner == "" || owner == ".." || path.Base(owner) != owner {
+				return nil, nil, fmt.Errorf("plugin %q has no job for the scratch directory", pr.Plugin.Name)
+			}
+			source.HostPath = &apiv1.HostPathVolumeSource{
+				Path: path.Join(scratchDirectory, owner),
+				Type: &hostPathDirectoryOrCreate,
+			}
+		case datatype.VolumeConfigMap:
+			if err := rm.allowedConfigMap(pr, v.Source); err != nil {
+				return nil, nil, err
+			}
+			source.ConfigMap = &apiv1.ConfigMapVolumeSource{
+				LocalObjectReference: apiv1.LocalObjectReference{
+					Name: v.Source,
+				},
+			}
+			mount.ReadOnly = true
+		case datatype.VolumeEmptyDir:
+			sizeLimit, err := resource.ParseQuantity(v.Source)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid size limit %q: %s", v.Source, err.Error())
+			}
+			source.EmptyDir = &apiv1.EmptyDirVolumeSource{
+				SizeLimit: &sizeLimit,
+			}
+		}
+		volumes = append(volumes, apiv1.Volume{
+			Name:         name,
+			VolumeSource: source,
+		})
+		volumeMounts = append(volumeMounts, mount)
+	}
+	return volumes, volumeMounts, nil
+}
+
 func nodeSelectorForConfig(pluginSpec *datatype.PluginSpec) map[string]string {
 	vals := map[string]string{}
 	if pluginSpec.Node != "" {
@@ -302,6 +525,9 @@ func resourceListForConfig(pluginSpec *datatype.PluginSpec) (v1.ResourceRequirem
 			resources.Requests[v1.ResourceCPU] = quantity
 		case "request.memory":
 			resources.Requests[v1.ResourceMemory] = quantity
+		case "request.gpu_memory":
+			// GPU memory is not a Kubernetes resource. It is used only by the scheduler
+			continue
 		default:
 			resources.Limits[v1.ResourceName(resourceName)] = quantity
 			// return resources, fmt.Errorf("Unknown resource name %q", resourceName)
@@ -364,37 +590,166 @@ func (rm *ResourceManager) ConfigureKubernetes(inCluster bool, kubeconfig string
 	return nil
 }
 
-// CreatePluginCredential creates a credential inside RabbitMQ server for the plugin
-func (rm *ResourceManager) CreatePluginCredential(plugin *datatype.Plugin) (datatype.PluginCredential, error) {
-	tag, err := plugin.PluginSpec.GetImageTag()
+// CreatePluginCredential creates a credential for the run of the plugin. The credential
+// is unique to the run as the instance of the run is a part of the username
+func (rm *ResourceManager) CreatePluginCredential(pr *datatype.PluginRuntime) (datatype.PluginCredential, error) {
+	tag, err := pr.Plugin.PluginSpec.GetImageTag()
 	if err != nil {
 		return datatype.PluginCredential{}, err
 	}
-
-	// TODO: We will need to add instance of plugin as a aprt of Username
+	instance := strings.TrimPrefix(pr.PodInstance, pr.Plugin.Name+"-")
+	if instance == "" {
+		return datatype.PluginCredential{}, fmt.Errorf("plugin %q has no instance", pr.Plugin.Name)
+	}
 	// username should follow "plugin.NAME:VERSION" format to publish messages via WES
 	credential := datatype.PluginCredential{
-		Username: fmt.Sprint("plugin.", strings.ToLower(plugin.Name), ":", tag),
+		Username: fmt.Sprint("plugin.", strings.ToLower(pr.Plugin.Name), ":", tag, ".", strings.ToLower(instance)),
 		Password: generatePassword(),
 	}
 	return credential, nil
 }
 
+// AttachPluginCredential registers a credential for the run of the plugin in RabbitMQ and
+// gives it to the Pod through a Secret. It does nothing if RabbitMQ management is not
+// configured, and the Pod uses the credential shared by all plugins
+func (rm *ResourceManager) AttachPluginCredential(pr *datatype.PluginRuntime, pod *apiv1.Pod) error {
+	if rm.RMQManagement == nil {
+		return nil
+	}
+	credential, err := rm.CreatePluginCredential(pr)
+	if err != nil {
+		return fmt.Errorf("failed to create a credential for %q: %s", pod.Name, err.Error())
+	}
+	if err := rm.RMQManagement.RegisterPluginCredential(credential); err != nil {
+		return fmt.Errorf("failed to register credential %q: %s", credential.Username, err.Error())
+	}
+	secretLabels := map[string]string{
+		SecretLabelPluginCredential: "true",
+	}
+	for _, k := range []string{PodLabelPluginTask, PodLabelGoalID, PodLabelJobID} {
+		if v, exist := pod.Labels[k]; exist {
+			secretLabels[k] = v
+		}
+	}
+	secret := &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pluginCredentialSecretName(pod.Name),
+			Namespace: rm.Namespace,
+			Labels:    secretLabels,
+		},
+		StringData: map[string]string{
+			"username": credential.Username,
+			"password": credential.Password,
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := rm.Clientset.CoreV1().Secrets(rm.Namespace).Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+		// the credential must not outlive the run that never started
+		if err := rm.RMQManagement.RevokePluginCredential(credential.Username); err != nil {
+			rmLog.WithField("pod", pod.Name).Errorf("Failed to revoke credential %q: %s", credential.Username, err.Error())
+		}
+		return fmt.Errorf("failed to create Secret %q: %s", secret.Name, err.Error())
+	}
+	for i := range pod.Spec.Containers {
+		envs := pod.Spec.Containers[i].Env
+		for j := range envs {
+			var key string
+			switch envs[j].Name {
+			case "WAGGLE_PLUGIN_USERNAME":
+				key = "username"
+			case "WAGGLE_PLUGIN_PASSWORD":
+				key = "password"
+			default:
+				continue
+			}
+			envs[j].Value = ""
+			envs[j].ValueFrom = &apiv1.EnvVarSource{
+				SecretKeyRef: &apiv1.SecretKeySelector{
+					LocalObjectReference: apiv1.LocalObjectReference{Name: secret.Name},
+					Key:                  key,
+				},
+			}
+		}
+	}
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[PodAnnotationPluginCredential] = credential.Username
+	rmLog.WithField("pod", pod.Name).Infof("credential %q is attached to %q", credential.Username, pod.Name)
+	return nil
+}
+
+// RevokePluginCredential removes the credential of the Pod from RabbitMQ and deletes its Secret.
+// It does nothing if the Pod was not given a credential of its own
+func (rm *ResourceManager) RevokePluginCredential(pod *apiv1.Pod) error {
+	username, exist := pod.Annotations[PodAnnotationPluginCredential]
+	if !exist || rm.RMQManagement == nil {
+		return nil
+	}
+	return rm.revokePluginCredential(username, pluginCredentialSecretName(pod.Name))
+}
+
+func (rm *ResourceManager) revokePluginCredential(username string, secretName string) error {
+	if username != "" {
+		if err := rm.RMQManagement.RevokePluginCredential(username); err != nil {
+			return fmt.Errorf("failed to revoke credential %q: %s", username, err.Error())
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := rm.Clientset.CoreV1().Secrets(rm.Namespace).Delete(ctx, secretName, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete Secret %q: %s", secretName, err.Error())
+	}
+	rmLog.Infof("credential %q is revoked", username)
+	return nil
+}
+
+// RevokeStalePluginCredentials revokes credentials of plugin runs that ended while
+// the scheduler was not running. It must be called after plugins are cleaned up
+func (rm *ResourceManager) RevokeStalePluginCredentials() error {
+	if rm.RMQManagement == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	secrets, err := rm.Clientset.CoreV1().Secrets(rm.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: SecretLabelPluginCredential,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list credentials: %s", err.Error())
+	}
+	for _, secret := range secrets.Items {
+		username := string(secret.Data["username"])
+		if username == "" {
+			username = secret.StringData["username"]
+		}
+		if err := rm.revokePluginCredential(username, secret.Name); err != nil {
+			rmLog.Errorf("Failed to revoke stale credential: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+func pluginCredentialSecretName(podName string) string {
+	return podName + "-credential"
+}
+
 // CreateNamespace creates a Kubernetes namespace
 //
 // If the namespace exists, it does nothing
 func (rm *ResourceManager) CreateNamespace(namespace string) error {
-	logger.Debug.Printf("Creating namespace %s", namespace)
+	rmLog.Debugf("Creating namespace %s", namespace)
 	_, err := rm.Clientset.CoreV1().Namespaces().Get(context.TODO(), namespace, metav1.GetOptions{})
 	if err != nil {
 		if errors.IsNotFound(err) {
-			logger.Debug.Printf("The namespace %s does not exist. Will create...", namespace)
+			rmLog.Debugf("The namespace %s does not exist. Will create...", namespace)
 		} else {
-			logger.Debug.Printf("Failed to get %s from cluster: %s", namespace, err.Error())
+			rmLog.Debugf("Failed to get %s from cluster: %s", namespace, err.Error())
 			return err
 		}
 	} else {
-		logger.Debug.Printf("The namespace %s already exists.", namespace)
+		rmLog.Debugf("The namespace %s already exists.", namespace)
 		return nil
 	}
 	objNamespace := &apiv1.Namespace{
@@ -423,14 +778,14 @@ func (rm *ResourceManager) CopyConfigMap(configMapName string, fromNamespace str
 //
 // This is useful when pods in the other namespace need to access to the service
 func (rm *ResourceManager) ForwardService(serviceName string, fromNamespace string, toNamespace string) error {
-	logger.Debug.Printf("Forwarding service %s from %s namespace to %s namespace", serviceName, fromNamespace, toNamespace)
+	rmLog.Debugf("Forwarding service %s from %s namespace to %s namespace", serviceName, fromNamespace, toNamespace)
 	existingServiceInFromNamespace, err := rm.Clientset.CoreV1().Services(fromNamespace).Get(context.TODO(), serviceName, metav1.GetOptions{})
 	if err != nil {
 		if errors.IsNotFound(err) {
-			logger.Debug.Printf("The service %s does not exist in %s namespace ", serviceName, fromNamespace)
+			rmLog.Debugf("The service %s does not exist in %s namespace ", serviceName, fromNamespace)
 			return err
 		}
-		logger.Debug.Printf("Failed to get %s from namespace %s: %s", serviceName, fromNamespace, err.Error())
+		rmLog.Debugf("Failed to get %s from namespace %s: %s", serviceName, fromNamespace, err.Error())
 		return err
 	}
 	objService := &apiv1.Service{
@@ -447,11 +802,11 @@ func (rm *ResourceManager) ForwardService(serviceName string, fromNamespace stri
 	existingServiceInToNamespace, err := rm.Clientset.CoreV1().Services(toNamespace).Get(context.TODO(), serviceName, metav1.GetOptions{})
 	if err != nil {
 		if errors.IsNotFound(err) {
-			logger.Debug.Printf("The service %s does not exist in the namespace %s. Will create...", serviceName, toNamespace)
+			rmLog.Debugf("The service %s does not exist in the namespace %s. Will create...", serviceName, toNamespace)
 			_, err = rm.Clientset.CoreV1().Services(toNamespace).Create(context.TODO(), objService, metav1.CreateOptions{})
 			return err
 		}
-		logger.Debug.Printf("Failed to get %s from namespace %s: %s", serviceName, toNamespace, err.Error())
+		rmLog.Debugf("Failed to get %s from namespace %s: %s", serviceName, toNamespace, err.Error())
 		return err
 	}
 	objService.ObjectMeta.ResourceVersion = existingServiceInToNamespace.ObjectMeta.ResourceVersion
@@ -515,7 +870,7 @@ func (rm *ResourceManager) WatchJob(name string, namespace string, retry int) (w
 	for i := 0; i <= retry; i++ {
 		job, err := rm.Clientset.BatchV1().Jobs(namespace).Get(context.TODO(), name, metav1.GetOptions{})
 		if err != nil {
-			logger.Debug.Printf("Failed to get job %q", err.Error())
+			rmLog.Debugf("Failed to get job %q", err.Error())
 			time.Sleep(3 * time.Second)
 			continue
 		}
@@ -523,7 +878,7 @@ func (rm *ResourceManager) WatchJob(name string, namespace string, retry int) (w
 		// err = metav1.Convert_Map_string_To_string_To_v1_LabelSelector(&configMap.Labels, selector, nil)
 		watcher, err = rm.Clientset.BatchV1().Jobs(namespace).Watch(context.TODO(), metav1.SingleObject(metav1.ObjectMeta{Name: job.Name, Namespace: job.Namespace}))
 		if err != nil {
-			logger.Debug.Printf("Failed to get watcher for %q: %q", job.Name, err.Error())
+			rmLog.Debugf("Failed to get watcher for %q: %q", job.Name, err.Error())
 			time.Sleep(3 * time.Second)
 			continue
 		}
@@ -547,7 +902,7 @@ func (rm *ResourceManager) WatchPod(name string, namespace string, retry int) (w
 	for i := 0; i <= retry; i++ {
 		pod, err := rm.Clientset.CoreV1().Pods(namespace).Get(context.TODO(), name, metav1.GetOptions{})
 		if err != nil {
-			logger.Debug.Printf("Failed to get pod %q", err.Error())
+			rmLog.Debugf("Failed to get pod %q", err.Error())
 			time.Sleep(3 * time.Second)
 			continue
 		}
@@ -555,7 +910,7 @@ func (rm *ResourceManager) WatchPod(name string, namespace string, retry int) (w
 		// err = metav1.Convert_Map_string_To_string_To_v1_LabelSelector(&configMap.Labels, selector, nil)
 		watcher, err = rm.Clientset.CoreV1().Pods(namespace).Watch(context.TODO(), metav1.SingleObject(metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace}))
 		if err != nil {
-			logger.Debug.Printf("Failed to get watcher for %q: %q", pod.Name, err.Error())
+			rmLog.WithField("pod", pod.Name).Debugf("Failed to get watcher for %q: %q", pod.Name, err.Error())
 			time.Sleep(3 * time.Second)
 			continue
 		}
@@ -611,6 +966,11 @@ func (rm *ResourceManager) createPodTemplateSpecForPlugin(pr *datatype.PluginRun
 			Name:  "WAGGLE_GPS_SERVER",
 			Value: "wes-gps-server.default.svc.cluster.local",
 		},
+		// plugins control themselves through the API of the node scheduler
+		{
+			Name:  "WAGGLE_SCHEDULER_URL",
+			Value: "http://wes-plugin-scheduler.default.svc.cluster.local:8080",
+		},
 		// NOTE WAGGLE_APP_ID is used to bind plugin <-> Pod identities.
 		{
 			Name: "WAGGLE_APP_ID",
@@ -639,6 +999,11 @@ func (rm *ResourceManager) createPodTemplateSpecForPlugin(pr *datatype.PluginRun
 			Name:  "WAGGLE_SCOREBOARD",
 			Value: "wes-scoreboard.default.svc.cluster.local",
 		},
+		// States that science rules of the job set are under the prefix
+		{
+			Name:  "WAGGLE_SCOREBOARD_PREFIX",
+			Value: datatype.ScoreboardPrefix(pr.Plugin.JobID),
+		},
 		{
 			Name: "HOST",
 			ValueFrom: &apiv1.EnvVarSource{
@@ -766,36 +1131,13 @@ func (rm *ResourceManager) createPodTemplateSpecForPlugin(pr *datatype.PluginRun
 		})
 	}
 
-	// Mount volumes if specifiedif
-	// WARNING: This holds a potential security problem because this can mount
-	//     system directories into the container. This feature should remain
-	//     disabled until we resolve this security problem.
-	// NOTE: We check if the source volume is owned by root. For security,
-	// 	we DO NOT allow mounting root-owned volumes into container.
-	// volumeCount := 1
-	// for from, to := range pr.Plugin.PluginSpec.Volume {
-	// 	// TODO: We need to check the owner of the directory! This can raise a security problem.
-	// 	// if result, err := IsOwnedByRoot(from); err != nil {
-	// 	// 	return v1.PodTemplateSpec{}, err
-	// 	// } else if !result {
-	// 	// 	return v1.PodTemplateSpec{}, fmt.Errorf("volume %q is owned by root; for security, we do not mount root-owned directories", from)
-	// 	// }
-	// 	name := fmt.Sprintf("uservolume-%d", volumeCount)
-	// 	volumeCount += 1
-	// 	volumes = append(volumes, apiv1.Volume{
-	// 		Name: name,
-	// 		VolumeSource: apiv1.VolumeSource{
-	// 			HostPath: &apiv1.HostPathVolumeSource{
-	// 				Path: from,
-	// 				Type: &hostPathDirectoryOrCreate,
-	// 			},
-	// 		},
-	// 	})
-	// 	volumeMounts = append(volumeMounts, apiv1.VolumeMount{
-	// 		Name:      name,
-	// 		MountPath: to,
-	// 	})
-	// }
+	// mount volumes the plugin asks for
+	userVolumes, userVolumeMounts, err := rm.volumesForPlugin(pr, volumeMounts)
+	if err != nil {
+		return v1.PodTemplateSpec{}, err
+	}
+	volumes = append(volumes, userVolumes...)
+	volumeMounts = append(volumeMounts, userVolumeMounts...)
 
 	appMeta := struct {
 		Host   string `json:"host"`
@@ -882,7 +1224,7 @@ func (rm *ResourceManager) createPodTemplateSpecForPlugin(pr *datatype.PluginRun
 
 	// add plugin-controller sidecar container
 	if pr.EnablePluginController {
-		logger.Info.Printf("plugin-controller sidecar is added to %s", pr.Plugin.Name)
+		rmLog.With(pr.LogFields()).Infof("plugin-controller sidecar is added to %s", pr.Plugin.Name)
 		pluginControllerArgs := []string{
 			"--enable-cpu-performance",
 			// Disabling metrics publishing since plugin-controller:0.3.0
@@ -891,13 +1233,13 @@ func (rm *ResourceManager) createPodTemplateSpecForPlugin(pr *datatype.PluginRun
 		}
 		if len(containers[0].Command) >= 1 {
 			pluginProcessName := containers[0].Command[0]
-			logger.Info.Printf("user specified plugin process (%s). it will be passed to the plugin-controller", pluginProcessName)
+			rmLog.Infof("user specified plugin process (%s). it will be passed to the plugin-controller", pluginProcessName)
 			pluginControllerArgs = append(pluginControllerArgs, "--plugin-process-name", pluginProcessName)
 		}
 		// Disabling GPU metrics publishing until we use the metrics for control
 		// See more in https://github.com/waggle-sensor/plugin-controller/releases/tag/0.3.0
 		// if _, found := pr.Plugin.PluginSpec.Selector["resource.gpu"]; found {
-		// 	logger.Info.Printf("%s's plugin-controller will collect GPU performance", pr.Plugin.Name)
+		// 	rmLog.Infof("%s's plugin-controller will collect GPU performance", pr.Plugin.Name)
 		// 	pluginControllerArgs = append(pluginControllerArgs, "--enable-gpu-performance")
 		// }
 		// adding plugin-controller to the pod
@@ -1108,7 +1450,7 @@ func (rm *ResourceManager) CreateDataConfigMap(configName string, datashims []*d
 	for _, c := range configMaps.Items {
 		if c.Name == configName {
 			// TODO: May want to renew the existing one
-			logger.Info.Printf("ConfigMap %s already exists", configName)
+			rmLog.Infof("ConfigMap %s already exists", configName)
 			return nil
 		}
 	}
@@ -1131,7 +1473,7 @@ func (rm *ResourceManager) UpdatePod(pod *apiv1.Pod, forceToUpdate bool) error {
 	if _, err := pods.Get(ctx, pod.Name, metav1.GetOptions{}); err == nil {
 		if _, err := pods.Update(ctx, pod, metav1.UpdateOptions{}); err != nil {
 			if forceToUpdate {
-				logger.Info.Printf("updating Pod %q failed: %s. forceToUpdate enabled. attempting to delete it before creating.", pod.Name, err.Error())
+				rmLog.WithField("pod", pod.Name).Infof("updating Pod %q failed: %s. forceToUpdate enabled. attempting to delete it before creating.", pod.Name, err.Error())
 				if err := pods.Delete(ctx, pod.Name, metav1.DeleteOptions{}); err != nil {
 					return err
 				}
@@ -1162,7 +1504,7 @@ func (rm *ResourceManager) UpdateJob(job *batchv1.Job, forceToUpdate bool) error
 	if _, err := jobs.Get(ctx, job.Name, metav1.GetOptions{}); err == nil {
 		if _, err := jobs.Update(ctx, job, metav1.UpdateOptions{}); err != nil {
 			if forceToUpdate {
-				logger.Info.Printf("updating Job %q failed: %s. forceToUpdate enabled. attempting to delete it before creating.", job.Name, err.Error())
+				rmLog.Infof("updating Job %q failed: %s. forceToUpdate enabled. attempting to delete it before creating.", job.Name, err.Error())
 				if err := jobs.Delete(ctx, job.Name, metav1.DeleteOptions{}); err != nil {
 					return err
 				}
@@ -1187,7 +1529,7 @@ func (rm *ResourceManager) UpdateDeployment(deployment *appsv1.Deployment, force
 	if _, err := deployments.Get(ctx, deployment.Name, metav1.GetOptions{}); err == nil {
 		if _, err := deployments.Update(ctx, deployment, metav1.UpdateOptions{}); err != nil {
 			if forceToUpdate {
-				logger.Info.Printf("updating Deployment %q failed: %s. forceToUpdate enabled. attempting to delete it before creating.", deployment.Name, err.Error())
+				rmLog.Infof("updating Deployment %q failed: %s. forceToUpdate enabled. attempting to delete it before creating.", deployment.Name, err.Error())
 				if err := deployments.Delete(ctx, deployment.Name, metav1.DeleteOptions{}); err != nil {
 					return err
 				}
@@ -1211,7 +1553,7 @@ func (rm *ResourceManager) UpdateDaemonSet(daemonSet *appsv1.DaemonSet, forceToU
 	if _, err := daemonSets.Get(ctx, daemonSet.Name, metav1.GetOptions{}); err == nil {
 		if _, err := daemonSets.Update(ctx, daemonSet, metav1.UpdateOptions{}); err != nil {
 			if forceToUpdate {
-				logger.Info.Printf("updating DaemonSet %q failed: %s. forceToUpdate enabled. attempting to delete it before creating.", daemonSet.Name, err.Error())
+				rmLog.Infof("updating DaemonSet %q failed: %s. forceToUpdate enabled. attempting to delete it before creating.", daemonSet.Name, err.Error())
 				if err := daemonSets.Delete(ctx, daemonSet.Name, metav1.DeleteOptions{}); err != nil {
 					return err
 				}
@@ -1243,9 +1585,9 @@ func (rm *ResourceManager) LaunchPlugin(deployment *appsv1.Deployment) error {
 	deploymentsClient := rm.Clientset.AppsV1().Deployments(rm.Namespace)
 	result, err := deploymentsClient.Create(ctx, deployment, metav1.CreateOptions{})
 	if err != nil {
-		logger.Error.Printf("Failed to create deployment %s.\n", err)
+		rmLog.Errorf("Failed to create deployment %s.\n", err)
 	}
-	logger.Info.Printf("Created deployment for plugin %q\n", result.GetObjectMeta().GetName())
+	rmLog.Infof("Created deployment for plugin %q\n", result.GetObjectMeta().GetName())
 	return err
 }
 
@@ -1296,7 +1638,7 @@ func (rm *ResourceManager) TerminateDeployment(pluginName string) error {
 		}
 	}
 	if !exists {
-		logger.Error.Printf("Could not terminate plugin %s: not exist", pluginNameInLowcase)
+		rmLog.Errorf("Could not terminate plugin %s: not exist", pluginNameInLowcase)
 		return nil
 	}
 
@@ -1307,7 +1649,7 @@ func (rm *ResourceManager) TerminateDeployment(pluginName string) error {
 	}); err != nil {
 		return err
 	}
-	logger.Info.Printf("Deleted deployment of plugin %s", pluginNameInLowcase)
+	rmLog.Infof("Deleted deployment of plugin %s", pluginNameInLowcase)
 	return err
 }
 
@@ -1385,7 +1727,7 @@ func (rm *ResourceManager) GetContainerLastLog(podName string, containerName str
 			if err == io.EOF {
 				break
 			} else {
-				logger.Error.Printf("error on reading plugin's %q container %q log: %s", podName, containerName, err.Error())
+				rmLog.Errorf("error on reading plugin's %q container %q log: %s", podName, containerName, err.Error())
 				return "", err
 			}
 		}
@@ -1419,9 +1761,9 @@ func (rm *ResourceManager) CleanUp() error {
 		if strings.Contains(pod.Name, "wes") {
 			continue
 		}
-		logger.Info.Printf("status of pod %q: %s", pod.Name, pod.Status.Phase)
+		rmLog.WithField("pod", pod.Name).Infof("status of pod %q: %s", pod.Name, pod.Status.Phase)
 		rm.TerminatePod(pod.Name)
-		logger.Info.Printf("pod %q terminated successfully", pod.Name)
+		rmLog.WithField("pod", pod.Name).Infof("pod %q terminated successfully", pod.Name)
 	}
 	return nil
 }
@@ -1431,10 +1773,11 @@ func (rm *ResourceManager) CleanUp() error {
 //
 // Deprecated: use Kubernetes Informer instead.
 func (rm *ResourceManager) LaunchAndWatchPlugin(pr *datatype.PluginRuntime) {
-	logger.Debug.Printf("Running plugin %q...", pr.Plugin.Name)
+	log := rmLog.With(pr.LogFields())
+	log.Debugf("Running plugin %q...", pr.Plugin.Name)
 	pod, err := rm.CreatePodTemplate(pr)
 	if err != nil {
-		logger.Error.Printf("Failed to create Kubernetes Pod for %q: %q", pr.Plugin.Name, err.Error())
+		log.Errorf("Failed to create Kubernetes Pod for %q: %q", pr.Plugin.Name, err.Error())
 		rm.Notifier.Notify(datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusFailed).AddReason(err.Error()).AddPluginMeta(pr.Plugin).Build())
 		return
 	}
@@ -1442,21 +1785,22 @@ func (rm *ResourceManager) LaunchAndWatchPlugin(pr *datatype.PluginRuntime) {
 	if pr.Plugin.JobID != "" {
 		pod.SetName(fmt.Sprintf("%s-%s", pod.GetName(), pr.Plugin.JobID))
 	}
+	log = log.WithField("pod", pod.Name)
 	err = rm.CreatePod(pod)
 	defer rm.TerminatePod(pod.Name)
 	if err != nil {
-		logger.Error.Printf("Failed to run %q: %q", pod.Name, err.Error())
+		log.Errorf("Failed to run %q: %q", pod.Name, err.Error())
 		rm.Notifier.Notify(datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusFailed).AddReason(err.Error()).AddPluginMeta(pr.Plugin).Build())
 		return
 	}
-	logger.Info.Printf("Plugin %q is scheduled", pod.Name)
+	log.Infof("Plugin %q is scheduled", pod.Name)
 	pr.Plugin.PluginSpec.Job = pod.Name
 	// NOTE: The for loop helps to re-connect to Kubernetes watcher when the connection
 	//       gets closed while the plugin is running
 	for {
 		watcher, err := rm.WatchPod(pod.Name, rm.Namespace, 1)
 		if err != nil {
-			logger.Error.Printf("Failed to watch %q. Abort the execution", pod.Name)
+			log.Errorf("Failed to watch %q. Abort the execution", pod.Name)
 			rm.Notifier.Notify(datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusFailed).
 				AddReason(err.Error()).
 				AddPodMeta(pod).
@@ -1467,14 +1811,14 @@ func (rm *ResourceManager) LaunchAndWatchPlugin(pr *datatype.PluginRuntime) {
 		chanEvent := watcher.ResultChan()
 		defer watcher.Stop()
 		for event := range chanEvent {
-			logger.Debug.Printf("Plugin %s received an event %s", pod.Name, event.Type)
+			log.Debugf("Plugin %s received an event %s", pod.Name, event.Type)
 			_pod := event.Object.(*v1.Pod)
-			logger.Debug.Printf("%s: %s, %s, %s", _pod.Name, _pod.Status.Phase, _pod.Status.Reason, _pod.Status.Message)
+			log.Debugf("%s: %s, %s, %s", _pod.Name, _pod.Status.Phase, _pod.Status.Reason, _pod.Status.Message)
 			for _, i := range _pod.Status.InitContainerStatuses {
-				logger.Debug.Printf("%s: (%s) %s", _pod.Name, i.Name, &i.State)
+				log.Debugf("%s: (%s) %s", _pod.Name, i.Name, &i.State)
 			}
 			for _, c := range _pod.Status.ContainerStatuses {
-				logger.Debug.Printf("%s: (%s) %s", _pod.Name, c.Name, &c.State)
+				log.Debugf("%s: (%s) %s", _pod.Name, c.Name, &c.State)
 			}
 			switch event.Type {
 			case watch.Added:
@@ -1498,7 +1842,7 @@ func (rm *ResourceManager) LaunchAndWatchPlugin(pr *datatype.PluginRuntime) {
 						AddPluginMeta(pr.Plugin)
 					// first, check if the init container failed
 					if len(_pod.Status.InitContainerStatuses) < 1 {
-						logger.Error.Printf("init container of %s does not exist: %s (%s)", _pod.Name, _pod.Status.Reason, _pod.Status.Message)
+						log.Errorf("init container of %s does not exist: %s (%s)", _pod.Name, _pod.Status.Reason, _pod.Status.Message)
 						// Pod failed even before the init container finishes
 						rm.Notifier.Notify(eventBuilder.
 							AddReason(fmt.Sprintf("pod failed: %s", _pod.Status.Reason)).
@@ -1508,7 +1852,7 @@ func (rm *ResourceManager) LaunchAndWatchPlugin(pr *datatype.PluginRuntime) {
 					}
 					initContainerStatus := _pod.Status.InitContainerStatuses[0]
 					if t := initContainerStatus.State.Terminated; t == nil {
-						logger.Error.Printf("pod failed before init container of %s terminates: %s (%s)", _pod.Name, _pod.Status.Reason, _pod.Status.Message)
+						log.Errorf("pod failed before init container of %s terminates: %s (%s)", _pod.Name, _pod.Status.Reason, _pod.Status.Message)
 						// Pod failed even before the init container finishes
 						rm.Notifier.Notify(eventBuilder.
 							AddReason(fmt.Sprintf("pod failed: %s", _pod.Status.Reason)).
@@ -1518,11 +1862,11 @@ func (rm *ResourceManager) LaunchAndWatchPlugin(pr *datatype.PluginRuntime) {
 					} else {
 						if t.ExitCode != 0 {
 							// init container terminated with an error
-							logger.Error.Printf("init container of %s has failed: %s", _pod.Name, t.String())
+							log.Errorf("init container of %s has failed: %s", _pod.Name, t.String())
 							if containerLog, err := rm.GetContainerLastLog(_pod.Name, initContainerStatus.Name, 1024); err == nil {
 								eventBuilder = eventBuilder.AddEntry("error_log", containerLog)
 							} else {
-								logger.Error.Printf("failed to get plugin %q container %q log: %s", _pod.Name, initContainerStatus.Name, err.Error())
+								log.Errorf("failed to get plugin %q container %q log: %s", _pod.Name, initContainerStatus.Name, err.Error())
 							}
 							rm.Notifier.Notify(eventBuilder.
 								AddReason("init container failed").
@@ -1536,7 +1880,7 @@ func (rm *ResourceManager) LaunchAndWatchPlugin(pr *datatype.PluginRuntime) {
 					if len(_pod.Status.ContainerStatuses) < 2 {
 						// NOTE: this should not happen; PodFailure only occurs when all containers terminated
 						// Pod must have 2 containers: plugin and its controller
-						logger.Error.Printf("pod must have plugin and its controller containers for %s", _pod.Name)
+						log.Errorf("pod must have plugin and its controller containers for %s", _pod.Name)
 						rm.Notifier.Notify(eventBuilder.
 							AddReason(fmt.Sprintf("pod failed: %s", _pod.Status.Reason)).
 							AddEntry("err_msg", _pod.Status.Message).
@@ -1557,7 +1901,7 @@ func (rm *ResourceManager) LaunchAndWatchPlugin(pr *datatype.PluginRuntime) {
 					}
 					if t := pluginStatus.State.Terminated; t == nil {
 						// NOTE: This should not happen as PodFailure means all containers were terminated
-						logger.Error.Printf("Pod failed, but plugin %q did not", _pod.Name)
+						log.Errorf("Pod failed, but plugin %q did not", _pod.Name)
 						rm.Notifier.Notify(eventBuilder.
 							AddReason("pod failed, but plugin did not terminate").
 							Build())
@@ -1567,7 +1911,7 @@ func (rm *ResourceManager) LaunchAndWatchPlugin(pr *datatype.PluginRuntime) {
 							// only for debugging purpose
 							if pcStatus := pluginControllerStatus.State.Terminated; pcStatus != nil {
 								containerLog, _ := rm.GetContainerLastLog(_pod.Name, initContainerStatus.Name, 1024)
-								logger.Error.Printf("%s's plugin controller failed: exitcode: %d, reason: %s, message: %s, log: %s",
+								log.Errorf("%s's plugin controller failed: exitcode: %d, reason: %s, message: %s, log: %s",
 									_pod.Name,
 									pcStatus.ExitCode,
 									pcStatus.Reason,
@@ -1575,18 +1919,18 @@ func (rm *ResourceManager) LaunchAndWatchPlugin(pr *datatype.PluginRuntime) {
 									containerLog,
 								)
 							}
-							logger.Info.Printf("Pod failed, but plugin %q succeeded", _pod.Name)
+							log.Infof("Pod failed, but plugin %q succeeded", _pod.Name)
 							rm.Notifier.Notify(datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusComplete).
 								AddPodMeta(_pod).
 								AddPluginMeta(pr.Plugin).
 								Build())
 							return
 						} else {
-							logger.Error.Printf("Plugin %q has failed", _pod.Name)
+							log.Errorf("Plugin %q has failed", _pod.Name)
 							if containerLog, err := rm.GetContainerLastLog(_pod.Name, pluginStatus.Name, 1024); err == nil {
 								eventBuilder = eventBuilder.AddEntry("error_log", containerLog)
 							} else {
-								logger.Error.Printf("failed to get plugin %q container %q log: %s", _pod.Name, pluginStatus.Name, err.Error())
+								log.Errorf("failed to get plugin %q container %q log: %s", _pod.Name, pluginStatus.Name, err.Error())
 							}
 							rm.Notifier.Notify(eventBuilder.
 								AddReason(t.Reason).
@@ -1597,7 +1941,7 @@ func (rm *ResourceManager) LaunchAndWatchPlugin(pr *datatype.PluginRuntime) {
 					}
 				}
 			case watch.Deleted:
-				logger.Debug.Printf("Plugin got deleted. Returning resource and notify")
+				log.Debugf("Plugin got deleted. Returning resource and notify")
 				rm.Notifier.Notify(datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusFailed).
 					AddReason("Plugin deleted").
 					AddPodMeta(_pod).
@@ -1605,7 +1949,7 @@ func (rm *ResourceManager) LaunchAndWatchPlugin(pr *datatype.PluginRuntime) {
 					Build())
 				return
 			case watch.Error:
-				logger.Debug.Printf("Error on watcher. Returning resource and notify")
+				log.Debugf("Error on watcher. Returning resource and notify")
 				rm.Notifier.Notify(datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusFailed).
 					AddReason("Error on watcher").
 					AddPodMeta(_pod).
@@ -1613,26 +1957,26 @@ func (rm *ResourceManager) LaunchAndWatchPlugin(pr *datatype.PluginRuntime) {
 					Build())
 				return
 			default:
-				logger.Error.Printf("Watcher of plugin %q received unknown event %q", _pod.Name, event.Type)
+				log.Errorf("Watcher of plugin %q received unknown event %q", _pod.Name, event.Type)
 			}
 		}
 		watcher.Stop()
-		logger.Error.Printf("Watcher of the plugin %s is unexpectedly closed. ", pod.Name)
+		log.Errorf("Watcher of the plugin %s is unexpectedly closed. ", pod.Name)
 		// when a pod becomes unhealthy (e.g., a host device of the pod disconnected) the watcher
 		// gets closed, but the job remains valid in the cluster and never runs the pod again.
 		// To get out from this loop, we check if the pod is running, if not, we should terminate the plugin
 		// if pod, err := rm.GetPod(job.Name); err != nil {
-		// 	logger.Error.Printf("failed to get status of pod for job %q: %s", job.Name, err.Error())
+		// 	log.Errorf("failed to get status of pod for job %q: %s", job.Name, err.Error())
 		// 	rm.Notifier.Notify(datatype.NewEventBuilder(datatype.EventPluginStatusFailed).AddReason("pod no longer exist").AddK3SJobMeta(job).AddPluginMeta(&pr.Plugin).Build())
 		// 	return
 		// } else {
 		// 	if pod.Status.Phase != apiv1.PodRunning {
-		// 		logger.Error.Printf("pod %q is not running for job %q. Closing plugin", pod.Name, job.Name)
+		// 		log.Errorf("pod %q is not running for job %q. Closing plugin", pod.Name, job.Name)
 		// 		rm.Notifier.Notify(datatype.NewEventBuilder(datatype.EventPluginStatusFailed).AddReason("pod no longer running").AddK3SJobMeta(job).AddPluginMeta(&pr.Plugin).AddPodMeta(pod).Build())
 		// 		return
 		// 	}
 		// }
-		logger.Info.Printf("attemping to re-connect for pod %q", pod.Name)
+		log.Infof("attemping to re-connect for pod %q", pod.Name)
 	}
 }
 
@@ -1658,7 +2002,7 @@ func (rm *ResourceManager) RunGabageCollector() error {
 		case apiv1.PodSucceeded:
 			elapsedSeconds := time.Now().Sub(job.CreationTimestamp.Time).Seconds()
 			if elapsedSeconds > float64(ttlSecondsAfterFinished) {
-				logger.Debug.Printf("%q exceeded ttlSeconds of %.2f. Cleaning up...", job.Name, elapsedSeconds)
+				rmLog.Debugf("%q exceeded ttlSeconds of %.2f. Cleaning up...", job.Name, elapsedSeconds)
 				rm.TerminateJob(job.Name)
 			}
 		}
@@ -1752,8 +2096,11 @@ func (rm *ResourceManager) Configure() (err error) {
 		return
 	}
 
-	logger.Info.Println("Attempting to clean up all plugins before starting scheduling...")
+	rmLog.Info("Attempting to clean up all plugins before starting scheduling...")
 	rm.CleanUp()
+	if err := rm.RevokeStalePluginCredentials(); err != nil {
+		rmLog.Errorf("Failed to revoke stale plugin credentials: %s", err.Error())
+	}
 
 	servicesToBringUp := []string{"wes-rabbitmq", "wes-audio-server", "wes-scoreboard", "wes-app-meta-cache"}
 	for _, service := range servicesToBringUp {
@@ -1766,7 +2113,7 @@ func (rm *ResourceManager) Configure() (err error) {
 	for _, configMapName := range configMapsToBring {
 		err = rm.CopyConfigMap(configMapName, "default", rm.Namespace)
 		if err != nil {
-			logger.Error.Printf("Failed to create ConfigMap %q: %q", configMapName, err.Error())
+			rmLog.Errorf("Failed to create ConfigMap %q: %q", configMapName, err.Error())
 		}
 	}
 	err = rm.CreateConfigMap(configMapNameForGoals, map[string]string{}, "default", false)
@@ -1779,7 +2126,7 @@ func (rm *ResourceManager) Configure() (err error) {
 
 func (rm *ResourceManager) Run() {
 	if rm.MetricsClient == nil {
-		logger.Info.Println("No metrics client is set. Metrics information cannot be obtained")
+		rmLog.Info("No metrics client is set. Metrics information cannot be obtained")
 	}
 
 	// metricsTicker := time.NewTicker(5 * time.Second)
@@ -1789,43 +2136,43 @@ func (rm *ResourceManager) Run() {
 	//       via k3s server --kube-control-manager-arg feature-gates=TTL...=true
 	// go ns.ResourceManager.RunGabageCollector()
 	// gabageCollectorTicker := time.NewTicker(1 * time.Minute)
-	// logger.Info.Printf("Pull goals from k3s configmap %s", configMapNameForGoals)
+	// rmLog.Infof("Pull goals from k3s configmap %s", configMapNameForGoals)
 	// goalConfigMapFunc, _ := rm.GetConfigMapWatcher(configMapNameForGoals, rm.Namespace)
 	// goalWatcher := NewAdvancedWatcher(configMapNameForGoals, goalConfigMapFunc)
 	// goalWatcher.Run()
-	// logger.Info.Println("Starting the main loop of resource manager...")
+	// rmLog.Info("Starting the main loop of resource manager...")
 	// for {
 	// 	select {
 	// 	// case <-gabageCollectorTicker.C:
 	// 	// 	err := rm.RunGabageCollector()
 	// 	// 	if err != nil {
-	// 	// 		logger.Error.Printf("Failed to run gabage collector: %s", err.Error())
+	// 	// 		rmLog.Errorf("Failed to run gabage collector: %s", err.Error())
 	// 	// 	}
 	// 	case event := <-goalWatcher.C:
 	// 		switch event.Type {
 	// 		case watch.Added, watch.Modified:
 	// 			if updatedConfigMap, ok := event.Object.(*apiv1.ConfigMap); ok {
-	// 				logger.Debug.Printf("%v", updatedConfigMap.Data)
+	// 				rmLog.Debugf("%v", updatedConfigMap.Data)
 	// 				event := datatype.NewSchedulerEventBuilder(datatype.EventGoalStatusReceivedBulk).
 	// 					AddEntry("goals", updatedConfigMap.Data["goals"]).Build()
 	// 				rm.Notifier.Notify(event)
 	// 			}
 	// 		}
 	// 		// case watch.Deleted, watch.Error:
-	// 		// 	logger.Error.Printf("Failed on %q k3s watcher", configMapName)
+	// 		// 	rmLog.Errorf("Failed on %q k3s watcher", configMapName)
 	// 		// 	break
 	// 		// }
 	// 		// case <-metricsTicker.C:
 	// 		// 	nodeMetrics, err := rm.MetricsClient.MetricsV1beta1().NodeMetricses().List(context.TODO(), metav1.ListOptions{})
 	// 		// 	if err != nil {
-	// 		// 		logger.Error.Println("Error:", err)
+	// 		// 		rmLog.Error("Error:", err)
 	// 		// 		return
 	// 		// 	}
 	// 		// 	for _, nodeMetric := range nodeMetrics.Items {
 	// 		// 		cpuQuantity := nodeMetric.Usage.Cpu().String()
 	// 		// 		memQuantity := nodeMetric.Usage.Memory().String()
 	// 		// 		msg := fmt.Sprintf("Node Name: %s \n CPU usage: %s \n Memory usage: %s", nodeMetric.Name, cpuQuantity, memQuantity)
-	// 		// 		logger.Debug.Println(msg)
+	// 		// 		rmLog.Debug(msg)
 	// 		// 	}
 	// 		// podMetrics, err := rm.MetricsClient.MetricsV1beta1().PodMetricses(rm.Namespace).List(context.TODO(), metav1.ListOptions{})
 	// 		// 	for _, podMetric := range podMetrics.Items {
@@ -1834,7 +2181,7 @@ func (rm *ResourceManager) Run() {
 	// 		// 			cpuQuantity := container.Usage.Cpu().String()
 	// 		// 			memQuantity := container.Usage.Memory().String()
 	// 		// 			msg := fmt.Sprintf("Container Name: %s \n CPU usage: %s \n Memory usage: %s", container.Name, cpuQuantity, memQuantity)
-	// 		// 			logger.Debug.Println(msg)
+	// 		// 			rmLog.Debug(msg)
 	// 		// 		}
 	// 		// 	}
 	// 	}
@@ -1842,7 +2189,7 @@ func (rm *ResourceManager) Run() {
 	// for {
 	// nodeMetrics, err := rm.MetricsClient.MetricsV1beta1().NodeMetricses().List(context.TODO(), metav1.ListOptions{})
 	// 	if err != nil {
-	// 		logger.Error.Println("Error:", err)
+	// 		rmLog.Error("Error:", err)
 	// 		return
 	// 	}
 	// 	for _, nodeMetric := range nodeMetrics.Items {
@@ -1852,12 +2199,12 @@ func (rm *ResourceManager) Run() {
 	// 			return
 	// 		}
 	// 		msg := fmt.Sprintf("Node Name: %s \n CPU usage: %d \n Memory usage: %d", nodeMetric.Name, cpuQuantity, memQuantity)
-	// 		logger.Debug.Println(msg)
+	// 		rmLog.Debug(msg)
 	// 	}
 	// }
 	// podMetrics, err := rm.MetricsClient.MetricsV1beta1().PodMetricses(rm.Namespace).List(context.TODO(), metav1.ListOptions{})
 	// if err != nil {
-	// 	logger.Error.Println("Error:", err)
+	// 	rmLog.Error("Error:", err)
 	// 	return
 	// }
 	// for _, podMetric := range podMetrics.Items {
@@ -1869,7 +2216,7 @@ func (rm *ResourceManager) Run() {
 	// 			return
 	// 		}
 	// 		msg := fmt.Sprintf("Container Name: %s \n CPU usage: %d \n Memory usage: %d", container.Name, cpuQuantity, memQuantity)
-	// 		logger.Debug.Println(msg)
+	// 		rmLog.Debug(msg)
 	// 	}
 	// }
 	// 	time.Sleep(1 * time.Millisecond)
@@ -1879,7 +2226,7 @@ func (rm *ResourceManager) Run() {
 	// ERROR: 2022/01/05 13:55:48 resourcemanager.go:873: Error: the server does not allow this method on the requested resource (get pods.metrics.k8s.io)
 	// watcher, err := rm.MetricsClient.MetricsV1beta1().PodMetricses(rm.Namespace).Watch(context.TODO(), metav1.ListOptions{})
 	// if err != nil {
-	// 	logger.Error.Println("Error:", err)
+	// 	rmLog.Error("Error:", err)
 	// 	return
 	// }
 	// chanEvent := watcher.ResultChan()
@@ -1897,7 +2244,7 @@ func (rm *ResourceManager) Run() {
 	// 				return
 	// 			}
 	// 			msg := fmt.Sprintf("Container Name: %s \n CPU usage: %d \n Memory usage: %d", container.Name, cpuQuantity, memQuantity)
-	// 			logger.Debug.Println(msg)
+	// 			rmLog.Debug(msg)
 	// 		}
 	// 	}
 	// }
@@ -1905,25 +2252,25 @@ func (rm *ResourceManager) Run() {
 	// for {
 	// 	select {
 	// 	case plugin := <-chanPluginToUpdate:
-	// 		logger.Debug.Printf("Plugin status changed to %q", plugin.Status.SchedulingStatus)
+	// 		rmLog.Debugf("Plugin status changed to %q", plugin.Status.SchedulingStatus)
 	// 		switch plugin.Status.SchedulingStatus {
 	// 		case datatype.Ready:
-	// 			logger.Debug.Printf("Running the plugin %q...", plugin.Name)
+	// 			rmLog.Debugf("Running the plugin %q...", plugin.Name)
 	// 			job, err := rm.CreateJob(plugin)
 	// 			if err != nil {
-	// 				logger.Error.Printf("Failed to create Kubernetes Job for %q: %q", plugin.Name, err.Error())
+	// 				rmLog.Errorf("Failed to create Kubernetes Job for %q: %q", plugin.Name, err.Error())
 	// 			} else {
 	// 				_, err = rm.RunPlugin(job)
 	// 				if err != nil {
-	// 					logger.Error.Printf("Failed to run %q: %q", plugin.Name, err.Error())
+	// 					rmLog.Errorf("Failed to run %q: %q", plugin.Name, err.Error())
 	// 				} else {
-	// 					logger.Info.Printf("Plugin %q deployed", plugin.Name)
+	// 					rmLog.Infof("Plugin %q deployed", plugin.Name)
 	// 					plugin.UpdatePluginSchedulingStatus(datatype.Running)
 	// 					rm.UpdateReservation(true)
 	// 					go func() {
 	// 						watcher, err := rm.WatchJob(plugin.Name, rm.Namespace, 0)
 	// 						if err != nil {
-	// 							logger.Error.Printf("Failed to watch %q. Abort the execution", plugin.Name)
+	// 							rmLog.Errorf("Failed to watch %q. Abort the execution", plugin.Name)
 	// 							rm.TerminateJob(job.Name)
 	// 						}
 	// 						chanEvent := watcher.ResultChan()
@@ -1937,7 +2284,7 @@ func (rm *ResourceManager) Run() {
 	// 							case watch.Modified:
 	// 								job := event.Object.(*batchv1.Job)
 	// 								if len(job.Status.Conditions) > 0 {
-	// 									logger.Debug.Printf("%s: %s", event.Type, job.Status.Conditions[0].Type)
+	// 									rmLog.Debugf("%s: %s", event.Type, job.Status.Conditions[0].Type)
 	// 									switch job.Status.Conditions[0].Type {
 	// 									case batchv1.JobComplete:
 	// 										fallthrough
@@ -1946,7 +2293,7 @@ func (rm *ResourceManager) Run() {
 	// 										rm.UpdateReservation(false)
 	// 									}
 	// 								} else {
-	// 									logger.Debug.Printf("%s: %s", event.Type, "UNKNOWN")
+	// 									rmLog.Debugf("%s: %s", event.Type, "UNKNOWN")
 	// 								}
 	// 							}
 	// 						}
@@ -1958,27 +2305,27 @@ func (rm *ResourceManager) Run() {
 	// if plugin.Status.SchedulingStatus == datatype.Running {
 	// 	credential, err := rm.CreatePluginCredential(plugin)
 	// 	if err != nil {
-	// 		logger.Error.Printf("Could not create a plugin credential for %s on RabbitMQ at %s: %s", plugin.Name, rm.RMQManagement.Client.Endpoint, err.Error())
+	// 		rmLog.Errorf("Could not create a plugin credential for %s on RabbitMQ at %s: %s", plugin.Name, rm.RMQManagement.Client.Endpoint, err.Error())
 	// 		continue
 	// 	}
 	// 	err = rm.RMQManagement.RegisterPluginCredential(credential)
 	// 	if err != nil {
-	// 		logger.Error.Printf("Could not register the credential %s to RabbitMQ at %s: %s", credential.Username, rm.RMQManagement.Client.Endpoint, err.Error())
+	// 		rmLog.Errorf("Could not register the credential %s to RabbitMQ at %s: %s", credential.Username, rm.RMQManagement.Client.Endpoint, err.Error())
 	// 		continue
 	// 	}
 	// 	deployablePlugin, err := rm.CreateDeployment(plugin, credential)
 	// 	if err != nil {
-	// 		logger.Error.Printf("Could not create a k3s deployment for plugin %s: %s", plugin.Name, err.Error())
+	// 		rmLog.Errorf("Could not create a k3s deployment for plugin %s: %s", plugin.Name, err.Error())
 	// 		continue
 	// 	}
 	// 	err = rm.LaunchPlugin(deployablePlugin)
 	// 	if err != nil {
-	// 		logger.Error.Printf("Failed to launch plugin %s: %s", plugin.Name, err.Error())
+	// 		rmLog.Errorf("Failed to launch plugin %s: %s", plugin.Name, err.Error())
 	// 	}
 	// } else if plugin.Status.SchedulingStatus == datatype.Stopped {
 	// 	err := rm.TerminateJob(plugin.Name)
 	// 	if err != nil {
-	// 		logger.Error.Printf("Failed to stop plugin %s: %s", plugin.Name, err.Error())
+	// 		rmLog.Errorf("Failed to stop plugin %s: %s", plugin.Name, err.Error())
 	// 	}
 	// }
 	// }
@@ -2028,7 +2375,7 @@ func (w *AdvancedWatcher) Run() {
 	go func() {
 		for {
 			if err := w.runWatcher(); err != nil {
-				logger.Error.Printf("Failed on watcher %q: %s", w.Name, err.Error())
+				rmLog.Errorf("Failed on watcher %q: %s", w.Name, err.Error())
 			}
 			time.Sleep(5 * time.Second)
 		}
@@ -2129,26 +2476,59 @@ func NewRMQManagement(rmqManagementURI string, rmqManagementUsername string, rmq
 	}, nil
 }
 
+// pluginCredentialTag tags RabbitMQ users minted for plugin runs
+const pluginCredentialTag = "plugin-run"
+
+// pluginPermissions allow plugins to publish messages to the validator and subscribe
+// to data on the node through queues named by RabbitMQ, and nothing else
+var pluginPermissions = rabbithole.Permissions{
+	Configure: `^amq\.gen-.*$`,
+	Write:     `^(to-validator|amq\.gen-.*)$`,
+	Read:      `^(data\.topic|amq\.gen-.*)$`,
+}
+
+// checkRMQResponse returns an error if the management API did not accept the request
+func checkRMQResponse(res *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("RabbitMQ management returned %s", res.Status)
+	}
+	return nil
+}
+
 // RegisterPluginCredential registers given plugin credential to designated RMQ server
 func (rmq *RMQManagement) RegisterPluginCredential(credential datatype.PluginCredential) error {
 	// The functions below come from Sean's RunPlugin
-	if _, err := rmq.Client.PutUser(credential.Username, rabbithole.UserSettings{
+	if err := checkRMQResponse(rmq.Client.PutUser(credential.Username, rabbithole.UserSettings{
 		Password: credential.Password,
-	}); err != nil {
+		Tags:     pluginCredentialTag,
+	})); err != nil {
 		return err
 	}
 
-	if _, err := rmq.Client.UpdatePermissionsIn("/", credential.Username, rabbithole.Permissions{
-		Configure: "^amq.gen",
-		Read:      ".*",
-		Write:     ".*",
-	}); err != nil {
+	if err := checkRMQResponse(rmq.Client.UpdatePermissionsIn("/", credential.Username, pluginPermissions)); err != nil {
+		// the user should not stay without permissions
+		rmq.RevokePluginCredential(credential.Username)
 		return err
 	}
-	logger.Debug.Printf("Plugin credential %s:%s is registered in RabbitMQ at %s", credential.Username, credential.Password, rmq.RabbitmqManagementURI)
+	rmLog.Debugf("Plugin credential %s is registered in RabbitMQ at %s", credential.Username, rmq.RabbitmqManagementURI)
 	return nil
 }
 
+// RevokePluginCredential removes the user of the plugin credential from the RMQ server.
+// Connections of the user are closed by RabbitMQ. It is not an error if the user does not exist
+func (rmq *RMQManagement) RevokePluginCredential(username string) error {
+	res, err := rmq.Client.DeleteUser(username)
+	if err == nil && res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil
+	}
+	return checkRMQResponse(res, err)
+}
+
 func int32Ptr(i int32) *int32 { return &i }
 
 func int64Ptr(i int64) *int64 { return &i }
@@ -2206,7 +2586,7 @@ func IsOwnedByRoot(p string) (bool, error) {
 	}
 
 	mode := info.Mode()
-	logger.Info.Printf(mode.String())
+	rmLog.Infof(mode.String())
 
 	fmt.Print("Owner: ")
 	for i := 1; i < 4; i++ {
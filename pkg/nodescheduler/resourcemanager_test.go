@@ -2,12 +2,23 @@ package nodescheduler
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	rabbithole "github.com/michaelklishin/rabbit-hole"
+
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 	"gopkg.in/yaml.v2"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -65,6 +76,340 @@ func TestEnvFromSecret(t *testing.T) {
 	t.Logf("%s", out)
 }
 
+// fakeRMQManagement keeps users and their permissions like the management API of RabbitMQ
+type fakeRMQManagement struct {
+	mu          sync.Mutex
+	users       map[string]rabbithole.UserSettings
+	permissions map[string]rabbithole.Permissions
+}
+
+func (f *fakeRMQManagement) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/users/"):
+		name := strings.TrimPrefix(r.URL.Path, "/api/users/")
+		switch r.Method {
+		case http.MethodPut:
+			var u rabbithole.UserSettings
+			json.NewDecoder(r.Body).Decode(&u)
+			f.users[name] = u
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodDelete:
+			if _, exist := f.users[name]; !exist {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			delete(f.users, name)
+			delete(f.permissions, name)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case strings.HasPrefix(r.URL.Path, "/api/permissions///") && r.Method == http.MethodPut:
+		name := strings.TrimPrefix(r.URL.Path, "/api/permissions///")
+		var p rabbithole.Permissions
+		json.NewDecoder(r.Body).Decode(&p)
+		f.permissions[name] = p
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestPluginCredential(t *testing.T) {
+	f := &fakeRMQManagement{
+		users:       make(map[string]rabbithole.UserSettings),
+		permissions: make(map[string]rabbithole.Permissions),
+	}
+	server := httptest.NewServer(f)
+	defer server.Close()
+	rmq, err := NewRMQManagement(server.URL, "admin", "admin", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rm := NewFakeK3SResourceManager(nil)
+	rm.RMQManagement = rmq
+
+	pr := datatype.NewPluginRuntime(datatype.Plugin{
+		Name:   "sampler",
+		GoalID: "goal-1",
+		JobID:  "42",
+		PluginSpec: &datatype.PluginSpec{
+			Image: "waggle/sampler:0.1.0",
+		},
+	})
+	// the plugin controller publishes with the credential of the plugin
+	pr.SetPluginController(true)
+	pr.GeneratePodInstance()
+	pod, err := rm.CreatePodTemplate(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rm.AttachPluginCredential(pr, pod); err != nil {
+		t.Fatal(err)
+	}
+	username := pod.Annotations[PodAnnotationPluginCredential]
+	wantPrefix := "plugin.sampler:0.1.0."
+	if !strings.HasPrefix(username, wantPrefix) || username == wantPrefix {
+		t.Fatalf("wanted a username of the run with prefix %q but got %q", wantPrefix, username)
+	}
+	user, exist := f.users[username]
+	if !exist {
+		t.Fatalf("%q is not registered", username)
+	}
+	if user.Tags != pluginCredentialTag {
+		t.Errorf("wanted tag %q but got %q", pluginCredentialTag, user.Tags)
+	}
+	if f.permissions[username] != pluginPermissions {
+		t.Errorf("wanted permissions %v but got %v", pluginPermissions, f.permissions[username])
+	}
+	secret, err := rm.Clientset.CoreV1().Secrets(rm.Namespace).Get(context.TODO(), pluginCredentialSecretName(pod.Name), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.StringData["username"] != username || secret.StringData["password"] != user.Password {
+		t.Errorf("Secret does not hold the registered credential: %v", secret.StringData)
+	}
+	for _, c := range pod.Spec.Containers {
+		found := 0
+		for _, e := range c.Env {
+			if e.Name != "WAGGLE_PLUGIN_USERNAME" && e.Name != "WAGGLE_PLUGIN_PASSWORD" {
+				continue
+			}
+			found++
+			if e.Value != "" || e.ValueFrom == nil || e.ValueFrom.SecretKeyRef == nil || e.ValueFrom.SecretKeyRef.Name != secret.Name {
+				t.Errorf("%s of container %q is not from Secret %q: %v", e.Name, c.Name, secret.Name, e)
+			}
+		}
+		if found != 2 {
+			t.Errorf("wanted the credential in container %q but found %d variables", c.Name, found)
+		}
+	}
+
+	if err := rm.RevokePluginCredential(pod); err != nil {
+		t.Fatal(err)
+	}
+	if _, exist := f.users[username]; exist {
+		t.Errorf("%q is not revoked", username)
+	}
+	if _, err := rm.Clientset.CoreV1().Secrets(rm.Namespace).Get(context.TODO(), secret.Name, metav1.GetOptions{}); err == nil {
+		t.Errorf("Secret %q is not deleted", secret.Name)
+	}
+	// revoking again is not an error as the user is gone
+	if err := rm.RevokePluginCredential(pod); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSharedPluginCredential(t *testing.T) {
+	rm := NewFakeK3SResourceManager(nil)
+	pr := datatype.NewPluginRuntime(datatype.Plugin{
+		Name:       "sampler",
+		PluginSpec: &datatype.PluginSpec{Image: "waggle/sampler:0.1.0"},
+	})
+	pr.GeneratePodInstance()
+	pod, err := rm.CreatePodTemplate(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rm.AttachPluginCredential(pr, pod); err != nil {
+		t.Fatal(err)
+	}
+	if _, exist := pod.Annotations[PodAnnotationPluginCredential]; exist {
+		t.Errorf("wanted no credential of the run without RabbitMQ management")
+	}
+	for _, e := range pod.Spec.Containers[0].Env {
+		if e.Name == "WAGGLE_PLUGIN_USERNAME" && e.Value != "plugin" {
+			t.Errorf("wanted the shared credential but got %v", e)
+		}
+	}
+}
+
+func TestPluginVolumes(t *testing.T) {
+	configMap := func(name string, labels map[string]string) *v1.ConfigMap {
+		return &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels}}
+	}
+	rm := NewFakeK3SResourceManager([]runtime.Object{
+		configMap("my-config", map[string]string{PodLabelJobID: "42"}),
+		configMap("other-config", map[string]string{PodLabelJobID: "7"}),
+		configMap("unlabeled-config", nil),
+		configMap(configMapNameForGoals, map[string]string{PodLabelJobID: "42"}),
+	})
+	rm.VolumeHostPaths = []string{"/media/plugin-data/shared", "/etc/waggle:ro", "/media/plugin-data/shared/models:ro"}
+	// the host filesystem seen by the scheduler
+	rm.HostRoot = t.TempDir()
+	for _, dir := range []string{"media/plugin-data/shared/camera", "media/plugin-data/shared/models/yolo", "etc/waggle"} {
+		if err := os.MkdirAll(filepath.Join(rm.HostRoot, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"media/plugin-data/shared/root":   "/",
+		"media/plugin-data/shared/etc":    "/etc",
+		"media/plugin-data/shared/up":     "../../..",
+		"media/plugin-data/shared/latest": "camera",
+		"media/plugin-data/shared/yolo":   "/media/plugin-data/shared/models/yolo",
+	} {
+		if err := os.Symlink(target, filepath.Join(rm.HostRoot, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sizeLimit := resource.MustParse("512Mi")
+	tests := map[string]struct {
+		Source    string
+		MountPath string
+		Want      v1.VolumeSource
+		ReadOnly  bool
+		Error     bool
+	}{
+		"Host path": {
+			Source:    "/media/plugin-data/shared/camera",
+			MountPath: "/data",
+			Want:      v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/media/plugin-data/shared/camera", Type: &hostPathDirectory}},
+		},
+		"Read-only host path": {
+			Source:    "/etc/waggle",
+			MountPath: "/etc/waggle",
+			Want:      v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/etc/waggle", Type: &hostPathDirectory}},
+			ReadOnly:  true,
+		},
+		"Read-only under read-write": {
+			Source:    "/media/plugin-data/shared/models/yolo",
+			MountPath: "/models",
+			Want:      v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/media/plugin-data/shared/models/yolo", Type: &hostPathDirectory}},
+			ReadOnly:  true,
+		},
+		"Host path not allowed":   {Source: "/etc", MountPath: "/data", Error: true},
+		"Host path with a prefix": {Source: "/media/plugin-data/shared-secrets", MountPath: "/data", Error: true},
+		"Host path escaping":      {Source: "/media/plugin-data/shared/../../../etc", MountPath: "/data", Error: true},
+		"Host path not found":     {Source: "/media/plugin-data/shared/missing", MountPath: "/data", Error: true},
+		"Symlink to the root":     {Source: "/media/plugin-data/shared/root", MountPath: "/data", Error: true},
+		"Path under symlink to the root": {
+			Source:    "/media/plugin-data/shared/root/etc/waggle",
+			MountPath: "/etc/waggle",
+			Want:      v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/etc/waggle", Type: &hostPathDirectory}},
+			ReadOnly:  true,
+		},
+		"Symlink out of allowed":          {Source: "/media/plugin-data/shared/etc", MountPath: "/data", Error: true},
+		"Relative symlink out of allowed": {Source: "/media/plugin-data/shared/up", MountPath: "/data", Error: true},
+		"Relative symlink": {
+			Source:    "/media/plugin-data/shared/latest",
+			MountPath: "/data",
+			Want:      v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/media/plugin-data/shared/camera", Type: &hostPathDirectory}},
+		},
+		"Symlink to read-only": {
+			Source:    "/media/plugin-data/shared/yolo",
+			MountPath: "/models",
+			Want:      v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/media/plugin-data/shared/models/yolo", Type: &hostPathDirectory}},
+			ReadOnly:  true,
+		},
+		"Scratch": {
+			Source:    "scratch",
+			MountPath: "/scratch",
+			Want:      v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/media/plugin-data/scratch/42", Type: &hostPathDirectoryOrCreate}},
+		},
+		"ConfigMap": {
+			Source:    "configmap=my-config",
+			MountPath: "/etc/config",
+			Want:      v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: "my-config"}}},
+			ReadOnly:  true,
+		},
+		"ConfigMap named after the job": {
+			Source:    "configmap=42-config",
+			MountPath: "/etc/config",
+			Want:      v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: "42-config"}}},
+			ReadOnly:  true,
+		},
+		"ConfigMap of another job":   {Source: "configmap=other-config", MountPath: "/etc/config", Error: true},
+		"ConfigMap without job":      {Source: "configmap=unlabeled-config", MountPath: "/etc/config", Error: true},
+		"ConfigMap not found":        {Source: "configmap=missing-config", MountPath: "/etc/config", Error: true},
+		"ConfigMap of the scheduler": {Source: "configmap=" + configMapNameForGoals, MountPath: "/etc/config", Error: true},
+		"ConfigMap of the node":      {Source: "configmap=waggle-data-config", MountPath: "/etc/config", Error: true},
+		"EmptyDir": {
+			Source:    "emptydir=512Mi",
+			MountPath: "/tmp/work",
+			Want:      v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{SizeLimit: &sizeLimit}},
+		},
+		"Overlapping the scheduler": {Source: "scratch", MountPath: "/run/waggle", Error: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			pr := datatype.NewPluginRuntime(datatype.Plugin{
+				Name:  "sampler",
+				JobID: "42",
+				PluginSpec: &datatype.PluginSpec{
+					Image:  "waggle/sampler:0.1.0",
+					Volume: map[string]string{test.Source: test.MountPath},
+				},
+			})
+			template, err := rm.createPodTemplateSpecForPlugin(pr)
+			if test.Error {
+				if err == nil {
+					t.Errorf("wanted error but got volumes %v", template.Spec.Volumes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var volume *v1.Volume
+			for i := range template.Spec.Volumes {
+				if template.Spec.Volumes[i].Name == "uservolume-1" {
+					volume = &template.Spec.Volumes[i]
+				}
+			}
+			if volume == nil {
+				t.Fatalf("volume is not found in %v", template.Spec.Volumes)
+			}
+			if !reflect.DeepEqual(volume.VolumeSource, test.Want) {
+				t.Errorf("wanted %+v but got %+v", test.Want, volume.VolumeSource)
+			}
+			found := false
+			for _, m := range template.Spec.Containers[0].VolumeMounts {
+				if m.Name == volume.Name {
+					found = true
+					if m.MountPath != test.MountPath || m.ReadOnly != test.ReadOnly {
+						t.Errorf("wanted %s (read-only %t) but got %s (read-only %t)", test.MountPath, test.ReadOnly, m.MountPath, m.ReadOnly)
+					}
+				}
+			}
+			if !found {
+				t.Errorf("volume is not mounted in the plugin")
+			}
+		})
+	}
+}
+
+func TestPluginVolumesWithoutHostRoot(t *testing.T) {
+	rm := NewFakeK3SResourceManager(nil)
+	rm.VolumeHostPaths = []string{"/media/plugin-data/shared"}
+	tests := map[string]struct {
+		Source string
+		Error  bool
+	}{
+		"Allowed path":       {Source: "/media/plugin-data/shared"},
+		"Path under allowed": {Source: "/media/plugin-data/shared/camera", Error: true},
+		"Host path escaping": {Source: "/media/plugin-data/shared/../../../etc", Error: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			pr := datatype.NewPluginRuntime(datatype.Plugin{
+				Name:  "sampler",
+				JobID: "42",
+				PluginSpec: &datatype.PluginSpec{
+					Image:  "waggle/sampler:0.1.0",
+					Volume: map[string]string{test.Source: "/data"},
+				},
+			})
+			_, err := rm.createPodTemplateSpecForPlugin(pr)
+			if test.Error && err == nil {
+				t.Errorf("wanted error for %q", test.Source)
+			} else if !test.Error && err != nil {
+				t.Errorf("wanted no error but got %s", err.Error())
+			}
+		})
+	}
+}
+
 // TestFakeClient demonstrates how to use a fake client with SharedInformerFactory in tests.
 func TestFakeClient(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
@@ -0,0 +1,101 @@
+package nodescheduler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/sciencerule"
+)
+
+// ruleInput is new data of an input that event-driven rules read. Publisher is
+// the job and goal whose rule published or set the data, or empty if the data came
+// from elsewhere, e.g. plugins
+type ruleInput struct {
+	Dependency sciencerule.Dependency
+	Publisher  string
+}
+
+// ruleInputPublisher returns the publisher of rule inputs published by rules of the goal
+func ruleInputPublisher(jobID string, goalID string) string {
+	if jobID == "" || goalID == "" {
+		return ""
+	}
+	return jobID + "/" + goalID
+}
+
+// pendingRuleInputs collects inputs arriving together and who published them
+type pendingRuleInputs map[sciencerule.Dependency]map[string]bool
+
+func (p pendingRuleInputs) add(in ruleInput) {
+	publishers, exist := p[in.Dependency]
+	if !exist {
+		publishers = make(map[string]bool)
+		p[in.Dependency] = publishers
+	}
+	publishers[in.Publisher] = true
+}
+
+// dependencies returns all the pending inputs
+func (p pendingRuleInputs) dependencies() map[sciencerule.Dependency]bool {
+	deps := make(map[sciencerule.Dependency]bool, len(p))
+	for dep := range p {
+		deps[dep] = true
+	}
+	return deps
+}
+
+// dependenciesFor returns the inputs that re-evaluate rules of the goal. Data that
+// only the goal itself published or set is left out so that a rule writing what it
+// reads does not fire itself over and over
+func (p pendingRuleInputs) dependenciesFor(jobID string, goalID string) map[sciencerule.Dependency]bool {
+	self := ruleInputPublisher(jobID, goalID)
+	deps := make(map[sciencerule.Dependency]bool, len(p))
+	for dep, publishers := range p {
+		for publisher := range publishers {
+			if publisher == "" || publisher != self {
+				deps[dep] = true
+				break
+			}
+		}
+	}
+	return deps
+}
+
+// recentWrites remembers scoreboard keys that the scheduler wrote. Keyspace events
+// of the keys are dropped for a while as the scheduler already notified rules of
+// the writes along with the goal that wrote them
+type recentWrites struct {
+	mu             sync.Mutex
+	window         time.Duration
+	writtenAt      map[string]time.Time
+	getCurrentTime func() time.Time
+}
+
+func newRecentWrites(window time.Duration) *recentWrites {
+	return &recentWrites{
+		window:         window,
+		writtenAt:      make(map[string]time.Time),
+		getCurrentTime: time.Now,
+	}
+}
+
+// add records that the scheduler is writing the key
+func (w *recentWrites) add(key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writtenAt[key] = w.getCurrentTime()
+}
+
+// has returns true if the scheduler wrote the key within the window
+func (w *recentWrites) has(key string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := w.getCurrentTime()
+	for k, t := range w.writtenAt {
+		if now.Sub(t) > w.window {
+			delete(w.writtenAt, k)
+		}
+	}
+	_, exist := w.writtenAt[key]
+	return exist
+}
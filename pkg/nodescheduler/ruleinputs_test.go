@@ -0,0 +1,107 @@
+package nodescheduler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/sciencerule"
+)
+
+func TestPendingRuleInputs(t *testing.T) {
+	storm := sciencerule.NewMeasurementDependency("storm.detected")
+	alarm := sciencerule.NewScoreboardDependency("job.1.alarm")
+	temperature := sciencerule.NewMeasurementDependency("env.temperature")
+	tests := map[string]struct {
+		Inputs []ruleInput
+		JobID  string
+		GoalID string
+		Want   map[sciencerule.Dependency]bool
+	}{
+		"from plugin": {
+			Inputs: []ruleInput{{Dependency: temperature}},
+			JobID:  "1",
+			GoalID: "goal-1",
+			Want:   map[sciencerule.Dependency]bool{temperature: true},
+		},
+		"published by the goal itself": {
+			Inputs: []ruleInput{{Dependency: storm, Publisher: ruleInputPublisher("1", "goal-1")}},
+			JobID:  "1",
+			GoalID: "goal-1",
+			Want:   map[sciencerule.Dependency]bool{},
+		},
+		"published by another goal": {
+			Inputs: []ruleInput{{Dependency: storm, Publisher: ruleInputPublisher("2", "goal-2")}},
+			JobID:  "1",
+			GoalID: "goal-1",
+			Want:   map[sciencerule.Dependency]bool{storm: true},
+		},
+		"published by the goal itself and a plugin": {
+			Inputs: []ruleInput{
+				{Dependency: storm, Publisher: ruleInputPublisher("1", "goal-1")},
+				{Dependency: storm},
+			},
+			JobID:  "1",
+			GoalID: "goal-1",
+			Want:   map[sciencerule.Dependency]bool{storm: true},
+		},
+		"set by the goal itself": {
+			Inputs: []ruleInput{{Dependency: alarm, Publisher: ruleInputPublisher("1", "goal-1")}},
+			JobID:  "1",
+			GoalID: "goal-1",
+			Want:   map[sciencerule.Dependency]bool{},
+		},
+		"set by another goal of the job": {
+			Inputs: []ruleInput{{Dependency: alarm, Publisher: ruleInputPublisher("1", "goal-2")}},
+			JobID:  "1",
+			GoalID: "goal-1",
+			Want:   map[sciencerule.Dependency]bool{alarm: true},
+		},
+		"mixed": {
+			Inputs: []ruleInput{
+				{Dependency: storm, Publisher: ruleInputPublisher("1", "goal-1")},
+				{Dependency: temperature},
+			},
+			JobID:  "1",
+			GoalID: "goal-1",
+			Want:   map[sciencerule.Dependency]bool{temperature: true},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := make(pendingRuleInputs)
+			for _, in := range test.Inputs {
+				p.add(in)
+			}
+			if got := p.dependenciesFor(test.JobID, test.GoalID); !reflect.DeepEqual(got, test.Want) {
+				t.Errorf("wanted %v but got %v", test.Want, got)
+			}
+			for _, in := range test.Inputs {
+				if !p.dependencies()[in.Dependency] {
+					t.Errorf("wanted %v in all pending inputs", in.Dependency)
+				}
+			}
+		})
+	}
+}
+
+func TestRecentWrites(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	w := newRecentWrites(2 * time.Second)
+	w.getCurrentTime = func() time.Time { return now }
+	w.add("job.42.alarm")
+	if !w.has("job.42.alarm") {
+		t.Errorf("wanted the key written by the scheduler")
+	}
+	if w.has("job.7.alarm") {
+		t.Errorf("wanted no key written by others")
+	}
+	// the key changes afterwards by others, e.g. when it expires
+	now = now.Add(3 * time.Second)
+	if w.has("job.42.alarm") {
+		t.Errorf("wanted the write forgotten after the window")
+	}
+	if len(w.writtenAt) != 0 {
+		t.Errorf("wanted old writes pruned but got %v", w.writtenAt)
+	}
+}
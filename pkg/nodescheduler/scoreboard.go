@@ -0,0 +1,212 @@
+package nodescheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/sciencerule"
+)
+
+// Scoreboard keeps states of the node that science rules set and read.
+// interfacing.RedisClient is the scoreboard of the node
+type Scoreboard interface {
+	SetWithTTL(k string, v interface{}, ttl time.Duration) error
+	Get(k string) (string, bool, error)
+	Del(keys ...string) error
+	Keys(pattern string) ([]string, error)
+	TTL(k string) (time.Duration, error)
+}
+
+// ScoreboardState is a state in the scoreboard
+type ScoreboardState struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	// JobID is the job the state belongs to. It is empty for global states
+	JobID string `json:"job_id,omitempty"`
+	// Name is the name of the state in the job, or the key for global states
+	Name string `json:"name"`
+	// ExpiresIn is the remaining time of the state. It is zero if the state does not expire
+	ExpiresIn time.Duration `json:"expires_in,omitempty"`
+}
+
+// ListScoreboard returns the states in the scoreboard sorted by key. It returns
+// the states of the job only if the job ID is given
+func ListScoreboard(s Scoreboard, jobID string) ([]ScoreboardState, error) {
+	pattern := "*"
+	if jobID != "" {
+		pattern = datatype.ScoreboardPrefix(jobID) + "*"
+	}
+	keys, err := s.Keys(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scoreboard: %s", err.Error())
+	}
+	sort.Strings(keys)
+	var states []ScoreboardState
+	for _, k := range keys {
+		v, exist, err := s.Get(k)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %q from scoreboard: %s", k, err.Error())
+		} else if !exist {
+			// expired while listing
+			continue
+		}
+		state := ScoreboardState{Key: k, Value: v}
+		state.JobID, state.Name = datatype.ParseScoreboardKey(k)
+		if ttl, err := s.TTL(k); err == nil && ttl > 0 {
+			state.ExpiresIn = ttl
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// encodeState returns the value as it is stored in the scoreboard. Objects and
+// lists are stored in JSON
+func encodeState(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", fmt.Errorf("value is None")
+	case bool, int, int64, float64:
+		return fmt.Sprint(v), nil
+	default:
+		blob, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(blob), nil
+	}
+}
+
+// decodeState returns the state for conditions. true and false are booleans,
+// and other states are strings that conditions read as numbers if they are numbers
+func decodeState(s string) interface{} {
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return s
+}
+
+// scopeScoreboard returns the condition with the names of scoreboard() replaced by the
+// keys of the job, e.g. scoreboard('rainy') becomes scoreboard('job.42.rainy').
+// Names read with global=True are kept as they are unless they are in the namespace
+// of jobs, which stays within the job
+func scopeScoreboard(e sciencerule.Expr, jobID string) sciencerule.Expr {
+	return sciencerule.ReplaceCalls(e, func(c *sciencerule.Call) sciencerule.Expr {
+		if c.Func != sciencerule.ScoreboardFunction || len(c.Args) != 1 {
+			return nil
+		}
+		name, ok := c.Args[0].(*sciencerule.Literal)
+		if !ok || (name.Value.Kind != sciencerule.ValueString && name.Value.Kind != sciencerule.ValueWord) {
+			return nil
+		}
+		global := false
+		for _, k := range c.Kwargs {
+			if k.Name != datatype.SetParameterGlobal {
+				return nil
+			}
+			l, ok := k.Value.(*sciencerule.Literal)
+			if !ok || l.Value.Kind != sciencerule.ValueBool {
+				return nil
+			}
+			global = l.Value.Bool
+		}
+		key := datatype.ScoreboardKey(jobID, name.Value.Text, global)
+		return &sciencerule.Call{
+			Func:     c.Func,
+			Position: c.Position,
+			Args:     []sciencerule.Expr{sciencerule.NewLiteral(key, name.Value.Position)},
+		}
+	})
+}
+
+// MemoryScoreboard keeps states in memory. It is the scoreboard in simulation
+type MemoryScoreboard struct {
+	mu             sync.Mutex
+	states         map[string]memoryState
+	getCurrentTime func() time.Time
+}
+
+type memoryState struct {
+	value     string
+	expiresAt time.Time
+}
+
+func NewMemoryScoreboard(getCurrentTime func() time.Time) *MemoryScoreboard {
+	return &MemoryScoreboard{
+		states:         make(map[string]memoryState),
+		getCurrentTime: getCurrentTime,
+	}
+}
+
+func (s *MemoryScoreboard) SetWithTTL(k string, v interface{}, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := memoryState{value: fmt.Sprint(v)}
+	if ttl > 0 {
+		state.expiresAt = s.getCurrentTime().Add(ttl)
+	}
+	s.states[k] = state
+	return nil
+}
+
+// get returns the state if it has not expired. The caller must hold the lock
+func (s *MemoryScoreboard) get(k string) (memoryState, bool) {
+	state, exist := s.states[k]
+	if exist && !state.expiresAt.IsZero() && !s.getCurrentTime().Before(state.expiresAt) {
+		delete(s.states, k)
+		return state, false
+	}
+	return state, exist
+}
+
+func (s *MemoryScoreboard) Get(k string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, exist := s.get(k)
+	return state.value, exist, nil
+}
+
+func (s *MemoryScoreboard) Del(keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range keys {
+		delete(s.states, k)
+	}
+	return nil
+}
+
+func (s *MemoryScoreboard) Keys(pattern string) (keys []string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k := range s.states {
+		if _, exist := s.get(k); !exist {
+			continue
+		}
+		if matched, err := path.Match(pattern, k); err != nil {
+			return nil, err
+		} else if matched {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (s *MemoryScoreboard) TTL(k string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, exist := s.get(k)
+	if !exist || state.expiresAt.IsZero() {
+		return -1, nil
+	}
+	return state.expiresAt.Sub(s.getCurrentTime()), nil
+}
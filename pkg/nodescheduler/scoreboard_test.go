@@ -0,0 +1,110 @@
+package nodescheduler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/sciencerule"
+)
+
+func TestMemoryScoreboard(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewMemoryScoreboard(func() time.Time { return now })
+	s.SetWithTTL(datatype.ScoreboardKey("42", "rainy", false), 1, 10*time.Minute)
+	s.SetWithTTL(datatype.ScoreboardKey("42", "rainy", true), "yes", 0)
+	s.SetWithTTL(datatype.ScoreboardKey("7", "mode", false), "night", 0)
+
+	states, err := ListScoreboard(s, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ScoreboardState{
+		{Key: "job.42.rainy", Value: "1", JobID: "42", Name: "rainy", ExpiresIn: 10 * time.Minute},
+		{Key: "job.7.mode", Value: "night", JobID: "7", Name: "mode"},
+		{Key: "rainy", Value: "yes", Name: "rainy"},
+	}
+	if !reflect.DeepEqual(states, want) {
+		t.Errorf("wanted states %+v but got %+v", want, states)
+	}
+	if states, _ := ListScoreboard(s, "42"); len(states) != 1 || states[0].Key != "job.42.rainy" {
+		t.Errorf("wanted states of job 42 only but got %+v", states)
+	}
+
+	now = now.Add(10 * time.Minute)
+	if _, exist, _ := s.Get("job.42.rainy"); exist {
+		t.Errorf("state must expire after its TTL")
+	}
+	s.Del("rainy")
+	if states, _ := ListScoreboard(s, ""); len(states) != 1 {
+		t.Errorf("wanted 1 state left but got %+v", states)
+	}
+}
+
+func TestKnowledgeBaseReadScoreboard(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	scoreboard := NewMemoryScoreboard(clock)
+	kb := NewKnowledgeBase("W000", "")
+	kb.SetRuleEvaluator(NewSimulatedRuleChecker(clock))
+	kb.SetScoreboard(scoreboard)
+	goal := &datatype.ScienceGoal{
+		ID:    "goal-1",
+		JobID: "42",
+		SubGoals: []*datatype.SubGoal{
+			{Name: "W000", ScienceRules: []datatype.ScienceRule{
+				{Rule: "publish(env.rainy): scoreboard('rainy') == 1"},
+				{Rule: "publish(env.global): scoreboard('mode', global=True) == 'night'"},
+			}},
+		},
+	}
+	if err := kb.AddRulesFromScienceGoal(goal); err != nil {
+		t.Fatal(err)
+	}
+	rainy := sciencerule.NewScoreboardDependency("job.42.rainy")
+	if !kb.HasDependents(rainy) {
+		t.Errorf("rules reading the state of the job must depend on %s", rainy)
+	}
+	if !kb.HasDependents(sciencerule.NewScoreboardDependency("mode")) {
+		t.Errorf("rules reading the global state must depend on the global key")
+	}
+
+	fired := func() (objects []string) {
+		rules, err := kb.EvaluateGoal(goal.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range rules {
+			objects = append(objects, r.ActionObject)
+		}
+		return
+	}
+	if got := fired(); len(got) != 0 {
+		t.Errorf("wanted no rule fired without states but got %v", got)
+	}
+	// the state of another job does not make the rule valid
+	scoreboard.SetWithTTL("job.7.rainy", 1, 0)
+	scoreboard.SetWithTTL("job.42.rainy", 1, 0)
+	scoreboard.SetWithTTL("mode", "night", 0)
+	if got, want := fired(), []string{"env.rainy", "env.global"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wanted rules %v fired but got %v", want, got)
+	}
+
+	result, err := kb.EvaluateCondition("scoreboard('rainy') == 1", "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantValues := []EvaluatedValue{{Expr: `scoreboard("job.7.rainy")`, Value: "1"}}
+	if !result.Result || !reflect.DeepEqual(result.Values, wantValues) {
+		t.Errorf("wanted the state of job 7 read but got %+v", result)
+	}
+	// global names in the namespace of jobs stay within the job
+	result, err = kb.EvaluateCondition("scoreboard('job.42.rainy', global=True) == 1", "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Result {
+		t.Errorf("wanted job 7 not to read the state of job 42 but got %+v", result)
+	}
+}
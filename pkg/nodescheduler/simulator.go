@@ -0,0 +1,571 @@
+package nodescheduler
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/nu7hatch/gouuid"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+	"github.com/waggle-sensor/edge-scheduler/pkg/sciencerule"
+	"gopkg.in/yaml.v2"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+var simLog = logger.New("simulator")
+
+const (
+	defaultSimulationDuration   = time.Hour
+	defaultSimulatedPodInitTime = 5 * time.Second
+	defaultSimulatedPodRunTime  = time.Minute
+)
+
+// SimulationConfig configures the simulation mode of the node scheduler.
+// Durations are given in the simulated time, e.g. 30s or 2h
+type SimulationConfig struct {
+	// GoalFile is either a JSON list of science goals or YAML job descriptions
+	GoalFile string `json:"goal_file,omitempty" yaml:"goalFile,omitempty"`
+	// MeasurementFile is a CSV or JSON lines file that has time, name, and value of measurements
+	MeasurementFile string `json:"measurement_file,omitempty" yaml:"measurementFile,omitempty"`
+	// TimelineFile receives plugin state transitions in CSV if it ends with .csv,
+	// otherwise in JSON. The timeline is printed in CSV if not given
+	TimelineFile string `json:"timeline_file,omitempty" yaml:"timelineFile,omitempty"`
+	// StartTime is the simulated time in RFC3339 at which the simulation starts. Default is now
+	StartTime string `json:"start_time,omitempty" yaml:"startTime,omitempty"`
+	Duration  string `json:"duration,omitempty" yaml:"duration,omitempty"`
+	// Speed is simulated seconds per second
+	Speed float64 `json:"speed,omitempty" yaml:"speed,omitempty"`
+	// Seed seeds failures of Pods
+	Seed int64 `json:"seed,omitempty" yaml:"seed,omitempty"`
+	// Pod emulates Pods of plugins not found in Plugins
+	Pod     SimulatedPodConfig            `json:"pod,omitempty" yaml:"pod,omitempty"`
+	Plugins map[string]SimulatedPodConfig `json:"plugins,omitempty" yaml:"plugins,omitempty"`
+}
+
+// SimulatedPodConfig configures the lifecycle of emulated Pods
+type SimulatedPodConfig struct {
+	InitDuration string  `json:"init_duration,omitempty" yaml:"initDuration,omitempty"`
+	RunDuration  string  `json:"run_duration,omitempty" yaml:"runDuration,omitempty"`
+	FailureRate  float64 `json:"failure_rate,omitempty" yaml:"failureRate,omitempty"`
+}
+
+type simulatedPodLifecycle struct {
+	initDuration time.Duration
+	runDuration  time.Duration
+	failureRate  float64
+}
+
+func parseSimulatedDuration(v string, def time.Duration) (time.Duration, error) {
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%q must not be negative", v)
+	}
+	return d, nil
+}
+
+func newSimulatedPodLifecycle(c SimulatedPodConfig, def simulatedPodLifecycle) (l simulatedPodLifecycle, err error) {
+	if l.initDuration, err = parseSimulatedDuration(c.InitDuration, def.initDuration); err != nil {
+		return l, fmt.Errorf("failed to parse init duration: %s", err.Error())
+	}
+	if l.runDuration, err = parseSimulatedDuration(c.RunDuration, def.runDuration); err != nil {
+		return l, fmt.Errorf("failed to parse run duration: %s", err.Error())
+	}
+	if c.FailureRate < 0 || c.FailureRate > 1 {
+		return l, fmt.Errorf("failure rate %f must be between 0 and 1", c.FailureRate)
+	}
+	l.failureRate = c.FailureRate
+	return l, nil
+}
+
+// SimulationClock runs the simulated time Speed times faster than the wall clock
+type SimulationClock struct {
+	Start     time.Time
+	Speed     float64
+	realStart time.Time
+}
+
+func NewSimulationClock(start time.Time, speed float64) *SimulationClock {
+	return &SimulationClock{
+		Start:     start,
+		Speed:     speed,
+		realStart: time.Now(),
+	}
+}
+
+// Now returns the current simulated time
+func (c *SimulationClock) Now() time.Time {
+	return c.Start.Add(time.Duration(float64(time.Since(c.realStart)) * c.Speed))
+}
+
+// Real returns the wall clock duration of the simulated duration
+func (c *SimulationClock) Real(d time.Duration) time.Duration {
+	return time.Duration(float64(d) / c.Speed)
+}
+
+// SimulatedMeasurement is a measurement fed to the rule checker at the simulated time
+type SimulatedMeasurement struct {
+	Offset time.Duration
+	// Time is the timestamp of the measurement when the file gives the timestamp
+	// instead of the offset
+	Time  time.Time
+	Name  string
+	Value interface{}
+}
+
+// resolveMeasurementTimes sets offsets of timestamped measurements from the start
+// and sorts the measurements by the offset
+func resolveMeasurementTimes(measurements []SimulatedMeasurement, start time.Time) {
+	for i := range measurements {
+		if !measurements[i].Time.IsZero() {
+			measurements[i].Offset = measurements[i].Time.Sub(start)
+		}
+	}
+	sort.SliceStable(measurements, func(i, j int) bool {
+		return measurements[i].Offset < measurements[j].Offset
+	})
+}
+
+// TimelineEntry records a state transition of a plugin in the simulated time
+type TimelineEntry struct {
+	Time   time.Time `json:"time"`
+	Plugin string    `json:"plugin"`
+	JobID  string    `json:"job_id"`
+	GoalID string    `json:"goal_id"`
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+}
+
+// Simulator replays goals and measurements, and emulates Pod lifecycles on the fake
+// Kubernetes clientset so that the node scheduler runs without Kubernetes
+type Simulator struct {
+	Clock        *SimulationClock
+	RuleChecker  *SimulatedRuleChecker
+	config       *SimulationConfig
+	duration     time.Duration
+	defaultPod   simulatedPodLifecycle
+	pods         map[string]simulatedPodLifecycle
+	measurements []SimulatedMeasurement
+	random       *rand.Rand
+	mu           sync.Mutex
+	timeline     []TimelineEntry
+	done         chan struct{}
+	// notify is called with every measurement fed to the rule checker
+	notify func(sciencerule.Dependency)
+}
+
+func NewSimulator(config *SimulationConfig) (*Simulator, error) {
+	start := time.Now()
+	if config.StartTime != "" {
+		t, err := time.Parse(time.RFC3339, config.StartTime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse start time: %s", err.Error())
+		}
+		start = t
+	}
+	speed := config.Speed
+	if speed == 0 {
+		speed = 1
+	} else if speed < 0 {
+		return nil, fmt.Errorf("speed %f must be positive", speed)
+	}
+	duration, err := parseSimulatedDuration(config.Duration, defaultSimulationDuration)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse duration: %s", err.Error())
+	}
+	s := &Simulator{
+		Clock:    NewSimulationClock(start, speed),
+		config:   config,
+		duration: duration,
+		pods:     make(map[string]simulatedPodLifecycle),
+		random:   rand.New(rand.NewSource(config.Seed)),
+		done:     make(chan struct{}),
+	}
+	s.RuleChecker = NewSimulatedRuleChecker(s.Clock.Now)
+	s.defaultPod, err = newSimulatedPodLifecycle(config.Pod, simulatedPodLifecycle{
+		initDuration: defaultSimulatedPodInitTime,
+		runDuration:  defaultSimulatedPodRunTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for name, c := range config.Plugins {
+		if s.pods[name], err = newSimulatedPodLifecycle(c, s.defaultPod); err != nil {
+			return nil, fmt.Errorf("plugin %q: %s", name, err.Error())
+		}
+	}
+	if config.MeasurementFile != "" {
+		if s.measurements, err = LoadSimulatedMeasurements(config.MeasurementFile); err != nil {
+			return nil, err
+		}
+		resolveMeasurementTimes(s.measurements, start)
+	}
+	return s, nil
+}
+
+// parseMeasurementValue parses a measurement value as a number or a boolean,
+// and keeps it as a string otherwise
+func parseMeasurementValue(v string) interface{} {
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return f
+	}
+	switch v {
+	case "True", "true":
+		return true
+	case "False", "false":
+		return false
+	}
+	return v
+}
+
+// LoadSimulatedMeasurements reads measurements from the CSV file with the header
+// time,name,value or the JSON lines file with the same keys. time is the offset from
+// the start of the simulation, e.g. 10m, or the timestamp in RFC3339
+func LoadSimulatedMeasurements(filePath string) (measurements []SimulatedMeasurement, err error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	add := func(offset string, name string, value interface{}) error {
+		if t, err := time.Parse(time.RFC3339Nano, offset); err == nil {
+			measurements = append(measurements, SimulatedMeasurement{Time: t, Name: name, Value: value})
+			return nil
+		}
+		d, err := time.ParseDuration(offset)
+		if err != nil {
+			return fmt.Errorf("failed to parse time %q of %q: %s", offset, name, err.Error())
+		}
+		measurements = append(measurements, SimulatedMeasurement{Offset: d, Name: name, Value: value})
+		return nil
+	}
+	if strings.HasSuffix(filePath, ".csv") {
+		records, err := csv.NewReader(f).ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		for i, record := range records {
+			if i == 0 && record[0] == "time" {
+				continue
+			}
+			if len(record) != 3 {
+				return nil, fmt.Errorf("line %d must have time, name, and value", i+1)
+			}
+			if err := add(record[0], record[1], parseMeasurementValue(record[2])); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			var m struct {
+				Time  string      `json:"time"`
+				Name  string      `json:"name"`
+				Value interface{} `json:"value"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+				return nil, err
+			}
+			if err := add(m.Time, m.Name, m.Value); err != nil {
+				return nil, err
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(measurements, func(i, j int) bool {
+		return measurements[i].Offset < measurements[j].Offset
+	})
+	return
+}
+
+// LoadSimulatedGoals reads science goals from the goal file. A JSON file holds a list of
+// science goals as the cloud scheduler sends. Otherwise, the file holds YAML job descriptions
+// separated by "---", each of which becomes a science goal for the node
+func LoadSimulatedGoals(filePath string, nodeID string) (goals []datatype.ScienceGoal, err error) {
+	blob, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(filePath) == ".json" {
+		err = json.Unmarshal(blob, &goals)
+		return
+	}
+	decoder := yaml.NewDecoder(strings.NewReader(string(blob)))
+	for i := 1; ; i++ {
+		var job datatype.Job
+		if err := decoder.Decode(&job); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse job %d: %s", i, err.Error())
+		}
+		if job.JobID == "" {
+			job.JobID = strconv.Itoa(i)
+		}
+		var rules []datatype.ScienceRule
+		for _, rule := range job.ScienceRules {
+			r, err := datatype.NewScienceRule(rule)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse science rule %q of job %q: %s", rule, job.Name, err.Error())
+			}
+			rules = append(rules, *r)
+		}
+		goal := datatype.NewScienceGoalBuilder(job.Name, job.JobID).
+			SetMaxConcurrency(job.MaxConcurrency).
+			SetUser(job.User).
+			AddSubGoal(nodeID, job.Plugins, rules)
+		if goal == nil {
+			return nil, fmt.Errorf("failed to create science goal of job %q", job.Name)
+		}
+		goals = append(goals, *goal.Build())
+	}
+	return
+}
+
+// NewSimulatedResourceManager returns a ResourceManager with the fake Kubernetes clientset.
+// The clientset assigns UID and creation time to Pods as Kubernetes does
+func NewSimulatedResourceManager() *ResourceManager {
+	rm := NewFakeK3SResourceManager(nil)
+	rm.Simulate = true
+	rm.Clientset.(*fake.Clientset).PrependReactor("create", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		pod := action.(clienttesting.CreateAction).GetObject().(*v1.Pod)
+		id, _ := uuid.NewV4()
+		pod.UID = types.UID(id.String())
+		pod.CreationTimestamp = metav1.Now()
+		// let the object tracker store the Pod
+		return false, nil, nil
+	})
+	return rm
+}
+
+// EmulatePods drives Pods of the resource manager through the phases Pending, Running, and
+// Succeeded or Failed as configured. Deleted Pods stop being emulated
+func (s *Simulator) EmulatePods(rm *ResourceManager) error {
+	watcher, err := rm.Clientset.CoreV1().Pods(rm.Namespace).Watch(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to watch Pods: %s", err.Error())
+	}
+	go func() {
+		for event := range watcher.ResultChan() {
+			if event.Type != watch.Added {
+				continue
+			}
+			pod := event.Object.(*v1.Pod)
+			lifecycle, found := s.pods[pod.Labels[PodLabelPluginTask]]
+			if !found {
+				lifecycle = s.defaultPod
+			}
+			s.mu.Lock()
+			failed := s.random.Float64() < lifecycle.failureRate
+			s.mu.Unlock()
+			s.updatePodStatus(rm, pod.Name, pod.UID, s.podPending)
+			time.AfterFunc(s.Clock.Real(lifecycle.initDuration), func() {
+				s.updatePodStatus(rm, pod.Name, pod.UID, s.podRunning)
+				time.AfterFunc(s.Clock.Real(lifecycle.runDuration), func() {
+					s.updatePodStatus(rm, pod.Name, pod.UID, func(p *v1.Pod) { s.podTerminated(p, failed) })
+				})
+			})
+		}
+	}()
+	return nil
+}
+
+// updatePodStatus updates the Pod if it still exists. The UID is checked as a Pod
+// of the same name is created whenever the plugin runs
+func (s *Simulator) updatePodStatus(rm *ResourceManager, podName string, uid types.UID, update func(*v1.Pod)) {
+	pod, err := rm.GetPod(podName)
+	if err != nil || pod.UID != uid {
+		simLog.Debugf("simulated Pod %q no longer exists", podName)
+		return
+	}
+	update(pod)
+	if _, err := rm.Clientset.CoreV1().Pods(rm.Namespace).UpdateStatus(context.TODO(), pod, metav1.UpdateOptions{}); err != nil {
+		simLog.Errorf("Failed to update status of simulated Pod %q: %s", podName, err.Error())
+	}
+}
+
+func (s *Simulator) podPending(pod *v1.Pod) {
+	pod.Status.Phase = v1.PodPending
+	for _, c := range pod.Spec.InitContainers {
+		pod.Status.InitContainerStatuses = append(pod.Status.InitContainerStatuses, v1.ContainerStatus{
+			Name:  c.Name,
+			State: v1.ContainerState{Running: &v1.ContainerStateRunning{StartedAt: metav1.Now()}},
+		})
+	}
+}
+
+func (s *Simulator) podRunning(pod *v1.Pod) {
+	pod.Status.Phase = v1.PodRunning
+	for i := range pod.Status.InitContainerStatuses {
+		pod.Status.InitContainerStatuses[i].State = v1.ContainerState{
+			Terminated: &v1.ContainerStateTerminated{ExitCode: 0, Reason: "Completed", FinishedAt: metav1.Now()},
+		}
+	}
+	pod.Status.ContainerStatuses = nil
+	for _, c := range pod.Spec.Containers {
+		pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, v1.ContainerStatus{
+			Name:  c.Name,
+			State: v1.ContainerState{Running: &v1.ContainerStateRunning{StartedAt: metav1.Now()}},
+		})
+	}
+}
+
+func (s *Simulator) podTerminated(pod *v1.Pod, failed bool) {
+	terminated := &v1.ContainerStateTerminated{ExitCode: 0, Reason: "Completed", FinishedAt: metav1.Now()}
+	pod.Status.Phase = v1.PodSucceeded
+	if failed {
+		terminated = &v1.ContainerStateTerminated{ExitCode: 1, Reason: "Error", FinishedAt: metav1.Now()}
+		pod.Status.Phase = v1.PodFailed
+	}
+	for i := range pod.Status.ContainerStatuses {
+		pod.Status.ContainerStatuses[i].State = v1.ContainerState{Terminated: terminated}
+	}
+}
+
+// Run feeds measurements to the rule checker at their simulated time and
+// finishes when the simulated duration passes
+func (s *Simulator) Run() {
+	simLog.Infof("Simulation starts at %s for %s at %gx speed", s.Clock.Start.Format(time.RFC3339), s.duration, s.Clock.Speed)
+	for _, m := range s.measurements {
+		if m.Offset > s.duration {
+			break
+		}
+		time.Sleep(time.Until(s.Clock.realStart.Add(s.Clock.Real(m.Offset))))
+		simLog.Debugf("simulated measurement %s: %v", m.Name, m.Value)
+		s.RuleChecker.Store(m.Name, m.Value)
+		if s.notify != nil {
+			s.notify(sciencerule.NewMeasurementDependency(m.Name))
+		}
+	}
+	time.Sleep(time.Until(s.Clock.realStart.Add(s.Clock.Real(s.duration))))
+	close(s.done)
+}
+
+// Done returns a channel that is closed when the simulation finishes
+func (s *Simulator) Done() <-chan struct{} {
+	return s.done
+}
+
+// RecordTransition is a datatype.StateObserver that records state transitions of plugins
+func (s *Simulator) RecordTransition(pr *datatype.PluginRuntime, from string, to string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timeline = append(s.timeline, TimelineEntry{
+		Time:   s.Clock.Now(),
+		Plugin: pr.Plugin.Name,
+		JobID:  pr.Plugin.JobID,
+		GoalID: pr.Plugin.GoalID,
+		From:   from,
+		To:     to,
+	})
+}
+
+func (s *Simulator) GetTimeline() []TimelineEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]TimelineEntry{}, s.timeline...)
+}
+
+// WriteTimeline writes the timeline in CSV or JSON
+func (s *Simulator) WriteTimeline(w io.Writer, format string) error {
+	timeline := s.GetTimeline()
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(timeline)
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"time", "plugin", "job_id", "goal_id", "from", "to"})
+		for _, e := range timeline {
+			writer.Write([]string{e.Time.Format(time.RFC3339Nano), e.Plugin, e.JobID, e.GoalID, e.From, e.To})
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("unknown timeline format %q", format)
+	}
+}
+
+// SaveTimeline writes the timeline to the timeline file in the config, or to stdout if not given
+func (s *Simulator) SaveTimeline() error {
+	if s.config.TimelineFile == "" {
+		return s.WriteTimeline(os.Stdout, "csv")
+	}
+	f, err := os.Create(s.config.TimelineFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	format := "json"
+	if strings.HasSuffix(s.config.TimelineFile, ".csv") {
+		format = "csv"
+	}
+	return s.WriteTimeline(f, format)
+}
+
+// configureSimulation sets up the scheduler to run on the simulator instead of Kubernetes
+func (ns *NodeScheduler) configureSimulation() error {
+	config := ns.Config.Simulation
+	if config == nil {
+		config = &SimulationConfig{}
+	}
+	simulator, err := NewSimulator(config)
+	if err != nil {
+		return fmt.Errorf("failed to create simulator: %s", err.Error())
+	}
+	ns.Simulator = simulator
+	ns.Knowledgebase.SetRuleEvaluator(simulator.RuleChecker)
+	ns.Knowledgebase.SetClock(simulator.Clock.Now)
+	// states set by rules are kept in memory in simulated time
+	ns.ToScoreboard = NewMemoryScoreboard(simulator.Clock.Now)
+	ns.Knowledgebase.SetScoreboard(ns.ToScoreboard)
+	simulator.notify = ns.NotifyRuleInput
+	if config.GoalFile != "" {
+		goals, err := LoadSimulatedGoals(config.GoalFile, ns.NodeID)
+		if err != nil {
+			return fmt.Errorf("failed to load goals from %s: %s", config.GoalFile, err.Error())
+		}
+		blob, err := json.Marshal(goals)
+		if err != nil {
+			return err
+		}
+		simLog.Infof("%d goals loaded from %s", len(goals), config.GoalFile)
+		// the goals are registered when the informer lists the ConfigMap
+		err = ns.ResourceManager.CreateConfigMap(configMapNameForGoals, map[string]string{"goals": string(blob)}, ns.ResourceManager.Namespace, true)
+		if err != nil {
+			return err
+		}
+	}
+	if err := ns.ResourceManager.ConfigureKubernetesInformer(); err != nil {
+		return err
+	}
+	return simulator.EmulatePods(ns.ResourceManager)
+}
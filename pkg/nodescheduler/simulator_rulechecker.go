@@ -0,0 +1,620 @@
+package nodescheduler
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/sciencerule"
+)
+
+// SimulatedRuleChecker evaluates conditions of science rules locally against measurements
+// fed by the simulation. It supports a subset of the rule checker,
+//
+// - v() and e() return the latest value of the measurement, or the values in the time window
+// with since=, e.g. since='-5m'
+//
+// - rate() returns the rate per second between the last two values of the measurement, or
+// the rates between the values in the time window with since=
+//
+// - avg(), sum(), min(), max(), last(), any(), and all() are applied to the values or the value
+//
+// - cronjob() is valid once in a minute that matches the cron expression in the simulated time
+//
+// - arithmetic, comparisons including chained ones, in, not in, is, is not, and, or, not,
+// and parentheses
+//
+// - lists and tuples, e.g. [1, 2], subscripts, e.g. v('env.temperature', since='-5m')[-1],
+// and conditional expressions, e.g. 1 if v('env.raining') else 0
+type SimulatedRuleChecker struct {
+	mu             sync.Mutex
+	measures       map[string][]simulatedSample
+	cronjobFiredAt map[string]time.Time
+	getCurrentTime func() time.Time
+}
+
+func NewSimulatedRuleChecker(getCurrentTime func() time.Time) *SimulatedRuleChecker {
+	return &SimulatedRuleChecker{
+		measures:       make(map[string][]simulatedSample),
+		cronjobFiredAt: make(map[string]time.Time),
+		getCurrentTime: getCurrentTime,
+	}
+}
+
+// maxSampleAge is how long the rule checker keeps values of measurements
+const maxSampleAge = 24 * time.Hour
+
+// simulatedSample is a value of a measurement at the time
+type simulatedSample struct {
+	time  time.Time
+	value interface{}
+}
+
+// Store keeps the measurement as the latest value of the name at the current time
+func (rc *SimulatedRuleChecker) Store(name string, value interface{}) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	now := rc.getCurrentTime()
+	samples := append(rc.measures[name], simulatedSample{time: now, value: value})
+	i := 0
+	for i < len(samples)-1 && now.Sub(samples[i].time) > maxSampleAge {
+		i++
+	}
+	rc.measures[name] = samples[i:]
+}
+
+// samples returns values of the measurement in the window. It returns the latest value
+// only if the window is not given
+func (rc *SimulatedRuleChecker) samples(name string, since interface{}) ([]simulatedSample, error) {
+	samples := rc.measures[name]
+	if since == nil {
+		if len(samples) > 0 {
+			return samples[len(samples)-1:], nil
+		}
+		return nil, nil
+	}
+	window, err := sciencerule.ParseDuration(strings.TrimPrefix(fmt.Sprint(since), "-"))
+	if err != nil {
+		return nil, fmt.Errorf("since=%v must be a duration, e.g. '-5m'", since)
+	}
+	from := rc.getCurrentTime().Add(-window)
+	i := len(samples)
+	for i > 0 && !samples[i-1].time.Before(from) {
+		i--
+	}
+	return samples[i:], nil
+}
+
+func (rc *SimulatedRuleChecker) Evaluate(condition string) (bool, error) {
+	e, err := sciencerule.ParseCondition(condition)
+	if err != nil {
+		return false, err
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	v, err := rc.eval(e)
+	if err != nil {
+		return false, err
+	}
+	return truthy(v), nil
+}
+
+// EvaluateValue returns the value of the expression, e.g. the values of v() with since=
+func (rc *SimulatedRuleChecker) EvaluateValue(expr string) (interface{}, error) {
+	e, err := sciencerule.ParseCondition(expr)
+	if err != nil {
+		return nil, err
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.eval(e)
+}
+
+func (rc *SimulatedRuleChecker) eval(e sciencerule.Expr) (interface{}, error) {
+	switch e := e.(type) {
+	case *sciencerule.Literal:
+		switch e.Value.Kind {
+		case sciencerule.ValueNumber:
+			return e.Value.Number, nil
+		case sciencerule.ValueBool:
+			return e.Value.Bool, nil
+		case sciencerule.ValueNone:
+			return nil, nil
+		default:
+			return e.Value.Text, nil
+		}
+	case *sciencerule.Call:
+		var values []interface{}
+		for _, a := range e.Args {
+			v, err := rc.eval(a)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		kwargs := make(map[string]interface{})
+		for _, k := range e.Kwargs {
+			v, err := rc.eval(k.Value)
+			if err != nil {
+				return nil, err
+			}
+			kwargs[k.Name] = v
+		}
+		return rc.call(e.Func, values, kwargs)
+	case *sciencerule.UnaryExpr:
+		v, err := rc.eval(e.X)
+		if err != nil {
+			return nil, err
+		}
+		if e.Op == "not" {
+			return !truthy(v), nil
+		}
+		n, ok := toNumber(v)
+		if !ok {
+			return nil, fmt.Errorf("bad operand for unary %s at column %d", e.Op, e.Position+1)
+		}
+		if e.Op == "-" {
+			return -n, nil
+		}
+		return n, nil
+	case *sciencerule.BinaryExpr:
+		l, err := rc.eval(e.X)
+		if err != nil {
+			return nil, err
+		}
+		switch e.Op {
+		case "or":
+			if truthy(l) {
+				return l, nil
+			}
+			return rc.eval(e.Y)
+		case "and":
+			if !truthy(l) {
+				return l, nil
+			}
+			return rc.eval(e.Y)
+		}
+		r, err := rc.eval(e.Y)
+		if err != nil {
+			return nil, err
+		}
+		if isComparison(e.Op) {
+			return compareValues(l, e.Op, r, e.Position)
+		}
+		return arithmetic(l, e.Op, r, e.Position)
+	case *sciencerule.CompareExpr:
+		l, err := rc.eval(e.Operands[0])
+		if err != nil {
+			return nil, err
+		}
+		// operands are evaluated until a comparison fails, as Python does
+		for i, op := range e.Ops {
+			r, err := rc.eval(e.Operands[i+1])
+			if err != nil {
+				return nil, err
+			}
+			ok, err := compareValues(l, op, r, e.Positions[i])
+			if err != nil || !ok {
+				return false, err
+			}
+			l = r
+		}
+		return true, nil
+	case *sciencerule.ListExpr:
+		values := []interface{}{}
+		for _, x := range e.Elems {
+			v, err := rc.eval(x)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	case *sciencerule.IndexExpr:
+		x, err := rc.eval(e.X)
+		if err != nil {
+			return nil, err
+		}
+		i, err := rc.eval(e.Index)
+		if err != nil {
+			return nil, err
+		}
+		return index(x, i, e.Position)
+	case *sciencerule.CondExpr:
+		cond, err := rc.eval(e.Cond)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(cond) {
+			return rc.eval(e.X)
+		}
+		return rc.eval(e.Else)
+	default:
+		return nil, fmt.Errorf("unexpected %q at column %d", e.String(), e.Pos()+1)
+	}
+}
+
+func (rc *SimulatedRuleChecker) call(name string, args []interface{}, kwargs map[string]interface{}) (interface{}, error) {
+	switch name {
+	case "v", "e", "rate":
+		measurement, ok := "", len(args) > 0
+		if ok {
+			measurement, ok = args[0].(string)
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s() needs a measurement name", name)
+		}
+		since, windowed := kwargs["since"]
+		if name == "rate" && !windowed {
+			// the rate needs the last two values
+			if samples := rc.measures[measurement]; len(samples) > 1 {
+				return rates(samples[len(samples)-2:])[0], nil
+			}
+			return nil, nil
+		}
+		samples, err := rc.samples(measurement, since)
+		if err != nil {
+			return nil, err
+		}
+		if name == "rate" {
+			return rates(samples), nil
+		}
+		if !windowed {
+			if len(samples) < 1 {
+				return nil, nil
+			}
+			return samples[0].value, nil
+		}
+		values := make([]interface{}, len(samples))
+		for i, s := range samples {
+			values[i] = s.value
+		}
+		return values, nil
+	case "avg", "sum", "min", "max", "last":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s() takes 1 argument", name)
+		}
+		return aggregate(name, args[0]), nil
+	case "any", "all":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s() takes 1 argument", name)
+		}
+		values, ok := args[0].([]interface{})
+		if !ok {
+			return truthy(args[0]), nil
+		}
+		for _, v := range values {
+			if truthy(v) == (name == "any") {
+				return name == "any", nil
+			}
+		}
+		return name == "all", nil
+	case "cronjob":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("cronjob() takes a name and a cron expression")
+		}
+		schedule, err := parseCronExpression(fmt.Sprint(args[1]))
+		if err != nil {
+			return nil, err
+		}
+		now := rc.getCurrentTime().Truncate(time.Minute)
+		jobName := fmt.Sprint(args[0])
+		if !schedule.match(now) || rc.cronjobFiredAt[jobName].Equal(now) {
+			return false, nil
+		}
+		rc.cronjobFiredAt[jobName] = now
+		return true, nil
+	default:
+		return nil, fmt.Errorf("function %q is not supported in simulation", name)
+	}
+}
+
+// rates returns the rates per second between consecutive values
+func rates(samples []simulatedSample) []interface{} {
+	var values []interface{}
+	for i := 1; i < len(samples); i++ {
+		a, okA := toNumber(samples[i-1].value)
+		b, okB := toNumber(samples[i].value)
+		d := samples[i].time.Sub(samples[i-1].time).Seconds()
+		if okA && okB && d > 0 {
+			values = append(values, (b-a)/d)
+		}
+	}
+	return values
+}
+
+// aggregate applies avg, sum, min, max, or last to the values. A single value is
+// returned as is, and no value is None
+func aggregate(name string, v interface{}) interface{} {
+	values, ok := v.([]interface{})
+	if !ok {
+		return v
+	}
+	var numbers []float64
+	for _, v := range values {
+		if n, ok := toNumber(v); ok {
+			numbers = append(numbers, n)
+		}
+	}
+	if len(numbers) < 1 {
+		if name == "sum" {
+			return 0.
+		}
+		return nil
+	}
+	result := numbers[0]
+	for _, n := range numbers[1:] {
+		switch name {
+		case "avg", "sum":
+			result += n
+		case "min":
+			result = math.Min(result, n)
+		case "max":
+			result = math.Max(result, n)
+		case "last":
+			result = n
+		}
+	}
+	if name == "avg" {
+		result /= float64(len(numbers))
+	}
+	return result
+}
+
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	default:
+		return false
+	}
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+// arithmetic applies +, -, *, /, //, %, or ** to numbers. Missing values propagate as None
+func arithmetic(l interface{}, op string, r interface{}, pos int) (interface{}, error) {
+	if l == nil || r == nil {
+		return nil, nil
+	}
+	a, ok := toNumber(l)
+	b, ok2 := toNumber(r)
+	if !ok || !ok2 {
+		if op == "+" {
+			if sl, ok := l.(string); ok {
+				if sr, ok := r.(string); ok {
+					return sl + sr, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("unsupported operand for %s at column %d", op, pos+1)
+	}
+	switch op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "**":
+		return math.Pow(a, b), nil
+	case "/", "//", "%":
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero at column %d", pos+1)
+		}
+		switch op {
+		case "/":
+			return a / b, nil
+		case "//":
+			return math.Floor(a / b), nil
+		}
+		return math.Mod(a, b), nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s at column %d", op, pos+1)
+}
+
+func isComparison(op string) bool {
+	switch op {
+	case "==", "!=", ">", ">=", "<", "<=", "in", "not in", "is", "is not":
+		return true
+	}
+	return false
+}
+
+// compareValues applies the comparison, including membership and identity tests
+func compareValues(l interface{}, op string, r interface{}, pos int) (bool, error) {
+	switch op {
+	case "in", "not in":
+		found, err := contains(r, l, pos)
+		return found == (op == "in"), err
+	case "is", "is not":
+		return same(l, r) == (op == "is"), nil
+	}
+	return compare(l, op, r), nil
+}
+
+// contains returns true if the list has the value, or the string has the substring
+func contains(container interface{}, v interface{}, pos int) (bool, error) {
+	switch c := container.(type) {
+	case nil:
+		return false, nil
+	case []interface{}:
+		for _, e := range c {
+			if compare(e, "==", v) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case string:
+		if s, ok := v.(string); ok {
+			return strings.Contains(c, s), nil
+		}
+	}
+	return false, fmt.Errorf("unsupported operand for in at column %d", pos+1)
+}
+
+// same returns true if the values are the same, e.g. v('env.temperature') is None
+func same(l interface{}, r interface{}) bool {
+	if _, ok := l.([]interface{}); ok {
+		return false
+	}
+	if _, ok := r.([]interface{}); ok {
+		return false
+	}
+	return l == r
+}
+
+// index returns the element of the list at the index. Negative indexes count
+// from the end. Missing values propagate as None
+func index(x interface{}, i interface{}, pos int) (interface{}, error) {
+	if x == nil {
+		return nil, nil
+	}
+	values, ok := x.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unsupported operand for [] at column %d", pos+1)
+	}
+	n, ok := toNumber(i)
+	if !ok || n != math.Trunc(n) {
+		return nil, fmt.Errorf("index must be an integer at column %d", pos+1)
+	}
+	if n < 0 {
+		n += float64(len(values))
+	}
+	// the range is checked before converting as int() of a large float is undefined
+	if n < 0 || n >= float64(len(values)) {
+		return nil, fmt.Errorf("index out of range at column %d", pos+1)
+	}
+	return values[int(n)], nil
+}
+
+// compare compares values as Python does, except that any comparison
+// with a missing value is false
+func compare(l interface{}, op string, r interface{}) bool {
+	if l == nil || r == nil {
+		return false
+	}
+	if a, ok := toNumber(l); ok {
+		if b, ok := toNumber(r); ok {
+			switch op {
+			case "==":
+				return a == b
+			case "!=":
+				return a != b
+			case ">":
+				return a > b
+			case ">=":
+				return a >= b
+			case "<":
+				return a < b
+			case "<=":
+				return a <= b
+			}
+		}
+	}
+	switch op {
+	case "==":
+		return fmt.Sprint(l) == fmt.Sprint(r)
+	case "!=":
+		return fmt.Sprint(l) != fmt.Sprint(r)
+	}
+	return false
+}
+
+// cronSchedule holds allowed values of minute, hour, day of month, month, and day of week
+type cronSchedule struct {
+	fields        [5]map[int]bool
+	dayOfMonthAny bool
+	dayOfWeekAny  bool
+}
+
+var cronFieldRanges = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+func parseCronExpression(expression string) (*cronSchedule, error) {
+	sp := strings.Fields(expression)
+	if len(sp) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields", expression)
+	}
+	s := &cronSchedule{
+		dayOfMonthAny: sp[2] == "*",
+		dayOfWeekAny:  sp[4] == "*",
+	}
+	for i, field := range sp {
+		low, high := cronFieldRanges[i][0], cronFieldRanges[i][1]
+		s.fields[i] = make(map[int]bool)
+		for _, part := range strings.Split(field, ",") {
+			step := 1
+			if k := strings.Index(part, "/"); k >= 0 {
+				var err error
+				if step, err = strconv.Atoi(part[k+1:]); err != nil || step < 1 {
+					return nil, fmt.Errorf("invalid step in %q", part)
+				}
+				part = part[:k]
+			}
+			start, end := low, high
+			if part != "*" {
+				var err error
+				r := strings.SplitN(part, "-", 2)
+				if start, err = strconv.Atoi(r[0]); err != nil {
+					return nil, fmt.Errorf("invalid value in %q", field)
+				}
+				end = start
+				if len(r) == 2 {
+					if end, err = strconv.Atoi(r[1]); err != nil {
+						return nil, fmt.Errorf("invalid range in %q", field)
+					}
+				} else if step > 1 {
+					end = high
+				}
+			}
+			if start < low || end > high || start > end {
+				return nil, fmt.Errorf("%q is out of range %d-%d", field, low, high)
+			}
+			for v := start; v <= end; v += step {
+				s.fields[i][v] = true
+			}
+		}
+	}
+	return s, nil
+}
+
+// match returns true if the time matches the schedule. As in cron, the day matches
+// if either day of month or day of week matches when both are restricted
+func (s *cronSchedule) match(t time.Time) bool {
+	if !s.fields[0][t.Minute()] || !s.fields[1][t.Hour()] || !s.fields[3][int(t.Month())] {
+		return false
+	}
+	dayOfMonth := s.fields[2][t.Day()]
+	dayOfWeek := s.fields[4][int(t.Weekday())]
+	switch {
+	case s.dayOfMonthAny && s.dayOfWeekAny:
+		return true
+	case s.dayOfMonthAny:
+		return dayOfWeek
+	case s.dayOfWeekAny:
+		return dayOfMonth
+	default:
+		return dayOfMonth || dayOfWeek
+	}
+}
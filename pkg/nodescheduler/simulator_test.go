@@ -0,0 +1,229 @@
+package nodescheduler
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSimulatedRuleChecker(t *testing.T) {
+	now := time.Date(2023, 1, 1, 7, 10, 0, 0, time.UTC)
+	tests := map[string]struct {
+		Condition string
+		Want      bool
+		Error     bool
+	}{
+		"literal":              {Condition: "True", Want: true},
+		"comparison":           {Condition: "v('env.temperature') > 30", Want: true},
+		"aggregation":          {Condition: "avg(v('env.temperature', since='-1m')) <= 30.0", Want: false},
+		"boolean":              {Condition: "v('env.detection.smoke') == True or v('env.detection.heat') == True", Want: true},
+		"missing":              {Condition: "v('env.nothing') > 0", Want: false},
+		"not":                  {Condition: "not (v('env.temperature') > 30 and v('env.detection.smoke'))", Want: false},
+		"cronjob":              {Condition: "cronjob('a', '*/10 * * * *')", Want: true},
+		"cronjob not match":    {Condition: "cronjob('b', '*/10 6,8 * * *')", Want: false},
+		"cronjob and":          {Condition: "v('env.temperature') > 40 and cronjob('c', '* * * * *')", Want: false},
+		"unsupported":          {Condition: "rate(v('env.temperature')) > 1", Error: true},
+		"malformed":            {Condition: "v('env.temperature') >", Error: true},
+		"bad cron":             {Condition: "cronjob('d', '*/10 * *')", Error: true},
+		"chained comparison":   {Condition: "30 < v('env.temperature') < 32", Want: true},
+		"chain fails":          {Condition: "1 < v('env.temperature') < 3", Want: false},
+		"power":                {Condition: "v('env.temperature') ** 2 == 961", Want: true},
+		"floor division":       {Condition: "v('env.temperature') // 2 == 15", Want: true},
+		"index":                {Condition: "[v('env.temperature'), 0][-1] == 0", Want: true},
+		"index out of range":   {Condition: "[v('env.temperature')][1] > 0", Error: true},
+		"large index":          {Condition: "[1][10**30] > 0", Error: true},
+		"large float index":    {Condition: "[1][1e300] > 0", Error: true},
+		"large negative index": {Condition: "[1][-10**30] > 0", Error: true},
+		"in list":              {Condition: "v('env.temperature') in [30, 31]", Want: true},
+		"not in tuple":         {Condition: "v('env.temperature') not in (30, 31)", Want: false},
+		"is None":              {Condition: "v('env.nothing') is None and v('env.temperature') is not None", Want: true},
+		"conditional":          {Condition: "(1 if v('env.detection.smoke') else 0) == 1", Want: true},
+	}
+	for name, test := range tests {
+		rc := NewSimulatedRuleChecker(func() time.Time { return now })
+		rc.Store("env.temperature", 31.)
+		rc.Store("env.detection.smoke", true)
+		got, err := rc.Evaluate(test.Condition)
+		if test.Error {
+			if err == nil {
+				t.Errorf("%s: expected an error, but got none", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", name, err.Error())
+		} else if got != test.Want {
+			t.Errorf("%s: expected %v, but got %v", name, test.Want, got)
+		}
+	}
+
+	// cronjob is valid once in the matching minute
+	rc := NewSimulatedRuleChecker(func() time.Time { return now })
+	for i, want := range []bool{true, false} {
+		if got, _ := rc.Evaluate("cronjob('a', '10 7 * * *')"); got != want {
+			t.Errorf("evaluation %d of cronjob: expected %v, but got %v", i, want, got)
+		}
+	}
+
+	// since= selects values in the time window
+	clock := now
+	rc = NewSimulatedRuleChecker(func() time.Time { return clock })
+	for i, v := range []float64{10, 20, 30, 40} {
+		clock = now.Add(time.Duration(i) * time.Minute)
+		rc.Store("env.raingauge.total_acc", v)
+	}
+	for condition, want := range map[string]bool{
+		"avg(v('env.raingauge.total_acc', since='-2m')) == 30":   true,
+		"sum(v('env.raingauge.total_acc', since='-10m')) == 100": true,
+		"max(v('env.raingauge.total_acc', since='-1m')) == 40":   true,
+		"min(v('env.raingauge.total_acc', since='-1m')) == 30":   true,
+		"v('env.raingauge.total_acc') == 40":                     true,
+		"rate('env.raingauge.total_acc') > 0.16":                 true,
+		"all(rate('env.raingauge.total_acc', since='-10m'))":     true,
+		"any(v('env.nothing', since='-1m'))":                     false,
+	} {
+		if got, err := rc.Evaluate(condition); err != nil {
+			t.Errorf("%s: %s", condition, err.Error())
+		} else if got != want {
+			t.Errorf("%s: expected %v, but got %v", condition, want, got)
+		}
+	}
+}
+
+func TestSimulatorEmulatePods(t *testing.T) {
+	s, err := NewSimulator(&SimulationConfig{
+		Speed: 100,
+		Pod: SimulatedPodConfig{
+			InitDuration: "1s",
+			RunDuration:  "2s",
+		},
+		Plugins: map[string]SimulatedPodConfig{
+			"failing": {FailureRate: 1},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rm := NewSimulatedResourceManager()
+	if err := s.EmulatePods(rm); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]v1.PodPhase{
+		"succeeding": v1.PodSucceeded,
+		"failing":    v1.PodFailed,
+	}
+	for pluginName := range tests {
+		pod := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   pluginName,
+				Labels: map[string]string{PodLabelPluginTask: pluginName},
+			},
+			Spec: v1.PodSpec{
+				InitContainers: []v1.Container{{Name: InitContainerName}},
+				Containers:     []v1.Container{{Name: pluginName}},
+			},
+		}
+		if err := rm.CreatePod(pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for pluginName, want := range tests {
+		var pod *v1.Pod
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if pod, err = rm.Clientset.CoreV1().Pods(rm.Namespace).Get(context.TODO(), pluginName, metav1.GetOptions{}); err == nil && pod.Status.Phase == want {
+				break
+			}
+		}
+		if pod.UID == "" {
+			t.Errorf("%s: expected Pod UID to be assigned", pluginName)
+		}
+		if pod.Status.Phase != want {
+			t.Errorf("%s: expected %s, but got %s", pluginName, want, pod.Status.Phase)
+			continue
+		}
+		status, err := rm.GetContainerStatusFromPod(pod, pluginName)
+		if err != nil || status.State.Terminated == nil {
+			t.Errorf("%s: expected the plugin container terminated, but got %v", pluginName, status)
+		}
+	}
+}
+
+func TestSimulatorTimeline(t *testing.T) {
+	s, err := NewSimulator(&SimulationConfig{StartTime: "2023-01-01T00:00:00Z"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr := datatype.NewPluginRuntime(datatype.Plugin{Name: "a", JobID: "1"})
+	pr.SetStateObserver(s.RecordTransition)
+	pr.Queued()
+	pr.Scheduled()
+	// failed transition is not recorded
+	pr.Completed()
+	timeline := s.GetTimeline()
+	if len(timeline) != 2 || timeline[1].From != string(datatype.Queued) || timeline[1].To != string(datatype.Scheduled) {
+		t.Fatalf("unexpected timeline %+v", timeline)
+	}
+	var b bytes.Buffer
+	if err := s.WriteTimeline(&b, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[1], ",a,1,,inactive,queued") {
+		t.Errorf("unexpected CSV timeline %q", b.String())
+	}
+}
+
+func TestLoadSimulatedGoals(t *testing.T) {
+	dir := t.TempDir()
+	jobs := `name: first
+plugins:
+- name: a
+  pluginSpec:
+    image: a:latest
+scienceRules:
+- "schedule(a): cronjob('a', '* * * * *')"
+---
+name: second
+jobID: "20"
+plugins:
+- name: b
+  pluginSpec:
+    image: b:latest
+scienceRules:
+- "schedule(b): True"
+`
+	goalFile := filepath.Join(dir, "jobs.yaml")
+	if err := os.WriteFile(goalFile, []byte(jobs), 0644); err != nil {
+		t.Fatal(err)
+	}
+	goals, err := LoadSimulatedGoals(goalFile, "W000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(goals) != 2 || goals[0].JobID != "1" || goals[1].JobID != "20" {
+		t.Fatalf("unexpected goals %+v", goals)
+	}
+	if subGoal := goals[1].GetMySubGoal("w000"); subGoal == nil || subGoal.Plugins[0].Name != "b" {
+		t.Errorf("expected sub goal of the node with plugin b, but got %+v", subGoal)
+	}
+
+	measurementFile := filepath.Join(dir, "measurements.csv")
+	if err := os.WriteFile(measurementFile, []byte("time,name,value\n10m,env.b,True\n1m,env.a,3.5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	measurements, err := LoadSimulatedMeasurements(measurementFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(measurements) != 2 || measurements[0].Name != "env.a" || measurements[0].Value != 3.5 || measurements[1].Value != true {
+		t.Errorf("unexpected measurements %+v", measurements)
+	}
+}
@@ -64,6 +64,10 @@ func NewPluginCtl(kubeconfig string) (*PluginCtl, error) {
 		return nil, err
 	}
 	resourceManager.Namespace = "default"
+	// host paths that plugins may mount are allowed by the node
+	resourceManager.VolumeHostPaths = nodescheduler.ParseVolumeHostPaths(os.Getenv("WAGGLE_VOLUME_HOST_PATHS"))
+	// pluginctl runs on the host
+	resourceManager.HostRoot = "/"
 	return &PluginCtl{
 		kubeConfig:      kubeconfig,
 		ResourceManager: resourceManager,
@@ -0,0 +1,98 @@
+package pluginctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
+	"github.com/waggle-sensor/edge-scheduler/pkg/nodescheduler"
+	"github.com/waggle-sensor/edge-scheduler/pkg/sciencerule"
+)
+
+// GetNodeSchedulerURL returns the URL of the API of the node scheduler running in the cluster
+func (p *PluginCtl) GetNodeSchedulerURL() (string, error) {
+	ip, err := p.ResourceManager.GetServiceClusterIP("wes-plugin-scheduler", "default")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("http://%s:8080", ip), nil
+}
+
+// EvaluateCondition asks the node scheduler at the URL to evaluate the condition against
+// its current knowledge. scoreboard() reads the states of the job if the job ID is given. It returns *sciencerule.SyntaxError if the condition fails to parse
+func EvaluateCondition(schedulerURL string, condition string, jobID string) (*nodescheduler.ConditionEvaluation, error) {
+	r := interfacing.NewHTTPRequest(schedulerURL)
+	data, _ := json.Marshal(map[string]string{
+		"condition": condition,
+		"job_id":    jobID,
+	})
+	resp, err := r.RequestPost("api/v1/rules/evaluate", data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach the node scheduler: %s", err.Error())
+	}
+	if resp.StatusCode == http.StatusBadRequest {
+		defer resp.Body.Close()
+		var body struct {
+			Error    string `json:"error"`
+			Message  string `json:"message"`
+			Position *int   `json:"position"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %s", err.Error())
+		}
+		if body.Position != nil {
+			return nil, &sciencerule.SyntaxError{
+				Position: *body.Position,
+				Message:  body.Message,
+			}
+		}
+		return nil, fmt.Errorf("failed to evaluate condition: %s", body.Error)
+	}
+	decoder, err := r.ParseJSONHTTPResponse(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse response: %s", err.Error())
+	}
+	var result nodescheduler.ConditionEvaluation
+	if err := decoder.Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %s", err.Error())
+	}
+	return &result, nil
+}
+
+// PrintConditionEvaluation prints the result of the condition and the values it read
+func PrintConditionEvaluation(o io.Writer, result *nodescheduler.ConditionEvaluation) {
+	fmt.Fprintf(o, "condition: %s\n", result.Condition)
+	fmt.Fprintf(o, "result: %t\n", result.Result)
+	if result.Error != "" {
+		fmt.Fprintf(o, "error: %s\n", result.Error)
+	}
+	if len(result.Values) > 0 {
+		fmt.Fprintln(o)
+		writer := tabwriter.NewWriter(o, 0, 0, 1, ' ', 0)
+		fmt.Fprintf(writer, "%s\t%s\n", "EXPRESSION", "VALUE")
+		for _, v := range result.Values {
+			value := fmt.Sprint(v.Value)
+			if v.Error != "" {
+				value = "error: " + v.Error
+			} else if v.Value == nil {
+				value = "no data"
+			}
+			fmt.Fprintf(writer, "%s\t%s\n", v.Expr, value)
+		}
+		writer.Flush()
+	}
+	if result.TimeBased {
+		fmt.Fprintln(o, "\nthe condition is time-based: rules with it are evaluated periodically")
+	}
+}
+
+// PrintSyntaxError prints the condition with a marker under the position of the error
+func PrintSyntaxError(o io.Writer, condition string, err *sciencerule.SyntaxError) {
+	fmt.Fprintf(o, "syntax error: %s\n", err.Error())
+	fmt.Fprintf(o, "  %s\n", condition)
+	fmt.Fprintf(o, "  %s^\n", strings.Repeat(" ", err.Position))
+}
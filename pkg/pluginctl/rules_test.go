@@ -0,0 +1,43 @@
+package pluginctl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/sciencerule"
+)
+
+func TestEvaluateCondition(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/rules/evaluate" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "unexpected end of rule at column 23", "message": "unexpected end of rule", "position": 22}`))
+			return
+		}
+		w.Write([]byte(`{"condition": "v('env.temperature') > 30", "result": true, "values": [{"expr": "v('env.temperature')", "value": 33}], "time_based": false}`))
+	}))
+	defer server.Close()
+
+	result, err := EvaluateCondition(server.URL, "v('env.temperature') > 30", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Result || len(result.Values) != 1 || result.Values[0].Value != 33.0 {
+		t.Errorf("wanted the condition valid with the value read but got %+v", result)
+	}
+
+	_, err = EvaluateCondition(server.URL+"?fail=1", "v('env.temperature') >", "")
+	syntaxError, ok := err.(*sciencerule.SyntaxError)
+	if !ok {
+		t.Fatalf("wanted a syntax error but got %v", err)
+	}
+	if syntaxError.Position != 22 || syntaxError.Error() != "unexpected end of rule at column 23" {
+		t.Errorf("wanted the syntax error at 22 but got %+v", syntaxError)
+	}
+}
@@ -0,0 +1,414 @@
+// Package sciencerule implements the grammar of science rules shared by the cloud
+// scheduler, the node scheduler, and sesctl. A science rule has the form,
+//
+//	action(object, name=value, ...): condition
+//
+// Parameters of the action are typed as strings, numbers, durations, or words.
+// The condition is an expression in a subset of Python that is evaluated by
+// the rule checker on nodes.
+package sciencerule
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValueKind is the type of a value in science rules
+type ValueKind string
+
+const (
+	// ValueString is a quoted string, e.g. 'imagesampler' or "5m"
+	ValueString ValueKind = "string"
+	// ValueNumber is a number, e.g. 0.5
+	ValueNumber ValueKind = "number"
+	// ValueDuration is an unquoted duration, e.g. 5m or 1h30m. d stands for 24h
+	ValueDuration ValueKind = "duration"
+	// ValueWord is an unquoted word that is not a number or duration,
+	// e.g. imagesampler-top or env.event.cloudmotion
+	ValueWord ValueKind = "word"
+	// ValueBool is True or False in conditions
+	ValueBool ValueKind = "bool"
+	// ValueNone is None in conditions
+	ValueNone ValueKind = "none"
+	// ValueObject is a JSON object in parameters, e.g. {"mode": "night"}
+	ValueObject ValueKind = "object"
+	// ValueExpr is an expression in parameters that is a function call or in
+	// parentheses, e.g. avg(v('env.temperature')) or (v('env.temperature') * 2)
+	ValueExpr ValueKind = "expr"
+)
+
+// Value is a literal value in science rules
+type Value struct {
+	Kind ValueKind
+	// Raw is the value as written in the rule
+	Raw string
+	// Text is the value without quotes
+	Text     string
+	Number   float64
+	Duration time.Duration
+	Bool     bool
+	Object   map[string]interface{}
+	Expr     Expr
+	// Position is the byte offset of the value in the rule
+	Position int
+}
+
+// Param is a parameter of the action. Name is empty for the positional parameter
+type Param struct {
+	Name     string
+	Value    Value
+	Position int
+}
+
+// Rule is a parsed science rule
+type Rule struct {
+	Action         string
+	ActionPosition int
+	Params         []Param
+	Condition      Expr
+	// ConditionText is the condition as written in the rule
+	ConditionText string
+}
+
+// Object returns the positional parameter of the action, which is the object
+// the action applies to
+func (r *Rule) Object() (Value, bool) {
+	for _, p := range r.Params {
+		if p.Name == "" {
+			return p.Value, true
+		}
+	}
+	return Value{}, false
+}
+
+// Keyword returns the value of the named parameter
+func (r *Rule) Keyword(name string) (Value, bool) {
+	for _, p := range r.Params {
+		if p.Name == name {
+			return p.Value, true
+		}
+	}
+	return Value{}, false
+}
+
+func (r *Rule) String() string {
+	var params []string
+	for _, p := range r.Params {
+		if p.Name == "" {
+			params = append(params, p.Value.Raw)
+		} else {
+			params = append(params, p.Name+"="+p.Value.Raw)
+		}
+	}
+	return fmt.Sprintf("%s(%s): %s", r.Action, strings.Join(params, ", "), r.Condition.String())
+}
+
+// Expr is an expression in conditions
+type Expr interface {
+	// Pos returns the byte offset of the expression in the rule
+	Pos() int
+	String() string
+}
+
+// Literal is a string, number, bool, or None
+type Literal struct {
+	Value Value
+}
+
+func (e *Literal) Pos() int { return e.Value.Position }
+
+func (e *Literal) String() string { return e.Value.Raw }
+
+// Name is a name, e.g. env.temperature
+type Name struct {
+	Name     string
+	Position int
+}
+
+func (e *Name) Pos() int { return e.Position }
+
+func (e *Name) String() string { return e.Name }
+
+// Kwarg is a keyword argument of a function call
+type Kwarg struct {
+	Name     string
+	Position int
+	Value    Expr
+}
+
+// Call is a function call, e.g. v('env.temperature', since='-5m')
+type Call struct {
+	Func     string
+	Position int
+	Args     []Expr
+	Kwargs   []*Kwarg
+}
+
+func (e *Call) Pos() int { return e.Position }
+
+func (e *Call) String() string {
+	var args []string
+	for _, a := range e.Args {
+		args = append(args, a.String())
+	}
+	for _, k := range e.Kwargs {
+		args = append(args, k.Name+"="+k.Value.String())
+	}
+	return e.Func + "(" + strings.Join(args, ", ") + ")"
+}
+
+// Kwarg returns the expression of the keyword argument
+func (e *Call) Kwarg(name string) (Expr, bool) {
+	for _, k := range e.Kwargs {
+		if k.Name == name {
+			return k.Value, true
+		}
+	}
+	return nil, false
+}
+
+// ReplaceCalls returns a copy of the expression with function calls replaced by
+// what replace returns. Calls that replace returns nil for are kept as they are,
+// with their arguments replaced. The given expression is not changed
+func ReplaceCalls(e Expr, replace func(*Call) Expr) Expr {
+	switch e := e.(type) {
+	case *Call:
+		c := &Call{Func: e.Func, Position: e.Position}
+		for _, a := range e.Args {
+			c.Args = append(c.Args, ReplaceCalls(a, replace))
+		}
+		for _, k := range e.Kwargs {
+			c.Kwargs = append(c.Kwargs, &Kwarg{Name: k.Name, Position: k.Position, Value: ReplaceCalls(k.Value, replace)})
+		}
+		if r := replace(c); r != nil {
+			return r
+		}
+		return c
+	case *UnaryExpr:
+		return &UnaryExpr{Op: e.Op, Position: e.Position, X: ReplaceCalls(e.X, replace)}
+	case *BinaryExpr:
+		return &BinaryExpr{Op: e.Op, Position: e.Position, X: ReplaceCalls(e.X, replace), Y: ReplaceCalls(e.Y, replace)}
+	case *CompareExpr:
+		c := &CompareExpr{Ops: e.Ops, Positions: e.Positions}
+		for _, x := range e.Operands {
+			c.Operands = append(c.Operands, ReplaceCalls(x, replace))
+		}
+		return c
+	case *ListExpr:
+		l := &ListExpr{Position: e.Position, Tuple: e.Tuple}
+		for _, x := range e.Elems {
+			l.Elems = append(l.Elems, ReplaceCalls(x, replace))
+		}
+		return l
+	case *IndexExpr:
+		return &IndexExpr{Position: e.Position, X: ReplaceCalls(e.X, replace), Index: ReplaceCalls(e.Index, replace)}
+	case *CondExpr:
+		return &CondExpr{Position: e.Position, X: ReplaceCalls(e.X, replace), Cond: ReplaceCalls(e.Cond, replace), Else: ReplaceCalls(e.Else, replace)}
+	default:
+		return e
+	}
+}
+
+// Children returns the expressions directly under the expression, in the order
+// they are written
+func Children(e Expr) []Expr {
+	switch e := e.(type) {
+	case *Call:
+		children := append([]Expr{}, e.Args...)
+		for _, k := range e.Kwargs {
+			children = append(children, k.Value)
+		}
+		return children
+	case *UnaryExpr:
+		return []Expr{e.X}
+	case *BinaryExpr:
+		return []Expr{e.X, e.Y}
+	case *CompareExpr:
+		return e.Operands
+	case *ListExpr:
+		return e.Elems
+	case *IndexExpr:
+		return []Expr{e.X, e.Index}
+	case *CondExpr:
+		return []Expr{e.X, e.Cond, e.Else}
+	default:
+		return nil
+	}
+}
+
+// NewLiteral returns the literal of the value at the position. Strings that are
+// numbers become numbers, and values other than numbers and booleans become strings
+func NewLiteral(v interface{}, pos int) *Literal {
+	switch v := v.(type) {
+	case nil:
+		return &Literal{Value: Value{Kind: ValueNone, Raw: "None", Text: "None", Position: pos}}
+	case bool:
+		raw := "False"
+		if v {
+			raw = "True"
+		}
+		return &Literal{Value: Value{Kind: ValueBool, Raw: raw, Text: raw, Bool: v, Position: pos}}
+	case float64:
+		raw := strconv.FormatFloat(v, 'g', -1, 64)
+		return &Literal{Value: Value{Kind: ValueNumber, Raw: raw, Text: raw, Number: v, Position: pos}}
+	case int:
+		return NewLiteral(float64(v), pos)
+	case string:
+		if n, err := strconv.ParseFloat(v, 64); err == nil && !math.IsInf(n, 0) && !math.IsNaN(n) {
+			return &Literal{Value: Value{Kind: ValueNumber, Raw: v, Text: v, Number: n, Position: pos}}
+		}
+		return &Literal{Value: Value{Kind: ValueString, Raw: strconv.Quote(v), Text: v, Position: pos}}
+	default:
+		return NewLiteral(fmt.Sprint(v), pos)
+	}
+}
+
+// UnaryExpr is not, -, or + applied to an expression
+type UnaryExpr struct {
+	Op       string
+	Position int
+	X        Expr
+}
+
+func (e *UnaryExpr) Pos() int { return e.Position }
+
+func (e *UnaryExpr) String() string {
+	if e.Op == "not" {
+		return "not " + e.X.String()
+	}
+	return e.Op + e.X.String()
+}
+
+// BinaryExpr is a boolean, comparison, or arithmetic operation
+type BinaryExpr struct {
+	Op       string
+	Position int
+	X        Expr
+	Y        Expr
+}
+
+func (e *BinaryExpr) Pos() int { return e.X.Pos() }
+
+func (e *BinaryExpr) String() string {
+	x := e.X.String()
+	// ** binds tighter than unary operators on its left, e.g. -2 ** 2 is -(2 ** 2)
+	if _, ok := e.X.(*UnaryExpr); ok && e.Op == "**" {
+		x = "(" + x + ")"
+	}
+	return "(" + x + " " + e.Op + " " + e.Y.String() + ")"
+}
+
+// CompareExpr is a chain of comparisons, e.g. 1 < v('env.temperature') < 3, which
+// holds if every comparison holds. A single comparison is a BinaryExpr
+type CompareExpr struct {
+	Ops       []string
+	Positions []int
+	// Operands has one more expression than Ops
+	Operands []Expr
+}
+
+func (e *CompareExpr) Pos() int { return e.Operands[0].Pos() }
+
+func (e *CompareExpr) String() string {
+	s := e.Operands[0].String()
+	for i, op := range e.Ops {
+		s += " " + op + " " + e.Operands[i+1].String()
+	}
+	return "(" + s + ")"
+}
+
+// ListExpr is a list, e.g. [1, 2], or a tuple, e.g. (1, 2)
+type ListExpr struct {
+	Position int
+	Elems    []Expr
+	Tuple    bool
+}
+
+func (e *ListExpr) Pos() int { return e.Position }
+
+func (e *ListExpr) String() string {
+	var elems []string
+	for _, x := range e.Elems {
+		elems = append(elems, x.String())
+	}
+	if !e.Tuple {
+		return "[" + strings.Join(elems, ", ") + "]"
+	}
+	if len(elems) == 1 {
+		return "(" + elems[0] + ",)"
+	}
+	return "(" + strings.Join(elems, ", ") + ")"
+}
+
+// IndexExpr is an element of a list, e.g. v('env.temperature', since='-5m')[0]
+type IndexExpr struct {
+	// Position is the offset of "["
+	Position int
+	X        Expr
+	Index    Expr
+}
+
+func (e *IndexExpr) Pos() int { return e.X.Pos() }
+
+func (e *IndexExpr) String() string {
+	x := e.X.String()
+	if _, ok := e.X.(*UnaryExpr); ok {
+		x = "(" + x + ")"
+	}
+	return x + "[" + e.Index.String() + "]"
+}
+
+// CondExpr is a conditional expression, e.g. 1 if v('env.raining') else 0,
+// that is X if Cond holds, or Else otherwise
+type CondExpr struct {
+	// Position is the offset of "if"
+	Position int
+	X        Expr
+	Cond     Expr
+	Else     Expr
+}
+
+func (e *CondExpr) Pos() int { return e.X.Pos() }
+
+func (e *CondExpr) String() string {
+	return "(" + e.X.String() + " if " + e.Cond.String() + " else " + e.Else.String() + ")"
+}
+
+// SyntaxError is an error in a science rule at a position
+type SyntaxError struct {
+	// Position is the byte offset in the rule where the error is found
+	Position int
+	Message  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at column %d", e.Message, e.Position+1)
+}
+
+func newSyntaxError(pos int, format string, a ...interface{}) *SyntaxError {
+	return &SyntaxError{Position: pos, Message: fmt.Sprintf(format, a...)}
+}
+
+// ParseDuration parses durations like time.ParseDuration, and also accepts
+// d for days, e.g. 1d12h
+func ParseDuration(s string) (time.Duration, error) {
+	if i := strings.Index(s, "d"); i > 0 {
+		days, err := strconv.ParseFloat(s[:i], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		d := time.Duration(days * float64(24*time.Hour))
+		if rest := s[i+1:]; rest != "" {
+			r, err := time.ParseDuration(rest)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			d += r
+		}
+		return d, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,136 @@
+package sciencerule
+
+import (
+	"sort"
+	"strings"
+)
+
+// DependencyKind is the kind of input a condition reads
+type DependencyKind string
+
+const (
+	// DependencyMeasurement is a measurement published by plugins, e.g. env.temperature
+	DependencyMeasurement DependencyKind = "measurement"
+	// DependencyScoreboard is a state in the node's scoreboard written by set()
+	DependencyScoreboard DependencyKind = "scoreboard"
+	// DependencyPluginEvent is an event the node scheduler publishes about plugins,
+	// e.g. sys.scheduler.status.plugin.complete
+	DependencyPluginEvent DependencyKind = "plugin_event"
+)
+
+// PluginEventPrefix is the prefix of measurement names that are plugin events
+const PluginEventPrefix = "sys.scheduler.status.plugin."
+
+// Dependency is an input that a condition reads
+type Dependency struct {
+	Kind DependencyKind `json:"kind"`
+	Name string         `json:"name"`
+}
+
+func (d Dependency) String() string {
+	return string(d.Kind) + ":" + d.Name
+}
+
+// NewMeasurementDependency returns the dependency on the measurement. Measurements
+// of plugin events are plugin event dependencies
+func NewMeasurementDependency(name string) Dependency {
+	if strings.HasPrefix(name, PluginEventPrefix) {
+		return Dependency{Kind: DependencyPluginEvent, Name: name}
+	}
+	return Dependency{Kind: DependencyMeasurement, Name: name}
+}
+
+// Dependencies are inputs of a condition
+type Dependencies struct {
+	Inputs []Dependency
+	// TimeBased is true if the result of the condition may change without any
+	// new input, e.g. cronjob() or v() with since=, or if the inputs are not known
+	TimeBased bool
+}
+
+// ScoreboardFunction reads a state of the node's scoreboard, e.g. scoreboard('rainy')
+const ScoreboardFunction = "scoreboard"
+
+// NewScoreboardDependency returns the dependency on the state of the scoreboard
+func NewScoreboardDependency(key string) Dependency {
+	return Dependency{Kind: DependencyScoreboard, Name: key}
+}
+
+// inputFunctions read the input of the name given as the first argument
+var inputFunctions = map[string]func(string) Dependency{
+	"v":                NewMeasurementDependency,
+	"e":                NewMeasurementDependency,
+	"rate":             NewMeasurementDependency,
+	ScoreboardFunction: NewScoreboardDependency,
+}
+
+// IsInputFunction returns true if the function reads an input, e.g. v()
+func IsInputFunction(name string) bool {
+	_, ok := inputFunctions[name]
+	return ok
+}
+
+// pureFunctions return results from their arguments only
+var pureFunctions = map[string]bool{
+	"avg":   true,
+	"sum":   true,
+	"min":   true,
+	"max":   true,
+	"last":  true,
+	"any":   true,
+	"all":   true,
+	"count": true,
+	"abs":   true,
+	"len":   true,
+}
+
+// FindDependencies returns inputs of the condition. Functions that are neither
+// input nor pure functions, e.g. cronjob() or daylight(), make the condition time-based
+func FindDependencies(e Expr) Dependencies {
+	found := make(map[Dependency]bool)
+	var d Dependencies
+	var walk func(Expr)
+	walk = func(e Expr) {
+		if c, ok := e.(*Call); ok {
+			if newDependency, ok := inputFunctions[c.Func]; ok {
+				if name, ok := literalName(c.Args); ok {
+					found[newDependency(name)] = true
+				} else {
+					d.TimeBased = true
+				}
+				if _, ok := c.Kwarg("since"); ok {
+					d.TimeBased = true
+				}
+			} else if !pureFunctions[c.Func] {
+				d.TimeBased = true
+			}
+		}
+		for _, c := range Children(e) {
+			walk(c)
+		}
+	}
+	walk(e)
+	for dep := range found {
+		d.Inputs = append(d.Inputs, dep)
+	}
+	sort.Slice(d.Inputs, func(i, j int) bool {
+		return d.Inputs[i].String() < d.Inputs[j].String()
+	})
+	// a condition without inputs, e.g. True, changes only over time
+	if len(d.Inputs) < 1 {
+		d.TimeBased = true
+	}
+	return d
+}
+
+// literalName returns the first argument if it is a string or a word
+func literalName(args []Expr) (string, bool) {
+	if len(args) < 1 {
+		return "", false
+	}
+	l, ok := args[0].(*Literal)
+	if !ok || (l.Value.Kind != ValueString && l.Value.Kind != ValueWord) {
+		return "", false
+	}
+	return l.Value.Text, true
+}
@@ -0,0 +1,77 @@
+package sciencerule
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindDependencies(t *testing.T) {
+	tests := map[string]struct {
+		Condition string
+		Inputs    []string
+		TimeBased bool
+	}{
+		"measurement": {
+			Condition: "avg(v('env.temperature')) > 30",
+			Inputs:    []string{"measurement:env.temperature"},
+		},
+		"measurements": {
+			Condition: "v('env.temperature') > 30 and not v('env.raingauge.event_acc') or v('env.temperature') < 0",
+			Inputs:    []string{"measurement:env.raingauge.event_acc", "measurement:env.temperature"},
+		},
+		"plugin event": {
+			Condition: "any(e('sys.scheduler.status.plugin.complete'))",
+			Inputs:    []string{"plugin_event:sys.scheduler.status.plugin.complete"},
+		},
+		"scoreboard": {
+			Condition: "scoreboard('rainy') == 1 and v('env.temperature') > 30",
+			Inputs:    []string{"measurement:env.temperature", "scoreboard:rainy"},
+		},
+		"nested expressions": {
+			Condition: "1 < v('env.temperature') < 3 and (scoreboard('rainy') if [v('env.mode')][0] in ('a',) else 0)",
+			Inputs:    []string{"measurement:env.mode", "measurement:env.temperature", "scoreboard:rainy"},
+		},
+		"time window": {
+			Condition: "sum(rate('env.raingauge.total_acc', since='-1h')) > 3",
+			Inputs:    []string{"measurement:env.raingauge.total_acc"},
+			TimeBased: true,
+		},
+		"cronjob": {
+			Condition: "cronjob('a', '*/5 * * * *') and v('env.temperature') > 30",
+			Inputs:    []string{"measurement:env.temperature"},
+			TimeBased: true,
+		},
+		"sun": {
+			Condition: "daylight() and sun_elevation() > 10 and v('env.temperature') > 30",
+			Inputs:    []string{"measurement:env.temperature"},
+			TimeBased: true,
+		},
+		"constant": {
+			Condition: "True",
+			TimeBased: true,
+		},
+		"unknown name": {
+			Condition: "v(env.temperature) > 30",
+			TimeBased: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			e, err := ParseCondition(test.Condition)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := FindDependencies(e)
+			var inputs []string
+			for _, dep := range d.Inputs {
+				inputs = append(inputs, dep.String())
+			}
+			if !reflect.DeepEqual(inputs, test.Inputs) {
+				t.Errorf("wanted inputs %v but got %v", test.Inputs, inputs)
+			}
+			if d.TimeBased != test.TimeBased {
+				t.Errorf("wanted time-based %t but got %t", test.TimeBased, d.TimeBased)
+			}
+		})
+	}
+}
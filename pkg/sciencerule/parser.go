@@ -0,0 +1,811 @@
+package sciencerule
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenName
+	tokenNumber
+	tokenString
+	tokenWord
+	tokenOp
+	// tokenObject is a JSON object in parameters
+	tokenObject
+)
+
+type token struct {
+	kind tokenKind
+	// text is the token as written. Strings keep their quotes
+	text string
+	pos  int
+}
+
+func (t token) describe() string {
+	if t.kind == tokenEOF {
+		return "end of rule"
+	}
+	return strconv.Quote(t.text)
+}
+
+// operators are ordered so that longer ones are matched first
+var operators = []string{"==", "!=", "<=", ">=", "**", "//", "<", ">", "=", "+", "-", "*", "/", "%", "(", ")", "[", "]", ",", ":"}
+
+// keywords are names that cannot be used as names in conditions
+var keywords = map[string]bool{"and": true, "or": true, "not": true, "in": true, "is": true, "if": true, "else": true}
+
+// lexer splits a rule into tokens. Parameters of actions are scanned as words,
+// so that plugin names like imagesampler-top and times like 06:39:00 need no quotes
+type lexer struct {
+	src string
+	pos int
+}
+
+func (l *lexer) skipSpaces() {
+	for l.pos < len(l.src) && unicode.IsSpace(rune(l.src[l.pos])) {
+		l.pos++
+	}
+}
+
+func (l *lexer) scanString() (token, error) {
+	start := l.pos
+	quote := l.src[l.pos]
+	for i := l.pos + 1; i < len(l.src); i++ {
+		switch l.src[i] {
+		case '\\':
+			i++
+		case quote:
+			l.pos = i + 1
+			return token{kind: tokenString, text: l.src[start:l.pos], pos: start}, nil
+		}
+	}
+	return token{}, newSyntaxError(start, "unterminated string")
+}
+
+// scanObject scans a JSON object up to the matching brace
+func (l *lexer) scanObject() (token, error) {
+	start := l.pos
+	depth := 0
+	for i := l.pos; i < len(l.src); i++ {
+		switch l.src[i] {
+		case '"', '\'':
+			l.pos = i
+			if _, err := l.scanString(); err != nil {
+				return token{}, err
+			}
+			i = l.pos - 1
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				l.pos = i + 1
+				return token{kind: tokenObject, text: l.src[start:l.pos], pos: start}, nil
+			}
+		}
+	}
+	return token{}, newSyntaxError(start, "unterminated object")
+}
+
+// next returns the next token in conditions
+func (l *lexer) next() (token, error) {
+	l.skipSpaces()
+	if l.pos >= len(l.src) {
+		return token{kind: tokenEOF, pos: l.pos}, nil
+	}
+	start := l.pos
+	c := rune(l.src[l.pos])
+	switch {
+	case c == '\'' || c == '"':
+		return l.scanString()
+	case unicode.IsDigit(c) || (c == '.' && l.pos+1 < len(l.src) && unicode.IsDigit(rune(l.src[l.pos+1]))):
+		for l.pos < len(l.src) && (unicode.IsDigit(rune(l.src[l.pos])) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+			l.pos++
+			if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+				l.pos++
+			}
+			for l.pos < len(l.src) && unicode.IsDigit(rune(l.src[l.pos])) {
+				l.pos++
+			}
+		}
+		return token{kind: tokenNumber, text: l.src[start:l.pos], pos: start}, nil
+	case unicode.IsLetter(c) || c == '_':
+		for l.pos < len(l.src) && isNameChar(rune(l.src[l.pos])) {
+			l.pos++
+		}
+		return token{kind: tokenName, text: l.src[start:l.pos], pos: start}, nil
+	}
+	for _, op := range operators {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokenOp, text: op, pos: start}, nil
+		}
+	}
+	return token{}, newSyntaxError(start, "unexpected %q", c)
+}
+
+// nextWord returns the next token in parameters of actions. A word ends at
+// a space, comma, or parenthesis. Unless inValue, it also ends at = or :
+// so that a missing ")" is reported where the condition begins
+func (l *lexer) nextWord(inValue bool) (token, error) {
+	l.skipSpaces()
+	if l.pos >= len(l.src) {
+		return token{kind: tokenEOF, pos: l.pos}, nil
+	}
+	start := l.pos
+	c := l.src[l.pos]
+	switch {
+	case c == '\'' || c == '"':
+		return l.scanString()
+	case inValue && c == '{':
+		return l.scanObject()
+	case strings.IndexByte("(),", c) >= 0 || (!inValue && (c == '=' || c == ':')):
+		l.pos++
+		return token{kind: tokenOp, text: string(c), pos: start}, nil
+	}
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if unicode.IsSpace(rune(c)) || strings.IndexByte("(),", c) >= 0 || (!inValue && (c == '=' || c == ':')) {
+			break
+		}
+		l.pos++
+	}
+	return token{kind: tokenWord, text: l.src[start:l.pos], pos: start}, nil
+}
+
+func isNameChar(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' || c == '.'
+}
+
+type parser struct {
+	lex *lexer
+	tok token
+}
+
+func (p *parser) advance() error {
+	t, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = t
+	return nil
+}
+
+func (p *parser) advanceWord(inValue bool) error {
+	t, err := p.lex.nextWord(inValue)
+	if err != nil {
+		return err
+	}
+	p.tok = t
+	return nil
+}
+
+func (p *parser) isOp(op string) bool {
+	return p.tok.kind == tokenOp && p.tok.text == op
+}
+
+func (p *parser) isName(name string) bool {
+	return p.tok.kind == tokenName && p.tok.text == name
+}
+
+func (p *parser) expectOp(op string) error {
+	if !p.isOp(op) {
+		return newSyntaxError(p.tok.pos, "expected %q, but found %s", op, p.tok.describe())
+	}
+	return p.advance()
+}
+
+// Parse parses a science rule
+func Parse(rule string) (*Rule, error) {
+	p := &parser{lex: &lexer{src: rule}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokenName {
+		return nil, newSyntaxError(p.tok.pos, "expected an action, but found %s", p.tok.describe())
+	}
+	r := &Rule{Action: p.tok.text, ActionPosition: p.tok.pos}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if !p.isOp("(") {
+		return nil, newSyntaxError(p.tok.pos, "expected \"(\" after action %q, but found %s", r.Action, p.tok.describe())
+	}
+	params, err := p.parseParams()
+	if err != nil {
+		return nil, err
+	}
+	r.Params = params
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if !p.isOp(":") {
+		return nil, newSyntaxError(p.tok.pos, "expected \":\" before the condition, but found %s", p.tok.describe())
+	}
+	conditionStart := p.tok.pos + 1
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokenEOF {
+		return nil, newSyntaxError(p.tok.pos, "condition is missing")
+	}
+	r.Condition, err = p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+	r.ConditionText = strings.TrimSpace(rule[conditionStart:])
+	return r, nil
+}
+
+// ParseCondition parses a condition of science rules
+func ParseCondition(condition string) (Expr, error) {
+	p := &parser{lex: &lexer{src: condition}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokenEOF {
+		return nil, newSyntaxError(p.tok.pos, "condition is missing")
+	}
+	return p.parseCondition()
+}
+
+func (p *parser) parseCondition() (Expr, error) {
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokenEOF {
+		return nil, newSyntaxError(p.tok.pos, "unexpected %s", p.tok.describe())
+	}
+	return e, nil
+}
+
+// parseParams parses parameters of the action after "(" up to ")"
+func (p *parser) parseParams() (params []Param, err error) {
+	seen := make(map[string]bool)
+	if err := p.advanceWord(false); err != nil {
+		return nil, err
+	}
+	if p.isOp(")") {
+		return nil, nil
+	}
+	for {
+		param := Param{Position: p.tok.pos}
+		if p.tok.kind != tokenWord && p.tok.kind != tokenString {
+			return nil, newSyntaxError(p.tok.pos, "expected a parameter, but found %s", p.tok.describe())
+		}
+		first := p.tok
+		if err := p.advanceWord(false); err != nil {
+			return nil, err
+		}
+		if p.isOp("=") {
+			if first.kind != tokenWord || !isParamName(first.text) {
+				return nil, newSyntaxError(first.pos, "invalid parameter name %s", first.describe())
+			}
+			if seen[first.text] {
+				return nil, newSyntaxError(first.pos, "parameter %q is given more than once", first.text)
+			}
+			seen[first.text] = true
+			param.Name = first.text
+			if err := p.advanceWord(true); err != nil {
+				return nil, err
+			}
+			if p.startsExpr() {
+				// the expression ends at "," or ")" that follows it
+				if param.Value, err = p.parseParamExpr(); err != nil {
+					return nil, err
+				}
+			} else {
+				if p.tok.kind != tokenWord && p.tok.kind != tokenString && p.tok.kind != tokenObject {
+					return nil, newSyntaxError(p.tok.pos, "expected a value of parameter %q, but found %s", param.Name, p.tok.describe())
+				}
+				if param.Value, err = newParamValue(p.tok); err != nil {
+					return nil, err
+				}
+				if err := p.advanceWord(false); err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			if len(seen) > 0 {
+				return nil, newSyntaxError(first.pos, "positional parameter %s follows keyword parameters", first.describe())
+			}
+			if param.Value, err = newParamValue(first); err != nil {
+				return nil, err
+			}
+		}
+		params = append(params, param)
+		switch {
+		case p.isOp(")"):
+			return params, nil
+		case p.isOp(","):
+			if err := p.advanceWord(false); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, newSyntaxError(p.tok.pos, "expected \",\" or \")\" after a parameter, but found %s", p.tok.describe())
+		}
+	}
+}
+
+// startsExpr returns true if the value of a parameter is an expression, that is
+// a function call, e.g. avg(v('env.temperature')), or in parentheses
+func (p *parser) startsExpr() bool {
+	if p.isOp("(") {
+		return true
+	}
+	return p.tok.kind == tokenWord && p.lex.pos < len(p.lex.src) && p.lex.src[p.lex.pos] == '(' && isParamName(p.tok.text)
+}
+
+// parseParamExpr parses the expression of a parameter value from the current token
+func (p *parser) parseParamExpr() (Value, error) {
+	start := p.tok.pos
+	p.lex.pos = start
+	if err := p.advance(); err != nil {
+		return Value{}, err
+	}
+	e, err := p.parseExpr()
+	if err != nil {
+		return Value{}, err
+	}
+	if !p.isOp(",") && !p.isOp(")") {
+		return Value{}, newSyntaxError(p.tok.pos, "expected \",\" or \")\" after an expression, but found %s", p.tok.describe())
+	}
+	raw := strings.TrimSpace(p.lex.src[start:p.tok.pos])
+	return Value{Kind: ValueExpr, Raw: raw, Text: raw, Expr: e, Position: start}, nil
+}
+
+func isParamName(s string) bool {
+	for i, c := range s {
+		if !(unicode.IsLetter(c) || c == '_' || (i > 0 && unicode.IsDigit(c))) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// newParamValue types the token as a string, number, duration, object, or word
+func newParamValue(t token) (Value, error) {
+	v := Value{Raw: t.text, Text: t.text, Position: t.pos}
+	if t.kind == tokenObject {
+		if err := json.Unmarshal([]byte(t.text), &v.Object); err != nil {
+			return v, newSyntaxError(t.pos, "invalid JSON object: %s", err.Error())
+		}
+		v.Kind = ValueObject
+		return v, nil
+	}
+	if t.kind == tokenString {
+		s, err := unquote(t)
+		if err != nil {
+			return v, err
+		}
+		v.Kind, v.Text = ValueString, s
+		return v, nil
+	}
+	if n, err := strconv.ParseFloat(t.text, 64); err == nil {
+		v.Kind, v.Number = ValueNumber, n
+	} else if d, err := ParseDuration(t.text); err == nil {
+		v.Kind, v.Duration = ValueDuration, d
+	} else {
+		v.Kind = ValueWord
+	}
+	return v, nil
+}
+
+func unquote(t token) (string, error) {
+	body := t.text[1 : len(t.text)-1]
+	if !strings.Contains(body, "\\") {
+		return body, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(body); i++ {
+		if body[i] != '\\' || i+1 == len(body) {
+			b.WriteByte(body[i])
+			continue
+		}
+		i++
+		switch body[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case '\\', '\'', '"':
+			b.WriteByte(body[i])
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(body[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// parseExpr parses an expression, which may be a conditional expression
+func (p *parser) parseExpr() (Expr, error) {
+	x, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isName("if") {
+		return x, nil
+	}
+	pos := p.tok.pos
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isName("else") {
+		return nil, newSyntaxError(p.tok.pos, "expected \"else\", but found %s", p.tok.describe())
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	y, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return &CondExpr{Position: pos, X: x, Cond: cond, Else: y}, nil
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	x, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isName("or") {
+		pos := p.tok.pos
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		y, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		x = &BinaryExpr{Op: "or", Position: pos, X: x, Y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	x, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isName("and") {
+		pos := p.tok.pos
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		y, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		x = &BinaryExpr{Op: "and", Position: pos, X: x, Y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseNot() (Expr, error) {
+	if !p.isName("not") {
+		return p.parseComparison()
+	}
+	pos := p.tok.pos
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	x, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	return &UnaryExpr{Op: "not", Position: pos, X: x}, nil
+}
+
+// parseComparison parses comparisons. Comparisons chain as in Python, e.g.
+// 1 < v('env.temperature') < 3
+func (p *parser) parseComparison() (Expr, error) {
+	x, err := p.parseArith()
+	if err != nil {
+		return nil, err
+	}
+	c := &CompareExpr{Operands: []Expr{x}}
+	for {
+		op, pos := "", p.tok.pos
+		switch {
+		case p.isOp("=="), p.isOp("!="), p.isOp("<"), p.isOp("<="), p.isOp(">"), p.isOp(">="):
+			op = p.tok.text
+		case p.isOp("="):
+			return nil, newSyntaxError(p.tok.pos, "unexpected \"=\"; use \"==\" to compare values")
+		case p.isName("in"):
+			op = "in"
+		case p.isName("is"):
+			op = "is"
+		case p.isName("not"):
+			// not is a comparison only in "not in"
+			save, lexPos := p.tok, p.lex.pos
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if !p.isName("in") {
+				p.tok, p.lex.pos = save, lexPos
+				break
+			}
+			op = "not in"
+		}
+		if op == "" {
+			break
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if op == "is" && p.isName("not") {
+			op = "is not"
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		}
+		y, err := p.parseArith()
+		if err != nil {
+			return nil, err
+		}
+		c.Ops = append(c.Ops, op)
+		c.Positions = append(c.Positions, pos)
+		c.Operands = append(c.Operands, y)
+	}
+	switch len(c.Ops) {
+	case 0:
+		return x, nil
+	case 1:
+		return &BinaryExpr{Op: c.Ops[0], Position: c.Positions[0], X: c.Operands[0], Y: c.Operands[1]}, nil
+	}
+	return c, nil
+}
+
+func (p *parser) parseArith() (Expr, error) {
+	x, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("+") || p.isOp("-") {
+		op, pos := p.tok.text, p.tok.pos
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		y, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		x = &BinaryExpr{Op: op, Position: pos, X: x, Y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseTerm() (Expr, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("*") || p.isOp("/") || p.isOp("//") || p.isOp("%") {
+		op, pos := p.tok.text, p.tok.pos
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		x = &BinaryExpr{Op: op, Position: pos, X: x, Y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if !p.isOp("-") && !p.isOp("+") {
+		return p.parsePower()
+	}
+	op, pos := p.tok.text, p.tok.pos
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return &UnaryExpr{Op: op, Position: pos, X: x}, nil
+}
+
+// parsePower parses **, which binds tighter than unary operators on its left
+// and groups from the right, e.g. -2 ** -1 ** 2 is -(2 ** (-(1 ** 2)))
+func (p *parser) parsePower() (Expr, error) {
+	x, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOp("**") {
+		return x, nil
+	}
+	pos := p.tok.pos
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	y, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return &BinaryExpr{Op: "**", Position: pos, X: x, Y: y}, nil
+}
+
+// parsePostfix parses subscripts that follow a primary expression, e.g. x[0]
+func (p *parser) parsePostfix() (Expr, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("[") {
+		pos := p.tok.pos
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		i, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectOp("]"); err != nil {
+			return nil, err
+		}
+		x = &IndexExpr{Position: pos, X: x, Index: i}
+	}
+	return x, nil
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	t := p.tok
+	switch t.kind {
+	case tokenEOF:
+		return nil, newSyntaxError(t.pos, "unexpected end of condition")
+	case tokenString:
+		s, err := unquote(t)
+		if err != nil {
+			return nil, err
+		}
+		return &Literal{Value: Value{Kind: ValueString, Raw: t.text, Text: s, Position: t.pos}}, p.advance()
+	case tokenNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, newSyntaxError(t.pos, "invalid number %q", t.text)
+		}
+		return &Literal{Value: Value{Kind: ValueNumber, Raw: t.text, Text: t.text, Number: n, Position: t.pos}}, p.advance()
+	case tokenOp:
+		switch t.text {
+		case "(":
+			return p.parseParen()
+		case "[":
+			return p.parseList()
+		}
+		return nil, newSyntaxError(t.pos, "unexpected %s", t.describe())
+	}
+	switch t.text {
+	case "True", "False":
+		return &Literal{Value: Value{Kind: ValueBool, Raw: t.text, Text: t.text, Bool: t.text == "True", Position: t.pos}}, p.advance()
+	case "None":
+		return &Literal{Value: Value{Kind: ValueNone, Raw: t.text, Text: t.text, Position: t.pos}}, p.advance()
+	}
+	if keywords[t.text] {
+		return nil, newSyntaxError(t.pos, "unexpected %s", t.describe())
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if !p.isOp("(") {
+		return &Name{Name: t.text, Position: t.pos}, nil
+	}
+	return p.parseCall(t)
+}
+
+// parseParen parses an expression in parentheses, or a tuple if it has commas
+func (p *parser) parseParen() (Expr, error) {
+	pos := p.tok.pos
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.isOp(")") {
+		return &ListExpr{Position: pos, Tuple: true}, p.advance()
+	}
+	x, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOp(",") {
+		return x, p.expectOp(")")
+	}
+	tuple := &ListExpr{Position: pos, Elems: []Expr{x}, Tuple: true}
+	for p.isOp(",") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.isOp(")") {
+			break
+		}
+		x, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		tuple.Elems = append(tuple.Elems, x)
+	}
+	return tuple, p.expectOp(")")
+}
+
+// parseList parses elements of a list after "[" up to "]"
+func (p *parser) parseList() (Expr, error) {
+	list := &ListExpr{Position: p.tok.pos}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	for !p.isOp("]") {
+		x, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		list.Elems = append(list.Elems, x)
+		if !p.isOp(",") {
+			break
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	return list, p.expectOp("]")
+}
+
+// parseCall parses arguments of the function after "(" up to ")"
+func (p *parser) parseCall(name token) (Expr, error) {
+	call := &Call{Func: name.text, Position: name.pos}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	for !p.isOp(")") {
+		if len(call.Args)+len(call.Kwargs) > 0 {
+			if err := p.expectOp(","); err != nil {
+				return nil, err
+			}
+		}
+		// a name followed by = is a keyword argument
+		if p.tok.kind == tokenName {
+			save, lexPos := p.tok, p.lex.pos
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if p.isOp("=") {
+				if err := p.advance(); err != nil {
+					return nil, err
+				}
+				v, err := p.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				call.Kwargs = append(call.Kwargs, &Kwarg{Name: save.text, Position: save.pos, Value: v})
+				continue
+			}
+			p.tok, p.lex.pos = save, lexPos
+		}
+		if len(call.Kwargs) > 0 {
+			return nil, newSyntaxError(p.tok.pos, "positional argument follows keyword arguments in %s()", call.Func)
+		}
+		a, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, a)
+	}
+	return call, p.advance()
+}
@@ -0,0 +1,264 @@
+package sciencerule
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	type param struct {
+		Name string
+		Kind ValueKind
+		Text string
+	}
+	tests := map[string]struct {
+		Rule      string
+		Action    string
+		Params    []param
+		Condition string
+		// AST is the condition printed back from the AST
+		AST string
+	}{
+		"schedule": {
+			Rule:      "schedule(plugin-a): True",
+			Action:    "schedule",
+			Params:    []param{{"", ValueWord, "plugin-a"}},
+			Condition: "True",
+			AST:       "True",
+		},
+		"typed parameters": {
+			Rule:   `schedule('plugin-a', duration=5m, count=3, note="a, b"): v('env.temperature') > 20`,
+			Action: "schedule",
+			Params: []param{
+				{"", ValueString, "plugin-a"},
+				{"duration", ValueDuration, "5m"},
+				{"count", ValueNumber, "3"},
+				{"note", ValueString, "a, b"},
+			},
+			Condition: "v('env.temperature') > 20",
+			AST:       "(v('env.temperature') > 20)",
+		},
+		"time as a value": {
+			Rule:      "set(sys.time.sunrise, value=06:39:00): True",
+			Action:    "set",
+			Params:    []param{{"", ValueWord, "sys.time.sunrise"}, {"value", ValueWord, "06:39:00"}},
+			Condition: "True",
+			AST:       "True",
+		},
+		"= in a value": {
+			Rule:      "publish(env.event, to=a=b): True",
+			Action:    "publish",
+			Params:    []param{{"", ValueWord, "env.event"}, {"to", ValueWord, "a=b"}},
+			Condition: "True",
+			AST:       "True",
+		},
+		"): in a condition string": {
+			Rule:      "schedule(plugin-a): v('a):b') == 'x, y'",
+			Action:    "schedule",
+			Params:    []param{{"", ValueWord, "plugin-a"}},
+			Condition: "v('a):b') == 'x, y'",
+			AST:       "(v('a):b') == 'x, y')",
+		},
+		"expression as a value": {
+			Rule:   "publish(env.avg, value=avg(v('env.temperature', since='-5m')), to=cloud): True",
+			Action: "publish",
+			Params: []param{
+				{"", ValueWord, "env.avg"},
+				{"value", ValueExpr, "avg(v('env.temperature', since='-5m'))"},
+				{"to", ValueWord, "cloud"},
+			},
+			Condition: "True",
+			AST:       "True",
+		},
+		"parenthesized expression as a value": {
+			Rule:      "set(doubled, value=(v('env.count') * 2)): True",
+			Action:    "set",
+			Params:    []param{{"", ValueWord, "doubled"}, {"value", ValueExpr, "(v('env.count') * 2)"}},
+			Condition: "True",
+			AST:       "True",
+		},
+		"object as a value": {
+			Rule:      `publish(env.mode, value={"mode": "night, dark", "level": {"min": 1}}): True`,
+			Action:    "publish",
+			Params:    []param{{"", ValueWord, "env.mode"}, {"value", ValueObject, `{"mode": "night, dark", "level": {"min": 1}}`}},
+			Condition: "True",
+			AST:       "True",
+		},
+		"precedence": {
+			Rule:      "schedule(p): not a() or b() and c() > 1 + 2 * -3",
+			Action:    "schedule",
+			Params:    []param{{"", ValueWord, "p"}},
+			Condition: "not a() or b() and c() > 1 + 2 * -3",
+			AST:       "(not a() or (b() and (c() > (1 + (2 * -3)))))",
+		},
+		"chained comparison": {
+			Rule:      "schedule(p): 1 < v('x') < 3",
+			Action:    "schedule",
+			Params:    []param{{"", ValueWord, "p"}},
+			Condition: "1 < v('x') < 3",
+			AST:       "(1 < v('x') < 3)",
+		},
+		"power": {
+			Rule:      "schedule(p): -v('x') ** 2 > 2 ** -1 ** 2",
+			Action:    "schedule",
+			Params:    []param{{"", ValueWord, "p"}},
+			Condition: "-v('x') ** 2 > 2 ** -1 ** 2",
+			AST:       "(-(v('x') ** 2) > (2 ** -(1 ** 2)))",
+		},
+		"floor division": {
+			Rule:      "schedule(p): v('x') // 2 == 1",
+			Action:    "schedule",
+			Params:    []param{{"", ValueWord, "p"}},
+			Condition: "v('x') // 2 == 1",
+			AST:       "((v('x') // 2) == 1)",
+		},
+		"subscript": {
+			Rule:      "schedule(p): v('x', since='-5m')[0] > x[-1][0]",
+			Action:    "schedule",
+			Params:    []param{{"", ValueWord, "p"}},
+			Condition: "v('x', since='-5m')[0] > x[-1][0]",
+			AST:       "(v('x', since='-5m')[0] > x[-1][0])",
+		},
+		"in a list": {
+			Rule:      "schedule(p): v('x') in [1, 2] and v('y') not in ('a',) and v('z') in []",
+			Action:    "schedule",
+			Params:    []param{{"", ValueWord, "p"}},
+			Condition: "v('x') in [1, 2] and v('y') not in ('a',) and v('z') in []",
+			AST:       "(((v('x') in [1, 2]) and (v('y') not in ('a',))) and (v('z') in []))",
+		},
+		"identity": {
+			Rule:      "schedule(p): v('x') is not None",
+			Action:    "schedule",
+			Params:    []param{{"", ValueWord, "p"}},
+			Condition: "v('x') is not None",
+			AST:       "(v('x') is not None)",
+		},
+		"conditional expression": {
+			Rule:      "set(level, value=(1 if v('x') > 0 else 2 if v('y') else 3)): not a() if b() else c()",
+			Action:    "set",
+			Params:    []param{{"", ValueWord, "level"}, {"value", ValueExpr, "(1 if v('x') > 0 else 2 if v('y') else 3)"}},
+			Condition: "not a() if b() else c()",
+			AST:       "(not a() if b() else c())",
+		},
+		"keyword arguments": {
+			Rule:      "schedule(p): avg(v('env.temperature', since='-5m')) >= 10.5",
+			Action:    "schedule",
+			Params:    []param{{"", ValueWord, "p"}},
+			Condition: "avg(v('env.temperature', since='-5m')) >= 10.5",
+			AST:       "(avg(v('env.temperature', since='-5m')) >= 10.5)",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r, err := Parse(test.Rule)
+			if err != nil {
+				t.Fatalf("failed to parse %q: %s", test.Rule, err.Error())
+			}
+			if r.Action != test.Action {
+				t.Errorf("wanted action %q but found %q", test.Action, r.Action)
+			}
+			var params []param
+			for _, p := range r.Params {
+				params = append(params, param{p.Name, p.Value.Kind, p.Value.Text})
+			}
+			if !reflect.DeepEqual(params, test.Params) {
+				t.Errorf("wanted parameters %v but found %v", test.Params, params)
+			}
+			if r.ConditionText != test.Condition {
+				t.Errorf("wanted condition %q but found %q", test.Condition, r.ConditionText)
+			}
+			if r.Condition.String() != test.AST {
+				t.Errorf("wanted AST %q but found %q", test.AST, r.Condition.String())
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]struct {
+		Rule     string
+		Position int
+	}{
+		"missing )":                 {Rule: "schedule(plugin-a: True", Position: 17},
+		"missing :":                 {Rule: "schedule(plugin-a) True", Position: 19},
+		"missing condition":         {Rule: "schedule(plugin-a):  ", Position: 21},
+		"no action":                 {Rule: "(plugin-a): True", Position: 0},
+		"duplicate keyword":         {Rule: "schedule(p, a=1, a=2): True", Position: 17},
+		"positional after keyword":  {Rule: "schedule(p, a=1, b): True", Position: 17},
+		"unterminated string":       {Rule: "schedule(p): v('env) > 1", Position: 15},
+		"= instead of ==":           {Rule: "schedule(p): v('a') = 1", Position: 20},
+		"unclosed parenthesis":      {Rule: "schedule(p): (v('a') > 1", Position: 24},
+		"trailing token":            {Rule: "schedule(p): True False", Position: 18},
+		"unexpected character":      {Rule: "schedule(p): v('a') > $1", Position: 22},
+		"invalid object":            {Rule: "publish(e, value={mode: 1}): True", Position: 17},
+		"unterminated object":       {Rule: "publish(e, value={\"a\": 1): True", Position: 17},
+		"unclosed value expression": {Rule: "publish(e, value=avg(v('a')): True", Position: 28},
+		"unclosed list":             {Rule: "schedule(p): v('a') in [1, 2", Position: 28},
+		"unclosed subscript":        {Rule: "schedule(p): x[0 > 1", Position: 20},
+		"missing else":              {Rule: "schedule(p): 1 if a()", Position: 21},
+		"keyword as a name":         {Rule: "schedule(p): in > 1", Position: 13},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse(test.Rule)
+			if err == nil {
+				t.Fatalf("wanted to fail parsing %q but succeeded", test.Rule)
+			}
+			e, ok := err.(*SyntaxError)
+			if !ok {
+				t.Fatalf("wanted a syntax error but found %T: %s", err, err.Error())
+			}
+			if e.Position != test.Position {
+				t.Errorf("wanted error at %d but found at %d: %s", test.Position, e.Position, e.Error())
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"5m":    5 * time.Minute,
+		"1h30m": 90 * time.Minute,
+		"1d":    24 * time.Hour,
+		"1d12h": 36 * time.Hour,
+	}
+	for s, want := range tests {
+		d, err := ParseDuration(s)
+		if err != nil {
+			t.Errorf("failed to parse %q: %s", s, err.Error())
+		} else if d != want {
+			t.Errorf("wanted %s for %q but found %s", want, s, d)
+		}
+	}
+	for _, s := range []string{"", "d", "1x", "cloud"} {
+		if _, err := ParseDuration(s); err == nil {
+			t.Errorf("wanted to fail parsing %q", s)
+		}
+	}
+}
+
+func TestReplaceCalls(t *testing.T) {
+	condition := "scoreboard('rainy') == 1 and avg(v('env.temperature')) > scoreboard('threshold') and 0 < [scoreboard('rainy')][0] < 2"
+	e, err := ParseCondition(condition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := map[string]interface{}{"rainy": "1", "threshold": "hot"}
+	replaced := ReplaceCalls(e, func(c *Call) Expr {
+		if c.Func != ScoreboardFunction {
+			return nil
+		}
+		return NewLiteral(states[c.Args[0].(*Literal).Value.Text], c.Position)
+	})
+	want := `(((1 == 1) and (avg(v('env.temperature')) > "hot")) and (0 < [1][0] < 2))`
+	if replaced.String() != want {
+		t.Errorf("wanted %s but found %s", want, replaced.String())
+	}
+	if e.String() == replaced.String() {
+		t.Errorf("the given expression must not be changed")
+	}
+	if _, err := ParseCondition(replaced.String()); err != nil {
+		t.Errorf("failed to parse the replaced expression: %s", err.Error())
+	}
+}
@@ -0,0 +1,204 @@
+package sciencerule
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Solar functions are computed by the node scheduler from the location of the node
+// and the current time, without any network access
+const (
+	// DaylightFunction is valid while the sun is above the horizon, e.g. daylight()
+	// or daylight(twilight='civil')
+	DaylightFunction = "daylight"
+	// SunriseFunction is valid in the minute of sunrise, e.g. sunrise(offset='-30m')
+	SunriseFunction = "sunrise"
+	// SunsetFunction is valid in the minute of sunset, e.g. sunset(twilight='civil') at civil dusk
+	SunsetFunction = "sunset"
+	// SunElevationFunction returns the elevation of the sun in degrees, e.g. sun_elevation() > 10
+	SunElevationFunction = "sun_elevation"
+)
+
+var solarFunctions = map[string]bool{
+	DaylightFunction:     true,
+	SunriseFunction:      true,
+	SunsetFunction:       true,
+	SunElevationFunction: true,
+}
+
+// IsSolarFunction returns true if the function is computed from the position of the sun
+func IsSolarFunction(name string) bool {
+	return solarFunctions[name]
+}
+
+// twilightAngles are elevations of the center of the sun in degrees at which the sun
+// rises and sets. The default accounts for the radius of the sun and refraction
+var twilightAngles = map[string]float64{
+	"":             -0.833,
+	"civil":        -6,
+	"nautical":     -12,
+	"astronomical": -18,
+}
+
+// Location is where the node is in degrees. Longitude is positive to the east
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// ParseLocation parses latitude and longitude separated by a comma, e.g. 41.7,-87.98
+func ParseLocation(s string) (Location, error) {
+	sp := strings.Split(s, ",")
+	if len(sp) != 2 {
+		return Location{}, fmt.Errorf("location %q must be latitude,longitude", s)
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(sp[0]), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return Location{}, fmt.Errorf("invalid latitude %q", sp[0])
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(sp[1]), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return Location{}, fmt.Errorf("invalid longitude %q", sp[1])
+	}
+	return Location{Latitude: lat, Longitude: lon}, nil
+}
+
+func (l Location) String() string {
+	return fmt.Sprintf("%g,%g", l.Latitude, l.Longitude)
+}
+
+const (
+	degree = math.Pi / 180
+	// j2000 is the Julian date of 2000-01-01 12:00 UTC
+	j2000 = 2451545.0
+	// unixEpoch is the Julian date of 1970-01-01 00:00 UTC
+	unixEpoch = 2440587.5
+)
+
+func julianDate(t time.Time) float64 {
+	return float64(t.UnixNano())/float64(24*time.Hour) + unixEpoch
+}
+
+func fromJulianDate(jd float64) time.Time {
+	return time.Unix(0, int64((jd-unixEpoch)*float64(24*time.Hour))).UTC()
+}
+
+// SunElevation returns the elevation of the center of the sun in degrees at the
+// location and time, without refraction. It is accurate to about 0.01 degrees
+func SunElevation(t time.Time, loc Location) float64 {
+	d := julianDate(t) - j2000
+	g := (357.529 + 0.98560028*d) * degree
+	q := 280.459 + 0.98564736*d
+	l := (q + 1.915*math.Sin(g) + 0.020*math.Sin(2*g)) * degree
+	e := (23.439 - 0.00000036*d) * degree
+	ra := math.Atan2(math.Cos(e)*math.Sin(l), math.Cos(l))
+	dec := math.Asin(math.Sin(e) * math.Sin(l))
+	gmst := (280.46061837 + 360.98564736629*d) * degree
+	h := gmst + loc.Longitude*degree - ra
+	lat := loc.Latitude * degree
+	return math.Asin(math.Sin(lat)*math.Sin(dec)+math.Cos(lat)*math.Cos(dec)*math.Cos(h)) / degree
+}
+
+// SunriseSunset returns when the sun rises above and sets below the angle in degrees
+// on the solar day of the location that t falls in. The solar day runs from local
+// midnight to midnight in mean solar time. It returns false if the sun stays above
+// or below the angle all day
+func SunriseSunset(t time.Time, loc Location, angle float64) (sunrise time.Time, sunset time.Time, ok bool) {
+	// mean solar noon nearest to t, in days since J2000
+	n := math.Round(julianDate(t) - j2000 + loc.Longitude/360)
+	noon := n - loc.Longitude/360
+	m := math.Mod(357.5291+0.98560028*noon, 360) * degree
+	c := 1.9148*math.Sin(m) + 0.0200*math.Sin(2*m) + 0.0003*math.Sin(3*m)
+	lambda := math.Mod(m/degree+c+180+102.9372, 360) * degree
+	transit := j2000 + noon + 0.0053*math.Sin(m) - 0.0069*math.Sin(2*lambda)
+	dec := math.Asin(math.Sin(lambda) * math.Sin(23.4397*degree))
+	lat := loc.Latitude * degree
+	cosHourAngle := (math.Sin(angle*degree) - math.Sin(lat)*math.Sin(dec)) / (math.Cos(lat) * math.Cos(dec))
+	if cosHourAngle < -1 || cosHourAngle > 1 {
+		return time.Time{}, time.Time{}, false
+	}
+	hourAngle := math.Acos(cosHourAngle) / degree
+	return fromJulianDate(transit - hourAngle/360), fromJulianDate(transit + hourAngle/360), true
+}
+
+// solarArgs returns the twilight angle and offset given to the solar function call
+func solarArgs(c *Call) (angle float64, offset time.Duration, err error) {
+	if len(c.Args) > 0 {
+		return 0, 0, fmt.Errorf("%s() takes keyword arguments only at column %d", c.Func, c.Position+1)
+	}
+	angle = twilightAngles[""]
+	for _, k := range c.Kwargs {
+		l, ok := k.Value.(*Literal)
+		if !ok {
+			return 0, 0, fmt.Errorf("%s of %s() must be a literal at column %d", k.Name, c.Func, k.Position+1)
+		}
+		switch {
+		case k.Name == "twilight" && c.Func != SunElevationFunction:
+			a, exist := twilightAngles[l.Value.Text]
+			if !exist || l.Value.Text == "" {
+				return 0, 0, fmt.Errorf("twilight must be civil, nautical, or astronomical at column %d", k.Position+1)
+			}
+			angle = a
+		case k.Name == "offset" && (c.Func == SunriseFunction || c.Func == SunsetFunction):
+			if l.Value.Kind != ValueString {
+				return 0, 0, fmt.Errorf("offset must be a quoted duration, e.g. '-30m', at column %d", k.Position+1)
+			}
+			if offset, err = ParseDuration(l.Value.Text); err != nil {
+				return 0, 0, fmt.Errorf("invalid offset %q at column %d", l.Value.Text, k.Position+1)
+			}
+		default:
+			return 0, 0, fmt.Errorf("%s() does not take %s= at column %d", c.Func, k.Name, k.Position+1)
+		}
+	}
+	return
+}
+
+// SolarEvent returns the time of the sunrise() or sunset() call, with its offset, on
+// the solar day of t. It returns false if the sun does not rise or set on the day
+func SolarEvent(c *Call, t time.Time, loc Location) (time.Time, bool, error) {
+	if c.Func != SunriseFunction && c.Func != SunsetFunction {
+		return time.Time{}, false, fmt.Errorf("%s() is not sunrise() or sunset()", c.Func)
+	}
+	angle, offset, err := solarArgs(c)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	// the event is on the solar day of t before the offset, so that an offset
+	// across midnight still refers to the sunrise or sunset near t
+	sunrise, sunset, ok := SunriseSunset(t.Add(-offset), loc, angle)
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	if c.Func == SunsetFunction {
+		return sunset.Add(offset), true, nil
+	}
+	return sunrise.Add(offset), true, nil
+}
+
+// EvaluateSolarFunction returns the result of the solar function call at the time and
+// location. sunrise() and sunset() are valid in the minute of the event
+func EvaluateSolarFunction(c *Call, t time.Time, loc Location) (interface{}, error) {
+	switch c.Func {
+	case DaylightFunction, SunElevationFunction:
+		angle, _, err := solarArgs(c)
+		if err != nil {
+			return nil, err
+		}
+		elevation := SunElevation(t, loc)
+		if c.Func == SunElevationFunction {
+			return elevation, nil
+		}
+		return elevation > angle, nil
+	case SunriseFunction, SunsetFunction:
+		event, ok, err := SolarEvent(c, t, loc)
+		if err != nil || !ok {
+			return false, err
+		}
+		return event.Truncate(time.Minute).Equal(t.Truncate(time.Minute)), nil
+	default:
+		return nil, fmt.Errorf("%s() is not a solar function", c.Func)
+	}
+}
@@ -0,0 +1,172 @@
+package sciencerule
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// chicago is where the sunrise and sunset times of the tests are published
+var chicago = Location{Latitude: 41.8781, Longitude: -87.6298}
+
+func mustParseTime(t *testing.T, s string) time.Time {
+	v, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestParseLocation(t *testing.T) {
+	tests := map[string]struct {
+		Location string
+		Want     Location
+		Error    bool
+	}{
+		"Location":         {Location: "41.8781, -87.6298", Want: chicago},
+		"Missing":          {Location: "41.8781", Error: true},
+		"Invalid latitude": {Location: "91,-87.6298", Error: true},
+		"Not a number":     {Location: "41.8781,west", Error: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			loc, err := ParseLocation(test.Location)
+			if test.Error {
+				if err == nil {
+					t.Errorf("expected error, got %v", loc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loc != test.Want {
+				t.Errorf("expected %v, got %v", test.Want, loc)
+			}
+		})
+	}
+}
+
+func TestSunriseSunset(t *testing.T) {
+	tests := map[string]struct {
+		Time     string
+		Angle    float64
+		Location Location
+		Sunrise  string
+		Sunset   string
+		NoEvents bool
+	}{
+		// published as 5:15 and 20:29 CDT
+		"Summer solstice": {Time: "2024-06-21T17:00:00Z", Angle: -0.833, Location: chicago, Sunrise: "2024-06-21T10:15:00Z", Sunset: "2024-06-22T01:29:00Z"},
+		// the sunset after midnight in UTC is on the same solar day
+		"After midnight in UTC": {Time: "2024-06-22T03:00:00Z", Angle: -0.833, Location: chicago, Sunrise: "2024-06-21T10:15:00Z", Sunset: "2024-06-22T01:29:00Z"},
+		// published as 4:42 and 21:02 CDT
+		"Civil twilight": {Time: "2024-06-21T17:00:00Z", Angle: -6, Location: chicago, Sunrise: "2024-06-21T09:42:00Z", Sunset: "2024-06-22T02:02:00Z"},
+		// published as 7:17 and 16:22 CST
+		"Winter solstice": {Time: "2024-12-21T18:00:00Z", Angle: -0.833, Location: chicago, Sunrise: "2024-12-21T13:17:00Z", Sunset: "2024-12-21T22:22:00Z"},
+		"Polar night":     {Time: "2024-12-21T12:00:00Z", Angle: -0.833, Location: Location{Latitude: 78.2, Longitude: 15.6}, NoEvents: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			sunrise, sunset, ok := SunriseSunset(mustParseTime(t, test.Time), test.Location, test.Angle)
+			if test.NoEvents {
+				if ok {
+					t.Errorf("expected no sunrise and sunset, got %s and %s", sunrise, sunset)
+				}
+				return
+			}
+			if !ok {
+				t.Fatal("expected sunrise and sunset")
+			}
+			for _, got := range []struct {
+				Name string
+				Want string
+				Time time.Time
+			}{{"sunrise", test.Sunrise, sunrise}, {"sunset", test.Sunset, sunset}} {
+				if d := got.Time.Sub(mustParseTime(t, got.Want)); d < -2*time.Minute || d > 2*time.Minute {
+					t.Errorf("expected %s at %s, got %s", got.Name, got.Want, got.Time.Format(time.RFC3339))
+				}
+			}
+		})
+	}
+}
+
+func TestSunElevation(t *testing.T) {
+	tests := map[string]struct {
+		Time string
+		Want float64
+	}{
+		// the sun is 90 - 41.88 degrees high at solar noon on the equinox
+		"Equinox noon": {Time: "2024-03-20T17:59:00Z", Want: 48.2},
+		// the sun is 0.833 degrees below at published sunrise
+		"Sunrise":  {Time: "2024-06-21T10:15:00Z", Want: -0.833},
+		"Midnight": {Time: "2024-06-22T05:49:00Z", Want: -24.7},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := SunElevation(mustParseTime(t, test.Time), chicago)
+			if math.Abs(got-test.Want) > 0.5 {
+				t.Errorf("expected %.2f degrees, got %.2f", test.Want, got)
+			}
+		})
+	}
+}
+
+func TestEvaluateSolarFunction(t *testing.T) {
+	tests := map[string]struct {
+		Condition string
+		Time      string
+		Want      interface{}
+		Error     bool
+	}{
+		"Daylight at noon":        {Condition: "daylight()", Time: "2024-06-21T17:00:00Z", Want: true},
+		"Daylight at night":       {Condition: "daylight()", Time: "2024-06-22T05:00:00Z", Want: false},
+		"Civil twilight at dusk":  {Condition: "daylight(twilight='civil')", Time: "2024-06-22T01:45:00Z", Want: true},
+		"Sunrise in the minute":   {Condition: "sunrise()", Time: "2024-06-21T10:15:30Z", Want: true},
+		"Sunrise before":          {Condition: "sunrise()", Time: "2024-06-21T10:10:00Z", Want: false},
+		"Sunrise with offset":     {Condition: "sunrise(offset='-30m')", Time: "2024-06-21T09:45:10Z", Want: true},
+		"Sunset with offset":      {Condition: "sunset(offset='1h')", Time: "2024-06-22T02:29:10Z", Want: true},
+		"Civil dusk":              {Condition: "sunset(twilight='civil')", Time: "2024-06-22T02:02:10Z", Want: true},
+		"Unknown twilight":        {Condition: "sunset(twilight='golden')", Time: "2024-06-22T02:02:10Z", Error: true},
+		"Invalid offset":          {Condition: "sunrise(offset='soon')", Time: "2024-06-21T10:15:30Z", Error: true},
+		"Positional argument":     {Condition: "daylight('civil')", Time: "2024-06-21T17:00:00Z", Error: true},
+		"Offset without an event": {Condition: "daylight(offset='1h')", Time: "2024-06-21T17:00:00Z", Error: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			e, err := ParseCondition(test.Condition)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, ok := e.(*Call)
+			if !ok {
+				t.Fatalf("%s is not a call", test.Condition)
+			}
+			now := mustParseTime(t, test.Time)
+			// the sunrise and sunset may be off by a minute
+			if v, ok := test.Want.(bool); ok && v && (c.Func == SunriseFunction || c.Func == SunsetFunction) {
+				event, _, err := SolarEvent(c, now, chicago)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if d := event.Sub(now); d < -2*time.Minute || d > 2*time.Minute {
+					t.Errorf("expected %s near %s, got %s", test.Condition, test.Time, event.Format(time.RFC3339))
+				}
+				now = event
+			}
+			got, err := EvaluateSolarFunction(c, now, chicago)
+			if test.Error {
+				if err == nil {
+					t.Errorf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.Want {
+				t.Errorf("expected %v, got %v", test.Want, got)
+			}
+		})
+	}
+}
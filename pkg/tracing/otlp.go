@@ -0,0 +1,235 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+)
+
+var tracingLog = logger.New("tracing")
+
+const (
+	otlpTracesPath       = "/v1/traces"
+	otlpSpanKindInternal = 1
+	otlpStatusOk         = 1
+	otlpStatusError      = 2
+)
+
+// The types below are the subset of the OTLP/JSON encoding of traces used by the scheduler.
+// See https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto
+type otlpTracesData struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func toOTLPAttributes(attributes map[string]string) (kvs []otlpKeyValue) {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		kvs = append(kvs, otlpKeyValue{Key: k, Value: otlpAnyValue{StringValue: attributes[k]}})
+	}
+	return
+}
+
+func fromOTLPAttributes(kvs []otlpKeyValue) map[string]string {
+	attributes := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		attributes[kv.Key] = kv.Value.StringValue
+	}
+	return attributes
+}
+
+func toUnixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func fromUnixNano(s string) (time.Time, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse time %q: %s", s, err.Error())
+	}
+	return time.Unix(0, n), nil
+}
+
+// EncodeOTLP encodes spans in OTLP/JSON. Spans are grouped by their service
+func EncodeOTLP(spans []*Span) ([]byte, error) {
+	var services []string
+	spansByService := make(map[string][]otlpSpan)
+	for _, s := range spans {
+		o := otlpSpan{
+			TraceID:           s.TraceID,
+			SpanID:            s.SpanID,
+			ParentSpanID:      s.ParentSpanID,
+			Name:              s.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: toUnixNano(s.Start),
+			EndTimeUnixNano:   toUnixNano(s.End),
+			Attributes:        toOTLPAttributes(s.Attributes),
+			Status:            otlpStatus{Code: otlpStatusOk},
+		}
+		if s.Error != "" {
+			o.Status = otlpStatus{Code: otlpStatusError, Message: s.Error}
+		}
+		for _, e := range s.Events {
+			o.Events = append(o.Events, otlpEvent{
+				TimeUnixNano: toUnixNano(e.Time),
+				Name:         e.Name,
+				Attributes:   toOTLPAttributes(e.Attributes),
+			})
+		}
+		if _, exist := spansByService[s.Service]; !exist {
+			services = append(services, s.Service)
+		}
+		spansByService[s.Service] = append(spansByService[s.Service], o)
+	}
+	var data otlpTracesData
+	for _, service := range services {
+		data.ResourceSpans = append(data.ResourceSpans, otlpResourceSpans{
+			Resource: otlpResource{
+				Attributes: toOTLPAttributes(map[string]string{"service.name": service}),
+			},
+			ScopeSpans: []otlpScopeSpans{
+				{
+					Scope: otlpScope{Name: defaultScopeName},
+					Spans: spansByService[service],
+				},
+			},
+		})
+	}
+	return json.Marshal(data)
+}
+
+// ParseOTLP decodes spans from OTLP/JSON, e.g. a file written by the file exporter
+// of an OpenTelemetry collector
+func ParseOTLP(blob []byte) (spans []*Span, err error) {
+	var data otlpTracesData
+	if err = json.Unmarshal(blob, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse OTLP traces: %s", err.Error())
+	}
+	for _, rs := range data.ResourceSpans {
+		service := fromOTLPAttributes(rs.Resource.Attributes)["service.name"]
+		for _, ss := range rs.ScopeSpans {
+			for _, o := range ss.Spans {
+				s := &Span{
+					TraceID:      strings.ToLower(o.TraceID),
+					SpanID:       strings.ToLower(o.SpanID),
+					ParentSpanID: strings.ToLower(o.ParentSpanID),
+					Name:         o.Name,
+					Service:      service,
+					Attributes:   fromOTLPAttributes(o.Attributes),
+				}
+				if s.Start, err = fromUnixNano(o.StartTimeUnixNano); err != nil {
+					return nil, err
+				}
+				if s.End, err = fromUnixNano(o.EndTimeUnixNano); err != nil {
+					return nil, err
+				}
+				if o.Status.Code == otlpStatusError {
+					s.Error = o.Status.Message
+				}
+				for _, e := range o.Events {
+					t, err := fromUnixNano(e.TimeUnixNano)
+					if err != nil {
+						return nil, err
+					}
+					s.Events = append(s.Events, SpanEvent{Name: e.Name, Time: t, Attributes: fromOTLPAttributes(e.Attributes)})
+				}
+				spans = append(spans, s)
+			}
+		}
+	}
+	return spans, nil
+}
+
+// OTLPExporter exports spans to an OpenTelemetry collector over OTLP/HTTP with JSON encoding
+type OTLPExporter struct {
+	url    string
+	client *http.Client
+}
+
+// NewOTLPExporter returns an exporter sending spans to the endpoint,
+// e.g. http://localhost:4318 of a collector
+func NewOTLPExporter(endpoint string) *OTLPExporter {
+	return &OTLPExporter{
+		url:    strings.TrimSuffix(endpoint, "/") + otlpTracesPath,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (e *OTLPExporter) Export(spans []*Span) error {
+	blob, err := EncodeOTLP(spans)
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %s", err.Error())
+	}
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(blob))
+	if err != nil {
+		return fmt.Errorf("failed to send spans to %s: %s", e.url, err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("collector at %s returned %s: %s", e.url, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
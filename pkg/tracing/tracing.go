@@ -0,0 +1,367 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	maxTracesInStore  = 1000
+	maxBufferedSpans  = 1000
+	exportBatchSize   = 100
+	exportInterval    = 5 * time.Second
+	defaultScopeName  = "github.com/waggle-sensor/edge-scheduler"
+	traceIDLengthByte = 16
+	spanIDLengthByte  = 8
+)
+
+func newID(length int) string {
+	b := make([]byte, length)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// NewTraceID returns a random 16-byte trace ID in hex
+func NewTraceID() string {
+	return newID(traceIDLengthByte)
+}
+
+// NewSpanID returns a random 8-byte span ID in hex
+func NewSpanID() string {
+	return newID(spanIDLengthByte)
+}
+
+// SpanContext identifies a span within a trace. It is carried in science goals
+// and scheduler events to continue the trace in other components
+type SpanContext struct {
+	TraceID string `json:"trace_id,omitempty"`
+	SpanID  string `json:"span_id,omitempty"`
+}
+
+// IsValid returns true if the context belongs to a trace
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != ""
+}
+
+// SpanEvent is a point in time within a span, e.g. a state transition
+type SpanEvent struct {
+	Name       string            `json:"name"`
+	Time       time.Time         `json:"time"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Span is an operation of a job, e.g. submission of the job or a run of a plugin
+type Span struct {
+	mu           sync.Mutex
+	tracer       *Tracer
+	ended        bool
+	TraceID      string            `json:"trace_id"`
+	SpanID       string            `json:"span_id"`
+	ParentSpanID string            `json:"parent_span_id,omitempty"`
+	Name         string            `json:"name"`
+	Service      string            `json:"service"`
+	Start        time.Time         `json:"start"`
+	End          time.Time         `json:"end"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	Events       []SpanEvent       `json:"events,omitempty"`
+	Error        string            `json:"error,omitempty"`
+}
+
+// Methods of Span are safe to call on a nil Span so that callers do not need
+// to check whether tracing is set up for what they trace
+
+// Context returns the context of the span to start child spans from
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return SpanContext{TraceID: s.TraceID, SpanID: s.SpanID}
+}
+
+// SetAttribute sets an attribute of the span
+func (s *Span) SetAttribute(k string, v string) *Span {
+	if s == nil {
+		return s
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Attributes[k] = v
+	return s
+}
+
+// AddEvent records an event in the span at the time
+func (s *Span) AddEvent(name string, t time.Time, attributes map[string]string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Events = append(s.Events, SpanEvent{Name: name, Time: t, Attributes: attributes})
+}
+
+// SetError marks the span failed with the message
+func (s *Span) SetError(message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Error = message
+}
+
+// Finish ends the span now
+func (s *Span) Finish() {
+	s.FinishAt(time.Now())
+}
+
+// FinishAt ends the span at the time and hands it over to the tracer.
+// Spans finish only once
+func (s *Span) FinishAt(t time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = t
+	s.mu.Unlock()
+	if s.tracer != nil {
+		s.tracer.record(s.Snapshot())
+	}
+}
+
+// Ended returns true if the span has finished
+func (s *Span) Ended() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ended
+}
+
+// Snapshot returns a copy of the span as of now
+func (s *Span) Snapshot() *Span {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := &Span{
+		TraceID:      s.TraceID,
+		SpanID:       s.SpanID,
+		ParentSpanID: s.ParentSpanID,
+		Name:         s.Name,
+		Service:      s.Service,
+		Start:        s.Start,
+		End:          s.End,
+		Attributes:   make(map[string]string, len(s.Attributes)),
+		Events:       append([]SpanEvent{}, s.Events...),
+		Error:        s.Error,
+	}
+	for k, v := range s.Attributes {
+		c.Attributes[k] = v
+	}
+	return c
+}
+
+// EncodeSpan encodes the span in JSON to carry it in an event
+func EncodeSpan(s *Span) (string, error) {
+	blob, err := json.Marshal(s.Snapshot())
+	if err != nil {
+		return "", err
+	}
+	return string(blob), nil
+}
+
+// DecodeSpan decodes the span encoded by EncodeSpan
+func DecodeSpan(blob string) (*Span, error) {
+	var s Span
+	if err := json.Unmarshal([]byte(blob), &s); err != nil {
+		return nil, fmt.Errorf("failed to decode span: %s", err.Error())
+	}
+	if s.TraceID == "" || s.SpanID == "" {
+		return nil, fmt.Errorf("span has no trace or span ID")
+	}
+	return &s, nil
+}
+
+// Exporter sends finished spans to a tracing backend
+type Exporter interface {
+	Export(spans []*Span) error
+}
+
+// Tracer creates spans of a service. Finished spans are kept in the store
+// and exported in batches if an exporter is given. A nil Tracer creates spans
+// that propagate their context but are not recorded
+type Tracer struct {
+	service  string
+	store    *Store
+	exporter Exporter
+	chanSpan chan *Span
+	flush    chan chan struct{}
+}
+
+// NewTracer returns a tracer of the service. exporter can be nil
+func NewTracer(service string, exporter Exporter) *Tracer {
+	t := &Tracer{
+		service:  service,
+		store:    NewStore(maxTracesInStore),
+		exporter: exporter,
+	}
+	if exporter != nil {
+		t.chanSpan = make(chan *Span, maxBufferedSpans)
+		t.flush = make(chan chan struct{})
+		go t.runExporter()
+	}
+	return t
+}
+
+// StartSpan starts a span as a child of parent. It starts a new trace if
+// parent does not belong to a trace
+func (t *Tracer) StartSpan(name string, parent SpanContext) *Span {
+	return t.StartSpanAt(name, parent, time.Now())
+}
+
+// StartSpanAt starts a span at the time
+func (t *Tracer) StartSpanAt(name string, parent SpanContext, start time.Time) *Span {
+	s := &Span{
+		tracer:       t,
+		TraceID:      parent.TraceID,
+		SpanID:       NewSpanID(),
+		ParentSpanID: parent.SpanID,
+		Name:         name,
+		Start:        start,
+		Attributes:   map[string]string{},
+	}
+	if !parent.IsValid() {
+		s.TraceID = NewTraceID()
+		s.ParentSpanID = ""
+	}
+	if t != nil {
+		s.Service = t.service
+	}
+	return s
+}
+
+// RecordSpan keeps a span reported by other services, e.g. a plugin run reported
+// by a node, to show it along with spans of the tracer. The span is not exported
+// as the reporting service exports it
+func (t *Tracer) RecordSpan(s *Span) {
+	if t == nil {
+		return
+	}
+	t.store.Add(s)
+}
+
+// GetTrace returns spans of the trace recorded by the tracer in the order of their start
+func (t *Tracer) GetTrace(traceID string) []*Span {
+	if t == nil {
+		return nil
+	}
+	return t.store.Get(traceID)
+}
+
+// Flush blocks until buffered spans are exported
+func (t *Tracer) Flush() {
+	if t == nil || t.exporter == nil {
+		return
+	}
+	done := make(chan struct{})
+	t.flush <- done
+	<-done
+}
+
+func (t *Tracer) record(s *Span) {
+	t.store.Add(s)
+	if t.exporter == nil {
+		return
+	}
+	select {
+	case t.chanSpan <- s:
+	default:
+		tracingLog.Warnf("span buffer is full. dropping span %q of trace %s", s.Name, s.TraceID)
+	}
+}
+
+func (t *Tracer) runExporter() {
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	var batch []*Span
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exporter.Export(batch); err != nil {
+			tracingLog.Errorf("Failed to export %d spans: %s", len(batch), err.Error())
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case s := <-t.chanSpan:
+			batch = append(batch, s)
+			if len(batch) >= exportBatchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case done := <-t.flush:
+			for len(t.chanSpan) > 0 {
+				batch = append(batch, <-t.chanSpan)
+			}
+			export()
+			close(done)
+		}
+	}
+}
+
+// Store keeps spans of recent traces
+type Store struct {
+	mu        sync.Mutex
+	maxTraces int
+	traces    map[string][]*Span
+	order     []string
+}
+
+func NewStore(maxTraces int) *Store {
+	return &Store{
+		maxTraces: maxTraces,
+		traces:    make(map[string][]*Span),
+	}
+}
+
+// Add adds the span. A span with the same span ID is replaced.
+// The oldest trace is dropped when the store is full
+func (st *Store) Add(s *Span) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for i, existing := range st.traces[s.TraceID] {
+		if existing.SpanID == s.SpanID {
+			st.traces[s.TraceID][i] = s
+			return
+		}
+	}
+	if _, exist := st.traces[s.TraceID]; !exist {
+		if len(st.order) >= st.maxTraces {
+			delete(st.traces, st.order[0])
+			st.order = st.order[1:]
+		}
+		st.order = append(st.order, s.TraceID)
+	}
+	st.traces[s.TraceID] = append(st.traces[s.TraceID], s)
+}
+
+// Get returns spans of the trace in the order of their start
+func (st *Store) Get(traceID string) []*Span {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	spans := append([]*Span{}, st.traces[traceID]...)
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].Start.Before(spans[j].Start) })
+	return spans
+}
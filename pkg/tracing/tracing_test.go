@@ -0,0 +1,147 @@
+package tracing
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStartSpan(t *testing.T) {
+	tracer := NewTracer("cloudscheduler", nil)
+	root := tracer.StartSpan("job.submit", SpanContext{})
+	if len(root.TraceID) != 32 || len(root.SpanID) != 16 {
+		t.Errorf("expected a 32-character trace ID and a 16-character span ID, but got %q and %q", root.TraceID, root.SpanID)
+	}
+	if root.ParentSpanID != "" {
+		t.Errorf("expected the root span not to have a parent, but got %q", root.ParentSpanID)
+	}
+	child := tracer.StartSpan("goal.push", root.Context())
+	if child.TraceID != root.TraceID || child.ParentSpanID != root.SpanID {
+		t.Errorf("expected the child span in trace %s under %s, but got %s under %s", root.TraceID, root.SpanID, child.TraceID, child.ParentSpanID)
+	}
+	child.Finish()
+	root.Finish()
+	root.Finish()
+	if spans := tracer.GetTrace(root.TraceID); len(spans) != 2 {
+		t.Errorf("expected 2 spans in the trace, but got %d", len(spans))
+	}
+
+	// a nil tracer still propagates the context
+	var noop *Tracer
+	s := noop.StartSpan("plugin.run", root.Context())
+	s.Finish()
+	if s.TraceID != root.TraceID || len(noop.GetTrace(root.TraceID)) != 0 {
+		t.Errorf("expected a nil tracer to propagate the trace without recording it")
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []*Span
+		path     string
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		blob, _ := io.ReadAll(r.Body)
+		spans, err := ParseOTLP(blob)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		path = r.URL.Path
+		received = append(received, spans...)
+	}))
+	defer collector.Close()
+
+	tracer := NewTracer("nodescheduler", NewOTLPExporter(collector.URL))
+	start := time.Unix(1700000000, 0)
+	parent := SpanContext{TraceID: NewTraceID(), SpanID: NewSpanID()}
+	s := tracer.StartSpanAt("plugin.run", parent, start)
+	s.SetAttribute("plugin", "imagesampler-top")
+	s.AddEvent("Running", start.Add(2*time.Second), nil)
+	s.SetError("OOMKilled")
+	s.FinishAt(start.Add(10 * time.Second))
+	tracer.Flush()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if path != "/v1/traces" {
+		t.Errorf("expected spans sent to /v1/traces, but got %q", path)
+	}
+	if len(received) != 1 {
+		t.Fatalf("expected 1 span received, but got %d", len(received))
+	}
+	got := received[0]
+	if got.TraceID != parent.TraceID || got.ParentSpanID != parent.SpanID || got.SpanID != s.SpanID {
+		t.Errorf("expected IDs %s/%s/%s, but got %s/%s/%s", parent.TraceID, parent.SpanID, s.SpanID, got.TraceID, got.ParentSpanID, got.SpanID)
+	}
+	if got.Service != "nodescheduler" || got.Attributes["plugin"] != "imagesampler-top" || got.Error != "OOMKilled" {
+		t.Errorf("unexpected span received: %+v", got)
+	}
+	if !got.Start.Equal(start) || got.End.Sub(got.Start) != 10*time.Second {
+		t.Errorf("expected the span to last 10s from %s, but got %s to %s", start, got.Start, got.End)
+	}
+	if len(got.Events) != 1 || got.Events[0].Name != "Running" {
+		t.Errorf("expected the Running event, but got %+v", got.Events)
+	}
+}
+
+func TestWriteTraceView(t *testing.T) {
+	tracer := NewTracer("cloudscheduler", nil)
+	start := time.Unix(1700000000, 0)
+	submit := tracer.StartSpanAt("job.submit", SpanContext{}, start)
+	submit.SetAttribute("job_id", "1")
+	push := tracer.StartSpanAt("goal.push", submit.Context(), start.Add(time.Second))
+	push.FinishAt(start.Add(1500 * time.Millisecond))
+	submit.FinishAt(start.Add(2 * time.Second))
+
+	var b bytes.Buffer
+	WriteTraceView(&b, tracer.GetTrace(submit.TraceID))
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, but got %q", b.String())
+	}
+	if !strings.HasPrefix(lines[1], "+0s") || !strings.Contains(lines[1], "job.submit job_id=1") {
+		t.Errorf("unexpected root line %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "+1s") || !strings.Contains(lines[2], "500ms") || !strings.Contains(lines[2], "  goal.push") {
+		t.Errorf("unexpected child line %q", lines[2])
+	}
+}
+
+func TestRecordSpan(t *testing.T) {
+	node := NewTracer("nodescheduler", nil)
+	s := node.StartSpan("plugin.run", SpanContext{})
+	s.SetAttribute("plugin", "a")
+	s.Finish()
+	blob, err := EncodeSpan(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cloud := NewTracer("cloudscheduler", nil)
+	// nodes may report the same span more than once
+	for i := 0; i < 2; i++ {
+		reported, err := DecodeSpan(blob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cloud.RecordSpan(reported)
+	}
+	spans := cloud.GetTrace(s.TraceID)
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span recorded, but got %d", len(spans))
+	}
+	if spans[0].Service != "nodescheduler" || spans[0].Attributes["plugin"] != "a" {
+		t.Errorf("unexpected span recorded: %+v", spans[0])
+	}
+	if _, err := DecodeSpan(`{"name":"plugin.run"}`); err == nil {
+		t.Errorf("expected an error for a span without IDs")
+	}
+}
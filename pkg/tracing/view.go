@@ -0,0 +1,79 @@
+package tracing
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WriteTraceView writes spans as a tree with the offset from the start of the trace
+// and the duration of each span, e.g.
+//
+//	+0s       120ms  cloudscheduler  job.submit job_id=1
+//	+120ms    5ms    cloudscheduler    goal.push node=W023
+//
+// Spans whose parent is not found are shown as roots
+func WriteTraceView(w io.Writer, spans []*Span) {
+	if len(spans) == 0 {
+		fmt.Fprintln(w, "no spans found")
+		return
+	}
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].Start.Before(spans[j].Start) })
+	traceStart := spans[0].Start
+	exist := make(map[string]bool, len(spans))
+	children := make(map[string][]*Span)
+	for _, s := range spans {
+		exist[s.SpanID] = true
+	}
+	var roots []*Span
+	for _, s := range spans {
+		if s.ParentSpanID != "" && exist[s.ParentSpanID] {
+			children[s.ParentSpanID] = append(children[s.ParentSpanID], s)
+		} else {
+			roots = append(roots, s)
+		}
+	}
+	fmt.Fprintf(w, "trace %s\n", spans[0].TraceID)
+	var write func(s *Span, depth int)
+	write = func(s *Span, depth int) {
+		duration := "running"
+		if !s.End.IsZero() {
+			duration = s.End.Sub(s.Start).Round(time.Millisecond).String()
+		}
+		var attributes []string
+		keys := make([]string, 0, len(s.Attributes))
+		for k := range s.Attributes {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			attributes = append(attributes, fmt.Sprintf("%s=%s", k, s.Attributes[k]))
+		}
+		if s.Error != "" {
+			attributes = append(attributes, fmt.Sprintf("error=%q", s.Error))
+		}
+		fmt.Fprintf(w, "+%-10s %-10s %-15s %s%s %s\n",
+			s.Start.Sub(traceStart).Round(time.Millisecond),
+			duration,
+			s.Service,
+			strings.Repeat("  ", depth),
+			s.Name,
+			strings.Join(attributes, " "))
+		for _, e := range s.Events {
+			fmt.Fprintf(w, "+%-10s %-10s %-15s %s- %s\n",
+				e.Time.Sub(traceStart).Round(time.Millisecond),
+				"",
+				"",
+				strings.Repeat("  ", depth+1),
+				e.Name)
+		}
+		for _, c := range children[s.SpanID] {
+			write(c, depth+1)
+		}
+	}
+	for _, r := range roots {
+		write(r, 0)
+	}
+}